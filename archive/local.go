@@ -0,0 +1,77 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStorage stores objects as files under a directory.
+type LocalStorage struct {
+	dir string
+}
+
+var _ Storage = &LocalStorage{}
+
+// NewLocalStorage creates a LocalStorage.  The directory is created if it does not exist.
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory %s: %w", dir, err)
+	}
+	return &LocalStorage{dir: dir}, nil
+}
+
+// Put implements Storage.
+func (s *LocalStorage) Put(ctx context.Context, name string, body io.ReadSeeker) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that readers never see partial objects.
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Get implements Storage.
+func (s *LocalStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return f, err
+}
+
+func (s *LocalStorage) path(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid object name: %s", name)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)), nil
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ManifestName is the object name of the manifest.
+const ManifestName = "manifest.json"
+
+// Compression algorithms of archived objects.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+)
+
+// Entry records an archived binary log file.
+type Entry struct {
+	// Name is the name of the binary log file.
+	Name string `json:"name"`
+
+	// Object is the object name in the storage.
+	Object string `json:"object"`
+
+	// Size and SHA256 are the size and the checksum of the binary log file.
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// ObjectSHA256 is the checksum of the stored object.
+	ObjectSHA256 string `json:"object_sha256"`
+
+	// Compression is the compression algorithm of the object.
+	Compression string `json:"compression,omitempty"`
+
+	// Encrypted is true if the binary log file is encrypted.
+	// GTID sets and event timestamps are not recorded for encrypted files.
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// PreviousGTIDSet is the GTID set executed before the file.
+	PreviousGTIDSet string `json:"previous_gtid_set"`
+
+	// GTIDSet is the GTID set of transactions in the file.
+	GTIDSet string `json:"gtid_set"`
+
+	FirstEventTime time.Time `json:"first_event_time"`
+	LastEventTime  time.Time `json:"last_event_time"`
+	ArchivedAt     time.Time `json:"archived_at"`
+}
+
+// Manifest is the list of archived binary log files.
+type Manifest struct {
+	Binlogs []Entry `json:"binlogs"`
+}
+
+// LoadManifest reads the manifest from the storage.
+// It returns an empty manifest if the storage has no manifest yet.
+func LoadManifest(ctx context.Context, s Storage) (*Manifest, error) {
+	r, err := s.Get(ctx, ManifestName)
+	if errors.Is(err, ErrNotFound) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	m := &Manifest{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Save writes the manifest to the storage.
+func (m *Manifest) Save(ctx context.Context, s Storage) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, ManifestName, bytes.NewReader(data))
+}
+
+// Find returns the entry for the binary log file `name`, or nil.
+func (m *Manifest) Find(name string) *Entry {
+	for i := range m.Binlogs {
+		if m.Binlogs[i].Name == name {
+			return &m.Binlogs[i]
+		}
+	}
+	return nil
+}
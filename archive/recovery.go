@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/binlog"
+)
+
+// ErrNotCovered is returned when the archive does not have binary logs needed for recovery.
+var ErrNotCovered = errors.New("archived binary logs do not cover the recovery")
+
+// RecoveryTarget is the point to which archived binary logs are replayed.
+// Either Time or GTIDSet must be set.
+type RecoveryTarget struct {
+	// Time is the time of the last transaction to be applied.
+	Time time.Time
+
+	// GTIDSet is the GTID set to be executed.
+	GTIDSet binlog.GTIDSet
+}
+
+// Plan returns the archived binary logs to be replayed to roll forward
+// an instance that has executed `executed` to `target`.
+//
+// For a time target, the last returned file may contain transactions after the target.
+// Callers should scan it to find where to stop.
+func (m *Manifest) Plan(executed binlog.GTIDSet, target RecoveryTarget) ([]Entry, error) {
+	start := -1
+	for i, e := range m.Binlogs {
+		if e.Encrypted {
+			continue
+		}
+		gtids, err := binlog.ParseGTIDSet(e.GTIDSet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GTID set of %s: %w", e.Name, err)
+		}
+		if !gtids.IsSubset(executed) {
+			start = i
+			break
+		}
+	}
+
+	if start < 0 {
+		if target.GTIDSet != nil && !target.GTIDSet.IsSubset(executed) {
+			return nil, fmt.Errorf("%w: target GTID set %s is not in the archive", ErrNotCovered, target.GTIDSet)
+		}
+		return nil, nil
+	}
+
+	covered := executed.Clone()
+	var entries []Entry
+	for i := start; i < len(m.Binlogs); i++ {
+		e := m.Binlogs[i]
+		if target.GTIDSet != nil {
+			if target.GTIDSet.IsSubset(covered) {
+				break
+			}
+		} else if e.FirstEventTime.After(target.Time) {
+			break
+		}
+
+		if e.Encrypted {
+			return nil, fmt.Errorf("%w: %s is encrypted", ErrNotCovered, e.Name)
+		}
+		prev, err := binlog.ParseGTIDSet(e.PreviousGTIDSet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous GTID set of %s: %w", e.Name, err)
+		}
+		if !prev.IsSubset(covered) {
+			return nil, fmt.Errorf("%w: transactions before %s are missing", ErrNotCovered, e.Name)
+		}
+		gtids, err := binlog.ParseGTIDSet(e.GTIDSet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GTID set of %s: %w", e.Name, err)
+		}
+		covered.Union(gtids)
+		entries = append(entries, e)
+	}
+
+	if target.GTIDSet != nil && !target.GTIDSet.IsSubset(covered) {
+		return nil, fmt.Errorf("%w: target GTID set %s is not in the archive", ErrNotCovered, target.GTIDSet)
+	}
+	return entries, nil
+}
@@ -0,0 +1,100 @@
+package archive_test
+
+import (
+	"time"
+
+	"github.com/cybozu-go/moco-agent/archive"
+	"github.com/cybozu-go/moco-agent/binlog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const testUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func mustParseGTIDSet(s string) binlog.GTIDSet {
+	set, err := binlog.ParseGTIDSet(s)
+	Expect(err).NotTo(HaveOccurred())
+	return set
+}
+
+func testManifest() *archive.Manifest {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &archive.Manifest{Binlogs: []archive.Entry{
+		{
+			Name:            "binlog.000001",
+			GTIDSet:         testUUID + ":1-10",
+			FirstEventTime:  base,
+			LastEventTime:   base.Add(time.Hour),
+			PreviousGTIDSet: "",
+		},
+		{
+			Name:            "binlog.000002",
+			PreviousGTIDSet: testUUID + ":1-10",
+			GTIDSet:         testUUID + ":11-20",
+			FirstEventTime:  base.Add(time.Hour),
+			LastEventTime:   base.Add(2 * time.Hour),
+		},
+		{
+			Name:            "binlog.000003",
+			PreviousGTIDSet: testUUID + ":1-20",
+			GTIDSet:         testUUID + ":21-30",
+			FirstEventTime:  base.Add(2 * time.Hour),
+			LastEventTime:   base.Add(3 * time.Hour),
+		},
+	}}
+}
+
+func names(entries []archive.Entry) []string {
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, e.Name)
+	}
+	return ret
+}
+
+var _ = Describe("Manifest.Plan", func() {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	It("should select binary logs up to a GTID set", func() {
+		m := testManifest()
+
+		entries, err := m.Plan(mustParseGTIDSet(testUUID+":1-5"), archive.RecoveryTarget{GTIDSet: mustParseGTIDSet(testUUID + ":1-15")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(entries)).To(Equal([]string{"binlog.000001", "binlog.000002"}))
+
+		entries, err = m.Plan(mustParseGTIDSet(testUUID+":1-12"), archive.RecoveryTarget{GTIDSet: mustParseGTIDSet(testUUID + ":1-30")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(entries)).To(Equal([]string{"binlog.000002", "binlog.000003"}))
+
+		entries, err = m.Plan(mustParseGTIDSet(testUUID+":1-30"), archive.RecoveryTarget{GTIDSet: mustParseGTIDSet(testUUID + ":1-30")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+
+		_, err = m.Plan(mustParseGTIDSet(testUUID+":1-12"), archive.RecoveryTarget{GTIDSet: mustParseGTIDSet(testUUID + ":1-31")})
+		Expect(err).To(MatchError(archive.ErrNotCovered))
+	})
+
+	It("should select binary logs up to a time", func() {
+		m := testManifest()
+
+		entries, err := m.Plan(mustParseGTIDSet(testUUID+":1-12"), archive.RecoveryTarget{Time: base.Add(90 * time.Minute)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(entries)).To(Equal([]string{"binlog.000002"}))
+
+		entries, err = m.Plan(mustParseGTIDSet(testUUID+":1-12"), archive.RecoveryTarget{Time: base.Add(5 * time.Hour)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(entries)).To(Equal([]string{"binlog.000002", "binlog.000003"}))
+	})
+
+	It("should detect missing binary logs", func() {
+		m := testManifest()
+		m.Binlogs = m.Binlogs[1:]
+
+		_, err := m.Plan(mustParseGTIDSet(""), archive.RecoveryTarget{Time: base.Add(5 * time.Hour)})
+		Expect(err).To(MatchError(archive.ErrNotCovered))
+
+		m.Binlogs[0].Encrypted = true
+		_, err = m.Plan(mustParseGTIDSet(testUUID+":1-10"), archive.RecoveryTarget{Time: base.Add(5 * time.Hour)})
+		Expect(err).To(MatchError(archive.ErrNotCovered))
+	})
+})
@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3Config is the configuration of S3Storage.
+type S3Config struct {
+	// Endpoint is the base URL of the S3-compatible service such as http://minio:9000.
+	Endpoint        string
+	Bucket          string
+	Prefix          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Client is used to send requests.  http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// S3Storage stores objects in an S3-compatible object storage.
+// Objects are addressed in the path-style, i.e. `<endpoint>/<bucket>/<prefix>/<name>`.
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+}
+
+var _ Storage = &S3Storage{}
+
+// NewS3Storage creates an S3Storage.
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %s: %w", config.Endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid S3 endpoint %s", config.Endpoint)
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("no S3 credentials are given")
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &S3Storage{config: config, endpoint: u}, nil
+}
+
+// Put implements Storage.
+func (s *S3Storage) Put(ctx context.Context, name string, body io.ReadSeeker) error {
+	h := sha256.New()
+	size, err := io.Copy(h, body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, name, io.NopCloser(body), hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to put %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to put %s: %s", name, responseError(resp))
+	}
+	return nil
+}
+
+// Get implements Storage.
+func (s *S3Storage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, name, nil, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", name, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	defer resp.Body.Close()
+	return nil, fmt.Errorf("failed to get %s: %s", name, responseError(resp))
+}
+
+func responseError(resp *http.Response) string {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+var emptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+func (s *S3Storage) newRequest(ctx context.Context, method, name string, body io.ReadCloser, payloadHash string) (*http.Request, error) {
+	key := path.Join(s.config.Prefix, name)
+	u := *s.endpoint
+	u.Path = path.Join("/", u.Path, s.config.Bucket, key)
+	u.RawPath = escapePath(u.Path)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+	return req, nil
+}
+
+// sign signs the request with AWS Signature Version 4.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.config.Region, "s3", "aws4_request"}, "/")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(crHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath encodes the path as described in the SigV4 specification.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
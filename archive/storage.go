@@ -0,0 +1,80 @@
+// Package archive provides storages to archive binary log files.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned when the object does not exist in the storage.
+var ErrNotFound = errors.New("object not found")
+
+// Storage is the interface of archive storages.
+type Storage interface {
+	// Put stores the contents of body as the object `name`.
+	Put(ctx context.Context, name string, body io.ReadSeeker) error
+
+	// Get returns the contents of the object `name`.
+	// The caller must close the returned reader.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// ENV keys for S3-compatible storages
+const (
+	AccessKeyIDEnvKey     = "AWS_ACCESS_KEY_ID"
+	SecretAccessKeyEnvKey = "AWS_SECRET_ACCESS_KEY"
+	RegionEnvKey          = "AWS_REGION"
+)
+
+const defaultRegion = "us-east-1"
+
+// NewStorage creates a Storage from a URL.
+//
+// The following URLs are supported.
+//
+//   - file:///path/to/dir
+//   - s3://bucket/prefix?endpoint=http://minio:9000
+//
+// For s3 URLs, the credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+// environment variables.  The region is read from AWS_REGION and defaults to us-east-1.
+// Without `endpoint`, the AWS S3 endpoint for the region is used.
+func NewStorage(rawURL string) (Storage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive URL %s: %w", rawURL, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("no path in archive URL %s", rawURL)
+		}
+		return NewLocalStorage(u.Path)
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("no bucket in archive URL %s", rawURL)
+		}
+		region := os.Getenv(RegionEnvKey)
+		if region == "" {
+			region = defaultRegion
+		}
+		endpoint := u.Query().Get("endpoint")
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+		}
+		return NewS3Storage(S3Config{
+			Endpoint:        endpoint,
+			Bucket:          u.Host,
+			Prefix:          strings.Trim(u.Path, "/"),
+			Region:          region,
+			AccessKeyID:     os.Getenv(AccessKeyIDEnvKey),
+			SecretAccessKey: os.Getenv(SecretAccessKeyEnvKey),
+		})
+	}
+	return nil, fmt.Errorf("unsupported archive URL scheme: %s", u.Scheme)
+}
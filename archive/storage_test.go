@@ -0,0 +1,130 @@
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/cybozu-go/moco-agent/archive"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeS3 is a minimal stand-in of S3-compatible object storages.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=testkey/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256(data)
+		if r.Header.Get("x-amz-content-sha256") != hex.EncodeToString(sum[:]) {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func testStorage(s archive.Storage) {
+	ctx := context.Background()
+
+	_, err := s.Get(ctx, "binlog.000001")
+	Expect(err).To(MatchError(archive.ErrNotFound))
+
+	err = s.Put(ctx, "binlog.000001", bytes.NewReader([]byte("foo")))
+	Expect(err).NotTo(HaveOccurred())
+	err = s.Put(ctx, "binlog.000002.gz", bytes.NewReader([]byte("bar")))
+	Expect(err).NotTo(HaveOccurred())
+
+	r, err := s.Get(ctx, "binlog.000001")
+	Expect(err).NotTo(HaveOccurred())
+	data, err := io.ReadAll(r)
+	r.Close()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(data)).To(Equal("foo"))
+
+	By("saving and loading the manifest")
+	m, err := archive.LoadManifest(ctx, s)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(m.Binlogs).To(BeEmpty())
+
+	m.Binlogs = append(m.Binlogs, archive.Entry{Name: "binlog.000001", Object: "binlog.000001", Size: 3})
+	Expect(m.Save(ctx, s)).To(Succeed())
+
+	m, err = archive.LoadManifest(ctx, s)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(m.Find("binlog.000001")).NotTo(BeNil())
+	Expect(m.Find("binlog.000001").Size).To(BeNumerically("==", 3))
+	Expect(m.Find("binlog.000002")).To(BeNil())
+}
+
+var _ = Describe("LocalStorage", func() {
+	It("should store objects", func() {
+		dir := GinkgoT().TempDir()
+		s, err := archive.NewStorage("file://" + dir)
+		Expect(err).NotTo(HaveOccurred())
+		testStorage(s)
+
+		err = s.Put(context.Background(), "../escape", bytes.NewReader(nil))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("S3Storage", func() {
+	It("should store objects", func() {
+		fake := &fakeS3{objects: make(map[string][]byte)}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		GinkgoT().Setenv(archive.AccessKeyIDEnvKey, "testkey")
+		GinkgoT().Setenv(archive.SecretAccessKeyEnvKey, "testsecret")
+		s, err := archive.NewStorage("s3://moco/cluster/instance-0?endpoint=" + server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		testStorage(s)
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		Expect(fake.objects).To(HaveKey("/moco/cluster/instance-0/binlog.000001"))
+		Expect(fake.objects).To(HaveKey("/moco/cluster/instance-0/" + archive.ManifestName))
+	})
+
+	It("should reject invalid configurations", func() {
+		GinkgoT().Setenv(archive.AccessKeyIDEnvKey, "")
+		_, err := archive.NewStorage("s3://moco/prefix?endpoint=http://localhost:9000")
+		Expect(err).To(HaveOccurred())
+
+		_, err = archive.NewStorage("ftp://example.com/")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,159 @@
+package binlog
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Interval is a range of GTID transaction numbers.  Both ends are inclusive.
+type Interval struct {
+	Start int64
+	End   int64
+}
+
+// GTIDSet is a set of GTIDs keyed by the source UUID.
+type GTIDSet map[string][]Interval
+
+// ParseGTIDSet parses the textual representation of a GTID set such as
+// "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11,...".
+func ParseGTIDSet(s string) (GTIDSet, error) {
+	set := make(GTIDSet)
+	s = strings.Join(strings.Fields(s), "")
+	if s == "" {
+		return set, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid GTID set: %s", part)
+		}
+		uuid := strings.ToLower(fields[0])
+		for _, r := range fields[1:] {
+			start, end, found := strings.Cut(r, "-")
+			first, err := strconv.ParseInt(start, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid GTID interval %s: %w", r, err)
+			}
+			last := first
+			if found {
+				last, err = strconv.ParseInt(end, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid GTID interval %s: %w", r, err)
+				}
+			}
+			if first <= 0 || last < first {
+				return nil, fmt.Errorf("invalid GTID interval %s", r)
+			}
+			set.AddInterval(uuid, Interval{Start: first, End: last})
+		}
+	}
+	return set, nil
+}
+
+// Add adds a GTID to the set.
+func (s GTIDSet) Add(uuid string, gno int64) {
+	s.AddInterval(uuid, Interval{Start: gno, End: gno})
+}
+
+// AddInterval adds a range of GTIDs to the set.
+func (s GTIDSet) AddInterval(uuid string, iv Interval) {
+	uuid = strings.ToLower(uuid)
+	ivs := append(s[uuid], iv)
+	sort.Slice(ivs, func(i, j int) bool { return ivs[i].Start < ivs[j].Start })
+
+	merged := ivs[:1]
+	for _, v := range ivs[1:] {
+		last := &merged[len(merged)-1]
+		if v.Start <= last.End+1 {
+			last.End = max(last.End, v.End)
+			continue
+		}
+		merged = append(merged, v)
+	}
+	s[uuid] = merged
+}
+
+// Union adds all GTIDs in other to the set.
+func (s GTIDSet) Union(other GTIDSet) {
+	for uuid, ivs := range other {
+		for _, iv := range ivs {
+			s.AddInterval(uuid, iv)
+		}
+	}
+}
+
+// Contains returns true if the set contains the GTID.
+func (s GTIDSet) Contains(uuid string, gno int64) bool {
+	for _, iv := range s[strings.ToLower(uuid)] {
+		if iv.Start <= gno && gno <= iv.End {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSubset returns true if all GTIDs in the set are contained in other.
+func (s GTIDSet) IsSubset(other GTIDSet) bool {
+	for uuid, ivs := range s {
+		for _, iv := range ivs {
+			if !slices.ContainsFunc(other[uuid], func(o Interval) bool {
+				return o.Start <= iv.Start && iv.End <= o.End
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of the set.
+func (s GTIDSet) Clone() GTIDSet {
+	c := make(GTIDSet, len(s))
+	for uuid, ivs := range s {
+		c[uuid] = slices.Clone(ivs)
+	}
+	return c
+}
+
+// IsEmpty returns true if the set has no GTID.
+func (s GTIDSet) IsEmpty() bool {
+	for _, ivs := range s {
+		if len(ivs) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the textual representation of the set in the same format as MySQL.
+func (s GTIDSet) String() string {
+	uuids := make([]string, 0, len(s))
+	for uuid, ivs := range s {
+		if len(ivs) > 0 {
+			uuids = append(uuids, uuid)
+		}
+	}
+	slices.Sort(uuids)
+
+	parts := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		var b strings.Builder
+		b.WriteString(uuid)
+		for _, iv := range s[uuid] {
+			if iv.Start == iv.End {
+				fmt.Fprintf(&b, ":%d", iv.Start)
+			} else {
+				fmt.Fprintf(&b, ":%d-%d", iv.Start, iv.End)
+			}
+		}
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,56 @@
+package binlog
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GTIDSet", func() {
+	It("should parse and format GTID sets", func() {
+		set, err := ParseGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11,\n" +
+			"0c1a2b3c-0000-0000-0000-000000000001:7")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(set.String()).To(Equal("0c1a2b3c-0000-0000-0000-000000000001:7,3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:11"))
+
+		empty, err := ParseGTIDSet("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(empty.IsEmpty()).To(BeTrue())
+		Expect(empty.String()).To(BeEmpty())
+
+		_, err = ParseGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:5-1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should merge adjacent intervals", func() {
+		set := make(GTIDSet)
+		uuid := "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+		set.Add(uuid, 3)
+		set.Add(uuid, 1)
+		set.Add(uuid, 2)
+		set.Add(uuid, 10)
+		Expect(set.String()).To(Equal(uuid + ":1-3:10"))
+		Expect(set.Contains(uuid, 2)).To(BeTrue())
+		Expect(set.Contains(uuid, 4)).To(BeFalse())
+
+		other := GTIDSet{uuid: {{Start: 4, End: 9}}}
+		set.Union(other)
+		Expect(set.String()).To(Equal(uuid + ":1-10"))
+	})
+	It("should compare GTID sets", func() {
+		a, err := ParseGTIDSet(testUUID + ":1-10,0c1a2b3c-0000-0000-0000-000000000001:1-3")
+		Expect(err).NotTo(HaveOccurred())
+		b, err := ParseGTIDSet(testUUID + ":2-5:7")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(b.IsSubset(a)).To(BeTrue())
+		Expect(a.IsSubset(b)).To(BeFalse())
+		Expect(GTIDSet{}.IsSubset(b)).To(BeTrue())
+
+		c := b.Clone()
+		c.Add(testUUID, 20)
+		Expect(c.IsSubset(a)).To(BeFalse())
+		Expect(b.String()).To(Equal(testUUID + ":2-5:7"))
+	})
+})
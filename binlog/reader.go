@@ -0,0 +1,232 @@
+// Package binlog implements a reader of MySQL binary log files.
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Magic is the header of binary log files.
+const Magic = "\xfebin"
+
+// HeaderSize is the size of the common event header in binary log format v4.
+const HeaderSize = 19
+
+const checksumSize = 4
+
+// EventType is the type code of binary log events.
+type EventType byte
+
+// Event types.  Only the ones this package handles are defined.
+const (
+	QueryEvent             EventType = 2
+	StopEvent              EventType = 3
+	RotateEvent            EventType = 4
+	FormatDescriptionEvent EventType = 15
+	XIDEvent               EventType = 16
+	TableMapEvent          EventType = 19
+	WriteRowsEventV2       EventType = 30
+	UpdateRowsEventV2      EventType = 31
+	DeleteRowsEventV2      EventType = 32
+	GTIDEvent              EventType = 33
+	AnonymousGTIDEvent     EventType = 34
+	PreviousGTIDsEvent     EventType = 35
+)
+
+// Checksum algorithms recorded in the format description event.
+const (
+	checksumOff   = 0
+	checksumCRC32 = 1
+)
+
+// ErrChecksumMismatch is returned when the CRC32 checksum of an event is wrong.
+var ErrChecksumMismatch = errors.New("binlog event checksum mismatch")
+
+// EventHeader is the common header of binary log events.
+type EventHeader struct {
+	Timestamp uint32
+	Type      EventType
+	ServerID  uint32
+	EventSize uint32
+	LogPos    uint32
+	Flags     uint16
+}
+
+// Time returns the timestamp of the event.
+func (h EventHeader) Time() time.Time {
+	return time.Unix(int64(h.Timestamp), 0).UTC()
+}
+
+// Event is a binary log event.
+type Event struct {
+	Header EventHeader
+
+	// Pos is the offset of the event in the file.
+	Pos int64
+
+	// Raw is the whole event including the header and the checksum.
+	Raw []byte
+
+	// Data is the event body without the header and the checksum.
+	Data []byte
+}
+
+// Reader reads events from a binary log file.
+type Reader struct {
+	r        *bufio.Reader
+	pos      int64
+	checksum bool
+}
+
+// NewReader creates a Reader.  It reads and verifies the magic header of r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("failed to read binlog magic: %w", err)
+	}
+	if string(magic) != Magic {
+		return nil, errors.New("not a binary log file")
+	}
+	return &Reader{r: br, pos: int64(len(Magic))}, nil
+}
+
+// Pos returns the offset of the next event.
+func (r *Reader) Pos() int64 {
+	return r.pos
+}
+
+// Next reads the next event.  It returns io.EOF at the end of the file.
+func (r *Reader) Next() (*Event, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated event header at %d: %w", r.pos, err)
+		}
+		return nil, err
+	}
+
+	h := EventHeader{
+		Timestamp: binary.LittleEndian.Uint32(header[0:]),
+		Type:      EventType(header[4]),
+		ServerID:  binary.LittleEndian.Uint32(header[5:]),
+		EventSize: binary.LittleEndian.Uint32(header[9:]),
+		LogPos:    binary.LittleEndian.Uint32(header[13:]),
+		Flags:     binary.LittleEndian.Uint16(header[17:]),
+	}
+	if h.EventSize < HeaderSize {
+		return nil, fmt.Errorf("invalid event size %d at %d", h.EventSize, r.pos)
+	}
+
+	raw := make([]byte, h.EventSize)
+	copy(raw, header)
+	if _, err := io.ReadFull(r.r, raw[HeaderSize:]); err != nil {
+		return nil, fmt.Errorf("truncated event at %d: %w", r.pos, err)
+	}
+
+	ev := &Event{Header: h, Pos: r.pos, Raw: raw}
+	r.pos += int64(h.EventSize)
+
+	if h.Type == FormatDescriptionEvent {
+		// The checksum algorithm is stored just before the checksum of the event.
+		if len(raw) < HeaderSize+checksumSize+1 {
+			return nil, fmt.Errorf("too short format description event at %d", ev.Pos)
+		}
+		r.checksum = raw[len(raw)-checksumSize-1] == checksumCRC32
+	}
+
+	body := raw[HeaderSize:]
+	if r.checksum || h.Type == FormatDescriptionEvent {
+		body = raw[HeaderSize : len(raw)-checksumSize]
+		if r.checksum {
+			expected := binary.LittleEndian.Uint32(raw[len(raw)-checksumSize:])
+			if crc32.ChecksumIEEE(raw[:len(raw)-checksumSize]) != expected {
+				return nil, fmt.Errorf("%w at %d", ErrChecksumMismatch, ev.Pos)
+			}
+		}
+	}
+	ev.Data = body
+	return ev, nil
+}
+
+// DecodeGTID decodes the GTID of a GTID event.
+func DecodeGTID(ev *Event) (uuid string, gno int64, err error) {
+	if ev.Header.Type != GTIDEvent {
+		return "", 0, fmt.Errorf("not a GTID event: %d", ev.Header.Type)
+	}
+	if len(ev.Data) < 25 {
+		return "", 0, errors.New("too short GTID event")
+	}
+	return formatUUID(ev.Data[1:17]), int64(binary.LittleEndian.Uint64(ev.Data[17:25])), nil
+}
+
+// DecodePreviousGTIDs decodes the GTID set of a Previous_gtids event.
+func DecodePreviousGTIDs(ev *Event) (GTIDSet, error) {
+	if ev.Header.Type != PreviousGTIDsEvent {
+		return nil, fmt.Errorf("not a Previous_gtids event: %d", ev.Header.Type)
+	}
+	data := ev.Data
+	if len(data) < 8 {
+		return nil, errors.New("too short Previous_gtids event")
+	}
+	set := make(GTIDSet)
+	nSIDs := binary.LittleEndian.Uint64(data)
+	data = data[8:]
+	for i := uint64(0); i < nSIDs; i++ {
+		if len(data) < 24 {
+			return nil, errors.New("truncated Previous_gtids event")
+		}
+		uuid := formatUUID(data[:16])
+		nIntervals := binary.LittleEndian.Uint64(data[16:])
+		data = data[24:]
+		for j := uint64(0); j < nIntervals; j++ {
+			if len(data) < 16 {
+				return nil, errors.New("truncated Previous_gtids event")
+			}
+			start := int64(binary.LittleEndian.Uint64(data))
+			end := int64(binary.LittleEndian.Uint64(data[8:]))
+			data = data[16:]
+			// The end of intervals is exclusive in the binary format.
+			set.AddInterval(uuid, Interval{Start: start, End: end - 1})
+		}
+	}
+	return set, nil
+}
+
+// DecodeRotate decodes the next file name and position of a Rotate event.
+func DecodeRotate(ev *Event) (file string, pos int64, err error) {
+	if ev.Header.Type != RotateEvent {
+		return "", 0, fmt.Errorf("not a Rotate event: %d", ev.Header.Type)
+	}
+	if len(ev.Data) < 8 {
+		return "", 0, errors.New("too short Rotate event")
+	}
+	return string(ev.Data[8:]), int64(binary.LittleEndian.Uint64(ev.Data)), nil
+}
+
+// DecodeQuery decodes the default schema and the statement of a Query event.
+func DecodeQuery(ev *Event) (schema, query string, err error) {
+	if ev.Header.Type != QueryEvent {
+		return "", "", fmt.Errorf("not a Query event: %d", ev.Header.Type)
+	}
+	// The post header is the thread ID, the execution time, the length of the schema name,
+	// the error code, and the length of the status variables.
+	const postHeaderSize = 13
+	data := ev.Data
+	if len(data) < postHeaderSize {
+		return "", "", errors.New("too short Query event")
+	}
+	schemaLen := int(data[8])
+	statusLen := int(binary.LittleEndian.Uint16(data[11:]))
+	data = data[postHeaderSize:]
+	if len(data) < statusLen+schemaLen+1 {
+		return "", "", errors.New("truncated Query event")
+	}
+	data = data[statusLen:]
+	return string(data[:schemaLen]), string(data[schemaLen+1:]), nil
+}
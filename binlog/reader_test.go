@@ -0,0 +1,227 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const testUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+// testBinlog builds a binary log file for testing.
+type testBinlog struct {
+	buf      bytes.Buffer
+	checksum bool
+}
+
+func newTestBinlog(checksum bool) *testBinlog {
+	b := &testBinlog{checksum: checksum}
+	b.buf.WriteString(Magic)
+	return b
+}
+
+func (b *testBinlog) event(ts uint32, typ EventType, data []byte) {
+	size := HeaderSize + len(data)
+	if b.checksum || typ == FormatDescriptionEvent {
+		size += checksumSize
+	}
+	header := make([]byte, HeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], ts)
+	header[4] = byte(typ)
+	binary.LittleEndian.PutUint32(header[5:], 1)
+	binary.LittleEndian.PutUint32(header[9:], uint32(size))
+	binary.LittleEndian.PutUint32(header[13:], uint32(b.buf.Len()+size))
+
+	ev := append(header, data...)
+	if b.checksum || typ == FormatDescriptionEvent {
+		ev = binary.LittleEndian.AppendUint32(ev, crc32.ChecksumIEEE(ev))
+	}
+	b.buf.Write(ev)
+}
+
+func (b *testBinlog) formatDescription(ts uint32) {
+	data := make([]byte, 2+50+4+1)
+	binary.LittleEndian.PutUint16(data, 4)
+	copy(data[2:], "8.4.4")
+	data[56] = HeaderSize
+	if b.checksum {
+		data = append(data, checksumCRC32)
+	} else {
+		data = append(data, checksumOff)
+	}
+	b.event(ts, FormatDescriptionEvent, data)
+}
+
+func (b *testBinlog) previousGTIDs(ts uint32, uuid string, start, end int64) {
+	data := binary.LittleEndian.AppendUint64(nil, 1)
+	data = append(data, uuidBytes(uuid)...)
+	data = binary.LittleEndian.AppendUint64(data, 1)
+	data = binary.LittleEndian.AppendUint64(data, uint64(start))
+	data = binary.LittleEndian.AppendUint64(data, uint64(end+1))
+	b.event(ts, PreviousGTIDsEvent, data)
+}
+
+func (b *testBinlog) gtid(ts uint32, uuid string, gno int64) {
+	data := []byte{1}
+	data = append(data, uuidBytes(uuid)...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(gno))
+	b.event(ts, GTIDEvent, data)
+}
+
+func (b *testBinlog) rotate(ts uint32, next string) {
+	data := binary.LittleEndian.AppendUint64(nil, 4)
+	data = append(data, next...)
+	b.event(ts, RotateEvent, data)
+}
+
+func uuidBytes(s string) []byte {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '-' {
+			continue
+		}
+		var v byte
+		for _, c := range s[i : i+2] {
+			v <<= 4
+			switch {
+			case c >= '0' && c <= '9':
+				v |= byte(c - '0')
+			default:
+				v |= byte(c-'a') + 10
+			}
+		}
+		b = append(b, v)
+		i++
+	}
+	return b
+}
+
+var _ = Describe("Reader", func() {
+	for _, checksum := range []bool{true, false} {
+		It("should read events", func() {
+			b := newTestBinlog(checksum)
+			b.formatDescription(1000)
+			b.previousGTIDs(1000, testUUID, 1, 10)
+			b.gtid(1001, testUUID, 11)
+			b.event(1001, QueryEvent, []byte("dummy"))
+			b.event(1001, XIDEvent, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+			b.gtid(1005, testUUID, 12)
+			b.event(1005, XIDEvent, []byte{2, 0, 0, 0, 0, 0, 0, 0})
+			b.rotate(1010, "binlog.000002")
+
+			r, err := NewReader(bytes.NewReader(b.buf.Bytes()))
+			Expect(err).NotTo(HaveOccurred())
+
+			var events []*Event
+			for {
+				ev, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				events = append(events, ev)
+			}
+			Expect(events).To(HaveLen(8))
+			Expect(events[0].Header.Type).To(Equal(FormatDescriptionEvent))
+			Expect(events[0].Pos).To(BeNumerically("==", len(Magic)))
+			Expect(r.Pos()).To(BeNumerically("==", b.buf.Len()))
+
+			prev, err := DecodePreviousGTIDs(events[1])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prev.String()).To(Equal(testUUID + ":1-10"))
+
+			uuid, gno, err := DecodeGTID(events[2])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uuid).To(Equal(testUUID))
+			Expect(gno).To(BeNumerically("==", 11))
+			Expect(events[3].Data).To(Equal([]byte("dummy")))
+
+			file, pos, err := DecodeRotate(events[7])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file).To(Equal("binlog.000002"))
+			Expect(pos).To(BeNumerically("==", 4))
+
+			info, err := Scan(bytes.NewReader(b.buf.Bytes()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.PreviousGTIDs.String()).To(Equal(testUUID + ":1-10"))
+			Expect(info.GTIDs.String()).To(Equal(testUUID + ":11-12"))
+			Expect(info.FirstEventTime).To(Equal(time.Unix(1000, 0).UTC()))
+			Expect(info.LastEventTime).To(Equal(time.Unix(1010, 0).UTC()))
+			Expect(info.Events).To(Equal(8))
+		})
+	}
+
+	It("should decode Query events", func() {
+		data := binary.LittleEndian.AppendUint32(nil, 1)
+		data = binary.LittleEndian.AppendUint32(data, 0)
+		data = append(data, 4)
+		data = binary.LittleEndian.AppendUint16(data, 0)
+		data = binary.LittleEndian.AppendUint16(data, 3)
+		data = append(data, 0x01, 0x02, 0x03)
+		data = append(data, "test\x00COMMIT"...)
+		b := newTestBinlog(true)
+		b.formatDescription(1000)
+		b.event(1000, QueryEvent, data)
+
+		r, err := NewReader(bytes.NewReader(b.buf.Bytes()))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		ev, err := r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		schema, query, err := DecodeQuery(ev)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schema).To(Equal("test"))
+		Expect(query).To(Equal("COMMIT"))
+
+		ev.Data = ev.Data[:20]
+		_, _, err = DecodeQuery(ev)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should detect broken files", func() {
+		_, err := NewReader(bytes.NewReader([]byte("not a binlog")))
+		Expect(err).To(HaveOccurred())
+
+		b := newTestBinlog(true)
+		b.formatDescription(1000)
+		b.gtid(1001, testUUID, 1)
+		data := b.buf.Bytes()
+		data[len(data)-6] ^= 0xff
+
+		_, err = Scan(bytes.NewReader(data))
+		Expect(err).To(MatchError(ErrChecksumMismatch))
+
+		_, err = Scan(bytes.NewReader(data[:len(data)-3]))
+		Expect(err).To(HaveOccurred())
+	})
+	It("should find the first transaction after a time", func() {
+		b := newTestBinlog(true)
+		b.formatDescription(1000)
+		b.previousGTIDs(1000, testUUID, 1, 10)
+		b.gtid(1001, testUUID, 11)
+		b.event(1001, XIDEvent, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+		b.gtid(1005, testUUID, 12)
+		b.event(1005, XIDEvent, []byte{2, 0, 0, 0, 0, 0, 0, 0})
+		b.gtid(1006, testUUID, 13)
+		b.event(1006, XIDEvent, []byte{3, 0, 0, 0, 0, 0, 0, 0})
+
+		before := make(GTIDSet)
+		gtid, err := FindTransactionAfter(bytes.NewReader(b.buf.Bytes()), time.Unix(1005, 0), before)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gtid).To(Equal(testUUID + ":13"))
+		Expect(before.String()).To(Equal(testUUID + ":11-12"))
+
+		before = make(GTIDSet)
+		gtid, err = FindTransactionAfter(bytes.NewReader(b.buf.Bytes()), time.Unix(2000, 0), before)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gtid).To(BeEmpty())
+		Expect(before.String()).To(Equal(testUUID + ":11-13"))
+	})
+})
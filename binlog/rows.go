@@ -0,0 +1,522 @@
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types in TABLE_MAP events.
+const (
+	typeDecimal    = 0
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDateTime   = 12
+	typeYear       = 13
+	typeNewDate    = 14
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDateTime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// Optional metadata types in TABLE_MAP events.
+const (
+	metadataSignedness = 1
+	metadataColumnName = 4
+)
+
+var errTruncated = errors.New("truncated event")
+
+// TableMap is a decoded TABLE_MAP event.
+type TableMap struct {
+	TableID     uint64
+	Schema      string
+	Table       string
+	ColumnTypes []byte
+	ColumnMeta  []uint16
+
+	// ColumnNames is available only if binlog_row_metadata=FULL.
+	ColumnNames []string
+
+	// Unsigned is true for unsigned numeric columns.
+	Unsigned []bool
+}
+
+// Value is a column value in a row image.
+type Value struct {
+	// Absent is true if the column is not included in the row image.
+	Absent bool
+	Null   bool
+
+	// Data is the textual representation of the value.
+	// Strings are returned as is, and JSON values are in the MySQL binary JSON format.
+	Data []byte
+}
+
+// Row is a row changed by a rows event.
+// Before is nil for insertions, and After is nil for deletions.
+type Row struct {
+	Before []Value
+	After  []Value
+}
+
+// RowsEvent is a decoded WRITE_ROWS, UPDATE_ROWS, or DELETE_ROWS event.
+type RowsEvent struct {
+	Table *TableMap
+	Rows  []Row
+}
+
+// IsRowsEvent returns true if t is a rows event that DecodeRows can decode.
+func IsRowsEvent(t EventType) bool {
+	return t == WriteRowsEventV2 || t == UpdateRowsEventV2 || t == DeleteRowsEventV2
+}
+
+// decoder consumes little-endian values from a byte slice.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.data) < n {
+		d.err = errTruncated
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint(n int) uint64 {
+	b := d.bytes(n)
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// packed reads a length-encoded integer.
+func (d *decoder) packed() uint64 {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	switch b[0] {
+	case 252:
+		return d.uint(2)
+	case 253:
+		return d.uint(3)
+	case 254:
+		return d.uint(8)
+	}
+	return uint64(b[0])
+}
+
+// DecodeTableMap decodes a TABLE_MAP event.
+func DecodeTableMap(ev *Event) (*TableMap, error) {
+	if ev.Header.Type != TableMapEvent {
+		return nil, fmt.Errorf("not a TABLE_MAP event: %d", ev.Header.Type)
+	}
+
+	d := &decoder{data: ev.Data}
+	tm := &TableMap{TableID: d.uint(6)}
+	d.bytes(2)
+	tm.Schema = string(d.bytes(int(d.uint(1))))
+	d.bytes(1)
+	tm.Table = string(d.bytes(int(d.uint(1))))
+	d.bytes(1)
+	n := int(d.packed())
+	tm.ColumnTypes = append([]byte(nil), d.bytes(n)...)
+	meta := &decoder{data: d.bytes(int(d.packed()))}
+	d.bytes((n + 7) / 8)
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	tm.ColumnMeta = make([]uint16, n)
+	for i, t := range tm.ColumnTypes {
+		switch t {
+		case typeFloat, typeDouble, typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeGeometry, typeJSON,
+			typeTime2, typeDateTime2, typeTimestamp2:
+			tm.ColumnMeta[i] = uint16(meta.uint(1))
+		case typeVarchar, typeVarString, typeBit:
+			tm.ColumnMeta[i] = uint16(meta.uint(2))
+		case typeNewDecimal, typeString, typeEnum, typeSet:
+			b := meta.bytes(2)
+			if b != nil {
+				tm.ColumnMeta[i] = uint16(b[0])<<8 | uint16(b[1])
+			}
+		}
+	}
+	if meta.err != nil {
+		return nil, fmt.Errorf("invalid column metadata: %w", meta.err)
+	}
+
+	tm.Unsigned = make([]bool, n)
+	for len(d.data) > 0 {
+		typ := d.uint(1)
+		field := &decoder{data: d.bytes(int(d.packed()))}
+		if d.err != nil {
+			return nil, fmt.Errorf("invalid optional metadata: %w", d.err)
+		}
+
+		switch typ {
+		case metadataSignedness:
+			var idx int
+			for i, t := range tm.ColumnTypes {
+				if !isNumericType(t) {
+					continue
+				}
+				if idx/8 < len(field.data) && field.data[idx/8]&(0x80>>(idx%8)) != 0 {
+					tm.Unsigned[i] = true
+				}
+				idx++
+			}
+		case metadataColumnName:
+			for len(field.data) > 0 {
+				tm.ColumnNames = append(tm.ColumnNames, string(field.bytes(int(field.packed()))))
+			}
+			if field.err != nil {
+				return nil, fmt.Errorf("invalid column names: %w", field.err)
+			}
+		}
+	}
+	return tm, nil
+}
+
+func isNumericType(t byte) bool {
+	switch t {
+	case typeTiny, typeShort, typeInt24, typeLong, typeLongLong, typeFloat, typeDouble, typeDecimal, typeNewDecimal:
+		return true
+	}
+	return false
+}
+
+// DecodeRows decodes a rows event.  `tables` should have the TABLE_MAP events
+// of the transaction keyed by the table ID.
+func DecodeRows(ev *Event, tables map[uint64]*TableMap) (*RowsEvent, error) {
+	if !IsRowsEvent(ev.Header.Type) {
+		return nil, fmt.Errorf("not a rows event: %d", ev.Header.Type)
+	}
+
+	d := &decoder{data: ev.Data}
+	tableID := d.uint(6)
+	d.bytes(2)
+	extra := int(d.uint(2))
+	d.bytes(extra - 2)
+	n := int(d.packed())
+	present := d.bytes((n + 7) / 8)
+	presentAfter := present
+	if ev.Header.Type == UpdateRowsEventV2 {
+		presentAfter = d.bytes((n + 7) / 8)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	tm, ok := tables[tableID]
+	if !ok {
+		return nil, fmt.Errorf("no TABLE_MAP event for table %d", tableID)
+	}
+	if len(tm.ColumnTypes) != n {
+		return nil, fmt.Errorf("column count mismatch for table %d: %d != %d", tableID, len(tm.ColumnTypes), n)
+	}
+
+	ret := &RowsEvent{Table: tm}
+	for len(d.data) > 0 {
+		var row Row
+		var err error
+		switch ev.Header.Type {
+		case WriteRowsEventV2:
+			row.After, err = decodeRowImage(d, tm, present)
+		case DeleteRowsEventV2:
+			row.Before, err = decodeRowImage(d, tm, present)
+		case UpdateRowsEventV2:
+			row.Before, err = decodeRowImage(d, tm, present)
+			if err == nil {
+				row.After, err = decodeRowImage(d, tm, presentAfter)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode a row of %s.%s: %w", tm.Schema, tm.Table, err)
+		}
+		ret.Rows = append(ret.Rows, row)
+	}
+	return ret, nil
+}
+
+func decodeRowImage(d *decoder, tm *TableMap, present []byte) ([]Value, error) {
+	var nPresent int
+	for i := range tm.ColumnTypes {
+		if present[i/8]&(1<<(i%8)) != 0 {
+			nPresent++
+		}
+	}
+	nulls := d.bytes((nPresent + 7) / 8)
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	values := make([]Value, len(tm.ColumnTypes))
+	var idx int
+	for i := range tm.ColumnTypes {
+		if present[i/8]&(1<<(i%8)) == 0 {
+			values[i].Absent = true
+			continue
+		}
+		if nulls[idx/8]&(1<<(idx%8)) != 0 {
+			values[i].Null = true
+		} else {
+			data, err := decodeValue(d, tm.ColumnTypes[i], tm.ColumnMeta[i], tm.Unsigned[i])
+			if err != nil {
+				return nil, fmt.Errorf("column %d: %w", i, err)
+			}
+			values[i].Data = data
+		}
+		idx++
+	}
+	return values, nil
+}
+
+func decodeValue(d *decoder, typ byte, meta uint16, unsigned bool) ([]byte, error) {
+	var ret []byte
+	switch typ {
+	case typeTiny, typeShort, typeInt24, typeLong, typeLongLong:
+		size := map[byte]int{typeTiny: 1, typeShort: 2, typeInt24: 3, typeLong: 4, typeLongLong: 8}[typ]
+		v := d.uint(size)
+		if unsigned {
+			ret = strconv.AppendUint(nil, v, 10)
+		} else {
+			shift := 64 - 8*size
+			ret = strconv.AppendInt(nil, int64(v<<shift)>>shift, 10)
+		}
+	case typeFloat:
+		ret = strconv.AppendFloat(nil, float64(math.Float32frombits(uint32(d.uint(4)))), 'g', -1, 32)
+	case typeDouble:
+		ret = strconv.AppendFloat(nil, math.Float64frombits(d.uint(8)), 'g', -1, 64)
+	case typeNewDecimal:
+		s, err := decodeDecimal(d, int(meta>>8), int(meta&0xff))
+		if err != nil {
+			return nil, err
+		}
+		ret = []byte(s)
+	case typeYear:
+		v := d.uint(1)
+		if v != 0 {
+			v += 1900
+		}
+		ret = fmt.Appendf(nil, "%04d", v)
+	case typeDate, typeNewDate:
+		v := d.uint(3)
+		ret = fmt.Appendf(nil, "%04d-%02d-%02d", v>>9, (v>>5)&15, v&31)
+	case typeTimestamp:
+		ret = []byte(time.Unix(int64(d.uint(4)), 0).UTC().Format(time.DateTime))
+	case typeDateTime:
+		v := d.uint(8)
+		ret = fmt.Appendf(nil, "%04d-%02d-%02d %02d:%02d:%02d",
+			v/10000000000, v/100000000%100, v/1000000%100, v/10000%100, v/100%100, v%100)
+	case typeTime:
+		v := int64(d.uint(3)<<40) >> 40
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		ret = fmt.Appendf(nil, "%s%02d:%02d:%02d", sign, v/10000, v/100%100, v%100)
+	case typeTimestamp2:
+		sec := int64(bigEndian(d.bytes(4)))
+		usec := decodeFraction(d, int(meta))
+		ret = []byte(time.Unix(sec, 0).UTC().Format(time.DateTime) + formatFraction(usec, int(meta)))
+	case typeDateTime2:
+		v := int64(bigEndian(d.bytes(5))) - 0x8000000000
+		usec := decodeFraction(d, int(meta))
+		ymd, hms := v>>17, v%(1<<17)
+		ym := ymd >> 5
+		ret = fmt.Appendf(nil, "%04d-%02d-%02d %02d:%02d:%02d%s",
+			ym/13, ym%13, ymd%32, hms>>12, (hms>>6)%64, hms%64, formatFraction(usec, int(meta)))
+	case typeTime2:
+		ret = []byte(decodeTime2(d, int(meta)))
+	case typeVarchar, typeVarString:
+		size := 1
+		if meta >= 256 {
+			size = 2
+		}
+		ret = d.bytes(int(d.uint(size)))
+	case typeString, typeEnum, typeSet:
+		realType, length := typ, int(meta)
+		if meta >= 256 {
+			b0, b1 := byte(meta>>8), int(meta&0xff)
+			if b0&0x30 != 0x30 {
+				realType, length = b0|0x30, b1|int((b0&0x30)^0x30)<<4
+			} else {
+				realType, length = b0, b1
+			}
+		}
+		switch realType {
+		case typeEnum, typeSet:
+			ret = strconv.AppendUint(nil, d.uint(length), 10)
+		default:
+			size := 1
+			if length > 255 {
+				size = 2
+			}
+			ret = d.bytes(int(d.uint(size)))
+		}
+	case typeBit:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		ret = strconv.AppendUint(nil, bigEndian(d.bytes((nbits+7)/8)), 10)
+	case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeGeometry, typeJSON:
+		ret = d.bytes(int(d.uint(int(meta))))
+	case typeNull:
+	default:
+		return nil, fmt.Errorf("unsupported column type %d", typ)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return append([]byte(nil), ret...), nil
+}
+
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// decodeFraction reads the fractional seconds of TIMESTAMP2 and DATETIME2 in microseconds.
+func decodeFraction(d *decoder, fsp int) int64 {
+	switch fsp {
+	case 1, 2:
+		return int64(bigEndian(d.bytes(1))) * 10000
+	case 3, 4:
+		return int64(bigEndian(d.bytes(2))) * 100
+	case 5, 6:
+		return int64(bigEndian(d.bytes(3)))
+	}
+	return 0
+}
+
+func formatFraction(usec int64, fsp int) string {
+	if fsp == 0 {
+		return ""
+	}
+	return fmt.Sprintf(".%06d", usec)[:fsp+1]
+}
+
+func decodeTime2(d *decoder, fsp int) string {
+	const intOffset = 0x800000
+	var packed int64
+	switch fsp {
+	case 0:
+		packed = (int64(bigEndian(d.bytes(3))) - intOffset) << 24
+	case 1, 2, 3, 4:
+		size, mul := 1, int64(10000)
+		if fsp > 2 {
+			size, mul = 2, 100
+		}
+		intpart := int64(bigEndian(d.bytes(3))) - intOffset
+		frac := int64(bigEndian(d.bytes(size)))
+		if intpart < 0 && frac != 0 {
+			intpart++
+			frac -= 1 << (8 * size)
+		}
+		packed = intpart<<24 + frac*mul
+	case 5, 6:
+		packed = int64(bigEndian(d.bytes(6))) - 0x800000000000
+	}
+
+	sign := ""
+	if packed < 0 {
+		sign, packed = "-", -packed
+	}
+	hms, usec := packed>>24, packed%(1<<24)
+	return fmt.Sprintf("%s%02d:%02d:%02d%s", sign, (hms>>12)%(1<<10), (hms>>6)%64, hms%64, formatFraction(usec, fsp))
+}
+
+var digitsToBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decodeDecimal decodes a DECIMAL value in the MySQL binary format.
+func decodeDecimal(d *decoder, precision, scale int) (string, error) {
+	intg := precision - scale
+	intg0, intg0x := intg/9, intg%9
+	frac0, frac0x := scale/9, scale%9
+	size := intg0*4 + digitsToBytes[intg0x] + frac0*4 + digitsToBytes[frac0x]
+
+	b := append([]byte(nil), d.bytes(size)...)
+	if d.err != nil {
+		return "", d.err
+	}
+	if len(b) == 0 {
+		return "", errors.New("invalid decimal")
+	}
+	negative := b[0]&0x80 == 0
+	b[0] ^= 0x80
+	if negative {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+	}
+
+	var intPart strings.Builder
+	pos := 0
+	read := func(n int) uint64 {
+		v := bigEndian(b[pos : pos+n])
+		pos += n
+		return v
+	}
+	if intg0x > 0 {
+		fmt.Fprintf(&intPart, "%d", read(digitsToBytes[intg0x]))
+	}
+	for i := 0; i < intg0; i++ {
+		fmt.Fprintf(&intPart, "%09d", read(4))
+	}
+	var fracPart strings.Builder
+	for i := 0; i < frac0; i++ {
+		fmt.Fprintf(&fracPart, "%09d", read(4))
+	}
+	if frac0x > 0 {
+		fmt.Fprintf(&fracPart, "%0*d", frac0x, read(digitsToBytes[frac0x]))
+	}
+
+	s := strings.TrimLeft(intPart.String(), "0")
+	if s == "" {
+		s = "0"
+	}
+	if scale > 0 {
+		s += "." + fracPart.String()
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s, nil
+}
@@ -0,0 +1,145 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func (b *testBinlog) tableMap(ts uint32, tableID uint64, schema, table string, types, meta, optional []byte) {
+	data := binary.LittleEndian.AppendUint64(nil, tableID)[:6]
+	data = append(data, 0, 0)
+	data = append(data, byte(len(schema)))
+	data = append(data, schema...)
+	data = append(data, 0, byte(len(table)))
+	data = append(data, table...)
+	data = append(data, 0, byte(len(types)))
+	data = append(data, types...)
+	data = append(data, byte(len(meta)))
+	data = append(data, meta...)
+	data = append(data, make([]byte, (len(types)+7)/8)...)
+	data = append(data, optional...)
+	b.event(ts, TableMapEvent, data)
+}
+
+func (b *testBinlog) rows(ts uint32, typ EventType, tableID uint64, columns int, rows ...[]byte) {
+	data := binary.LittleEndian.AppendUint64(nil, tableID)[:6]
+	data = append(data, 0, 0, 2, 0, byte(columns))
+	present := bytes.Repeat([]byte{0xff}, (columns+7)/8)
+	data = append(data, present...)
+	if typ == UpdateRowsEventV2 {
+		data = append(data, present...)
+	}
+	for _, r := range rows {
+		data = append(data, r...)
+	}
+	b.event(ts, typ, data)
+}
+
+func bigEndianBytes(v uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+var _ = Describe("DecodeRows", func() {
+	It("should decode row events", func() {
+		types := []byte{typeLong, typeLong, typeVarchar, typeNewDecimal, typeDateTime2, typeTime2, typeDate, typeBlob}
+		meta := []byte{40, 0, 10, 2, 3, 0, 2}
+		optional := []byte{metadataSignedness, 1, 0x40, metadataColumnName, 16,
+			1, 'a', 1, 'b', 1, 'c', 1, 'd', 1, 'e', 1, 'f', 1, 'g', 1, 'h'}
+
+		var row1 []byte
+		row1 = append(row1, 0)                                            // null bitmap
+		row1 = binary.LittleEndian.AppendUint32(row1, uint32(0xfffffffb)) // -5
+		row1 = binary.LittleEndian.AppendUint32(row1, 0xffffffff)
+		row1 = append(row1, 3, 'a', 'b', 'c')
+		row1 = append(row1, 0x80, 0x00, 0x04, 0xd2, 0x38) // 1234.56
+		ymd := uint64((2024*13+1)<<5 | 2)
+		hms := uint64(3<<12 | 4<<6 | 5)
+		row1 = append(row1, bigEndianBytes(ymd<<17|hms+0x8000000000, 5)...)
+		row1 = append(row1, bigEndianBytes(6780, 2)...)
+		row1 = append(row1, bigEndianBytes(uint64(0x800000-(1<<12|2<<6|3)), 3)...) // -01:02:03
+		date := uint32(2024<<9 | 2<<5 | 29)
+		row1 = append(row1, byte(date), byte(date>>8), byte(date>>16))
+		row1 = append(row1, 2, 0, 'x', 'y')
+
+		var row2 []byte
+		row2 = append(row2, 0xfe) // all columns but the first one are null
+		row2 = binary.LittleEndian.AppendUint32(row2, 7)
+
+		var row3 []byte
+		row3 = append(row3, 0xf6) // the first and the 4th columns are not null
+		row3 = binary.LittleEndian.AppendUint32(row3, 7)
+		row3 = append(row3, 0x7f, 0xff, 0xfb, 0x2d, 0xc7) // -1234.56
+
+		b := newTestBinlog(true)
+		b.formatDescription(1000)
+		b.tableMap(1001, 100, "foo", "bar", types, meta, optional)
+		b.rows(1001, WriteRowsEventV2, 100, len(types), row1)
+		b.rows(1001, UpdateRowsEventV2, 100, len(types), row2, row3)
+		b.rows(1001, DeleteRowsEventV2, 100, len(types), row3)
+
+		r, err := NewReader(bytes.NewReader(b.buf.Bytes()))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.Next()
+		Expect(err).NotTo(HaveOccurred())
+
+		ev, err := r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		tm, err := DecodeTableMap(ev)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tm.TableID).To(BeNumerically("==", 100))
+		Expect(tm.Schema).To(Equal("foo"))
+		Expect(tm.Table).To(Equal("bar"))
+		Expect(tm.ColumnNames).To(Equal([]string{"a", "b", "c", "d", "e", "f", "g", "h"}))
+		Expect(tm.Unsigned).To(Equal([]bool{false, true, false, false, false, false, false, false}))
+		tables := map[uint64]*TableMap{tm.TableID: tm}
+
+		texts := func(values []Value) []string {
+			var ret []string
+			for _, v := range values {
+				if v.Null {
+					ret = append(ret, "NULL")
+					continue
+				}
+				ret = append(ret, string(v.Data))
+			}
+			return ret
+		}
+
+		ev, err = r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		rows, err := DecodeRows(ev, tables)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows.Table).To(Equal(tm))
+		Expect(rows.Rows).To(HaveLen(1))
+		Expect(rows.Rows[0].Before).To(BeNil())
+		Expect(texts(rows.Rows[0].After)).To(Equal([]string{
+			"-5", "4294967295", "abc", "1234.56", "2024-01-02 03:04:05.678", "-01:02:03", "2024-02-29", "xy",
+		}))
+
+		ev, err = r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		rows, err = DecodeRows(ev, tables)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows.Rows).To(HaveLen(1))
+		Expect(texts(rows.Rows[0].Before)).To(Equal([]string{"7", "NULL", "NULL", "NULL", "NULL", "NULL", "NULL", "NULL"}))
+		Expect(texts(rows.Rows[0].After)).To(Equal([]string{"7", "NULL", "NULL", "-1234.56", "NULL", "NULL", "NULL", "NULL"}))
+
+		ev, err = r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		rows, err = DecodeRows(ev, tables)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows.Rows).To(HaveLen(1))
+		Expect(rows.Rows[0].After).To(BeNil())
+
+		_, err = DecodeRows(ev, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
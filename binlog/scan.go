@@ -0,0 +1,111 @@
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FileInfo summarizes the contents of a binary log file.
+type FileInfo struct {
+	// PreviousGTIDs is the GTID set executed before the file.
+	PreviousGTIDs GTIDSet
+
+	// GTIDs is the GTID set of transactions in the file.
+	GTIDs GTIDSet
+
+	// FirstEventTime and LastEventTime are the timestamps of the first and the last events.
+	FirstEventTime time.Time
+	LastEventTime  time.Time
+
+	// Events is the number of events in the file.
+	Events int
+}
+
+// Scan reads all events from r and summarizes them.
+func Scan(r io.Reader) (*FileInfo, error) {
+	br, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{
+		PreviousGTIDs: make(GTIDSet),
+		GTIDs:         make(GTIDSet),
+	}
+	for {
+		ev, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Events == 0 {
+			info.FirstEventTime = ev.Header.Time()
+		}
+		info.LastEventTime = ev.Header.Time()
+		info.Events++
+
+		switch ev.Header.Type {
+		case PreviousGTIDsEvent:
+			set, err := DecodePreviousGTIDs(ev)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", ev.Pos, err)
+			}
+			info.PreviousGTIDs = set
+		case GTIDEvent:
+			uuid, gno, err := DecodeGTID(ev)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", ev.Pos, err)
+			}
+			info.GTIDs.Add(uuid, gno)
+		}
+	}
+	return info, nil
+}
+
+// ScanFile summarizes the binary log file at path.
+func ScanFile(path string) (*FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Scan(f)
+}
+
+// FindTransactionAfter returns the GTID of the first transaction in r whose
+// GTID event is timestamped after t, or an empty string if there is none.
+// GTIDs of the transactions before it are added to `before`.
+func FindTransactionAfter(r io.Reader, t time.Time, before GTIDSet) (string, error) {
+	br, err := NewReader(r)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		ev, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if ev.Header.Type != GTIDEvent {
+			continue
+		}
+
+		uuid, gno, err := DecodeGTID(ev)
+		if err != nil {
+			return "", fmt.Errorf("at %d: %w", ev.Pos, err)
+		}
+		if ev.Header.Time().After(t) {
+			return fmt.Sprintf("%s:%d", uuid, gno), nil
+		}
+		before.Add(uuid, gno)
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/cybozu-go/moco-agent/credential"
+	"github.com/spf13/cobra"
+)
+
+var encryptKeyFile string
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt-passwords",
+	Short: "Encrypt passwords of MOCO users for password-file",
+	Long: `Encrypt passwords of MOCO users read from stdin and write the result to stdout.
+
+The input consists of lines in the form of KEY=password such as AGENT_PASSWORD=xxx.
+The key file contains a base64-encoded 256-bit key generated by "openssl rand -base64 32".`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if encryptKeyFile == "" {
+			return errors.New("key-file is required")
+		}
+		key, err := credential.LoadKey(encryptKeyFile)
+		if err != nil {
+			return err
+		}
+		plaintext, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		data, err := credential.Encrypt(key, plaintext)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
+
+func init() {
+	encryptCmd.Flags().StringVar(&encryptKeyFile, "key-file", "", "File of the key to encrypt the passwords")
+	rootCmd.AddCommand(encryptCmd)
+}
@@ -12,7 +12,9 @@ import (
 	"time"
 
 	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/archive"
 	"github.com/cybozu-go/moco-agent/cert"
+	"github.com/cybozu-go/moco-agent/credential"
 	"github.com/cybozu-go/moco-agent/metrics"
 	"github.com/cybozu-go/moco-agent/proto"
 	"github.com/cybozu-go/moco-agent/server"
@@ -27,6 +29,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/robfig/cron/v3"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
@@ -57,6 +60,31 @@ var config struct {
 	grpcCertDir             string
 	transactionQueueingWait time.Duration
 	mysqldLocalHost         bool
+	mysqldSocket            bool
+	mysqldTLSCertDir        string
+	mysqldRequireTLS        bool
+	probePool               server.PoolConfig
+	opsPool                 server.PoolConfig
+	rotationPool            server.PoolConfig
+	binlogPurgeSchedule     string
+	binlogRetention         time.Duration
+	binlogArchiveURL        string
+	binlogArchiveInterval   time.Duration
+	binlogArchiveMargin     time.Duration
+	binlogArchiveCompress   bool
+	cloneLocalDir           string
+	cloneLocalKeep          int
+	privilegeCheckInterval  time.Duration
+	reconcilePrivileges     bool
+	customUsersFile         string
+	plugins                 []string
+	components              []string
+	nativeSemiSyncPlugins   bool
+	passwordDir             string
+	passwordFile            string
+	passwordKeyFile         string
+	passwordCheckInterval   time.Duration
+	passwordGracePeriod     time.Duration
 }
 
 type mysqlLogger struct{}
@@ -83,7 +111,11 @@ var rootCmd = &cobra.Command{
 		index := -1
 		fields := strings.Split(podName, "-")
 		index, _ = strconv.Atoi(fields[len(fields)-1])
-		agentPassword := os.Getenv(mocoagent.AgentPasswordEnvKey)
+		passwords, err := newCredentialProvider(rLogger.WithName("credentials"))
+		if err != nil {
+			return err
+		}
+		agentPassword := passwords.Password(mocoagent.AgentPasswordEnvKey)
 		if agentPassword == "" {
 			return fmt.Errorf("%s is empty", mocoagent.AgentPasswordEnvKey)
 		}
@@ -92,12 +124,20 @@ var rootCmd = &cobra.Command{
 			return fmt.Errorf("%s is empty", mocoagent.ClusterNameEnvKey)
 		}
 
+		pluginConfig, err := server.NewPluginConfig(config.plugins, config.components, config.nativeSemiSyncPlugins)
+		if err != nil {
+			return err
+		}
+
 		ctx := context.Background()
-		err = initializeMySQLForMOCO(ctx, config.socketPath, rLogger.WithName("init"))
+		err = initializeMySQLForMOCO(ctx, config.socketPath, pluginConfig, passwords, rLogger.WithName("init"))
 		if err != nil {
 			return err
 		}
 
+		registry := prometheus.DefaultRegisterer
+		metrics.Init(registry, clusterName, index)
+
 		conf := server.MySQLAccessorConfig{
 			Host:              podName,
 			Port:              mocoagent.MySQLAdminPort,
@@ -105,29 +145,92 @@ var rootCmd = &cobra.Command{
 			ConnMaxIdleTime:   config.connIdleTime,
 			ConnectionTimeout: config.connectionTimeout,
 			ReadTimeout:       config.readTimeout,
+			UseSocket:         config.mysqldSocket,
+			Pools: map[server.PoolClass]server.PoolConfig{
+				server.PoolProbe:    config.probePool,
+				server.PoolOps:      config.opsPool,
+				server.PoolRotation: config.rotationPool,
+			},
 		}
 
 		if config.mysqldLocalHost {
 			conf.Host = "localhost"
 		}
 
+		if config.mysqldTLSCertDir != "" {
+			mysqlReloader, err := cert.NewReloader(config.mysqldTLSCertDir, rLogger.WithName("mysqld-cert-reloader"))
+			if err != nil {
+				return err
+			}
+			conf.TLSConfig = mysqlReloader.TLSClientConfig
+			conf.RequireTLS = config.mysqldRequireTLS
+			well.Go(func(ctx context.Context) error {
+				mysqlReloader.Run(ctx, 1*time.Hour)
+				return nil
+			})
+		} else if config.mysqldRequireTLS {
+			return errors.New("mysqld-require-tls requires mysqld-tls-cert-dir")
+		}
+
 		agent, err := server.New(conf, clusterName, config.socketPath, mocoagent.VarLogPath,
 			config.maxDelayThreshold, config.transactionQueueingWait, rLogger.WithName("agent"))
 		if err != nil {
 			return err
 		}
 		defer agent.CloseDB()
+		agent.SetPluginConfig(pluginConfig)
+		agent.SetCredentialProvider(passwords)
 
-		mysql.SetLogger(mysqlLogger{})
+		if config.cloneLocalDir != "" {
+			if err := agent.EnableCloneLocal(config.cloneLocalDir, config.cloneLocalKeep); err != nil {
+				return err
+			}
+		}
 
-		registry := prometheus.DefaultRegisterer
-		metrics.Init(registry, clusterName, index)
+		if config.customUsersFile != "" {
+			if config.privilegeCheckInterval <= 0 || !config.reconcilePrivileges {
+				return errors.New("custom-users-file requires privilege-check-interval and reconcile-privileges")
+			}
+			if err := agent.LoadCustomUsers(config.customUsersFile); err != nil {
+				return err
+			}
+		}
+
+		// Enable archiving before purging binary logs so that no binary logs are purged before archived.
+		if config.binlogArchiveURL != "" {
+			storage, err := archive.NewStorage(config.binlogArchiveURL)
+			if err != nil {
+				return err
+			}
+			archiver, err := agent.EnableBinlogArchive(ctx, storage, config.binlogArchiveCompress, config.binlogArchiveInterval, config.binlogArchiveMargin)
+			if err != nil {
+				return err
+			}
+			well.Go(func(ctx context.Context) error {
+				archiver.Run(ctx)
+				return nil
+			})
+		}
+
+		mysql.SetLogger(mysqlLogger{})
 
 		c := cron.New(cron.WithLogger(rLogger.WithName("cron")))
 		if _, err := c.AddFunc(config.logRotationSchedule, agent.RotateLog); err != nil {
 			rLogger.Error(err, "failed to parse the cron spec", "spec", config.logRotationSchedule)
 			return err
 		}
+		if config.binlogPurgeSchedule != "" {
+			if config.binlogRetention <= 0 {
+				return errors.New("binlog-retention must be positive to purge binary logs periodically")
+			}
+			_, err := c.AddFunc(config.binlogPurgeSchedule, func() {
+				agent.PurgeExpiredBinaryLogs(config.binlogRetention)
+			})
+			if err != nil {
+				rLogger.Error(err, "failed to parse the cron spec", "spec", config.binlogPurgeSchedule)
+				return err
+			}
+		}
 		c.Start()
 		defer func() {
 			ctx := c.Stop()
@@ -135,7 +238,7 @@ var rootCmd = &cobra.Command{
 			select {
 			case <-ctx.Done():
 			case <-time.After(5 * time.Second):
-				rLogger.Info("log rotate job did not finish")
+				rLogger.Info("cron jobs did not finish")
 			}
 		}()
 
@@ -182,6 +285,10 @@ var rootCmd = &cobra.Command{
 				grpcMetrics.UnaryServerInterceptor(),
 				logging.UnaryServerInterceptor(InterceptorLogger(grpcLogger), grpcLoggingOpts...),
 			),
+			grpc.ChainStreamInterceptor(
+				grpcMetrics.StreamServerInterceptor(),
+				logging.StreamServerInterceptor(InterceptorLogger(grpcLogger), grpcLoggingOpts...),
+			),
 		)
 		proto.RegisterAgentServer(grpcServer, server.NewAgentService(agent))
 		grpcMetrics.InitializeMetrics(grpcServer)
@@ -194,6 +301,23 @@ var rootCmd = &cobra.Command{
 			reloader.Run(ctx, 1*time.Hour)
 			return nil
 		})
+		// MOCO users created by an older moco-agent may lack privileges required by this version.
+		well.Go(func(ctx context.Context) error {
+			agent.RunGrantMissingPrivileges(ctx, time.Minute)
+			return nil
+		})
+		if config.privilegeCheckInterval > 0 {
+			well.Go(func(ctx context.Context) error {
+				agent.RunPrivilegeCheck(ctx, config.privilegeCheckInterval, config.reconcilePrivileges)
+				return nil
+			})
+		}
+		if passwords.Updated() != nil {
+			well.Go(func(ctx context.Context) error {
+				agent.RunPasswordRotation(ctx, config.passwordCheckInterval, config.passwordGracePeriod)
+				return nil
+			})
+		}
 		well.Go(func(ctx context.Context) error {
 			return grpcServer.Serve(lis)
 		})
@@ -260,10 +384,68 @@ func init() {
 	fs.StringVar(&config.socketPath, "socket-path", socketPathDefault, "Path of mysqld socket file.")
 	fs.StringVar(&config.grpcCertDir, "grpc-cert-dir", "/grpc-cert", "gRPC certificate directory")
 	fs.DurationVar(&config.transactionQueueingWait, "transaction-queueing-wait", time.Minute, "The maximum amount of time for waiting transaction queueing on replica")
+	addPoolFlags(fs, "probe", "health and readiness probes", &config.probePool, 3)
+	addPoolFlags(fs, "ops", "gRPC operations and background jobs", &config.opsPool, 0)
+	addPoolFlags(fs, "rotation", "log rotation", &config.rotationPool, 1)
 	fs.BoolVar(&config.mysqldLocalHost, "mysqld-localhost", false, "If true, access mysqld on localhost instead of pod name")
+	fs.StringVar(&config.mysqldTLSCertDir, "mysqld-tls-cert-dir", "", "Directory of ca.crt, tls.crt, and tls.key to connect to mysqld with TLS; empty disables TLS")
+	fs.BoolVar(&config.mysqldRequireTLS, "mysqld-require-tls", false, "If true, fail to connect to mysqld that does not support TLS")
+	fs.BoolVar(&config.mysqldSocket, "mysqld-socket", false, "If true, access mysqld via socket-path and fall back to TCP when it is not connectable")
+	fs.StringVar(&config.binlogPurgeSchedule, "binlog-purge-schedule", "", "Cron format schedule for purging binary logs older than binlog-retention; empty disables it")
+	fs.DurationVar(&config.binlogRetention, "binlog-retention", 0, "Minimum retention period of binary logs purged by binlog-purge-schedule")
+	fs.StringVar(&config.binlogArchiveURL, "binlog-archive-url", "", "URL of the storage to archive binary logs (file:///path or s3://bucket/prefix?endpoint=URL); empty disables archiving")
+	fs.DurationVar(&config.binlogArchiveInterval, "binlog-archive-interval", time.Minute, "Interval to check binary logs to be archived")
+	fs.DurationVar(&config.binlogArchiveMargin, "binlog-archive-expire-margin", time.Hour, "Margin for uploads and retries required between binlog-archive-interval and binlog_expire_logs_seconds")
+	fs.BoolVar(&config.binlogArchiveCompress, "binlog-archive-compress", false, "If true, compress archived binary logs with gzip")
+	fs.StringVar(&config.cloneLocalDir, "clone-local-dir", "", "Directory to store snapshots taken by CloneLocal; empty disables it")
+	fs.IntVar(&config.cloneLocalKeep, "clone-local-keep", 3, "Number of snapshots kept in clone-local-dir")
+	fs.DurationVar(&config.privilegeCheckInterval, "privilege-check-interval", 0, "Interval to check the privileges of MOCO users; the zero value disables it")
+	fs.BoolVar(&config.reconcilePrivileges, "reconcile-privileges", false, "If true, correct the drifted privileges found by the privilege check")
+	fs.StringVar(&config.customUsersFile, "custom-users-file", "", "YAML or JSON file defining users created and reconciled by the privilege check")
+	fs.StringSliceVar(&config.plugins, "plugins", nil, "Additional plugins to install in the form of name=library.so")
+	fs.StringSliceVar(&config.components, "components", nil, "Components to install in the form of file://component_name")
+	fs.BoolVar(&config.nativeSemiSyncPlugins, "native-semi-sync-plugins", false, "If true, install rpl_semi_sync_source and rpl_semi_sync_replica instead of the legacy ones on MySQL 8.4 or later")
+	fs.StringVar(&config.passwordDir, "password-dir", "", "Directory of password files of MOCO users reloaded on changes to rotate the passwords")
+	fs.StringVar(&config.passwordFile, "password-file", "", "File of the passwords of MOCO users encrypted by encrypt-passwords, reloaded on changes to rotate the passwords")
+	fs.StringVar(&config.passwordKeyFile, "password-key-file", "", "File of the key to decrypt password-file")
+	fs.DurationVar(&config.passwordCheckInterval, "password-check-interval", time.Minute, "Interval to check the passwords of password-dir or password-file in addition to the reloads")
+	fs.DurationVar(&config.passwordGracePeriod, "password-grace-period", 10*time.Minute, "Period to retain the old password after rotating a password")
+}
+
+// addPoolFlags adds the flags to configure the connection pool for `name`.
+func addPoolFlags(fs *pflag.FlagSet, name, usage string, pool *server.PoolConfig, maxOpenConns int) {
+	fs.IntVar(&pool.MaxOpenConns, name+"-max-open-conns", maxOpenConns, "Maximum number of open connections to mysqld for "+usage+"; 0 means unlimited")
+	fs.IntVar(&pool.MaxIdleConns, name+"-max-idle-conns", 1, "Maximum number of idle connections to mysqld for "+usage)
+	fs.DurationVar(&pool.ConnectionTimeout, name+"-connection-timeout", 0, "Dial timeout for "+usage+"; 0 means connection-timeout")
+	fs.DurationVar(&pool.ReadTimeout, name+"-read-timeout", 0, "I/O read timeout for "+usage+"; 0 means read-timeout")
+}
+
+// newCredentialProvider returns the provider of the passwords of MOCO users specified by the flags.
+// The files are watched in the background.
+func newCredentialProvider(logger logr.Logger) (credential.Provider, error) {
+	var p *credential.FileProvider
+	var err error
+	switch {
+	case config.passwordDir != "" && config.passwordFile != "":
+		return nil, errors.New("password-dir and password-file are exclusive")
+	case config.passwordDir != "":
+		p, err = credential.NewDirProvider(config.passwordDir, logger)
+	case config.passwordFile != "":
+		if config.passwordKeyFile == "" {
+			return nil, errors.New("password-file requires password-key-file")
+		}
+		p, err = credential.NewEncryptedFileProvider(config.passwordFile, config.passwordKeyFile, logger)
+	default:
+		return credential.Env{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	well.Go(p.Run)
+	return p, nil
 }
 
-func initializeMySQLForMOCO(ctx context.Context, socketPath string, logger logr.Logger) error {
+func initializeMySQLForMOCO(ctx context.Context, socketPath string, plugins *server.PluginConfig, passwords credential.Provider, logger logr.Logger) error {
 	var db *sqlx.DB
 	st := time.Now()
 	for {
@@ -292,7 +474,7 @@ func initializeMySQLForMOCO(ctx context.Context, socketPath string, logger logr.
 
 	defer db.Close()
 
-	return server.Init(ctx, db, socketPath)
+	return server.Init(ctx, db, socketPath, plugins, passwords)
 }
 
 // https://github.com/grpc-ecosystem/go-grpc-middleware/blob/ab2131d954af9580c1b49a3d9475f6adbe5de9d3/interceptors/logging/examples/logr/example_test.go#L16-L42
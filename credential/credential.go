@@ -0,0 +1,229 @@
+// Package credential provides the passwords of MOCO users from environment variables or files.
+package credential
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+)
+
+// Provider provides the passwords of MOCO users.
+// Passwords are keyed by the names of the environment variables such as `AGENT_PASSWORD`.
+type Provider interface {
+	// Password returns the current password for `key`, or an empty string if it is not provided.
+	Password(key string) string
+
+	// Updated returns a channel that receives a value when the passwords may have been changed.
+	// It returns nil if the passwords never change.
+	Updated() <-chan struct{}
+}
+
+// Env is Provider reading the environment variables.
+type Env struct{}
+
+var _ Provider = Env{}
+
+func (Env) Password(key string) string {
+	return os.Getenv(key)
+}
+
+func (Env) Updated() <-chan struct{} {
+	return nil
+}
+
+// FileProvider is Provider loading the passwords from files.
+// While Run is running, the passwords are reloaded when the files are updated.
+// The passwords not found in the files are read from the environment variables.
+type FileProvider struct {
+	dir  string
+	load func() (map[string]string, error)
+	log  logr.Logger
+
+	mu        sync.RWMutex
+	passwords map[string]string
+	updated   chan struct{}
+}
+
+var _ Provider = &FileProvider{}
+
+// NewDirProvider creates a FileProvider that loads the passwords from the files in `dir`.
+// Each file is named after the key such as `AGENT_PASSWORD` and contains the password.
+// Trailing newlines are ignored, and so are the files whose names begin with a dot
+// such as `..data` of Kubernetes Secret volumes.
+func NewDirProvider(dir string, log logr.Logger) (*FileProvider, error) {
+	return newFileProvider(dir, func() (map[string]string, error) {
+		return loadDir(dir)
+	}, log)
+}
+
+// NewEncryptedFileProvider creates a FileProvider that loads the passwords from `file` encrypted by Encrypt
+// with the key in `keyFile`.  The decrypted content consists of lines in the form of `KEY=password`.
+func NewEncryptedFileProvider(file, keyFile string, log logr.Logger) (*FileProvider, error) {
+	return newFileProvider(filepath.Dir(file), func() (map[string]string, error) {
+		key, err := LoadKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		plaintext, err := Decrypt(key, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", file, err)
+		}
+		return parsePasswords(plaintext)
+	}, log)
+}
+
+func newFileProvider(dir string, load func() (map[string]string, error), log logr.Logger) (*FileProvider, error) {
+	p := &FileProvider{
+		dir:     dir,
+		load:    load,
+		log:     log,
+		updated: make(chan struct{}, 1),
+	}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileProvider) Password(key string) string {
+	p.mu.RLock()
+	pwd, ok := p.passwords[key]
+	p.mu.RUnlock()
+	if ok {
+		return pwd
+	}
+	return os.Getenv(key)
+}
+
+func (p *FileProvider) Updated() <-chan struct{} {
+	return p.updated
+}
+
+func (p *FileProvider) reload() error {
+	passwords, err := p.load()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.passwords = passwords
+	p.mu.Unlock()
+
+	select {
+	case p.updated <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run watches the files with inotify and reloads the passwords until `ctx` is canceled.
+// If the files are broken, the passwords loaded last are kept.
+// This should be called as a goroutine.
+func (p *FileProvider) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create a watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch the directory because the files are replaced by renaming.
+	if err := watcher.Add(p.dir); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", p.dir, err)
+	}
+	// Load the changes made before watching.
+	if err := p.reload(); err != nil {
+		p.log.Error(err, "failed to reload passwords")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			p.log.Error(err, "failed to watch password files")
+		case ev := <-watcher.Events:
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			if err := p.reload(); err != nil {
+				p.log.Error(err, "failed to reload passwords")
+				continue
+			}
+			p.log.Info("passwords reloaded", "event", ev.String())
+		}
+	}
+}
+
+func loadDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	passwords := make(map[string]string)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		// Follow symbolic links of Kubernetes Secret volumes.
+		// The files removed while loading and dangling links are ignored.
+		fi, err := os.Stat(filepath.Join(dir, e.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pwd := strings.TrimRight(string(data), "\r\n"); pwd != "" {
+			passwords[e.Name()] = pwd
+		}
+	}
+	return passwords, nil
+}
+
+func parsePasswords(data []byte) (map[string]string, error) {
+	passwords := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, pwd, ok := strings.Cut(line, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid line %d: no KEY=password", n)
+		}
+		passwords[key] = pwd
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(passwords) == 0 {
+		return nil, errors.New("no passwords")
+	}
+	return passwords, nil
+}
@@ -0,0 +1,164 @@
+package credential_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+
+	"github.com/cybozu-go/moco-agent/credential"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// runProvider runs `p` until the spec ends.
+func runProvider(p *credential.FileProvider) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	DeferCleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func drain(ch <-chan struct{}) {
+	select {
+	case <-ch:
+	default:
+	}
+}
+
+// writeSecret writes `data` as Kubernetes does for Secret volumes.
+// The files are symbolic links to `..data/<key>`, and `..data` is replaced atomically.
+func writeSecret(dir string, data map[string]string) {
+	tsDir, err := os.MkdirTemp(dir, "..ts")
+	Expect(err).NotTo(HaveOccurred())
+	for k, v := range data {
+		Expect(os.WriteFile(filepath.Join(tsDir, k), []byte(v), 0600)).To(Succeed())
+		link := filepath.Join(dir, k)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			Expect(os.Symlink(filepath.Join("..data", k), link)).To(Succeed())
+		}
+	}
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	Expect(os.Symlink(filepath.Base(tsDir), tmpLink)).To(Succeed())
+	Expect(os.Rename(tmpLink, filepath.Join(dir, "..data"))).To(Succeed())
+}
+
+var _ = Describe("Env", func() {
+	It("should read environment variables", func() {
+		GinkgoT().Setenv("TEST_PASSWORD", "foo")
+		Expect(credential.Env{}.Password("TEST_PASSWORD")).To(Equal("foo"))
+		Expect(credential.Env{}.Password("NO_SUCH_PASSWORD")).To(BeEmpty())
+		Expect(credential.Env{}.Updated()).To(BeNil())
+	})
+})
+
+var _ = Describe("NewDirProvider", func() {
+	It("should load and reload passwords from a directory", func() {
+		GinkgoT().Setenv("ENV_PASSWORD", "env")
+		dir := GinkgoT().TempDir()
+		writeSecret(dir, map[string]string{
+			"AGENT_PASSWORD": "agent\n",
+			"ADMIN_PASSWORD": "admin",
+			"EMPTY_PASSWORD": "\n",
+		})
+
+		p, err := credential.NewDirProvider(dir, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Password("AGENT_PASSWORD")).To(Equal("agent"))
+		Expect(p.Password("ADMIN_PASSWORD")).To(Equal("admin"))
+		Expect(p.Password("EMPTY_PASSWORD")).To(BeEmpty())
+		Expect(p.Password("..data")).To(BeEmpty())
+		Expect(p.Password("ENV_PASSWORD")).To(Equal("env"))
+
+		By("updating the secret")
+		drain(p.Updated())
+		runProvider(p)
+		writeSecret(dir, map[string]string{
+			"AGENT_PASSWORD": "newagent",
+			"ADMIN_PASSWORD": "admin",
+		})
+		Eventually(p.Updated()).Should(Receive())
+		Eventually(func() string {
+			return p.Password("AGENT_PASSWORD")
+		}).Should(Equal("newagent"))
+		Expect(p.Password("ADMIN_PASSWORD")).To(Equal("admin"))
+
+		By("writing a file directly")
+		Expect(os.WriteFile(filepath.Join(dir, "ENV_PASSWORD"), []byte("file"), 0600)).To(Succeed())
+		Eventually(func() string {
+			return p.Password("ENV_PASSWORD")
+		}).Should(Equal("file"))
+	})
+
+	It("should fail for a missing directory", func() {
+		_, err := credential.NewDirProvider(filepath.Join(GinkgoT().TempDir(), "missing"), logr.Discard())
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("NewEncryptedFileProvider", func() {
+	var keyFile string
+	var key []byte
+
+	BeforeEach(func() {
+		key = make([]byte, credential.KeySize)
+		_, err := rand.Read(key)
+		Expect(err).NotTo(HaveOccurred())
+		keyFile = filepath.Join(GinkgoT().TempDir(), "key")
+		Expect(os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)).To(Succeed())
+	})
+
+	writeEncrypted := func(file, plaintext string) {
+		data, err := credential.Encrypt(key, []byte(plaintext))
+		Expect(err).NotTo(HaveOccurred())
+		// Replace the file atomically.
+		Expect(os.WriteFile(file+".tmp", data, 0600)).To(Succeed())
+		Expect(os.Rename(file+".tmp", file)).To(Succeed())
+	}
+
+	It("should load and reload passwords from an encrypted file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "passwords")
+		writeEncrypted(file, "# comment\nAGENT_PASSWORD=agent\n\nADMIN_PASSWORD=a=b\r\n")
+
+		p, err := credential.NewEncryptedFileProvider(file, keyFile, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Password("AGENT_PASSWORD")).To(Equal("agent"))
+		Expect(p.Password("ADMIN_PASSWORD")).To(Equal("a=b"))
+
+		By("updating the file")
+		runProvider(p)
+		writeEncrypted(file, "AGENT_PASSWORD=newagent\n")
+		Eventually(func() string {
+			return p.Password("AGENT_PASSWORD")
+		}).Should(Equal("newagent"))
+		Expect(p.Password("ADMIN_PASSWORD")).To(BeEmpty())
+
+		By("keeping the passwords if the file is broken")
+		Expect(os.WriteFile(file, []byte("broken"), 0600)).To(Succeed())
+		Consistently(func() string {
+			return p.Password("AGENT_PASSWORD")
+		}, "200ms").Should(Equal("newagent"))
+	})
+
+	It("should fail with a wrong key", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "passwords")
+		writeEncrypted(file, "AGENT_PASSWORD=agent\n")
+
+		otherKey := filepath.Join(GinkgoT().TempDir(), "key")
+		Expect(os.WriteFile(otherKey, []byte(base64.StdEncoding.EncodeToString(make([]byte, credential.KeySize))), 0600)).To(Succeed())
+		_, err := credential.NewEncryptedFileProvider(file, otherKey, logr.Discard())
+		Expect(err).To(HaveOccurred())
+
+		Expect(os.WriteFile(otherKey, []byte("c2hvcnQ="), 0600)).To(Succeed())
+		_, err = credential.NewEncryptedFileProvider(file, otherKey, logr.Discard())
+		Expect(err).To(MatchError(ContainSubstring("is not 32 bytes")))
+	})
+})
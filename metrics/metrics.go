@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"database/sql"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -18,11 +20,94 @@ var (
 	CloneFailureCount          prometheus.Counter
 	CloneDurationSeconds       prometheus.Summary
 	CloneInProgress            prometheus.Gauge
+	CloneAttempts              prometheus.Counter
 	LogRotationCount           prometheus.Counter
 	LogRotationFailureCount    prometheus.Counter
 	LogRotationDurationSeconds prometheus.Summary
+	BinlogPurgeCount           prometheus.Counter
+	BinlogPurgeFailureCount    prometheus.Counter
+	BinlogPurgeDurationSeconds prometheus.Summary
+
+	BinlogArchiveCount           prometheus.Counter
+	BinlogArchiveFailureCount    prometheus.Counter
+	BinlogArchiveDurationSeconds prometheus.Summary
+	BinlogArchiveLagSeconds      prometheus.Gauge
+	BinlogArchiveExpiredCount    prometheus.Counter
+
+	LogicalBackupCount           prometheus.Counter
+	LogicalBackupFailureCount    prometheus.Counter
+	LogicalBackupDurationSeconds prometheus.Summary
+	LogicalBackupInProgress      prometheus.Gauge
+
+	BackupLockHeld prometheus.Gauge
+
+	CloneLocalCount           prometheus.Counter
+	CloneLocalFailureCount    prometheus.Counter
+	CloneLocalDurationSeconds prometheus.Summary
+
+	PrivilegeDrifts *prometheus.GaugeVec
+
+	PasswordRotationCount        prometheus.Counter
+	PasswordRotationFailureCount prometheus.Counter
+
+	MySQLConnectionCount     *prometheus.CounterVec
+	MySQLSocketFallbackCount prometheus.Counter
+
+	poolStats *poolStatsCollector
 )
 
+// poolStatsFunc returns the statistics of the connection pools of moco-agent keyed by the workload class.
+var poolStatsFunc atomic.Pointer[func() map[string]sql.DBStats]
+
+// SetPoolStats sets the function to get the statistics of the connection pools exported as metrics.
+func SetPoolStats(f func() map[string]sql.DBStats) {
+	poolStatsFunc.Store(&f)
+}
+
+// poolStatsCollector exports the statistics of the connection pools got by poolStatsFunc.
+type poolStatsCollector struct {
+	openConnections     *prometheus.Desc
+	inUseConnections    *prometheus.Desc
+	idleConnections     *prometheus.Desc
+	waitCount           *prometheus.Desc
+	waitDurationSeconds *prometheus.Desc
+}
+
+func newPoolStatsCollector(labels prometheus.Labels) *poolStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, []string{"pool"}, labels)
+	}
+	return &poolStatsCollector{
+		openConnections:     desc("mysql_pool_open_connections", "The number of established connections of the pool"),
+		inUseConnections:    desc("mysql_pool_in_use_connections", "The number of connections of the pool currently in use"),
+		idleConnections:     desc("mysql_pool_idle_connections", "The number of idle connections of the pool"),
+		waitCount:           desc("mysql_pool_wait_count", "The number of connections waited for because the pool reached the limit"),
+		waitDurationSeconds: desc("mysql_pool_wait_duration_seconds", "The total time blocked waiting for a new connection of the pool"),
+	}
+}
+
+func (c *poolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openConnections
+	ch <- c.inUseConnections
+	ch <- c.idleConnections
+	ch <- c.waitCount
+	ch <- c.waitDurationSeconds
+}
+
+func (c *poolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	f := poolStatsFunc.Load()
+	if f == nil {
+		return
+	}
+	for pool, st := range (*f)() {
+		ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(st.OpenConnections), pool)
+		ch <- prometheus.MustNewConstMetric(c.inUseConnections, prometheus.GaugeValue, float64(st.InUse), pool)
+		ch <- prometheus.MustNewConstMetric(c.idleConnections, prometheus.GaugeValue, float64(st.Idle), pool)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(st.WaitCount), pool)
+		ch <- prometheus.MustNewConstMetric(c.waitDurationSeconds, prometheus.CounterValue, st.WaitDuration.Seconds(), pool)
+	}
+}
+
 // Init initializes and registers MOCO's metrics to the registry
 func Init(registry prometheus.Registerer, name string, index int) {
 	labels := prometheus.Labels{
@@ -65,6 +150,13 @@ func Init(registry prometheus.Registerer, name string, index int) {
 		Help:        "Whether the clone operation is in progress or not",
 		ConstLabels: labels,
 	})
+	CloneAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "clone_attempts",
+		Help:        "The number of CLONE INSTANCE attempts including retries",
+		ConstLabels: labels,
+	})
 	LogRotationCount = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: subsystem,
@@ -86,15 +178,190 @@ func Init(registry prometheus.Registerer, name string, index int) {
 		ConstLabels: labels,
 		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
 	})
+	BinlogPurgeCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_purge_count",
+		Help:        "The number of binary log purge operations",
+		ConstLabels: labels,
+	})
+	BinlogPurgeFailureCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_purge_failure_count",
+		Help:        "The number of times binary log purge operation failed",
+		ConstLabels: labels,
+	})
+	BinlogPurgeDurationSeconds = prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_purge_duration_seconds",
+		Help:        "The time took to binary log purge operation",
+		ConstLabels: labels,
+		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+	BinlogArchiveCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_archive_count",
+		Help:        "The number of archived binary log files",
+		ConstLabels: labels,
+	})
+	BinlogArchiveFailureCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_archive_failure_count",
+		Help:        "The number of times binary log archiving failed",
+		ConstLabels: labels,
+	})
+	BinlogArchiveDurationSeconds = prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_archive_duration_seconds",
+		Help:        "The time took to archive a binary log file",
+		ConstLabels: labels,
+		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+	BinlogArchiveLagSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_archive_lag_seconds",
+		Help:        "The seconds since the oldest binary log file not archived yet was closed",
+		ConstLabels: labels,
+	})
+	BinlogArchiveExpiredCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "binlog_archive_expired_count",
+		Help:        "The number of binary log files removed by mysqld before archived",
+		ConstLabels: labels,
+	})
+	LogicalBackupCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "logical_backup_count",
+		Help:        "The number of logical backup operations",
+		ConstLabels: labels,
+	})
+	LogicalBackupFailureCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "logical_backup_failure_count",
+		Help:        "The number of times logical backup operation failed",
+		ConstLabels: labels,
+	})
+	LogicalBackupDurationSeconds = prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "logical_backup_duration_seconds",
+		Help:        "The time took to logical backup operation",
+		ConstLabels: labels,
+		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+	LogicalBackupInProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "logical_backup_in_progress",
+		Help:        "Whether the logical backup operation is in progress or not",
+		ConstLabels: labels,
+	})
+	BackupLockHeld = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "backup_lock_held",
+		Help:        "Whether the backup lock is held or not",
+		ConstLabels: labels,
+	})
+	CloneLocalCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "clone_local_count",
+		Help:        "The number of local clone operations",
+		ConstLabels: labels,
+	})
+	CloneLocalFailureCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "clone_local_failure_count",
+		Help:        "The number of times local clone operation failed",
+		ConstLabels: labels,
+	})
+	CloneLocalDurationSeconds = prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "clone_local_duration_seconds",
+		Help:        "The time took to local clone operation",
+		ConstLabels: labels,
+		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+	PrivilegeDrifts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "privilege_drifts",
+		Help:        "The number of drifted privileges of the user",
+		ConstLabels: labels,
+	}, []string{"user"})
+	PasswordRotationCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "password_rotation_count",
+		Help:        "The number of rotated passwords of MOCO users",
+		ConstLabels: labels,
+	})
+	PasswordRotationFailureCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "password_rotation_failure_count",
+		Help:        "The number of failed password rotations",
+		ConstLabels: labels,
+	})
+	MySQLConnectionCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "mysql_connection_count",
+		Help:        "The number of connections made by moco-agent to mysqld for each transport",
+		ConstLabels: labels,
+	}, []string{"transport"})
+	MySQLSocketFallbackCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "mysql_socket_fallback_count",
+		Help:        "The number of times falling back to TCP because the mysqld socket was not connectable",
+		ConstLabels: labels,
+	})
+	poolStats = newPoolStatsCollector(labels)
 
 	registry.MustRegister(
 		CloneCount,
 		CloneFailureCount,
 		CloneDurationSeconds,
 		CloneInProgress,
+		CloneAttempts,
 		LogRotationCount,
 		LogRotationFailureCount,
 		LogRotationDurationSeconds,
+		BinlogPurgeCount,
+		BinlogPurgeFailureCount,
+		BinlogPurgeDurationSeconds,
+		BinlogArchiveCount,
+		BinlogArchiveFailureCount,
+		BinlogArchiveDurationSeconds,
+		BinlogArchiveLagSeconds,
+		BinlogArchiveExpiredCount,
+		LogicalBackupCount,
+		LogicalBackupFailureCount,
+		LogicalBackupDurationSeconds,
+		LogicalBackupInProgress,
+		BackupLockHeld,
+		CloneLocalCount,
+		CloneLocalFailureCount,
+		CloneLocalDurationSeconds,
+		PrivilegeDrifts,
+		PasswordRotationCount,
+		PasswordRotationFailureCount,
+		MySQLConnectionCount,
+		MySQLSocketFallbackCount,
+		poolStats,
 	)
 }
 
@@ -0,0 +1,135 @@
+package mysqltest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/binlog"
+)
+
+// BinlogFile builds a binary log file of MySQL 8.4 with CRC32 checksums.
+type BinlogFile struct {
+	buf      bytes.Buffer
+	previous binlog.GTIDSet
+	xid      uint64
+}
+
+// NewBinlogFile returns BinlogFile beginning with the Format_description and Previous_gtids events at `ts`.
+// `previousGTIDs` is the GTID set executed before the file, and nil means none.
+func NewBinlogFile(ts time.Time, previousGTIDs binlog.GTIDSet) *BinlogFile {
+	b := &BinlogFile{previous: previousGTIDs}
+	if b.previous == nil {
+		b.previous = make(binlog.GTIDSet)
+	}
+	b.buf.WriteString(binlog.Magic)
+
+	fde := binary.LittleEndian.AppendUint16(nil, 4)
+	fde = append(fde, make([]byte, 50)...)
+	copy(fde[2:], "8.4.3")
+	fde = binary.LittleEndian.AppendUint32(fde, uint32(ts.Unix()))
+	fde = append(fde, binlog.HeaderSize)
+	// The post-header lengths of event types are omitted since the readers of moco-agent do not use them.
+	fde = append(fde, 1)
+	b.event(ts, binlog.FormatDescriptionEvent, fde)
+
+	var uuids []string
+	for uuid, ivs := range b.previous {
+		if len(ivs) > 0 {
+			uuids = append(uuids, uuid)
+		}
+	}
+	slices.Sort(uuids)
+	prev := binary.LittleEndian.AppendUint64(nil, uint64(len(uuids)))
+	for _, uuid := range uuids {
+		prev = append(prev, uuidBytes(uuid)...)
+		prev = binary.LittleEndian.AppendUint64(prev, uint64(len(b.previous[uuid])))
+		for _, iv := range b.previous[uuid] {
+			prev = binary.LittleEndian.AppendUint64(prev, uint64(iv.Start))
+			prev = binary.LittleEndian.AppendUint64(prev, uint64(iv.End+1))
+		}
+	}
+	b.event(ts, binlog.PreviousGTIDsEvent, prev)
+	return b
+}
+
+// Transaction appends a transaction of `query` in the statement format, i.e.,
+// the GTID, Query of BEGIN, Query of `query`, and Xid events at `ts`.
+func (b *BinlogFile) Transaction(ts time.Time, uuid string, gno int64, query string) {
+	gtid := []byte{1}
+	gtid = append(gtid, uuidBytes(uuid)...)
+	gtid = binary.LittleEndian.AppendUint64(gtid, uint64(gno))
+	// The logical timestamps, i.e., the type, last_committed, and sequence_number.
+	gtid = append(gtid, 2)
+	gtid = binary.LittleEndian.AppendUint64(gtid, uint64(gno-1))
+	gtid = binary.LittleEndian.AppendUint64(gtid, uint64(gno))
+	b.event(ts, binlog.GTIDEvent, gtid)
+
+	b.query(ts, "BEGIN")
+	b.query(ts, query)
+
+	b.xid++
+	b.event(ts, binlog.XIDEvent, binary.LittleEndian.AppendUint64(nil, b.xid))
+}
+
+// Rotate appends the Rotate event to the next file `next`.
+func (b *BinlogFile) Rotate(ts time.Time, next string) {
+	data := binary.LittleEndian.AppendUint64(nil, 4)
+	data = append(data, next...)
+	b.event(ts, binlog.RotateEvent, data)
+}
+
+// PreviousGTIDs returns the GTID set executed before the file.
+func (b *BinlogFile) PreviousGTIDs() binlog.GTIDSet {
+	return b.previous.Clone()
+}
+
+// Bytes returns the contents of the file.
+func (b *BinlogFile) Bytes() []byte {
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// WriteFile writes the contents to `path`.
+func (b *BinlogFile) WriteFile(path string) error {
+	return os.WriteFile(path, b.buf.Bytes(), 0644)
+}
+
+func (b *BinlogFile) query(ts time.Time, query string) {
+	// The post header is the thread ID, the execution time, the length of the schema name,
+	// the error code, and the length of the status variables.
+	data := binary.LittleEndian.AppendUint32(nil, 1)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = append(data, 0)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	// The empty schema name is terminated by NUL.
+	data = append(data, 0)
+	data = append(data, query...)
+	b.event(ts, binlog.QueryEvent, data)
+}
+
+func (b *BinlogFile) event(ts time.Time, typ binlog.EventType, data []byte) {
+	size := binlog.HeaderSize + len(data) + crc32.Size
+	ev := binary.LittleEndian.AppendUint32(nil, uint32(ts.Unix()))
+	ev = append(ev, byte(typ))
+	ev = binary.LittleEndian.AppendUint32(ev, 1)
+	ev = binary.LittleEndian.AppendUint32(ev, uint32(size))
+	ev = binary.LittleEndian.AppendUint32(ev, uint32(b.buf.Len()+size))
+	ev = binary.LittleEndian.AppendUint16(ev, 0)
+	ev = append(ev, data...)
+	ev = binary.LittleEndian.AppendUint32(ev, crc32.ChecksumIEEE(ev))
+	b.buf.Write(ev)
+}
+
+func uuidBytes(uuid string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil || len(b) != 16 {
+		panic("mysqltest: invalid UUID " + uuid)
+	}
+	return b
+}
@@ -0,0 +1,705 @@
+package mysqltest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/binlog"
+)
+
+// Clone states in performance_schema.clone_status.
+const (
+	CloneInProgress = "In Progress"
+	CloneCompleted  = "Completed"
+	CloneFailed     = "Failed"
+)
+
+// quoted matches a quoted string in queries interpolated by the client.
+const quoted = `'((?:[^'\\]|\\.)*)'`
+
+// selectItemPattern matches an item of SELECT without FROM such as "@@global.read_only AS read_only".
+var selectItemPattern = regexp.MustCompile("(?i)^(VERSION\\(\\)|@@[a-z0-9_.]+)(?: AS `?([a-z0-9_@.]+)`?)?$")
+
+// Instance is Server simulating mysqld for moco-agent.
+//
+// It answers the queries that moco-agent issues, such as SELECT of system variables, SET GLOBAL,
+// SHOW REPLICA STATUS, SHOW BINARY LOGS, CLONE INSTANCE, ALTER USER with dual passwords,
+// and selects from performance_schema, with the state set by its methods.
+// Statements only change the state; for example,
+// START REPLICA marks the replication threads running without connecting to the source.
+// The relay logs are applied only by ApplyRelayLog.
+// Use the methods of Server to override the results or to inject errors.
+type Instance struct {
+	*Server
+
+	mu        sync.Mutex
+	comment   string
+	variables map[string]string
+	plugins   []string
+	dataSize  int64
+
+	cloneState string
+	clones     []string
+
+	// replicas maps replication channels to the columns of SHOW REPLICA STATUS.
+	replicas map[string]map[string]any
+	// untils maps replication channels to the condition of START REPLICA UNTIL.
+	untils map[string]untilCondition
+
+	queued  time.Time
+	applied time.Time
+	uptime  time.Duration
+
+	binlogs       []binaryLog
+	previousGTIDs map[string]string
+}
+
+type binaryLog struct {
+	name string
+	size int64
+}
+
+// untilCondition is SQL_AFTER_GTIDS or SQL_BEFORE_GTIDS of START REPLICA UNTIL.
+type untilCondition struct {
+	after  binlog.GTIDSet
+	before binlog.GTIDSet
+}
+
+// NewInstance returns a writable MySQL 8.4 instance with no data.
+func NewInstance() *Instance {
+	i := &Instance{
+		Server:  NewServer(),
+		comment: "MySQL Community Server - GPL",
+		variables: map[string]string{
+			"read_only":                  "0",
+			"super_read_only":            "0",
+			"clone_valid_donor_list":     "",
+			"clone_max_concurrency":      "16",
+			"clone_max_data_bandwidth":   "0",
+			"clone_enable_compression":   "0",
+			"clone_ssl_ca":               "",
+			"clone_ssl_cert":             "",
+			"clone_ssl_key":              "",
+			"binlog_expire_logs_seconds": "2592000",
+			"gtid_executed":              "",
+			"innodb_page_size":           "16384",
+			"lower_case_table_names":     "0",
+			"max_allowed_packet":         "67108864",
+			"datadir":                    "/var/lib/mysql/",
+			"log_bin_basename":           "/var/lib/mysql/binlog",
+			"relay_log_basename":         "/var/lib/mysql/relay-bin",
+			"partial_revokes":            "1",
+			"sql_log_bin":                "1",
+			"rpl_semi_sync_source_wait_for_replica_count": "1",
+		},
+		plugins:       []string{"InnoDB", "clone"},
+		replicas:      make(map[string]map[string]any),
+		untils:        make(map[string]untilCondition),
+		uptime:        time.Hour,
+		previousGTIDs: make(map[string]string),
+	}
+	i.registerHandlers()
+	return i
+}
+
+// SetVersion sets VERSION() and @@version_comment.
+func (i *Instance) SetVersion(version, comment string) {
+	i.Server.mu.Lock()
+	i.Server.version = version
+	i.Server.mu.Unlock()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.comment = comment
+}
+
+// SetVariable sets the global system variable `name`.  Booleans are "0" or "1".
+func (i *Instance) SetVariable(name, value string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.variables[name] = value
+}
+
+// Variable returns the global system variable `name`.
+func (i *Instance) Variable(name string) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.variables[name]
+}
+
+// SetPlugins sets the active plugins and the size of the data in information_schema.FILES.
+func (i *Instance) SetPlugins(plugins []string, dataSize int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.plugins = slices.Clone(plugins)
+	i.dataSize = dataSize
+}
+
+// SetCloneState sets the state in performance_schema.clone_status.  The empty state means no clone has been run.
+func (i *Instance) SetCloneState(state string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.cloneState = state
+}
+
+// Clones returns the donors of CLONE INSTANCE as "user@host:port".
+func (i *Instance) Clones() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return slices.Clone(i.clones)
+}
+
+// SetReplicaStatus sets the columns of SHOW REPLICA STATUS for `channel` such as "Replica_IO_Running".
+// nil removes the channel.
+func (i *Instance) SetReplicaStatus(channel string, columns map[string]any) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if columns == nil {
+		delete(i.replicas, channel)
+		return
+	}
+	i.replicas[channel] = maps.Clone(columns)
+}
+
+// ReplicaStatus returns the columns of SHOW REPLICA STATUS for `channel`, or nil if it does not exist.
+func (i *Instance) ReplicaStatus(channel string) map[string]any {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return maps.Clone(i.replicas[channel])
+}
+
+// SetTransactionTimestamps sets the timestamps of the last queued and applied transactions, and the uptime.
+func (i *Instance) SetTransactionTimestamps(queued, applied time.Time, uptime time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.queued = queued
+	i.applied = applied
+	i.uptime = uptime
+}
+
+// AddBinaryLog appends a binary log file whose Previous_gtids event has `previousGTIDs`.
+func (i *Instance) AddBinaryLog(name string, size int64, previousGTIDs string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.binlogs = append(i.binlogs, binaryLog{name: name, size: size})
+	i.previousGTIDs[name] = previousGTIDs
+}
+
+// WriteBinaryLog writes `f` as the binary log file `name` in the directory of log_bin_basename,
+// and appends it as AddBinaryLog.
+func (i *Instance) WriteBinaryLog(name string, f *BinlogFile) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	data := f.Bytes()
+	if err := os.WriteFile(filepath.Join(filepath.Dir(i.variables["log_bin_basename"]), name), data, 0644); err != nil {
+		return err
+	}
+	i.binlogs = append(i.binlogs, binaryLog{name: name, size: int64(len(data))})
+	i.previousGTIDs[name] = f.PreviousGTIDs().String()
+	return nil
+}
+
+// ApplyRelayLog applies at most `n` transactions in the relay logs of `channel` by adding their GTIDs to gtid_executed.
+// The relay logs are read from RELAY_LOG_FILE of CHANGE REPLICATION SOURCE and the files following it
+// in the index file such as "relay-bin-pitr.index".  The transactions already executed are skipped.
+// The SQL thread stops when the condition of START REPLICA UNTIL is satisfied.
+// It returns the number of the applied transactions.
+func (i *Instance) ApplyRelayLog(channel string, n int) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	st, ok := i.replicas[channel]
+	if !ok || st["Replica_SQL_Running"] != "Yes" {
+		return 0, fmt.Errorf("the SQL thread of channel %q is not running", channel)
+	}
+	first, _ := st["Relay_Log_File"].(string)
+	files, err := relayLogFiles(first)
+	if err != nil {
+		return 0, err
+	}
+	executed, err := binlog.ParseGTIDSet(i.variables["gtid_executed"])
+	if err != nil {
+		return 0, err
+	}
+	until := i.untils[channel]
+
+	applied := 0
+	stopped := false
+	for _, file := range files {
+		gtids, err := readGTIDs(file)
+		if err != nil {
+			return applied, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for _, g := range gtids {
+			if until.after != nil && until.after.IsSubset(executed) {
+				stopped = true
+				break
+			}
+			if until.before != nil && until.before.Contains(g.uuid, g.gno) {
+				stopped = true
+				break
+			}
+			if executed.Contains(g.uuid, g.gno) {
+				continue
+			}
+			if applied == n {
+				break
+			}
+			executed.Add(g.uuid, g.gno)
+			applied++
+		}
+		if stopped || applied == n {
+			break
+		}
+	}
+	if until.after != nil && until.after.IsSubset(executed) {
+		stopped = true
+	}
+
+	i.variables["gtid_executed"] = executed.String()
+	if stopped {
+		st["Replica_SQL_Running"] = "No"
+	}
+	return applied, nil
+}
+
+type gtid struct {
+	uuid string
+	gno  int64
+}
+
+// relayLogFiles returns `first` and the files following it in the index file.
+func relayLogFiles(first string) ([]string, error) {
+	index := strings.TrimSuffix(first, filepath.Ext(first)) + ".index"
+	f, err := os.Open(index)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{first}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if s.Text() == first || len(files) > 0 {
+			files = append(files, s.Text())
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s is not in %s", first, index)
+	}
+	return files, nil
+}
+
+func readGTIDs(path string) ([]gtid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := binlog.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var gtids []gtid
+	for {
+		ev, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return gtids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ev.Header.Type != binlog.GTIDEvent {
+			continue
+		}
+		uuid, gno, err := binlog.DecodeGTID(ev)
+		if err != nil {
+			return nil, err
+		}
+		gtids = append(gtids, gtid{uuid: uuid, gno: gno})
+	}
+}
+
+// BinaryLogs returns the names of the binary log files.
+func (i *Instance) BinaryLogs() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	names := make([]string, len(i.binlogs))
+	for j, l := range i.binlogs {
+		names[j] = l.name
+	}
+	return names
+}
+
+// handle registers `fn` called with the lock of the instance.
+func (i *Instance) handle(pattern string, fn Handler) {
+	i.Server.Handle(pattern, func(query string, match []string) (*Result, error) {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		return fn(query, match)
+	})
+}
+
+func (i *Instance) registerHandlers() {
+	ok := func(string, []string) (*Result, error) { return nil, nil }
+
+	i.handle(`SELECT (?:VERSION\(\)|@@[\w.]+)(?: AS \S+)?(?:, (?:VERSION\(\)|@@[\w.]+)(?: AS \S+)?)*`, i.selectVariables)
+	i.handle(`SELECT @@read_only, @@super_read_only, @@clone_valid_donor_list, IFNULL\(.*`, i.selectMOCOVariables)
+	i.handle(`SET GLOBAL (\w+) ?= ?(.+)`, i.setVariable)
+	i.handle(`SET (?:SESSION )?\w+ ?= ?.+`, ok)
+	i.handle(`FLUSH .+`, ok)
+
+	i.handle(`SELECT state FROM performance_schema.clone_status`, func(string, []string) (*Result, error) {
+		res := &Result{Columns: []string{"state"}}
+		if i.cloneState != "" {
+			res.Rows = [][]any{{i.cloneState}}
+		}
+		return res, nil
+	})
+	i.handle(`SELECT COUNT\(\*\) FROM performance_schema.clone_status WHERE STATE = 'In Progress'`, func(string, []string) (*Result, error) {
+		count := 0
+		if i.cloneState == CloneInProgress {
+			count = 1
+		}
+		return &Result{Columns: []string{"COUNT(*)"}, Rows: [][]any{{count}}}, nil
+	})
+	i.handle(`CLONE INSTANCE FROM `+quoted+`@`+quoted+`:(\d+) IDENTIFIED BY `+quoted+`(?: REQUIRE SSL)?`, func(_ string, m []string) (*Result, error) {
+		i.clones = append(i.clones, fmt.Sprintf("%s@%s:%s", m[1], m[2], m[3]))
+		i.cloneState = CloneCompleted
+		return nil, nil
+	})
+	i.handle(`SELECT PLUGIN_NAME FROM information_schema.PLUGINS WHERE PLUGIN_STATUS = 'ACTIVE'`, func(string, []string) (*Result, error) {
+		res := &Result{Columns: []string{"PLUGIN_NAME"}}
+		for _, p := range i.plugins {
+			res.Rows = append(res.Rows, []any{p})
+		}
+		return res, nil
+	})
+	i.handle(`SELECT COALESCE\(SUM\(TOTAL_EXTENTS \* EXTENT_SIZE\), 0\) FROM information_schema.FILES .*`, func(string, []string) (*Result, error) {
+		return &Result{Columns: []string{"size"}, Rows: [][]any{{i.dataSize}}}, nil
+	})
+
+	i.handle(`SELECT (?:COALESCE\()?MAX\(LAST_QUEUED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP\).*`, func(string, []string) (*Result, error) {
+		return &Result{Columns: []string{"queued"}, Rows: [][]any{{i.queued}}}, nil
+	})
+	i.handle(`SELECT (?:COALESCE\()?MAX\(LAST_APPLIED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP\).*`, func(string, []string) (*Result, error) {
+		return &Result{Columns: []string{"applied"}, Rows: [][]any{{i.applied}}}, nil
+	})
+	i.handle(`SELECT VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME='Uptime'`, func(string, []string) (*Result, error) {
+		return &Result{Columns: []string{"VARIABLE_VALUE"}, Rows: [][]any{{strconv.Itoa(int(i.uptime.Seconds()))}}}, nil
+	})
+
+	i.handle(`SHOW (?:BINARY LOG|MASTER) STATUS`, i.showBinaryLogStatus)
+	i.handle(`SHOW BINARY LOGS`, func(string, []string) (*Result, error) {
+		res := &Result{Columns: []string{"Log_name", "File_size", "Encrypted"}}
+		for _, l := range i.binlogs {
+			res.Rows = append(res.Rows, []any{l.name, l.size, "No"})
+		}
+		return res, nil
+	})
+	i.handle(`SHOW BINLOG EVENTS IN `+quoted+` LIMIT (\d+)`, i.showBinlogEvents)
+	i.handle(`PURGE BINARY LOGS TO `+quoted, i.purgeBinaryLogs)
+	i.handle(`SELECT GTID_SUBSET\(GTID_SUBTRACT\(`+quoted+`, `+quoted+`\), `+quoted+`\)`, func(_ string, m []string) (*Result, error) {
+		sets := make([]binlog.GTIDSet, 3)
+		for j := range sets {
+			set, err := binlog.ParseGTIDSet(m[j+1])
+			if err != nil {
+				return nil, NewError(1772, "Malformed GTID set specification '%s'.", m[j+1])
+			}
+			sets[j] = set
+		}
+		// set - excluded ⊆ superset if and only if set ⊆ superset ∪ excluded.
+		union := sets[2].Clone()
+		union.Union(sets[1])
+		return &Result{Columns: []string{"subset"}, Rows: [][]any{{sets[0].IsSubset(union)}}}, nil
+	})
+
+	i.handle(`ALTER USER `+quoted+`@`+quoted+` IDENTIFIED BY `+quoted+` RETAIN CURRENT PASSWORD`, i.changePassword)
+	i.handle(`ALTER USER `+quoted+`@`+quoted+` DISCARD OLD PASSWORD`, func(_ string, m []string) (*Result, error) {
+		user, _ := unquote(`'` + m[1] + `'`)
+		i.Server.mu.Lock()
+		defer i.Server.mu.Unlock()
+		delete(i.Server.retained, user)
+		return nil, nil
+	})
+	i.handle(`SELECT COUNT\(\*\) FROM mysql.user WHERE user=`+quoted+` AND host=`+quoted+` AND JSON_CONTAINS_PATH\(User_attributes, 'one', '\$.additional_password'\)`, func(_ string, m []string) (*Result, error) {
+		user, _ := unquote(`'` + m[1] + `'`)
+		i.Server.mu.Lock()
+		defer i.Server.mu.Unlock()
+		count := 0
+		if _, ok := i.Server.retained[user]; ok {
+			count = 1
+		}
+		return &Result{Columns: []string{"COUNT(*)"}, Rows: [][]any{{count}}}, nil
+	})
+
+	i.handle(`SHOW (?:REPLICA|SLAVE) STATUS(?: FOR CHANNEL `+quoted+`)?`, i.showReplicaStatus)
+	i.handle(`CHANGE REPLICATION SOURCE TO (.+?)(?: FOR CHANNEL `+quoted+`)?`, i.changeReplicationSource)
+	i.handle(`START REPLICA( SQL_THREAD)?(?: UNTIL (SQL_AFTER_GTIDS|SQL_BEFORE_GTIDS) = `+quoted+`)?(?: FOR CHANNEL `+quoted+`)?`, func(_ string, m []string) (*Result, error) {
+		st, ok := i.replicas[m[4]]
+		if !ok {
+			return nil, NewError(3074, "Replica failed to initialize applier metadata structure from the repository")
+		}
+		var until untilCondition
+		if m[2] != "" {
+			set, err := binlog.ParseGTIDSet(m[3])
+			if err != nil {
+				return nil, NewError(1772, "Malformed GTID set specification '%s'.", m[3])
+			}
+			if m[2] == "SQL_AFTER_GTIDS" {
+				until.after = set
+			} else {
+				until.before = set
+			}
+		}
+		i.untils[m[4]] = until
+		if m[1] == "" {
+			st["Replica_IO_Running"] = "Yes"
+		}
+		st["Replica_SQL_Running"] = "Yes"
+		return nil, nil
+	})
+	i.handle(`STOP REPLICA(?: FOR CHANNEL `+quoted+`)?`, func(_ string, m []string) (*Result, error) {
+		if st, ok := i.replicas[m[1]]; ok {
+			st["Replica_IO_Running"] = "No"
+			st["Replica_SQL_Running"] = "No"
+		}
+		return nil, nil
+	})
+	i.handle(`RESET REPLICA ALL(?: FOR CHANNEL `+quoted+`)?`, func(_ string, m []string) (*Result, error) {
+		delete(i.replicas, m[1])
+		delete(i.untils, m[1])
+		return nil, nil
+	})
+	i.handle(`SELECT COUNT\(\*\) FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=`+quoted, func(_ string, m []string) (*Result, error) {
+		count := 0
+		if _, ok := i.replicas[m[1]]; ok {
+			count = 1
+		}
+		return &Result{Columns: []string{"COUNT(*)"}, Rows: [][]any{{count}}}, nil
+	})
+}
+
+// variable returns the value of a system variable such as "@@global.read_only".  The caller must hold mu.
+func (i *Instance) variable(expr string) (any, error) {
+	if strings.EqualFold(expr, "VERSION()") {
+		i.Server.mu.Lock()
+		defer i.Server.mu.Unlock()
+		return i.Server.version, nil
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(expr, "@@"))
+	name = strings.TrimPrefix(name, "global.")
+	switch name {
+	case "version":
+		return i.variable("VERSION()")
+	case "version_comment":
+		return i.comment, nil
+	}
+	v, ok := i.variables[name]
+	if !ok {
+		return nil, &Error{Code: 1193, State: "HY000", Message: fmt.Sprintf("Unknown system variable '%s'", name)}
+	}
+	return v, nil
+}
+
+func (i *Instance) selectVariables(query string, _ []string) (*Result, error) {
+	res := &Result{Rows: [][]any{nil}}
+	for _, item := range strings.Split(strings.TrimPrefix(query[len("SELECT"):], " "), ", ") {
+		m := selectItemPattern.FindStringSubmatch(item)
+		if m == nil {
+			return nil, NewError(1064, "mysqltest: unsupported item %q", item)
+		}
+		v, err := i.variable(m[1])
+		if err != nil {
+			return nil, err
+		}
+		name := m[1]
+		if m[2] != "" {
+			name = m[2]
+		}
+		res.Columns = append(res.Columns, name)
+		res.Rows[0] = append(res.Rows[0], v)
+	}
+	return res, nil
+}
+
+func (i *Instance) selectMOCOVariables(string, []string) (*Result, error) {
+	var donors any
+	if v := i.variables["clone_valid_donor_list"]; v != "" {
+		donors = v
+	}
+	count := i.variables["rpl_semi_sync_source_wait_for_replica_count"]
+	return &Result{
+		Columns: []string{"@@read_only", "@@super_read_only", "@@clone_valid_donor_list", "@@rpl_semi_sync_master_wait_for_slave_count"},
+		Rows:    [][]any{{i.variables["read_only"], i.variables["super_read_only"], donors, count}},
+	}, nil
+}
+
+func (i *Instance) setVariable(_ string, m []string) (*Result, error) {
+	name := strings.ToLower(m[1])
+	if _, ok := i.variables[name]; !ok {
+		return nil, &Error{Code: 1193, State: "HY000", Message: fmt.Sprintf("Unknown system variable '%s'", name)}
+	}
+	value := m[2]
+	if v, ok := unquote(value); ok {
+		value = v
+	}
+	switch strings.ToUpper(value) {
+	case "ON", "TRUE":
+		value = "1"
+	case "OFF", "FALSE":
+		value = "0"
+	}
+	i.variables[name] = value
+	return nil, nil
+}
+
+// unquote returns the content of a quoted string interpolated by the client.
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return "", false
+	}
+	var b strings.Builder
+	s = s[1 : len(s)-1]
+	for j := 0; j < len(s); j++ {
+		if s[j] == '\\' && j+1 < len(s) {
+			j++
+		}
+		b.WriteByte(s[j])
+	}
+	return b.String(), true
+}
+
+func (i *Instance) showBinaryLogStatus(string, []string) (*Result, error) {
+	res := &Result{Columns: []string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}}
+	file, pos := "", int64(0)
+	if len(i.binlogs) > 0 {
+		file, pos = i.binlogs[len(i.binlogs)-1].name, i.binlogs[len(i.binlogs)-1].size
+	}
+	res.Rows = [][]any{{file, pos, "", "", i.variables["gtid_executed"]}}
+	return res, nil
+}
+
+func (i *Instance) showBinlogEvents(_ string, m []string) (*Result, error) {
+	file, _ := unquote(`'` + m[1] + `'`)
+	prev, ok := i.previousGTIDs[file]
+	if !ok {
+		return nil, NewError(1220, "Error when executing command SHOW BINLOG EVENTS: Could not find target log")
+	}
+	limit, _ := strconv.Atoi(m[2])
+	res := &Result{Columns: []string{"Log_name", "Pos", "Event_type", "Server_id", "End_log_pos", "Info"}}
+	events := [][]any{
+		{file, 4, "Format_desc", 1, 126, "Server ver: 8.4.3, Binlog ver: 4"},
+		{file, 126, "Previous_gtids", 1, 197, prev},
+	}
+	res.Rows = events[:min(limit, len(events))]
+	return res, nil
+}
+
+func (i *Instance) purgeBinaryLogs(_ string, m []string) (*Result, error) {
+	file, _ := unquote(`'` + m[1] + `'`)
+	idx := slices.IndexFunc(i.binlogs, func(l binaryLog) bool { return l.name == file })
+	if idx < 0 {
+		return nil, NewError(1373, "Target log not found in binlog index")
+	}
+	for _, l := range i.binlogs[:idx] {
+		delete(i.previousGTIDs, l.name)
+	}
+	i.binlogs = slices.Clone(i.binlogs[idx:])
+	return nil, nil
+}
+
+func (i *Instance) changePassword(_ string, m []string) (*Result, error) {
+	user, _ := unquote(`'` + m[1] + `'`)
+	password, _ := unquote(`'` + m[3] + `'`)
+	i.Server.mu.Lock()
+	defer i.Server.mu.Unlock()
+	current, ok := i.Server.users[user]
+	if !ok {
+		return nil, NewError(1396, "Operation ALTER USER failed for '%s'@'%s'", user, m[2])
+	}
+	i.Server.retained[user] = current
+	i.Server.users[user] = password
+	return nil, nil
+}
+
+func (i *Instance) showReplicaStatus(_ string, m []string) (*Result, error) {
+	channel, _ := unquote(`'` + m[1] + `'`)
+	st, ok := i.replicas[channel]
+	if !ok {
+		return &Result{Columns: []string{"Channel_Name"}}, nil
+	}
+
+	st = maps.Clone(st)
+	st["Channel_Name"] = channel
+	st["Executed_Gtid_Set"] = i.variables["gtid_executed"]
+	res := &Result{Columns: slices.Sorted(maps.Keys(st)), Rows: [][]any{nil}}
+	for _, c := range res.Columns {
+		res.Rows[0] = append(res.Rows[0], st[c])
+	}
+	return res, nil
+}
+
+var sourceOptionPattern = regexp.MustCompile(`(?i)(\w+) = ` + quoted + `|(\w+) ?= ?(\d+)|(\w+)='([^']*)'`)
+
+func (i *Instance) changeReplicationSource(_ string, m []string) (*Result, error) {
+	channel, _ := unquote(`'` + m[2] + `'`)
+	st, ok := i.replicas[channel]
+	if !ok {
+		st = map[string]any{
+			"Replica_IO_Running":  "No",
+			"Replica_SQL_Running": "No",
+			"Last_IO_Errno":       0,
+			"Last_IO_Error":       "",
+			"Last_SQL_Errno":      0,
+			"Last_SQL_Error":      "",
+		}
+		i.replicas[channel] = st
+	}
+
+	columns := map[string]string{
+		"SOURCE_HOST":    "Source_Host",
+		"SOURCE_PORT":    "Source_Port",
+		"SOURCE_USER":    "Source_User",
+		"RELAY_LOG_FILE": "Relay_Log_File",
+		"RELAY_LOG_POS":  "Relay_Log_Pos",
+	}
+	for _, o := range sourceOptionPattern.FindAllStringSubmatch(m[1], -1) {
+		switch {
+		case o[1] != "":
+			if c, ok := columns[strings.ToUpper(o[1])]; ok {
+				v, _ := unquote(`'` + o[2] + `'`)
+				st[c] = v
+			}
+		case o[3] != "":
+			if c, ok := columns[strings.ToUpper(o[3])]; ok {
+				n, _ := strconv.Atoi(o[4])
+				st[c] = n
+			}
+		case o[5] != "":
+			if c, ok := columns[strings.ToUpper(o[5])]; ok {
+				st[c] = o[6]
+			}
+		}
+	}
+	return nil, nil
+}
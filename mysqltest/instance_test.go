@@ -0,0 +1,498 @@
+package mysqltest_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/archive"
+	"github.com/cybozu-go/moco-agent/credential"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/cybozu-go/moco-agent/mysqltest"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/cybozu-go/moco-agent/server"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+// startInstance starts Instance listening on TCP and a UNIX domain socket.
+func startInstance() (*mysqltest.Instance, *net.TCPAddr, string) {
+	inst := mysqltest.NewInstance()
+	addr, err := inst.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	sock := filepath.Join(GinkgoT().TempDir(), "mysqld.sock")
+	_, err = inst.Listen("unix", sock)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(inst.Close)
+	return inst, addr.(*net.TCPAddr), sock
+}
+
+func startAgent(addr *net.TCPAddr, sock, logDir string, useSocket bool) *server.Agent {
+	conf := server.MySQLAccessorConfig{
+		Host:              addr.IP.String(),
+		Port:              addr.Port,
+		Password:          "password",
+		ConnMaxIdleTime:   time.Minute,
+		ConnectionTimeout: 3 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		UseSocket:         useSocket,
+	}
+	agent, err := server.New(conf, "test", sock, logDir, 5*time.Second, time.Second, logr.Discard())
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(agent.CloseDB)
+	return agent
+}
+
+// writePassword writes the password file of `key` in `dir`.
+func writePassword(dir, key, password string) {
+	Expect(os.WriteFile(filepath.Join(dir, key), []byte(password), 0600)).To(Succeed())
+}
+
+// canLogin returns true if `user` can log in to the instance listening on `sock` with `password`.
+func canLogin(sock, user, password string) bool {
+	db, err := server.GetMySQLConnLocalSocket(user, password, sock)
+	if err != nil {
+		return false
+	}
+	db.Close()
+	return true
+}
+
+// countQueries returns the number of `query` received by `inst`.
+func countQueries(inst *mysqltest.Instance, query string) int {
+	var n int
+	for _, q := range inst.Queries() {
+		if q == query {
+			n++
+		}
+	}
+	return n
+}
+
+// poolMetric returns the value of the metric about the connection pool for `class`.
+func poolMetric(name, class string) float64 {
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	for _, mf := range families {
+		if mf.GetName() != "moco_instance_"+name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "pool" && l.GetValue() == class {
+					if m.Gauge != nil {
+						return m.Gauge.GetValue()
+					}
+					return m.Counter.GetValue()
+				}
+			}
+		}
+	}
+	return -1
+}
+
+func probe(handler http.HandlerFunc) int {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://localhost/", nil))
+	return rec.Code
+}
+
+var _ = Describe("Instance", func() {
+	It("should let moco-agent reply for probes", func() {
+		inst, addr, sock := startInstance()
+		agent := startAgent(addr, sock, "", false)
+
+		By("checking a writable primary")
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+		Expect(probe(agent.MySQLDReady)).To(Equal(http.StatusOK))
+
+		By("checking a replica in sync")
+		inst.SetVariable("read_only", "1")
+		inst.SetReplicaStatus("", map[string]any{
+			"Source_Host":         "moco-test-0",
+			"Replica_IO_Running":  "Yes",
+			"Replica_SQL_Running": "Yes",
+			"Last_IO_Errno":       0,
+			"Last_SQL_Errno":      0,
+		})
+		now := time.Now()
+		inst.SetTransactionTimestamps(now, now, time.Hour)
+		Expect(probe(agent.MySQLDReady)).To(Equal(http.StatusOK))
+
+		By("checking a lagging replica")
+		inst.SetTransactionTimestamps(now, now.Add(-time.Minute), time.Hour)
+		Expect(probe(agent.MySQLDReady)).To(Equal(http.StatusServiceUnavailable))
+
+		By("checking a replica with a replication error")
+		inst.SetTransactionTimestamps(now, now, time.Hour)
+		st := inst.ReplicaStatus("")
+		st["Replica_IO_Running"] = "Connecting"
+		st["Last_IO_Errno"] = 2003
+		inst.SetReplicaStatus("", st)
+		Expect(probe(agent.MySQLDReady)).To(Equal(http.StatusServiceUnavailable))
+
+		By("checking an instance under cloning")
+		inst.SetCloneState(mysqltest.CloneInProgress)
+		Expect(probe(agent.MySQLDReady)).To(Equal(http.StatusServiceUnavailable))
+
+		By("checking failures of queries")
+		inst.Fail(`SELECT VERSION\(\)`, mysqltest.NewError(1053, "Server shutdown in progress"))
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should let moco-agent connect via the socket", func() {
+		inst := mysqltest.NewInstance()
+		DeferCleanup(inst.Close)
+		sock := filepath.Join(GinkgoT().TempDir(), "mysqld.sock")
+		_, err := inst.Listen("unix", sock)
+		Expect(err).NotTo(HaveOccurred())
+		tcp := mysqltest.NewInstance()
+		DeferCleanup(tcp.Close)
+		addr, err := tcp.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		unixCount := testutil.ToFloat64(metrics.MySQLConnectionCount.WithLabelValues("unix"))
+		agent := startAgent(addr.(*net.TCPAddr), sock, "", true)
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+		Expect(inst.Queries()).To(ContainElement("SELECT VERSION()"))
+		Expect(tcp.Queries()).To(BeEmpty())
+		Expect(testutil.ToFloat64(metrics.MySQLConnectionCount.WithLabelValues("unix"))).To(BeNumerically(">", unixCount))
+
+		By("falling back to TCP")
+		tcpCount := testutil.ToFloat64(metrics.MySQLConnectionCount.WithLabelValues("tcp"))
+		fallbackCount := testutil.ToFloat64(metrics.MySQLSocketFallbackCount)
+		agent = startAgent(addr.(*net.TCPAddr), filepath.Join(GinkgoT().TempDir(), "missing.sock"), "", true)
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+		Expect(tcp.Queries()).To(ContainElement("SELECT VERSION()"))
+		Expect(testutil.ToFloat64(metrics.MySQLConnectionCount.WithLabelValues("tcp"))).To(BeNumerically(">", tcpCount))
+		Expect(testutil.ToFloat64(metrics.MySQLSocketFallbackCount)).To(BeNumerically(">", fallbackCount))
+
+		By("connecting via TCP without the socket")
+		tcpCount = testutil.ToFloat64(metrics.MySQLConnectionCount.WithLabelValues("tcp"))
+		fallbackCount = testutil.ToFloat64(metrics.MySQLSocketFallbackCount)
+		agent = startAgent(addr.(*net.TCPAddr), sock, "", false)
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+		Expect(testutil.ToFloat64(metrics.MySQLConnectionCount.WithLabelValues("tcp"))).To(BeNumerically(">", tcpCount))
+		Expect(testutil.ToFloat64(metrics.MySQLSocketFallbackCount)).To(Equal(fallbackCount))
+	})
+
+	It("should let probes use their own connection pool", func() {
+		inst, addr, sock := startInstance()
+		conf := server.MySQLAccessorConfig{
+			Host:              addr.IP.String(),
+			Port:              addr.Port,
+			Password:          "password",
+			ConnMaxIdleTime:   time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			Pools: map[server.PoolClass]server.PoolConfig{
+				server.PoolOps: {MaxOpenConns: 1, MaxIdleConns: 1},
+			},
+		}
+		agent, err := server.New(conf, "test", sock, "", 5*time.Second, time.Second, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(agent.CloseDB)
+
+		By("blocking the only connection for operations")
+		unblock := make(chan struct{})
+		DeferCleanup(func() {
+			select {
+			case <-unblock:
+			default:
+				close(unblock)
+			}
+		})
+		inst.Handle(`SHOW BINARY LOGS`, func(string, []string) (*mysqltest.Result, error) {
+			<-unblock
+			return &mysqltest.Result{Columns: []string{"Log_name", "File_size", "Encrypted"}}, nil
+		})
+		done := make(chan error)
+		go func() {
+			_, err := server.NewAgentService(agent).PurgeBinaryLogs(context.Background(), &proto.PurgeBinaryLogsRequest{
+				ReplicaGtidSets: []string{testUUID + ":1-10"},
+			})
+			done <- err
+		}()
+		Eventually(func() float64 {
+			return poolMetric("mysql_pool_in_use_connections", "ops")
+		}).Should(Equal(1.0))
+
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+		Expect(probe(agent.MySQLDReady)).To(Equal(http.StatusOK))
+		Expect(poolMetric("mysql_pool_open_connections", "probe")).To(BeNumerically(">=", 1))
+
+		By("waiting for the connection in the pool for operations")
+		go func() {
+			defer GinkgoRecover()
+			Expect(agent.GetMySQLGlobalVariable(context.Background())).NotTo(BeNil())
+		}()
+		Eventually(func() float64 {
+			return poolMetric("mysql_pool_wait_count", "ops")
+		}).Should(Equal(1.0))
+
+		close(unblock)
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should let moco-agent reconnect with the rotated password", func() {
+		inst, addr, sock := startInstance()
+		inst.SetVariable("read_only", "1")
+		inst.AddUser(mocoagent.AgentUser, "password")
+		agent := startAgent(addr, sock, "", false)
+
+		dir := GinkgoT().TempDir()
+		passwordFile := filepath.Join(dir, mocoagent.AgentPasswordEnvKey)
+		Expect(os.WriteFile(passwordFile, []byte("password"), 0600)).To(Succeed())
+		provider, err := credential.NewDirProvider(dir, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		agent.SetCredentialProvider(provider)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go provider.Run(ctx)
+		go agent.RunPasswordRotation(ctx, time.Hour, time.Hour)
+
+		By("changing the password on the primary and replicating it")
+		inst.AddUser(mocoagent.AgentUser, "newpassword")
+		inst.Disconnect()
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusServiceUnavailable))
+
+		By("updating the password file")
+		Expect(os.WriteFile(passwordFile, []byte("newpassword\n"), 0600)).To(Succeed())
+		Eventually(func() int {
+			return probe(agent.MySQLDHealth)
+		}).Should(Equal(http.StatusOK))
+	})
+
+	It("should rotate a password on the primary only once", func() {
+		inst, addr, sock := startInstance()
+		inst.AddUser(mocoagent.AgentUser, "password")
+		inst.AddUser(mocoagent.AdminUser, "admin")
+		inst.AddUser(mocoagent.WritableUser, "old")
+		agent := startAgent(addr, sock, "", false)
+
+		dir := GinkgoT().TempDir()
+		writePassword(dir, mocoagent.AgentPasswordEnvKey, "password")
+		writePassword(dir, mocoagent.AdminPasswordEnvKey, "admin")
+		writePassword(dir, mocoagent.WritablePasswordEnvKey, "old")
+		provider, err := credential.NewDirProvider(dir, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		agent.SetCredentialProvider(provider)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go provider.Run(ctx)
+		go agent.RunPasswordRotation(ctx, 20*time.Millisecond, 300*time.Millisecond)
+
+		By("failing to log in with the new password after changing it")
+		inst.FailLogin(mocoagent.WritableUser, mysqltest.NewError(1226, "User '%s' has exceeded the 'max_user_connections' resource", mocoagent.WritableUser))
+		writePassword(dir, mocoagent.WritablePasswordEnvKey, "new")
+		changes := func() int {
+			return countQueries(inst, "ALTER USER 'moco-writable'@'%' IDENTIFIED BY 'new' RETAIN CURRENT PASSWORD")
+		}
+		Eventually(changes).Should(Equal(1))
+		Consistently(changes, 200*time.Millisecond).Should(Equal(1))
+
+		By("discarding the old password after the new one becomes effective")
+		inst.FailLogin(mocoagent.WritableUser, nil)
+		Eventually(func() int {
+			return countQueries(inst, "ALTER USER 'moco-writable'@'%' DISCARD OLD PASSWORD")
+		}).Should(Equal(1))
+		Expect(changes()).To(Equal(1))
+		Expect(canLogin(sock, mocoagent.WritableUser, "old")).To(BeFalse())
+		Expect(canLogin(sock, mocoagent.WritableUser, "new")).To(BeTrue())
+	})
+
+	It("should discard the password retained before moco-agent restarts", func() {
+		inst, addr, sock := startInstance()
+		inst.AddUser(mocoagent.AgentUser, "password")
+		inst.AddUser(mocoagent.AdminUser, "admin")
+		inst.AddUser(mocoagent.WritableUser, "old")
+		db, err := server.GetMySQLConnLocalSocket(mocoagent.AdminUser, "admin", sock)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`ALTER USER 'moco-writable'@'%' IDENTIFIED BY 'new' RETAIN CURRENT PASSWORD`)
+		Expect(err).NotTo(HaveOccurred())
+		db.Close()
+		agent := startAgent(addr, sock, "", false)
+
+		dir := GinkgoT().TempDir()
+		writePassword(dir, mocoagent.AgentPasswordEnvKey, "password")
+		writePassword(dir, mocoagent.AdminPasswordEnvKey, "admin")
+		writePassword(dir, mocoagent.WritablePasswordEnvKey, "new")
+		provider, err := credential.NewDirProvider(dir, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		agent.SetCredentialProvider(provider)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go agent.RunPasswordRotation(ctx, 20*time.Millisecond, 100*time.Millisecond)
+
+		Eventually(func() bool {
+			return canLogin(sock, mocoagent.WritableUser, "old")
+		}).Should(BeFalse())
+		Expect(canLogin(sock, mocoagent.WritableUser, "new")).To(BeTrue())
+		Expect(countQueries(inst, "ALTER USER 'moco-writable'@'%' IDENTIFIED BY 'new' RETAIN CURRENT PASSWORD")).To(Equal(1))
+	})
+
+	It("should let moco-agent start after the password is changed while it is stopped", func() {
+		inst, addr, sock := startInstance()
+		inst.AddUser(mocoagent.AgentUser, "password")
+		inst.AddUser(mocoagent.AdminUser, "admin")
+		inst.AddUser(mocoagent.WritableUser, "writable")
+		agent := startAgent(addr, sock, "", false)
+
+		dir := GinkgoT().TempDir()
+		writePassword(dir, mocoagent.AgentPasswordEnvKey, "password")
+		writePassword(dir, mocoagent.AdminPasswordEnvKey, "admin")
+		writePassword(dir, mocoagent.WritablePasswordEnvKey, "writable")
+		provider, err := credential.NewDirProvider(dir, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		agent.SetCredentialProvider(provider)
+
+		By("changing the password while moco-agent is stopped")
+		Expect(agent.CloseDB()).To(Succeed())
+		writePassword(dir, mocoagent.AgentPasswordEnvKey, "newpassword")
+
+		By("restarting moco-agent with the new password")
+		provider, err = credential.NewDirProvider(dir, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		conf := server.MySQLAccessorConfig{
+			Host:              addr.IP.String(),
+			Port:              addr.Port,
+			Password:          provider.Password(mocoagent.AgentPasswordEnvKey),
+			ConnMaxIdleTime:   time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err = server.New(conf, "test", sock, "", 5*time.Second, time.Second, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(agent.CloseDB)
+		agent.SetCredentialProvider(provider)
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+
+		By("applying the new password")
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go agent.RunPasswordRotation(ctx, 20*time.Millisecond, 100*time.Millisecond)
+		Eventually(func() bool {
+			return canLogin(sock, mocoagent.AgentUser, "password")
+		}).Should(BeFalse())
+		Expect(canLogin(sock, mocoagent.AgentUser, "newpassword")).To(BeTrue())
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+		cancel()
+		Expect(agent.CloseDB()).To(Succeed())
+
+		By("falling back to the given password when the recorded one is rejected")
+		inst.AddUser(mocoagent.AgentUser, "otherpassword")
+		conf.Password = "otherpassword"
+		agent, err = server.New(conf, "test", sock, "", 5*time.Second, time.Second, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(agent.CloseDB)
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+	})
+
+	It("should refuse to archive binary logs expired by mysqld before archiving", func() {
+		inst, addr, sock := startInstance()
+		agent := startAgent(addr, sock, "", false)
+		storage, err := archive.NewStorage("file://" + GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		inst.SetVariable("binlog_expire_logs_seconds", "60")
+		_, err = agent.EnableBinlogArchive(context.Background(), storage, false, time.Minute, 0)
+		Expect(err).To(MatchError(ContainSubstring("binlog_expire_logs_seconds")))
+
+		By("requiring the margin for uploads and retries")
+		inst.SetVariable("binlog_expire_logs_seconds", "3600")
+		_, err = agent.EnableBinlogArchive(context.Background(), storage, false, time.Minute, time.Hour)
+		Expect(err).To(MatchError(ContainSubstring("binlog_expire_logs_seconds")))
+		inst.SetVariable("binlog_expire_logs_seconds", "7200")
+		_, err = agent.EnableBinlogArchive(context.Background(), storage, false, time.Minute, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		inst.SetVariable("binlog_expire_logs_seconds", "0")
+		_, err = agent.EnableBinlogArchive(context.Background(), storage, false, time.Minute, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should let moco-agent purge binary logs and rotate logs", func() {
+		inst, addr, sock := startInstance()
+		logDir := GinkgoT().TempDir()
+		agent := startAgent(addr, sock, logDir, false)
+
+		inst.AddBinaryLog("binlog.000001", 1000, "")
+		inst.AddBinaryLog("binlog.000002", 1000, testUUID+":1-10")
+		inst.AddBinaryLog("binlog.000003", 1000, testUUID+":1-20")
+
+		By("purging binary logs through the gRPC service")
+		svc := server.NewAgentService(agent)
+		res, err := svc.PurgeBinaryLogs(context.Background(), &proto.PurgeBinaryLogsRequest{
+			ReplicaGtidSets: []string{testUUID + ":1-15"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.PurgedFiles).To(Equal([]string{"binlog.000001"}))
+		Expect(inst.BinaryLogs()).To(Equal([]string{"binlog.000002", "binlog.000003"}))
+
+		By("rotating the slow query log")
+		slowFile := filepath.Join(logDir, mocoagent.MySQLSlowLogName)
+		Expect(os.WriteFile(slowFile, []byte("slow"), 0644)).To(Succeed())
+		agent.RotateLog()
+		Expect(slowFile + ".0").To(BeAnExistingFile())
+		Expect(inst.Queries()).To(ContainElement("FLUSH LOCAL SLOW LOGS"))
+	})
+
+	It("should let moco-agent select a donor for clone", func() {
+		recipient, addr, sock := startInstance()
+		recipient.SetVariable("datadir", GinkgoT().TempDir())
+		agent := startAgent(addr, sock, "", false)
+
+		lagging, laggingAddr, _ := startInstance()
+		now := time.Now()
+		lagging.SetTransactionTimestamps(now, now.Add(-time.Minute), time.Hour)
+		_, upToDateAddr, _ := startInstance()
+		incompatible, incompatibleAddr, _ := startInstance()
+		incompatible.SetVersion("8.0.39", "MySQL Community Server - GPL")
+
+		donor := func(a *net.TCPAddr) *proto.CloneDonor {
+			return &proto.CloneDonor{Host: a.IP.String(), Port: int32(a.Port)}
+		}
+		res, err := server.NewAgentService(agent).Clone(context.Background(), &proto.CloneRequest{
+			Candidates: []*proto.CloneDonor{donor(incompatibleAddr), donor(laggingAddr), donor(upToDateAddr)},
+			User:       mocoagent.CloneDonorUser,
+			Password:   "password",
+			DryRun:     true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.DonorPort).To(Equal(int32(upToDateAddr.Port)))
+		Expect(res.Reason).To(ContainSubstring(strconv.Itoa(incompatibleAddr.Port)))
+		Expect(recipient.Clones()).To(BeEmpty())
+	})
+
+	It("should let moco-agent clone from a donor whose data size is not readable", func() {
+		recipient, addr, sock := startInstance()
+		recipient.SetVariable("datadir", GinkgoT().TempDir())
+		agent := startAgent(addr, sock, "", false)
+
+		donor, donorAddr, _ := startInstance()
+		donor.Fail(`SELECT COALESCE\(SUM\(TOTAL_EXTENTS \* EXTENT_SIZE\), 0\) FROM information_schema.FILES .*`,
+			mysqltest.NewError(1227, "Access denied; you need (at least one of) the PROCESS privilege(s) for this operation"))
+
+		_, err := server.NewAgentService(agent).Clone(context.Background(), &proto.CloneRequest{
+			Host:     donorAddr.IP.String(),
+			Port:     int32(donorAddr.Port),
+			User:     mocoagent.CloneDonorUser,
+			Password: "password",
+			DryRun:   true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,609 @@
+// Package mysqltest provides an in-process server speaking the MySQL client/server protocol for tests.
+//
+// Server answers queries with the results of handlers registered for regular expressions.
+// Instance registers handlers that simulate the queries moco-agent issues to its own mysqld,
+// so that the probes, the gRPC service, and the cron jobs of moco-agent can be tested
+// without Docker or a MySQL binary.
+package mysqltest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Commands of the client/server protocol.
+const (
+	comQuit            = 0x01
+	comInitDB          = 0x02
+	comQuery           = 0x03
+	comPing            = 0x0e
+	comResetConnection = 0x1f
+)
+
+// Capability flags of the server.
+const (
+	clientLongPassword     = 0x00000001
+	clientFoundRows        = 0x00000002
+	clientLongFlag         = 0x00000004
+	clientConnectWithDB    = 0x00000008
+	clientProtocol41       = 0x00000200
+	clientSSL              = 0x00000800
+	clientTransactions     = 0x00002000
+	clientSecureConnection = 0x00008000
+	clientMultiStatements  = 0x00010000
+	clientMultiResults     = 0x00020000
+	clientPluginAuth       = 0x00080000
+
+	serverCapabilities = clientLongPassword | clientFoundRows | clientLongFlag | clientConnectWithDB | clientProtocol41 |
+		clientTransactions | clientSecureConnection | clientMultiStatements | clientMultiResults | clientPluginAuth
+)
+
+const (
+	serverStatusAutocommit = 0x0002
+	charsetUTF8MB4         = 255
+	charsetBinary          = 63
+	nativePasswordPlugin   = "mysql_native_password"
+)
+
+// Error is an error returned to clients in an ERR packet.
+type Error struct {
+	Code    uint16
+	State   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Error %d (%s): %s", e.Code, e.State, e.Message)
+}
+
+// NewError returns Error with the SQL state HY000.
+func NewError(code uint16, format string, args ...any) *Error {
+	return &Error{Code: code, State: "HY000", Message: fmt.Sprintf(format, args...)}
+}
+
+// Result is the result of a query.  A result without columns is returned as an OK packet.
+//
+// Values in Rows are nil for NULL, string, []byte, int, int64, uint64, float64, bool, or time.Time.
+// The type of a column is decided by the first non-nil value in the column.
+type Result struct {
+	Columns      []string
+	Rows         [][]any
+	AffectedRows uint64
+}
+
+// Handler returns the result of `query`.  `match` is the submatches of the pattern of the handler.
+// If Handler returns an error other than *Error, the client receives ER_UNKNOWN_ERROR (1105).
+type Handler func(query string, match []string) (*Result, error)
+
+type route struct {
+	pattern string
+	re      *regexp.Regexp
+	handler Handler
+}
+
+// Server is an in-process MySQL protocol server.
+//
+// Queries are normalized by collapsing whitespace before they are matched against the patterns of handlers.
+// Patterns are case-insensitive and must match the whole query.  When several patterns match,
+// the handler registered last is used.
+type Server struct {
+	mu        sync.Mutex
+	version   string
+	routes    []route
+	users     map[string]string
+	retained  map[string]string
+	loginErrs map[string]*Error
+	tlsConfig *tls.Config
+	tlsConns  int
+	queries   []string
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	nextID    uint32
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a Server with no handlers.
+func NewServer() *Server {
+	return &Server{
+		version:   "8.4.3",
+		users:     make(map[string]string),
+		retained:  make(map[string]string),
+		loginErrs: make(map[string]*Error),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Handle registers `handler` for the queries matching `pattern`.
+func (s *Server) Handle(pattern string, handler Handler) {
+	re := regexp.MustCompile(`(?is)^(?:` + pattern + `)$`)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append(s.routes, route{pattern: pattern, re: re, handler: handler})
+}
+
+// Respond registers a handler returning `result` for the queries matching `pattern`.
+func (s *Server) Respond(pattern string, result *Result) {
+	s.Handle(pattern, func(string, []string) (*Result, error) {
+		return result, nil
+	})
+}
+
+// Fail registers a handler returning `err` for the queries matching `pattern`.
+func (s *Server) Fail(pattern string, err *Error) {
+	s.Handle(pattern, func(string, []string) (*Result, error) {
+		return nil, err
+	})
+}
+
+// Remove unregisters the handlers registered for `pattern`.
+func (s *Server) Remove(pattern string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	routes := s.routes[:0]
+	for _, r := range s.routes {
+		if r.pattern != pattern {
+			routes = append(routes, r)
+		}
+	}
+	s.routes = routes
+}
+
+// AddUser adds a user authenticated with mysql_native_password, or changes the password of the user
+// discarding the retained one.  If no users are added, any user can log in with any password.
+func (s *Server) AddUser(user, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user] = password
+	delete(s.retained, user)
+}
+
+// FailLogin makes the logins of `user` fail with `err` until it is called again with nil.
+func (s *Server) FailLogin(user string, err *Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.loginErrs, user)
+		return
+	}
+	s.loginErrs[user] = err
+}
+
+// SetTLSConfig enables TLS for the clients requesting it.  nil disables TLS.
+// It affects new connections only.
+func (s *Server) SetTLSConfig(config *tls.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsConfig = config
+}
+
+// TLSConnections returns the number of connections established with TLS so far.
+func (s *Server) TLSConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tlsConns
+}
+
+// Disconnect closes all the client connections as if mysqld were restarted.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Queries returns the normalized queries received so far.
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// Listen starts accepting connections on `address`.  It can be called for several addresses.
+func (s *Server) Listen(network, address string) (net.Addr, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		l.Close()
+		return nil, errors.New("server is closed")
+	}
+	s.listeners = append(s.listeners, l)
+	s.wg.Add(1)
+	go s.serve(l)
+	return l.Addr(), nil
+}
+
+// Close closes the listeners and the connections, and waits for the connections to finish.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) serve(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.nextID++
+		id := s.nextID
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+				c.Close()
+			}()
+			s.handleConn(newPacketConn(c), id)
+		}()
+	}
+}
+
+func (s *Server) handleConn(pc *packetConn, id uint32) {
+	if err := s.handshake(pc, id); err != nil {
+		return
+	}
+
+	for {
+		pc.seq = 0
+		data, err := pc.readPacket()
+		if err != nil || len(data) == 0 {
+			return
+		}
+
+		switch data[0] {
+		case comQuit:
+			return
+		case comQuery:
+			err = s.handleQuery(pc, string(data[1:]))
+		case comPing, comInitDB, comResetConnection:
+			err = pc.writeOK(0)
+		default:
+			err = pc.writeError(NewError(1047, "Unknown command %d", data[0]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handshake(pc *packetConn, id uint32) error {
+	scramble := make([]byte, 20)
+	if _, err := rand.Read(scramble); err != nil {
+		return err
+	}
+	for i := range scramble {
+		// The scramble must not contain NUL.
+		scramble[i] = scramble[i]%94 + 33
+	}
+
+	s.mu.Lock()
+	version := s.version
+	tlsConfig := s.tlsConfig
+	s.mu.Unlock()
+	capabilities := uint32(serverCapabilities)
+	if tlsConfig != nil {
+		capabilities |= clientSSL
+	}
+
+	var b bytes.Buffer
+	b.WriteByte(10)
+	b.WriteString(version)
+	b.WriteByte(0)
+	b.Write(binary.LittleEndian.AppendUint32(nil, id))
+	b.Write(scramble[:8])
+	b.WriteByte(0)
+	b.Write(binary.LittleEndian.AppendUint16(nil, uint16(capabilities&0xffff)))
+	b.WriteByte(charsetUTF8MB4)
+	b.Write(binary.LittleEndian.AppendUint16(nil, serverStatusAutocommit))
+	b.Write(binary.LittleEndian.AppendUint16(nil, uint16(capabilities>>16)))
+	b.WriteByte(21)
+	b.Write(make([]byte, 10))
+	b.Write(scramble[8:])
+	b.WriteByte(0)
+	b.WriteString(nativePasswordPlugin)
+	b.WriteByte(0)
+	if err := pc.writePacket(b.Bytes()); err != nil {
+		return err
+	}
+
+	data, err := pc.readPacket()
+	if err != nil {
+		return err
+	}
+	// SSLRequest is the first 32 bytes of HandshakeResponse41 with CLIENT_SSL.
+	if tlsConfig != nil && len(data) == 32 && binary.LittleEndian.Uint32(data)&clientSSL != 0 {
+		// ClientHello may be already buffered in pc.r.
+		tc := tls.Server(&bufferedConn{Conn: pc.conn, r: pc.r}, tlsConfig)
+		if err := tc.Handshake(); err != nil {
+			return err
+		}
+		pc.conn = tc
+		pc.r = bufio.NewReader(tc)
+
+		s.mu.Lock()
+		s.tlsConns++
+		s.mu.Unlock()
+
+		data, err = pc.readPacket()
+		if err != nil {
+			return err
+		}
+	}
+	user, authResponse, err := parseHandshakeResponse(data)
+	if err != nil {
+		pc.writeError(&Error{Code: 1043, State: "08S01", Message: "Bad handshake"})
+		return err
+	}
+
+	s.mu.Lock()
+	password, ok := s.users[user]
+	retained, hasRetained := s.retained[user]
+	anyone := len(s.users) == 0
+	loginErr := s.loginErrs[user]
+	s.mu.Unlock()
+	if loginErr != nil {
+		pc.writeError(loginErr)
+		return loginErr
+	}
+	authenticated := ok && bytes.Equal(authResponse, scrambleNativePassword(scramble, password)) ||
+		hasRetained && bytes.Equal(authResponse, scrambleNativePassword(scramble, retained))
+	if !anyone && !authenticated {
+		err := &Error{Code: 1045, State: "28000", Message: fmt.Sprintf("Access denied for user '%s'@'localhost' (using password: YES)", user)}
+		pc.writeError(err)
+		return err
+	}
+	return pc.writeOK(0)
+}
+
+// parseHandshakeResponse returns the user name and the auth response in HandshakeResponse41.
+func parseHandshakeResponse(data []byte) (string, []byte, error) {
+	// capability flags(4), max packet size(4), character set(1), and filler(23)
+	if len(data) < 32 {
+		return "", nil, errors.New("short handshake response")
+	}
+	if binary.LittleEndian.Uint32(data)&clientProtocol41 == 0 {
+		return "", nil, errors.New("old protocol")
+	}
+	rest := data[32:]
+	user, rest, ok := bytes.Cut(rest, []byte{0})
+	if !ok || len(rest) == 0 {
+		return "", nil, errors.New("malformed handshake response")
+	}
+	n := int(rest[0])
+	if len(rest) < 1+n {
+		return "", nil, errors.New("malformed handshake response")
+	}
+	return string(user), rest[1 : 1+n], nil
+}
+
+// scrambleNativePassword returns SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password))).
+func scrambleNativePassword(scramble []byte, password string) []byte {
+	if password == "" {
+		return nil
+	}
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	h := sha1.New()
+	h.Write(scramble)
+	h.Write(stage2[:])
+	ret := h.Sum(nil)
+	for i := range ret {
+		ret[i] ^= stage1[i]
+	}
+	return ret
+}
+
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func (s *Server) handleQuery(pc *packetConn, query string) error {
+	query = normalizeQuery(query)
+
+	s.mu.Lock()
+	s.queries = append(s.queries, query)
+	var handler Handler
+	var match []string
+	for i := len(s.routes) - 1; i >= 0; i-- {
+		if m := s.routes[i].re.FindStringSubmatch(query); m != nil {
+			handler = s.routes[i].handler
+			match = m
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if handler == nil {
+		return pc.writeError(NewError(1064, "mysqltest: no handler for %q", query))
+	}
+	res, err := handler(query, match)
+	if err != nil {
+		var merr *Error
+		if !errors.As(err, &merr) {
+			merr = NewError(1105, "%v", err)
+		}
+		return pc.writeError(merr)
+	}
+	if res == nil || len(res.Columns) == 0 {
+		var affected uint64
+		if res != nil {
+			affected = res.AffectedRows
+		}
+		return pc.writeOK(affected)
+	}
+	return pc.writeResult(res)
+}
+
+// packetConn reads and writes packets of the client/server protocol.
+type packetConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	seq  byte
+}
+
+// bufferedConn is net.Conn reading from the buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func newPacketConn(c net.Conn) *packetConn {
+	return &packetConn{conn: c, r: bufio.NewReader(c)}
+}
+
+func (pc *packetConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(pc.r, header[:]); err != nil {
+			return nil, err
+		}
+		n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		pc.seq = header[3] + 1
+
+		data := make([]byte, n)
+		if _, err := io.ReadFull(pc.r, data); err != nil {
+			return nil, err
+		}
+		payload = append(payload, data...)
+		if n < 0xffffff {
+			return payload, nil
+		}
+	}
+}
+
+func (pc *packetConn) writePacket(payload []byte) error {
+	for {
+		n := min(len(payload), 0xffffff)
+		header := []byte{byte(n), byte(n >> 8), byte(n >> 16), pc.seq}
+		pc.seq++
+		if _, err := pc.conn.Write(append(header, payload[:n]...)); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if n < 0xffffff {
+			return nil
+		}
+	}
+}
+
+func (pc *packetConn) writeOK(affected uint64) error {
+	b := []byte{0x00}
+	b = appendLengthEncodedInt(b, affected)
+	b = appendLengthEncodedInt(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, serverStatusAutocommit)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	return pc.writePacket(b)
+}
+
+func (pc *packetConn) writeEOF() error {
+	b := []byte{0xfe, 0, 0}
+	b = binary.LittleEndian.AppendUint16(b, serverStatusAutocommit)
+	return pc.writePacket(b)
+}
+
+func (pc *packetConn) writeError(e *Error) error {
+	b := []byte{0xff}
+	b = binary.LittleEndian.AppendUint16(b, e.Code)
+	state := e.State
+	if len(state) != 5 {
+		state = "HY000"
+	}
+	b = append(b, '#')
+	b = append(b, state...)
+	b = append(b, e.Message...)
+	return pc.writePacket(b)
+}
+
+func (pc *packetConn) writeResult(res *Result) error {
+	if err := pc.writePacket(appendLengthEncodedInt(nil, uint64(len(res.Columns)))); err != nil {
+		return err
+	}
+	for i, name := range res.Columns {
+		if err := pc.writePacket(columnDefinition(name, columnType(res.Rows, i))); err != nil {
+			return err
+		}
+	}
+	if err := pc.writeEOF(); err != nil {
+		return err
+	}
+	for _, row := range res.Rows {
+		var b []byte
+		for i := range res.Columns {
+			var v any
+			if i < len(row) {
+				v = row[i]
+			}
+			if v == nil {
+				b = append(b, 0xfb)
+				continue
+			}
+			b = appendLengthEncodedString(b, formatValue(v))
+		}
+		if err := pc.writePacket(b); err != nil {
+			return err
+		}
+	}
+	return pc.writeEOF()
+}
+
+func appendLengthEncodedInt(b []byte, n uint64) []byte {
+	switch {
+	case n < 251:
+		return append(b, byte(n))
+	case n < 1<<16:
+		return append(b, 0xfc, byte(n), byte(n>>8))
+	case n < 1<<24:
+		return append(b, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return binary.LittleEndian.AppendUint64(append(b, 0xfe), n)
+}
+
+func appendLengthEncodedString(b []byte, s string) []byte {
+	return append(appendLengthEncodedInt(b, uint64(len(s))), s...)
+}
@@ -0,0 +1,107 @@
+package mysqltest_test
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/mysqltest"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func connect(addr, user, password string) (*sqlx.DB, error) {
+	conf := mysql.NewConfig()
+	conf.User = user
+	conf.Passwd = password
+	conf.Net = "tcp"
+	conf.Addr = addr
+	conf.InterpolateParams = true
+	conf.ParseTime = true
+	return sqlx.Connect("mysql", conf.FormatDSN())
+}
+
+var _ = Describe("Server", func() {
+	var s *mysqltest.Server
+	var addr string
+
+	BeforeEach(func() {
+		s = mysqltest.NewServer()
+		a, err := s.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		addr = a.String()
+		DeferCleanup(s.Close)
+	})
+
+	It("should authenticate users", func() {
+		s.AddUser("moco-agent", "password")
+
+		db, err := connect(addr, "moco-agent", "password")
+		Expect(err).NotTo(HaveOccurred())
+		db.Close()
+
+		_, err = connect(addr, "moco-agent", "wrong")
+		var merr *mysql.MySQLError
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Number).To(BeNumerically("==", 1045))
+	})
+
+	It("should return scripted results", func() {
+		now := time.Date(2026, 1, 2, 3, 4, 5, 678000000, time.UTC)
+		s.Respond(`SELECT \* FROM t WHERE id = (\d+)`, &mysqltest.Result{
+			Columns: []string{"id", "name", "created", "deleted", "enabled"},
+			Rows:    [][]any{{1, "foo", now, nil, true}},
+		})
+		s.Handle(`UPDATE t SET name = '(\w+)'`, func(_ string, m []string) (*mysqltest.Result, error) {
+			return &mysqltest.Result{AffectedRows: uint64(len(m[1]))}, nil
+		})
+
+		db, err := connect(addr, "user", "")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		var row struct {
+			ID      int64          `db:"id"`
+			Name    string         `db:"name"`
+			Created time.Time      `db:"created"`
+			Deleted sql.NullString `db:"deleted"`
+			Enabled bool           `db:"enabled"`
+		}
+		Expect(db.Get(&row, "SELECT *\n  FROM t WHERE id = ?", 1)).To(Succeed())
+		Expect(row.ID).To(Equal(int64(1)))
+		Expect(row.Name).To(Equal("foo"))
+		Expect(row.Created.Equal(now)).To(BeTrue())
+		Expect(row.Deleted.Valid).To(BeFalse())
+		Expect(row.Enabled).To(BeTrue())
+
+		res, err := db.Exec("UPDATE t SET name = ?", "bar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RowsAffected()).To(BeNumerically("==", 3))
+
+		Expect(s.Queries()).To(Equal([]string{"SELECT * FROM t WHERE id = 1", "UPDATE t SET name = 'bar'"}))
+	})
+
+	It("should return errors", func() {
+		db, err := connect(addr, "user", "")
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		var merr *mysql.MySQLError
+		_, err = db.Exec("DROP TABLE t")
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Number).To(BeNumerically("==", 1064))
+
+		s.Respond(`DROP TABLE t`, nil)
+		s.Fail(`DROP TABLE t`, mysqltest.NewError(1051, "Unknown table 't'"))
+		_, err = db.Exec("DROP TABLE t")
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Number).To(BeNumerically("==", 1051))
+
+		s.Remove(`DROP TABLE t`)
+		_, err = db.Exec("DROP TABLE t")
+		Expect(errors.As(err, &merr)).To(BeTrue())
+		Expect(merr.Number).To(BeNumerically("==", 1064))
+	})
+})
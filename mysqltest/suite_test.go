@@ -0,0 +1,21 @@
+package mysqltest_test
+
+import (
+	"testing"
+
+	"github.com/cybozu-go/moco-agent/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMySQLTest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MySQLTest Suite")
+}
+
+var registry = prometheus.NewRegistry()
+
+var _ = BeforeSuite(func() {
+	metrics.Init(registry, "test", 0)
+})
@@ -0,0 +1,160 @@
+package mysqltest_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/cert"
+	"github.com/cybozu-go/moco-agent/mysqltest"
+	"github.com/cybozu-go/moco-agent/server"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	c, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return &testCA{cert: c, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue returns a certificate for 127.0.0.1 and its private key in PEM format.
+func (ca *testCA) issue(name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// serverTLSConfig returns the TLS configuration of mysqld with a certificate issued by `ca`
+// that accepts client certificates issued by `clientCA`.
+func serverTLSConfig(ca, clientCA *testCA) *tls.Config {
+	certPEM, keyPEM := ca.issue("mysqld", x509.ExtKeyUsageServerAuth)
+	c, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).NotTo(HaveOccurred())
+	return &tls.Config{
+		Certificates: []tls.Certificate{c},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCA.pool(),
+	}
+}
+
+func probeMessage(handler http.HandlerFunc) (int, string) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://localhost/", nil))
+	return rec.Code, rec.Body.String()
+}
+
+var _ = Describe("TLS", func() {
+	It("should let moco-agent connect with TLS and report TLS failures", func() {
+		ca := newTestCA("ca")
+		inst := mysqltest.NewInstance()
+		DeferCleanup(inst.Close)
+		inst.SetTLSConfig(serverTLSConfig(ca, ca))
+		addr, err := inst.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		certDir := GinkgoT().TempDir()
+		certPEM, keyPEM := ca.issue("moco-agent", x509.ExtKeyUsageClientAuth)
+		Expect(os.WriteFile(filepath.Join(certDir, "ca.crt"), ca.pem, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(certDir, "tls.crt"), certPEM, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(certDir, "tls.key"), keyPEM, 0600)).To(Succeed())
+		reloader, err := cert.NewReloader(certDir, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+
+		conf := server.MySQLAccessorConfig{
+			Host:              "127.0.0.1",
+			Port:              addr.(*net.TCPAddr).Port,
+			Password:          "password",
+			ConnMaxIdleTime:   time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			TLSConfig:         reloader.TLSClientConfig,
+			RequireTLS:        true,
+		}
+		agent, err := server.New(conf, "test", "", "", 5*time.Second, time.Second, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(agent.CloseDB)
+
+		Expect(probe(agent.MySQLDHealth)).To(Equal(http.StatusOK))
+		Expect(inst.TLSConnections()).To(BeNumerically(">", 0))
+
+		By("replacing the certificate of mysqld with one issued by another CA")
+		otherCA := newTestCA("other-ca")
+		inst.SetTLSConfig(serverTLSConfig(otherCA, ca))
+		inst.Disconnect()
+		code, msg := probeMessage(agent.MySQLDHealth)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(msg).To(ContainSubstring("failed to verify the certificate of mysqld"))
+		code, msg = probeMessage(agent.MySQLDReady)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(msg).To(ContainSubstring("failed to verify the certificate of mysqld"))
+
+		By("making mysqld reject the certificate of moco-agent")
+		// With TLS 1.3, the client certificate is verified after the handshake completes on the client side.
+		tlsConfig := serverTLSConfig(ca, otherCA)
+		tlsConfig.MaxVersion = tls.VersionTLS12
+		inst.SetTLSConfig(tlsConfig)
+		inst.Disconnect()
+		code, msg = probeMessage(agent.MySQLDHealth)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(msg).To(ContainSubstring("mysqld rejected the TLS connection"))
+
+		By("disabling TLS of mysqld")
+		inst.SetTLSConfig(nil)
+		inst.Disconnect()
+		code, msg = probeMessage(agent.MySQLDHealth)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(msg).To(ContainSubstring("mysqld does not support TLS"))
+	})
+})
@@ -0,0 +1,90 @@
+package mysqltest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Column types of the client/server protocol.
+const (
+	typeDouble     = 0x05
+	typeLongLong   = 0x08
+	typeDatetime   = 0x0c
+	typeVarString  = 0xfd
+	flagBinary     = 0x0080
+	datetimeFormat = "2006-01-02 15:04:05.000000"
+)
+
+// columnType returns the type of the i-th column decided by the first non-nil value.
+func columnType(rows [][]any, i int) byte {
+	for _, row := range rows {
+		if i >= len(row) || row[i] == nil {
+			continue
+		}
+		switch row[i].(type) {
+		case int, int64, uint64, bool:
+			return typeLongLong
+		case float64:
+			return typeDouble
+		case time.Time:
+			return typeDatetime
+		}
+		return typeVarString
+	}
+	return typeVarString
+}
+
+func columnDefinition(name string, typ byte) []byte {
+	var b []byte
+	for _, s := range []string{"def", "", "", "", name, name} {
+		b = appendLengthEncodedString(b, s)
+	}
+	b = append(b, 0x0c)
+	charset := uint16(charsetUTF8MB4)
+	var flags uint16
+	if typ != typeVarString {
+		charset = charsetBinary
+		flags = flagBinary
+	}
+	b = binary.LittleEndian.AppendUint16(b, charset)
+	b = binary.LittleEndian.AppendUint32(b, 1024)
+	b = append(b, typ)
+	b = binary.LittleEndian.AppendUint16(b, flags)
+	if typ == typeDatetime {
+		b = append(b, 6)
+	} else {
+		b = append(b, 0)
+	}
+	return append(b, 0, 0)
+}
+
+// formatValue returns the text representation of `v` in the text protocol.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return "0000-00-00 00:00:00.000000"
+		}
+		return v.UTC().Format(datetimeFormat)
+	}
+	return fmt.Sprint(v)
+}
@@ -10,6 +10,7 @@ import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -25,16 +26,27 @@ const (
 // *
 // CloneRequest is the request message to invoke MySQL CLONE command.
 type CloneRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`                                     // host is the donor host in the own cluster
-	Port          int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`                                    // port is the port number where the donor host
-	User          string                 `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`                                     // user is the MySQL user who has BACKUP_ADMIN privilege in the donor host.
-	Password      string                 `protobuf:"bytes,4,opt,name=password,proto3" json:"password,omitempty"`                             // password for the above user.
-	InitUser      string                 `protobuf:"bytes,5,opt,name=init_user,json=initUser,proto3" json:"init_user,omitempty"`             // localhost user to initialize cloned database for MOCO.
-	InitPassword  string                 `protobuf:"bytes,6,opt,name=init_password,json=initPassword,proto3" json:"init_password,omitempty"` // password for init_user.
-	BootTimeout   *durationpb.Duration   `protobuf:"bytes,7,opt,name=boot_timeout,json=bootTimeout,proto3" json:"boot_timeout,omitempty"`    // wait up to this duration for mysqld to boot after clone.
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state             protoimpl.MessageState      `protogen:"open.v1"`
+	Host              string                      `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`                                                      // host is the donor host in the own cluster
+	Port              int32                       `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`                                                     // port is the port number where the donor host
+	User              string                      `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`                                                      // user is the MySQL user who has BACKUP_ADMIN privilege in the donor host.
+	Password          string                      `protobuf:"bytes,4,opt,name=password,proto3" json:"password,omitempty"`                                              // password for the above user.
+	InitUser          string                      `protobuf:"bytes,5,opt,name=init_user,json=initUser,proto3" json:"init_user,omitempty"`                              // localhost user to initialize cloned database for MOCO.
+	InitPassword      string                      `protobuf:"bytes,6,opt,name=init_password,json=initPassword,proto3" json:"init_password,omitempty"`                  // password for init_user.
+	BootTimeout       *durationpb.Duration        `protobuf:"bytes,7,opt,name=boot_timeout,json=bootTimeout,proto3" json:"boot_timeout,omitempty"`                     // wait up to this duration for mysqld to boot after clone.
+	Recovery          *PointInTimeRecoveryRequest `protobuf:"bytes,8,opt,name=recovery,proto3" json:"recovery,omitempty"`                                              // if set, roll forward the cloned database after initialization.
+	DryRun            bool                        `protobuf:"varint,9,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`                                   // if true, run only the preflight checks.
+	MaxDataBandwidth  int32                       `protobuf:"varint,10,opt,name=max_data_bandwidth,json=maxDataBandwidth,proto3" json:"max_data_bandwidth,omitempty"`  // clone_max_data_bandwidth in MiB per second.  0 means unlimited.
+	MaxConcurrency    int32                       `protobuf:"varint,11,opt,name=max_concurrency,json=maxConcurrency,proto3" json:"max_concurrency,omitempty"`          // clone_max_concurrency.  0 means the current value.
+	EnableCompression bool                        `protobuf:"varint,12,opt,name=enable_compression,json=enableCompression,proto3" json:"enable_compression,omitempty"` // if true, set clone_enable_compression to ON.
+	SslCa             string                      `protobuf:"bytes,13,opt,name=ssl_ca,json=sslCa,proto3" json:"ssl_ca,omitempty"`                                      // clone_ssl_ca; path of the CA certificate file on the recipient.
+	SslCert           string                      `protobuf:"bytes,14,opt,name=ssl_cert,json=sslCert,proto3" json:"ssl_cert,omitempty"`                                // clone_ssl_cert; path of the client certificate file on the recipient.
+	SslKey            string                      `protobuf:"bytes,15,opt,name=ssl_key,json=sslKey,proto3" json:"ssl_key,omitempty"`                                   // clone_ssl_key; path of the client private key file on the recipient.
+	RequireSsl        bool                        `protobuf:"varint,16,opt,name=require_ssl,json=requireSsl,proto3" json:"require_ssl,omitempty"`                      // if true, clone with REQUIRE SSL.  Implied if any of ssl_ca, ssl_cert, or ssl_key is set.
+	MaxAttempts       int32                       `protobuf:"varint,17,opt,name=max_attempts,json=maxAttempts,proto3" json:"max_attempts,omitempty"`                   // maximum number of CLONE INSTANCE attempts for retryable errors.  Defaults to 1.
+	Candidates        []*CloneDonor               `protobuf:"bytes,18,rep,name=candidates,proto3" json:"candidates,omitempty"`                                         // candidate donors.  If specified, host and port are ignored.
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
 }
 
 func (x *CloneRequest) Reset() {
@@ -116,17 +128,151 @@ func (x *CloneRequest) GetBootTimeout() *durationpb.Duration {
 	return nil
 }
 
+func (x *CloneRequest) GetRecovery() *PointInTimeRecoveryRequest {
+	if x != nil {
+		return x.Recovery
+	}
+	return nil
+}
+
+func (x *CloneRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *CloneRequest) GetMaxDataBandwidth() int32 {
+	if x != nil {
+		return x.MaxDataBandwidth
+	}
+	return 0
+}
+
+func (x *CloneRequest) GetMaxConcurrency() int32 {
+	if x != nil {
+		return x.MaxConcurrency
+	}
+	return 0
+}
+
+func (x *CloneRequest) GetEnableCompression() bool {
+	if x != nil {
+		return x.EnableCompression
+	}
+	return false
+}
+
+func (x *CloneRequest) GetSslCa() string {
+	if x != nil {
+		return x.SslCa
+	}
+	return ""
+}
+
+func (x *CloneRequest) GetSslCert() string {
+	if x != nil {
+		return x.SslCert
+	}
+	return ""
+}
+
+func (x *CloneRequest) GetSslKey() string {
+	if x != nil {
+		return x.SslKey
+	}
+	return ""
+}
+
+func (x *CloneRequest) GetRequireSsl() bool {
+	if x != nil {
+		return x.RequireSsl
+	}
+	return false
+}
+
+func (x *CloneRequest) GetMaxAttempts() int32 {
+	if x != nil {
+		return x.MaxAttempts
+	}
+	return 0
+}
+
+func (x *CloneRequest) GetCandidates() []*CloneDonor {
+	if x != nil {
+		return x.Candidates
+	}
+	return nil
+}
+
+// *
+// CloneDonor is a candidate donor of Clone.
+type CloneDonor struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`  // host of the donor.
+	Port          int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"` // port number of the donor.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloneDonor) Reset() {
+	*x = CloneDonor{}
+	mi := &file_proto_agentrpc_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloneDonor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloneDonor) ProtoMessage() {}
+
+func (x *CloneDonor) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloneDonor.ProtoReflect.Descriptor instead.
+func (*CloneDonor) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CloneDonor) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *CloneDonor) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
 // *
 // CloneResponse is the response message of Clone.
 type CloneResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	DonorHost     string                 `protobuf:"bytes,1,opt,name=donor_host,json=donorHost,proto3" json:"donor_host,omitempty"`  // host of the donor actually cloned from.
+	DonorPort     int32                  `protobuf:"varint,2,opt,name=donor_port,json=donorPort,proto3" json:"donor_port,omitempty"` // port number of the donor actually cloned from.
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`                         // why the donor was chosen.
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *CloneResponse) Reset() {
 	*x = CloneResponse{}
-	mi := &file_proto_agentrpc_proto_msgTypes[1]
+	mi := &file_proto_agentrpc_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -138,7 +284,7 @@ func (x *CloneResponse) String() string {
 func (*CloneResponse) ProtoMessage() {}
 
 func (x *CloneResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_agentrpc_proto_msgTypes[1]
+	mi := &file_proto_agentrpc_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -151,25 +297,2155 @@ func (x *CloneResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CloneResponse.ProtoReflect.Descriptor instead.
 func (*CloneResponse) Descriptor() ([]byte, []int) {
-	return file_proto_agentrpc_proto_rawDescGZIP(), []int{1}
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{2}
 }
 
-var File_proto_agentrpc_proto protoreflect.FileDescriptor
+func (x *CloneResponse) GetDonorHost() string {
+	if x != nil {
+		return x.DonorHost
+	}
+	return ""
+}
 
-const file_proto_agentrpc_proto_rawDesc = "" +
-	"\n" +
-	"\x14proto/agentrpc.proto\x12\x04moco\x1a\x1egoogle/protobuf/duration.proto\"\xe6\x01\n" +
-	"\fCloneRequest\x12\x12\n" +
-	"\x04host\x18\x01 \x01(\tR\x04host\x12\x12\n" +
-	"\x04port\x18\x02 \x01(\x05R\x04port\x12\x12\n" +
-	"\x04user\x18\x03 \x01(\tR\x04user\x12\x1a\n" +
-	"\bpassword\x18\x04 \x01(\tR\bpassword\x12\x1b\n" +
-	"\tinit_user\x18\x05 \x01(\tR\binitUser\x12#\n" +
-	"\rinit_password\x18\x06 \x01(\tR\finitPassword\x12<\n" +
-	"\fboot_timeout\x18\a \x01(\v2\x19.google.protobuf.DurationR\vbootTimeout\"\x0f\n" +
-	"\rCloneResponse29\n" +
-	"\x05Agent\x120\n" +
-	"\x05Clone\x12\x12.moco.CloneRequest\x1a\x13.moco.CloneResponseB'Z%github.com/cybozu-go/moco-agent/protob\x06proto3"
+func (x *CloneResponse) GetDonorPort() int32 {
+	if x != nil {
+		return x.DonorPort
+	}
+	return 0
+}
+
+func (x *CloneResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// *
+// GetCloneStatusRequest is the request message to get the status of the last Clone.
+type GetCloneStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCloneStatusRequest) Reset() {
+	*x = GetCloneStatusRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCloneStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCloneStatusRequest) ProtoMessage() {}
+
+func (x *GetCloneStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCloneStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetCloneStatusRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{3}
+}
+
+// *
+// CloneAttempt is an attempt of CLONE INSTANCE.
+type CloneAttempt struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Attempt       int32                  `protobuf:"varint,1,opt,name=attempt,proto3" json:"attempt,omitempty"`                     // 1-origin number of the attempt.
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"` // time when the attempt started.
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`       // time when the attempt finished.  Unset while running.
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`                          // error of the attempt.  Empty if succeeded or running.
+	Retryable     bool                   `protobuf:"varint,5,opt,name=retryable,proto3" json:"retryable,omitempty"`                 // true if the error is retryable.
+	Donor         string                 `protobuf:"bytes,6,opt,name=donor,proto3" json:"donor,omitempty"`                          // address of the donor.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloneAttempt) Reset() {
+	*x = CloneAttempt{}
+	mi := &file_proto_agentrpc_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloneAttempt) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloneAttempt) ProtoMessage() {}
+
+func (x *CloneAttempt) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloneAttempt.ProtoReflect.Descriptor instead.
+func (*CloneAttempt) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CloneAttempt) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *CloneAttempt) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *CloneAttempt) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *CloneAttempt) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CloneAttempt) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *CloneAttempt) GetDonor() string {
+	if x != nil {
+		return x.Donor
+	}
+	return ""
+}
+
+// *
+// GetCloneStatusResponse is the status of the last Clone.
+type GetCloneStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         string                 `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`                          // "running", "succeeded", or "failed".  Empty if Clone has never been called.
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"` // time when Clone started.
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`       // time when Clone finished.  Unset while running.
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`                          // error of Clone if failed.
+	Attempts      []*CloneAttempt        `protobuf:"bytes,5,rep,name=attempts,proto3" json:"attempts,omitempty"`                    // attempts of CLONE INSTANCE.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCloneStatusResponse) Reset() {
+	*x = GetCloneStatusResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCloneStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCloneStatusResponse) ProtoMessage() {}
+
+func (x *GetCloneStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCloneStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetCloneStatusResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetCloneStatusResponse) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *GetCloneStatusResponse) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *GetCloneStatusResponse) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *GetCloneStatusResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *GetCloneStatusResponse) GetAttempts() []*CloneAttempt {
+	if x != nil {
+		return x.Attempts
+	}
+	return nil
+}
+
+// *
+// PurgeBinaryLogsRequest is the request message to purge binary logs.
+//
+// At least one of the constraints must be specified.  When multiple constraints
+// are specified, binary logs are purged only up to the point that satisfies all of them.
+type PurgeBinaryLogsRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ReplicaGtidSets []string               `protobuf:"bytes,1,rep,name=replica_gtid_sets,json=replicaGtidSets,proto3" json:"replica_gtid_sets,omitempty"` // executed GTID sets of replicas.  Binary logs containing GTIDs missing in any of them are kept.
+	MinRetention    *durationpb.Duration   `protobuf:"bytes,2,opt,name=min_retention,json=minRetention,proto3" json:"min_retention,omitempty"`            // binary logs written within this duration are kept.
+	ToFile          string                 `protobuf:"bytes,3,opt,name=to_file,json=toFile,proto3" json:"to_file,omitempty"`                              // if not empty, binary logs before this file can be purged.
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *PurgeBinaryLogsRequest) Reset() {
+	*x = PurgeBinaryLogsRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgeBinaryLogsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgeBinaryLogsRequest) ProtoMessage() {}
+
+func (x *PurgeBinaryLogsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgeBinaryLogsRequest.ProtoReflect.Descriptor instead.
+func (*PurgeBinaryLogsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PurgeBinaryLogsRequest) GetReplicaGtidSets() []string {
+	if x != nil {
+		return x.ReplicaGtidSets
+	}
+	return nil
+}
+
+func (x *PurgeBinaryLogsRequest) GetMinRetention() *durationpb.Duration {
+	if x != nil {
+		return x.MinRetention
+	}
+	return nil
+}
+
+func (x *PurgeBinaryLogsRequest) GetToFile() string {
+	if x != nil {
+		return x.ToFile
+	}
+	return ""
+}
+
+// *
+// PurgeBinaryLogsResponse is the response message of PurgeBinaryLogs.
+type PurgeBinaryLogsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PurgedFiles   []string               `protobuf:"bytes,1,rep,name=purged_files,json=purgedFiles,proto3" json:"purged_files,omitempty"` // names of the purged binary log files.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurgeBinaryLogsResponse) Reset() {
+	*x = PurgeBinaryLogsResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgeBinaryLogsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgeBinaryLogsResponse) ProtoMessage() {}
+
+func (x *PurgeBinaryLogsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgeBinaryLogsResponse.ProtoReflect.Descriptor instead.
+func (*PurgeBinaryLogsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PurgeBinaryLogsResponse) GetPurgedFiles() []string {
+	if x != nil {
+		return x.PurgedFiles
+	}
+	return nil
+}
+
+// *
+// PointInTimeRecoveryRequest is the request message to roll forward the database
+// by replaying archived binary logs.
+//
+// Exactly one of target_time and target_gtid_set must be specified.
+type PointInTimeRecoveryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ArchiveUrl    string                 `protobuf:"bytes,1,opt,name=archive_url,json=archiveUrl,proto3" json:"archive_url,omitempty"`            // URL of the binary log archive.  If empty, the archive of the agent is used.
+	TargetTime    *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=target_time,json=targetTime,proto3" json:"target_time,omitempty"`            // transactions started after this time are not applied.
+	TargetGtidSet string                 `protobuf:"bytes,3,opt,name=target_gtid_set,json=targetGtidSet,proto3" json:"target_gtid_set,omitempty"` // transactions in this GTID set are applied.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PointInTimeRecoveryRequest) Reset() {
+	*x = PointInTimeRecoveryRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PointInTimeRecoveryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PointInTimeRecoveryRequest) ProtoMessage() {}
+
+func (x *PointInTimeRecoveryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PointInTimeRecoveryRequest.ProtoReflect.Descriptor instead.
+func (*PointInTimeRecoveryRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PointInTimeRecoveryRequest) GetArchiveUrl() string {
+	if x != nil {
+		return x.ArchiveUrl
+	}
+	return ""
+}
+
+func (x *PointInTimeRecoveryRequest) GetTargetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.TargetTime
+	}
+	return nil
+}
+
+func (x *PointInTimeRecoveryRequest) GetTargetGtidSet() string {
+	if x != nil {
+		return x.TargetGtidSet
+	}
+	return ""
+}
+
+// *
+// PointInTimeRecoveryResponse is the progress of PointInTimeRecovery.
+type PointInTimeRecoveryResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Phase           string                 `protobuf:"bytes,1,opt,name=phase,proto3" json:"phase,omitempty"`                                              // one of "fetching", "applying", or "completed".
+	FetchedFiles    int32                  `protobuf:"varint,2,opt,name=fetched_files,json=fetchedFiles,proto3" json:"fetched_files,omitempty"`           // number of binary log files fetched from the archive.
+	TotalFiles      int32                  `protobuf:"varint,3,opt,name=total_files,json=totalFiles,proto3" json:"total_files,omitempty"`                 // number of binary log files to be replayed.
+	ExecutedGtidSet string                 `protobuf:"bytes,4,opt,name=executed_gtid_set,json=executedGtidSet,proto3" json:"executed_gtid_set,omitempty"` // the current value of gtid_executed.
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *PointInTimeRecoveryResponse) Reset() {
+	*x = PointInTimeRecoveryResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PointInTimeRecoveryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PointInTimeRecoveryResponse) ProtoMessage() {}
+
+func (x *PointInTimeRecoveryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PointInTimeRecoveryResponse.ProtoReflect.Descriptor instead.
+func (*PointInTimeRecoveryResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *PointInTimeRecoveryResponse) GetPhase() string {
+	if x != nil {
+		return x.Phase
+	}
+	return ""
+}
+
+func (x *PointInTimeRecoveryResponse) GetFetchedFiles() int32 {
+	if x != nil {
+		return x.FetchedFiles
+	}
+	return 0
+}
+
+func (x *PointInTimeRecoveryResponse) GetTotalFiles() int32 {
+	if x != nil {
+		return x.TotalFiles
+	}
+	return 0
+}
+
+func (x *PointInTimeRecoveryResponse) GetExecutedGtidSet() string {
+	if x != nil {
+		return x.ExecutedGtidSet
+	}
+	return ""
+}
+
+// *
+// BootstrapReplicaRequest is the request message to bootstrap a replica.
+type BootstrapReplicaRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Clone          *CloneRequest          `protobuf:"bytes,1,opt,name=clone,proto3" json:"clone,omitempty"`                                           // parameters of Clone.  dry_run must not be set.
+	SourceHost     string                 `protobuf:"bytes,2,opt,name=source_host,json=sourceHost,proto3" json:"source_host,omitempty"`               // host of the replication source.  Defaults to the donor actually cloned from.
+	SourcePort     int32                  `protobuf:"varint,3,opt,name=source_port,json=sourcePort,proto3" json:"source_port,omitempty"`              // port number of the replication source.  Defaults to the donor actually cloned from.
+	SourceUser     string                 `protobuf:"bytes,4,opt,name=source_user,json=sourceUser,proto3" json:"source_user,omitempty"`               // user for the replication.
+	SourcePassword string                 `protobuf:"bytes,5,opt,name=source_password,json=sourcePassword,proto3" json:"source_password,omitempty"`   // password of source_user.
+	SourceSsl      bool                   `protobuf:"varint,6,opt,name=source_ssl,json=sourceSsl,proto3" json:"source_ssl,omitempty"`                 // if true, replicate with SOURCE_SSL=1.
+	MaxLag         *durationpb.Duration   `protobuf:"bytes,7,opt,name=max_lag,json=maxLag,proto3" json:"max_lag,omitempty"`                           // replication lag regarded as caught up.  Defaults to 1 second.
+	CatchUpTimeout *durationpb.Duration   `protobuf:"bytes,8,opt,name=catch_up_timeout,json=catchUpTimeout,proto3" json:"catch_up_timeout,omitempty"` // time limit to catch up after starting the replication.  No limit if unset.
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *BootstrapReplicaRequest) Reset() {
+	*x = BootstrapReplicaRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BootstrapReplicaRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BootstrapReplicaRequest) ProtoMessage() {}
+
+func (x *BootstrapReplicaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BootstrapReplicaRequest.ProtoReflect.Descriptor instead.
+func (*BootstrapReplicaRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *BootstrapReplicaRequest) GetClone() *CloneRequest {
+	if x != nil {
+		return x.Clone
+	}
+	return nil
+}
+
+func (x *BootstrapReplicaRequest) GetSourceHost() string {
+	if x != nil {
+		return x.SourceHost
+	}
+	return ""
+}
+
+func (x *BootstrapReplicaRequest) GetSourcePort() int32 {
+	if x != nil {
+		return x.SourcePort
+	}
+	return 0
+}
+
+func (x *BootstrapReplicaRequest) GetSourceUser() string {
+	if x != nil {
+		return x.SourceUser
+	}
+	return ""
+}
+
+func (x *BootstrapReplicaRequest) GetSourcePassword() string {
+	if x != nil {
+		return x.SourcePassword
+	}
+	return ""
+}
+
+func (x *BootstrapReplicaRequest) GetSourceSsl() bool {
+	if x != nil {
+		return x.SourceSsl
+	}
+	return false
+}
+
+func (x *BootstrapReplicaRequest) GetMaxLag() *durationpb.Duration {
+	if x != nil {
+		return x.MaxLag
+	}
+	return nil
+}
+
+func (x *BootstrapReplicaRequest) GetCatchUpTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.CatchUpTimeout
+	}
+	return nil
+}
+
+// *
+// BootstrapReplicaResponse is the progress of BootstrapReplica.
+type BootstrapReplicaResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Phase         string                 `protobuf:"bytes,1,opt,name=phase,proto3" json:"phase,omitempty"`                              // one of "cloned", "replication_configured", "replication_started", "catching_up", or "completed".
+	DonorHost     string                 `protobuf:"bytes,2,opt,name=donor_host,json=donorHost,proto3" json:"donor_host,omitempty"`     // host of the donor actually cloned from.
+	DonorPort     int32                  `protobuf:"varint,3,opt,name=donor_port,json=donorPort,proto3" json:"donor_port,omitempty"`    // port number of the donor actually cloned from.
+	SourceHost    string                 `protobuf:"bytes,4,opt,name=source_host,json=sourceHost,proto3" json:"source_host,omitempty"`  // host of the replication source.
+	SourcePort    int32                  `protobuf:"varint,5,opt,name=source_port,json=sourcePort,proto3" json:"source_port,omitempty"` // port number of the replication source.
+	Lag           *durationpb.Duration   `protobuf:"bytes,6,opt,name=lag,proto3" json:"lag,omitempty"`                                  // the current replication lag.  Set in "catching_up" and "completed".
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BootstrapReplicaResponse) Reset() {
+	*x = BootstrapReplicaResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BootstrapReplicaResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BootstrapReplicaResponse) ProtoMessage() {}
+
+func (x *BootstrapReplicaResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BootstrapReplicaResponse.ProtoReflect.Descriptor instead.
+func (*BootstrapReplicaResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *BootstrapReplicaResponse) GetPhase() string {
+	if x != nil {
+		return x.Phase
+	}
+	return ""
+}
+
+func (x *BootstrapReplicaResponse) GetDonorHost() string {
+	if x != nil {
+		return x.DonorHost
+	}
+	return ""
+}
+
+func (x *BootstrapReplicaResponse) GetDonorPort() int32 {
+	if x != nil {
+		return x.DonorPort
+	}
+	return 0
+}
+
+func (x *BootstrapReplicaResponse) GetSourceHost() string {
+	if x != nil {
+		return x.SourceHost
+	}
+	return ""
+}
+
+func (x *BootstrapReplicaResponse) GetSourcePort() int32 {
+	if x != nil {
+		return x.SourcePort
+	}
+	return 0
+}
+
+func (x *BootstrapReplicaResponse) GetLag() *durationpb.Duration {
+	if x != nil {
+		return x.Lag
+	}
+	return nil
+}
+
+// *
+// StreamBinlogRequest is the request message to stream binary log events.
+//
+// If gtid_set is specified, file and position are ignored.
+type StreamBinlogRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`                                // binary log file to start from.  If empty, the oldest file is used.
+	Position      int64                  `protobuf:"varint,2,opt,name=position,proto3" json:"position,omitempty"`                       // position of the first event in file.  If 0, events are streamed from the beginning of file.
+	GtidSet       string                 `protobuf:"bytes,3,opt,name=gtid_set,json=gtidSet,proto3" json:"gtid_set,omitempty"`           // if specified, only transactions not in this GTID set are streamed.
+	DecodeRows    bool                   `protobuf:"varint,4,opt,name=decode_rows,json=decodeRows,proto3" json:"decode_rows,omitempty"` // if true, only row events are streamed in the decoded form.
+	Follow        bool                   `protobuf:"varint,5,opt,name=follow,proto3" json:"follow,omitempty"`                           // if true, wait for new events at the end of the binary logs.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamBinlogRequest) Reset() {
+	*x = StreamBinlogRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamBinlogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamBinlogRequest) ProtoMessage() {}
+
+func (x *StreamBinlogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamBinlogRequest.ProtoReflect.Descriptor instead.
+func (*StreamBinlogRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StreamBinlogRequest) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *StreamBinlogRequest) GetPosition() int64 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *StreamBinlogRequest) GetGtidSet() string {
+	if x != nil {
+		return x.GtidSet
+	}
+	return ""
+}
+
+func (x *StreamBinlogRequest) GetDecodeRows() bool {
+	if x != nil {
+		return x.DecodeRows
+	}
+	return false
+}
+
+func (x *StreamBinlogRequest) GetFollow() bool {
+	if x != nil {
+		return x.Follow
+	}
+	return false
+}
+
+// *
+// StreamBinlogResponse is a binary log event.
+type StreamBinlogResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`                                      // binary log file of the event.
+	Position      int64                  `protobuf:"varint,2,opt,name=position,proto3" json:"position,omitempty"`                             // position of the event.
+	NextPosition  int64                  `protobuf:"varint,3,opt,name=next_position,json=nextPosition,proto3" json:"next_position,omitempty"` // position of the next event.
+	EventType     uint32                 `protobuf:"varint,4,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`          // type code of the event.
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                            // timestamp of the event.
+	Gtid          string                 `protobuf:"bytes,6,opt,name=gtid,proto3" json:"gtid,omitempty"`                                      // GTID of the transaction that the event belongs to.
+	Raw           []byte                 `protobuf:"bytes,7,opt,name=raw,proto3" json:"raw,omitempty"`                                        // the event including the header and the checksum.  Empty if decode_rows is true.
+	Rows          *BinlogRowsEvent       `protobuf:"bytes,8,opt,name=rows,proto3" json:"rows,omitempty"`                                      // the decoded row event.  Set only if decode_rows is true.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamBinlogResponse) Reset() {
+	*x = StreamBinlogResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamBinlogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamBinlogResponse) ProtoMessage() {}
+
+func (x *StreamBinlogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamBinlogResponse.ProtoReflect.Descriptor instead.
+func (*StreamBinlogResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StreamBinlogResponse) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *StreamBinlogResponse) GetPosition() int64 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *StreamBinlogResponse) GetNextPosition() int64 {
+	if x != nil {
+		return x.NextPosition
+	}
+	return 0
+}
+
+func (x *StreamBinlogResponse) GetEventType() uint32 {
+	if x != nil {
+		return x.EventType
+	}
+	return 0
+}
+
+func (x *StreamBinlogResponse) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *StreamBinlogResponse) GetGtid() string {
+	if x != nil {
+		return x.Gtid
+	}
+	return ""
+}
+
+func (x *StreamBinlogResponse) GetRaw() []byte {
+	if x != nil {
+		return x.Raw
+	}
+	return nil
+}
+
+func (x *StreamBinlogResponse) GetRows() *BinlogRowsEvent {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+// *
+// BinlogRowsEvent is a decoded row event.
+type BinlogRowsEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Schema        string                 `protobuf:"bytes,1,opt,name=schema,proto3" json:"schema,omitempty"`   // schema name.
+	Table         string                 `protobuf:"bytes,2,opt,name=table,proto3" json:"table,omitempty"`     // table name.
+	Action        string                 `protobuf:"bytes,3,opt,name=action,proto3" json:"action,omitempty"`   // one of "insert", "update", or "delete".
+	Columns       []string               `protobuf:"bytes,4,rep,name=columns,proto3" json:"columns,omitempty"` // column names.  Available only if binlog_row_metadata is FULL.
+	Rows          []*BinlogRow           `protobuf:"bytes,5,rep,name=rows,proto3" json:"rows,omitempty"`       // changed rows.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BinlogRowsEvent) Reset() {
+	*x = BinlogRowsEvent{}
+	mi := &file_proto_agentrpc_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BinlogRowsEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BinlogRowsEvent) ProtoMessage() {}
+
+func (x *BinlogRowsEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BinlogRowsEvent.ProtoReflect.Descriptor instead.
+func (*BinlogRowsEvent) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *BinlogRowsEvent) GetSchema() string {
+	if x != nil {
+		return x.Schema
+	}
+	return ""
+}
+
+func (x *BinlogRowsEvent) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *BinlogRowsEvent) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *BinlogRowsEvent) GetColumns() []string {
+	if x != nil {
+		return x.Columns
+	}
+	return nil
+}
+
+func (x *BinlogRowsEvent) GetRows() []*BinlogRow {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+// *
+// BinlogRow is a row changed by a row event.
+type BinlogRow struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Before        []*BinlogValue         `protobuf:"bytes,1,rep,name=before,proto3" json:"before,omitempty"` // the row image before update or delete.
+	After         []*BinlogValue         `protobuf:"bytes,2,rep,name=after,proto3" json:"after,omitempty"`   // the row image after insert or update.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BinlogRow) Reset() {
+	*x = BinlogRow{}
+	mi := &file_proto_agentrpc_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BinlogRow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BinlogRow) ProtoMessage() {}
+
+func (x *BinlogRow) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BinlogRow.ProtoReflect.Descriptor instead.
+func (*BinlogRow) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *BinlogRow) GetBefore() []*BinlogValue {
+	if x != nil {
+		return x.Before
+	}
+	return nil
+}
+
+func (x *BinlogRow) GetAfter() []*BinlogValue {
+	if x != nil {
+		return x.After
+	}
+	return nil
+}
+
+// *
+// BinlogValue is a column value in a row image.
+type BinlogValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Null          bool                   `protobuf:"varint,1,opt,name=null,proto3" json:"null,omitempty"`     // true if the value is NULL.
+	Absent        bool                   `protobuf:"varint,2,opt,name=absent,proto3" json:"absent,omitempty"` // true if the column is not included in the row image.
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`      // textual representation of the value.  JSON values are in the MySQL binary JSON format.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BinlogValue) Reset() {
+	*x = BinlogValue{}
+	mi := &file_proto_agentrpc_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BinlogValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BinlogValue) ProtoMessage() {}
+
+func (x *BinlogValue) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BinlogValue.ProtoReflect.Descriptor instead.
+func (*BinlogValue) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *BinlogValue) GetNull() bool {
+	if x != nil {
+		return x.Null
+	}
+	return false
+}
+
+func (x *BinlogValue) GetAbsent() bool {
+	if x != nil {
+		return x.Absent
+	}
+	return false
+}
+
+func (x *BinlogValue) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// *
+// LogicalBackupRequest is the request message to take a logical backup.
+type LogicalBackupRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	IncludeSchemas []string               `protobuf:"bytes,1,rep,name=include_schemas,json=includeSchemas,proto3" json:"include_schemas,omitempty"` // schemas to be dumped.  If empty, all schemas except for system ones are dumped.
+	ExcludeSchemas []string               `protobuf:"bytes,2,rep,name=exclude_schemas,json=excludeSchemas,proto3" json:"exclude_schemas,omitempty"` // schemas not to be dumped.
+	Format         string                 `protobuf:"bytes,3,opt,name=format,proto3" json:"format,omitempty"`                                       // format of table data, "sql" or "csv".  Defaults to "sql".
+	Parallel       int32                  `protobuf:"varint,4,opt,name=parallel,proto3" json:"parallel,omitempty"`                                  // number of tables dumped in parallel.  Defaults to 1.
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *LogicalBackupRequest) Reset() {
+	*x = LogicalBackupRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogicalBackupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogicalBackupRequest) ProtoMessage() {}
+
+func (x *LogicalBackupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogicalBackupRequest.ProtoReflect.Descriptor instead.
+func (*LogicalBackupRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *LogicalBackupRequest) GetIncludeSchemas() []string {
+	if x != nil {
+		return x.IncludeSchemas
+	}
+	return nil
+}
+
+func (x *LogicalBackupRequest) GetExcludeSchemas() []string {
+	if x != nil {
+		return x.ExcludeSchemas
+	}
+	return nil
+}
+
+func (x *LogicalBackupRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *LogicalBackupRequest) GetParallel() int32 {
+	if x != nil {
+		return x.Parallel
+	}
+	return 0
+}
+
+// *
+// LogicalBackupResponse is a chunk of a logical backup.
+//
+// The first response has only gtid_set, binlog_file, and binlog_position.
+// The following responses have chunks of gzip-compressed files.
+// Chunks of a file are sent in order, but chunks of different files may be interleaved.
+type LogicalBackupResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	GtidSet        string                 `protobuf:"bytes,1,opt,name=gtid_set,json=gtidSet,proto3" json:"gtid_set,omitempty"`                       // the executed GTID set at the snapshot.
+	BinlogFile     string                 `protobuf:"bytes,2,opt,name=binlog_file,json=binlogFile,proto3" json:"binlog_file,omitempty"`              // the binary log file at the snapshot.
+	BinlogPosition int64                  `protobuf:"varint,3,opt,name=binlog_position,json=binlogPosition,proto3" json:"binlog_position,omitempty"` // the binary log position at the snapshot.
+	File           string                 `protobuf:"bytes,4,opt,name=file,proto3" json:"file,omitempty"`                                            // name of the file such as `db1/t1.sql.gz`.
+	Data           []byte                 `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`                                            // a chunk of the file.
+	Eof            bool                   `protobuf:"varint,6,opt,name=eof,proto3" json:"eof,omitempty"`                                             // true if this is the last chunk of the file.
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *LogicalBackupResponse) Reset() {
+	*x = LogicalBackupResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogicalBackupResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogicalBackupResponse) ProtoMessage() {}
+
+func (x *LogicalBackupResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogicalBackupResponse.ProtoReflect.Descriptor instead.
+func (*LogicalBackupResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *LogicalBackupResponse) GetGtidSet() string {
+	if x != nil {
+		return x.GtidSet
+	}
+	return ""
+}
+
+func (x *LogicalBackupResponse) GetBinlogFile() string {
+	if x != nil {
+		return x.BinlogFile
+	}
+	return ""
+}
+
+func (x *LogicalBackupResponse) GetBinlogPosition() int64 {
+	if x != nil {
+		return x.BinlogPosition
+	}
+	return 0
+}
+
+func (x *LogicalBackupResponse) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *LogicalBackupResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *LogicalBackupResponse) GetEof() bool {
+	if x != nil {
+		return x.Eof
+	}
+	return false
+}
+
+// *
+// AcquireBackupLockRequest is the request message to acquire a backup lock.
+type AcquireBackupLockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mode          string                 `protobuf:"bytes,1,opt,name=mode,proto3" json:"mode,omitempty"` // "instance" for LOCK INSTANCE FOR BACKUP, or "flush_tables" for FLUSH TABLES WITH READ LOCK.  Defaults to "instance".
+	Ttl           *durationpb.Duration   `protobuf:"bytes,2,opt,name=ttl,proto3" json:"ttl,omitempty"`   // lease of the lock.  Defaults to 5 minutes.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AcquireBackupLockRequest) Reset() {
+	*x = AcquireBackupLockRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcquireBackupLockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcquireBackupLockRequest) ProtoMessage() {}
+
+func (x *AcquireBackupLockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcquireBackupLockRequest.ProtoReflect.Descriptor instead.
+func (*AcquireBackupLockRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *AcquireBackupLockRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *AcquireBackupLockRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+// *
+// AcquireBackupLockResponse is the response message of AcquireBackupLock.
+type AcquireBackupLockResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	LockId         string                 `protobuf:"bytes,1,opt,name=lock_id,json=lockId,proto3" json:"lock_id,omitempty"`                          // ID to release the lock.
+	GtidSet        string                 `protobuf:"bytes,2,opt,name=gtid_set,json=gtidSet,proto3" json:"gtid_set,omitempty"`                       // the executed GTID set under the lock; empty in the "instance" mode.
+	BinlogFile     string                 `protobuf:"bytes,3,opt,name=binlog_file,json=binlogFile,proto3" json:"binlog_file,omitempty"`              // the binary log file under the lock; empty in the "instance" mode.
+	BinlogPosition int64                  `protobuf:"varint,4,opt,name=binlog_position,json=binlogPosition,proto3" json:"binlog_position,omitempty"` // the binary log position under the lock; 0 in the "instance" mode.
+	ExpireTime     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=expire_time,json=expireTime,proto3" json:"expire_time,omitempty"`              // time when the lock is released automatically.
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *AcquireBackupLockResponse) Reset() {
+	*x = AcquireBackupLockResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcquireBackupLockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcquireBackupLockResponse) ProtoMessage() {}
+
+func (x *AcquireBackupLockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcquireBackupLockResponse.ProtoReflect.Descriptor instead.
+func (*AcquireBackupLockResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *AcquireBackupLockResponse) GetLockId() string {
+	if x != nil {
+		return x.LockId
+	}
+	return ""
+}
+
+func (x *AcquireBackupLockResponse) GetGtidSet() string {
+	if x != nil {
+		return x.GtidSet
+	}
+	return ""
+}
+
+func (x *AcquireBackupLockResponse) GetBinlogFile() string {
+	if x != nil {
+		return x.BinlogFile
+	}
+	return ""
+}
+
+func (x *AcquireBackupLockResponse) GetBinlogPosition() int64 {
+	if x != nil {
+		return x.BinlogPosition
+	}
+	return 0
+}
+
+func (x *AcquireBackupLockResponse) GetExpireTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpireTime
+	}
+	return nil
+}
+
+// *
+// ReleaseBackupLockRequest is the request message to release a backup lock.
+type ReleaseBackupLockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LockId        string                 `protobuf:"bytes,1,opt,name=lock_id,json=lockId,proto3" json:"lock_id,omitempty"` // ID returned by AcquireBackupLock.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseBackupLockRequest) Reset() {
+	*x = ReleaseBackupLockRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseBackupLockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseBackupLockRequest) ProtoMessage() {}
+
+func (x *ReleaseBackupLockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseBackupLockRequest.ProtoReflect.Descriptor instead.
+func (*ReleaseBackupLockRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ReleaseBackupLockRequest) GetLockId() string {
+	if x != nil {
+		return x.LockId
+	}
+	return ""
+}
+
+// *
+// ReleaseBackupLockResponse is the response message of ReleaseBackupLock.
+type ReleaseBackupLockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseBackupLockResponse) Reset() {
+	*x = ReleaseBackupLockResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseBackupLockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseBackupLockResponse) ProtoMessage() {}
+
+func (x *ReleaseBackupLockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseBackupLockResponse.ProtoReflect.Descriptor instead.
+func (*ReleaseBackupLockResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{22}
+}
+
+// *
+// CloneLocalRequest is the request message to take a local snapshot.
+type CloneLocalRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keep          int32                  `protobuf:"varint,1,opt,name=keep,proto3" json:"keep,omitempty"` // number of snapshots to keep including the new one.  Defaults to the value of the agent flag.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloneLocalRequest) Reset() {
+	*x = CloneLocalRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloneLocalRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloneLocalRequest) ProtoMessage() {}
+
+func (x *CloneLocalRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloneLocalRequest.ProtoReflect.Descriptor instead.
+func (*CloneLocalRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *CloneLocalRequest) GetKeep() int32 {
+	if x != nil {
+		return x.Keep
+	}
+	return 0
+}
+
+// *
+// CloneLocalResponse is the response message of CloneLocal.
+type CloneLocalResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Path           string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`                                            // path of the snapshot directory.
+	SizeBytes      int64                  `protobuf:"varint,2,opt,name=size_bytes,json=sizeBytes,proto3" json:"size_bytes,omitempty"`                // total size of the files in the snapshot.
+	Duration       *durationpb.Duration   `protobuf:"bytes,3,opt,name=duration,proto3" json:"duration,omitempty"`                                    // time took to clone.
+	GtidSet        string                 `protobuf:"bytes,4,opt,name=gtid_set,json=gtidSet,proto3" json:"gtid_set,omitempty"`                       // the executed GTID set of the snapshot.
+	BinlogFile     string                 `protobuf:"bytes,5,opt,name=binlog_file,json=binlogFile,proto3" json:"binlog_file,omitempty"`              // the binary log file of the snapshot.
+	BinlogPosition int64                  `protobuf:"varint,6,opt,name=binlog_position,json=binlogPosition,proto3" json:"binlog_position,omitempty"` // the binary log position of the snapshot.
+	Removed        []string               `protobuf:"bytes,7,rep,name=removed,proto3" json:"removed,omitempty"`                                      // paths of old snapshots removed by the retention.
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CloneLocalResponse) Reset() {
+	*x = CloneLocalResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloneLocalResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloneLocalResponse) ProtoMessage() {}
+
+func (x *CloneLocalResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloneLocalResponse.ProtoReflect.Descriptor instead.
+func (*CloneLocalResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *CloneLocalResponse) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *CloneLocalResponse) GetSizeBytes() int64 {
+	if x != nil {
+		return x.SizeBytes
+	}
+	return 0
+}
+
+func (x *CloneLocalResponse) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *CloneLocalResponse) GetGtidSet() string {
+	if x != nil {
+		return x.GtidSet
+	}
+	return ""
+}
+
+func (x *CloneLocalResponse) GetBinlogFile() string {
+	if x != nil {
+		return x.BinlogFile
+	}
+	return ""
+}
+
+func (x *CloneLocalResponse) GetBinlogPosition() int64 {
+	if x != nil {
+		return x.BinlogPosition
+	}
+	return 0
+}
+
+func (x *CloneLocalResponse) GetRemoved() []string {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+// *
+// ReconcilePrivilegesRequest is the request message to reconcile the privileges of MOCO users.
+type ReconcilePrivilegesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DryRun        bool                   `protobuf:"varint,1,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"` // if true, only report the drifts.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReconcilePrivilegesRequest) Reset() {
+	*x = ReconcilePrivilegesRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReconcilePrivilegesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcilePrivilegesRequest) ProtoMessage() {}
+
+func (x *ReconcilePrivilegesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcilePrivilegesRequest.ProtoReflect.Descriptor instead.
+func (*ReconcilePrivilegesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *ReconcilePrivilegesRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+// *
+// PrivilegeDrift is the difference between the declared and the actual privileges of a MOCO user or a custom user.
+type PrivilegeDrift struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`                                   // name of the user.
+	Missing       []string               `protobuf:"bytes,2,rep,name=missing,proto3" json:"missing,omitempty"`                             // declared privileges the user lacks, such as "SELECT ON *.*".
+	Extra         []string               `protobuf:"bytes,3,rep,name=extra,proto3" json:"extra,omitempty"`                                 // privileges the user has but are not declared.
+	Statements    []string               `protobuf:"bytes,4,rep,name=statements,proto3" json:"statements,omitempty"`                       // GRANT and REVOKE statements to correct the drift.
+	Host          string                 `protobuf:"bytes,5,opt,name=host,proto3" json:"host,omitempty"`                                   // host part of the account.
+	UserMissing   bool                   `protobuf:"varint,6,opt,name=user_missing,json=userMissing,proto3" json:"user_missing,omitempty"` // true if the user does not exist.
+	Attributes    []string               `protobuf:"bytes,7,rep,name=attributes,proto3" json:"attributes,omitempty"`                       // account attributes different from the declared ones, such as "MAX_USER_CONNECTIONS 10 (actual 0)".
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PrivilegeDrift) Reset() {
+	*x = PrivilegeDrift{}
+	mi := &file_proto_agentrpc_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PrivilegeDrift) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrivilegeDrift) ProtoMessage() {}
+
+func (x *PrivilegeDrift) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrivilegeDrift.ProtoReflect.Descriptor instead.
+func (*PrivilegeDrift) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *PrivilegeDrift) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *PrivilegeDrift) GetMissing() []string {
+	if x != nil {
+		return x.Missing
+	}
+	return nil
+}
+
+func (x *PrivilegeDrift) GetExtra() []string {
+	if x != nil {
+		return x.Extra
+	}
+	return nil
+}
+
+func (x *PrivilegeDrift) GetStatements() []string {
+	if x != nil {
+		return x.Statements
+	}
+	return nil
+}
+
+func (x *PrivilegeDrift) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *PrivilegeDrift) GetUserMissing() bool {
+	if x != nil {
+		return x.UserMissing
+	}
+	return false
+}
+
+func (x *PrivilegeDrift) GetAttributes() []string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
+// *
+// ReconcilePrivilegesResponse is the response message of ReconcilePrivileges.
+type ReconcilePrivilegesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Drifts        []*PrivilegeDrift      `protobuf:"bytes,1,rep,name=drifts,proto3" json:"drifts,omitempty"`    // users whose privileges have drifted.
+	Applied       bool                   `protobuf:"varint,2,opt,name=applied,proto3" json:"applied,omitempty"` // true if the statements have been applied.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReconcilePrivilegesResponse) Reset() {
+	*x = ReconcilePrivilegesResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReconcilePrivilegesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcilePrivilegesResponse) ProtoMessage() {}
+
+func (x *ReconcilePrivilegesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcilePrivilegesResponse.ProtoReflect.Descriptor instead.
+func (*ReconcilePrivilegesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ReconcilePrivilegesResponse) GetDrifts() []*PrivilegeDrift {
+	if x != nil {
+		return x.Drifts
+	}
+	return nil
+}
+
+func (x *ReconcilePrivilegesResponse) GetApplied() bool {
+	if x != nil {
+		return x.Applied
+	}
+	return false
+}
+
+// *
+// ReconcilePluginsRequest is the request message of ReconcilePlugins.
+type ReconcilePluginsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DryRun        bool                   `protobuf:"varint,1,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"` // if true, only report the state.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReconcilePluginsRequest) Reset() {
+	*x = ReconcilePluginsRequest{}
+	mi := &file_proto_agentrpc_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReconcilePluginsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcilePluginsRequest) ProtoMessage() {}
+
+func (x *ReconcilePluginsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcilePluginsRequest.ProtoReflect.Descriptor instead.
+func (*ReconcilePluginsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *ReconcilePluginsRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+// *
+// PluginState is the desired and installed state of a plugin or a component.
+type PluginState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                                  // name of the plugin or URN of the component.
+	Kind          string                 `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`                                  // "plugin" or "component".
+	Library       string                 `protobuf:"bytes,3,opt,name=library,proto3" json:"library,omitempty"`                            // shared library of the plugin.
+	Desired       bool                   `protobuf:"varint,4,opt,name=desired,proto3" json:"desired,omitempty"`                           // true if it should be installed.
+	Installed     bool                   `protobuf:"varint,5,opt,name=installed,proto3" json:"installed,omitempty"`                       // true if it is installed.
+	Status        string                 `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`                              // PLUGIN_STATUS such as "ACTIVE".
+	InstalledAs   string                 `protobuf:"bytes,7,opt,name=installed_as,json=installedAs,proto3" json:"installed_as,omitempty"` // legacy plugin installed instead of the desired one.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PluginState) Reset() {
+	*x = PluginState{}
+	mi := &file_proto_agentrpc_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PluginState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PluginState) ProtoMessage() {}
+
+func (x *PluginState) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PluginState.ProtoReflect.Descriptor instead.
+func (*PluginState) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *PluginState) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PluginState) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *PluginState) GetLibrary() string {
+	if x != nil {
+		return x.Library
+	}
+	return ""
+}
+
+func (x *PluginState) GetDesired() bool {
+	if x != nil {
+		return x.Desired
+	}
+	return false
+}
+
+func (x *PluginState) GetInstalled() bool {
+	if x != nil {
+		return x.Installed
+	}
+	return false
+}
+
+func (x *PluginState) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *PluginState) GetInstalledAs() string {
+	if x != nil {
+		return x.InstalledAs
+	}
+	return ""
+}
+
+// *
+// ReconcilePluginsResponse is the response message of ReconcilePlugins.
+type ReconcilePluginsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Plugins       []*PluginState         `protobuf:"bytes,1,rep,name=plugins,proto3" json:"plugins,omitempty"`     // desired plugins and components followed by the other installed ones.
+	Installed     []string               `protobuf:"bytes,2,rep,name=installed,proto3" json:"installed,omitempty"` // plugins and components installed by this request.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReconcilePluginsResponse) Reset() {
+	*x = ReconcilePluginsResponse{}
+	mi := &file_proto_agentrpc_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReconcilePluginsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcilePluginsResponse) ProtoMessage() {}
+
+func (x *ReconcilePluginsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_agentrpc_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcilePluginsResponse.ProtoReflect.Descriptor instead.
+func (*ReconcilePluginsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_agentrpc_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *ReconcilePluginsResponse) GetPlugins() []*PluginState {
+	if x != nil {
+		return x.Plugins
+	}
+	return nil
+}
+
+func (x *ReconcilePluginsResponse) GetInstalled() []string {
+	if x != nil {
+		return x.Installed
+	}
+	return nil
+}
+
+var File_proto_agentrpc_proto protoreflect.FileDescriptor
+
+const file_proto_agentrpc_proto_rawDesc = "" +
+	"\n" +
+	"\x14proto/agentrpc.proto\x12\x04moco\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x84\x05\n" +
+	"\fCloneRequest\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\x05R\x04port\x12\x12\n" +
+	"\x04user\x18\x03 \x01(\tR\x04user\x12\x1a\n" +
+	"\bpassword\x18\x04 \x01(\tR\bpassword\x12\x1b\n" +
+	"\tinit_user\x18\x05 \x01(\tR\binitUser\x12#\n" +
+	"\rinit_password\x18\x06 \x01(\tR\finitPassword\x12<\n" +
+	"\fboot_timeout\x18\a \x01(\v2\x19.google.protobuf.DurationR\vbootTimeout\x12<\n" +
+	"\brecovery\x18\b \x01(\v2 .moco.PointInTimeRecoveryRequestR\brecovery\x12\x17\n" +
+	"\adry_run\x18\t \x01(\bR\x06dryRun\x12,\n" +
+	"\x12max_data_bandwidth\x18\n" +
+	" \x01(\x05R\x10maxDataBandwidth\x12'\n" +
+	"\x0fmax_concurrency\x18\v \x01(\x05R\x0emaxConcurrency\x12-\n" +
+	"\x12enable_compression\x18\f \x01(\bR\x11enableCompression\x12\x15\n" +
+	"\x06ssl_ca\x18\r \x01(\tR\x05sslCa\x12\x19\n" +
+	"\bssl_cert\x18\x0e \x01(\tR\asslCert\x12\x17\n" +
+	"\assl_key\x18\x0f \x01(\tR\x06sslKey\x12\x1f\n" +
+	"\vrequire_ssl\x18\x10 \x01(\bR\n" +
+	"requireSsl\x12!\n" +
+	"\fmax_attempts\x18\x11 \x01(\x05R\vmaxAttempts\x120\n" +
+	"\n" +
+	"candidates\x18\x12 \x03(\v2\x10.moco.CloneDonorR\n" +
+	"candidates\"4\n" +
+	"\n" +
+	"CloneDonor\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\x05R\x04port\"e\n" +
+	"\rCloneResponse\x12\x1d\n" +
+	"\n" +
+	"donor_host\x18\x01 \x01(\tR\tdonorHost\x12\x1d\n" +
+	"\n" +
+	"donor_port\x18\x02 \x01(\x05R\tdonorPort\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"\x17\n" +
+	"\x15GetCloneStatusRequest\"\xe4\x01\n" +
+	"\fCloneAttempt\x12\x18\n" +
+	"\aattempt\x18\x01 \x01(\x05R\aattempt\x129\n" +
+	"\n" +
+	"start_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x1c\n" +
+	"\tretryable\x18\x05 \x01(\bR\tretryable\x12\x14\n" +
+	"\x05donor\x18\x06 \x01(\tR\x05donor\"\xe6\x01\n" +
+	"\x16GetCloneStatusResponse\x12\x14\n" +
+	"\x05state\x18\x01 \x01(\tR\x05state\x129\n" +
+	"\n" +
+	"start_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12.\n" +
+	"\battempts\x18\x05 \x03(\v2\x12.moco.CloneAttemptR\battempts\"\x9d\x01\n" +
+	"\x16PurgeBinaryLogsRequest\x12*\n" +
+	"\x11replica_gtid_sets\x18\x01 \x03(\tR\x0freplicaGtidSets\x12>\n" +
+	"\rmin_retention\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\fminRetention\x12\x17\n" +
+	"\ato_file\x18\x03 \x01(\tR\x06toFile\"<\n" +
+	"\x17PurgeBinaryLogsResponse\x12!\n" +
+	"\fpurged_files\x18\x01 \x03(\tR\vpurgedFiles\"\xa2\x01\n" +
+	"\x1aPointInTimeRecoveryRequest\x12\x1f\n" +
+	"\varchive_url\x18\x01 \x01(\tR\n" +
+	"archiveUrl\x12;\n" +
+	"\vtarget_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"targetTime\x12&\n" +
+	"\x0ftarget_gtid_set\x18\x03 \x01(\tR\rtargetGtidSet\"\xa5\x01\n" +
+	"\x1bPointInTimeRecoveryResponse\x12\x14\n" +
+	"\x05phase\x18\x01 \x01(\tR\x05phase\x12#\n" +
+	"\rfetched_files\x18\x02 \x01(\x05R\ffetchedFiles\x12\x1f\n" +
+	"\vtotal_files\x18\x03 \x01(\x05R\n" +
+	"totalFiles\x12*\n" +
+	"\x11executed_gtid_set\x18\x04 \x01(\tR\x0fexecutedGtidSet\"\xe7\x02\n" +
+	"\x17BootstrapReplicaRequest\x12(\n" +
+	"\x05clone\x18\x01 \x01(\v2\x12.moco.CloneRequestR\x05clone\x12\x1f\n" +
+	"\vsource_host\x18\x02 \x01(\tR\n" +
+	"sourceHost\x12\x1f\n" +
+	"\vsource_port\x18\x03 \x01(\x05R\n" +
+	"sourcePort\x12\x1f\n" +
+	"\vsource_user\x18\x04 \x01(\tR\n" +
+	"sourceUser\x12'\n" +
+	"\x0fsource_password\x18\x05 \x01(\tR\x0esourcePassword\x12\x1d\n" +
+	"\n" +
+	"source_ssl\x18\x06 \x01(\bR\tsourceSsl\x122\n" +
+	"\amax_lag\x18\a \x01(\v2\x19.google.protobuf.DurationR\x06maxLag\x12C\n" +
+	"\x10catch_up_timeout\x18\b \x01(\v2\x19.google.protobuf.DurationR\x0ecatchUpTimeout\"\xdd\x01\n" +
+	"\x18BootstrapReplicaResponse\x12\x14\n" +
+	"\x05phase\x18\x01 \x01(\tR\x05phase\x12\x1d\n" +
+	"\n" +
+	"donor_host\x18\x02 \x01(\tR\tdonorHost\x12\x1d\n" +
+	"\n" +
+	"donor_port\x18\x03 \x01(\x05R\tdonorPort\x12\x1f\n" +
+	"\vsource_host\x18\x04 \x01(\tR\n" +
+	"sourceHost\x12\x1f\n" +
+	"\vsource_port\x18\x05 \x01(\x05R\n" +
+	"sourcePort\x12+\n" +
+	"\x03lag\x18\x06 \x01(\v2\x19.google.protobuf.DurationR\x03lag\"\x99\x01\n" +
+	"\x13StreamBinlogRequest\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x1a\n" +
+	"\bposition\x18\x02 \x01(\x03R\bposition\x12\x19\n" +
+	"\bgtid_set\x18\x03 \x01(\tR\agtidSet\x12\x1f\n" +
+	"\vdecode_rows\x18\x04 \x01(\bR\n" +
+	"decodeRows\x12\x16\n" +
+	"\x06follow\x18\x05 \x01(\bR\x06follow\"\x95\x02\n" +
+	"\x14StreamBinlogResponse\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x1a\n" +
+	"\bposition\x18\x02 \x01(\x03R\bposition\x12#\n" +
+	"\rnext_position\x18\x03 \x01(\x03R\fnextPosition\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\x04 \x01(\rR\teventType\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x12\n" +
+	"\x04gtid\x18\x06 \x01(\tR\x04gtid\x12\x10\n" +
+	"\x03raw\x18\a \x01(\fR\x03raw\x12)\n" +
+	"\x04rows\x18\b \x01(\v2\x15.moco.BinlogRowsEventR\x04rows\"\x96\x01\n" +
+	"\x0fBinlogRowsEvent\x12\x16\n" +
+	"\x06schema\x18\x01 \x01(\tR\x06schema\x12\x14\n" +
+	"\x05table\x18\x02 \x01(\tR\x05table\x12\x16\n" +
+	"\x06action\x18\x03 \x01(\tR\x06action\x12\x18\n" +
+	"\acolumns\x18\x04 \x03(\tR\acolumns\x12#\n" +
+	"\x04rows\x18\x05 \x03(\v2\x0f.moco.BinlogRowR\x04rows\"_\n" +
+	"\tBinlogRow\x12)\n" +
+	"\x06before\x18\x01 \x03(\v2\x11.moco.BinlogValueR\x06before\x12'\n" +
+	"\x05after\x18\x02 \x03(\v2\x11.moco.BinlogValueR\x05after\"M\n" +
+	"\vBinlogValue\x12\x12\n" +
+	"\x04null\x18\x01 \x01(\bR\x04null\x12\x16\n" +
+	"\x06absent\x18\x02 \x01(\bR\x06absent\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\"\x9c\x01\n" +
+	"\x14LogicalBackupRequest\x12'\n" +
+	"\x0finclude_schemas\x18\x01 \x03(\tR\x0eincludeSchemas\x12'\n" +
+	"\x0fexclude_schemas\x18\x02 \x03(\tR\x0eexcludeSchemas\x12\x16\n" +
+	"\x06format\x18\x03 \x01(\tR\x06format\x12\x1a\n" +
+	"\bparallel\x18\x04 \x01(\x05R\bparallel\"\xb6\x01\n" +
+	"\x15LogicalBackupResponse\x12\x19\n" +
+	"\bgtid_set\x18\x01 \x01(\tR\agtidSet\x12\x1f\n" +
+	"\vbinlog_file\x18\x02 \x01(\tR\n" +
+	"binlogFile\x12'\n" +
+	"\x0fbinlog_position\x18\x03 \x01(\x03R\x0ebinlogPosition\x12\x12\n" +
+	"\x04file\x18\x04 \x01(\tR\x04file\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\x12\x10\n" +
+	"\x03eof\x18\x06 \x01(\bR\x03eof\"[\n" +
+	"\x18AcquireBackupLockRequest\x12\x12\n" +
+	"\x04mode\x18\x01 \x01(\tR\x04mode\x12+\n" +
+	"\x03ttl\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\"\xd6\x01\n" +
+	"\x19AcquireBackupLockResponse\x12\x17\n" +
+	"\alock_id\x18\x01 \x01(\tR\x06lockId\x12\x19\n" +
+	"\bgtid_set\x18\x02 \x01(\tR\agtidSet\x12\x1f\n" +
+	"\vbinlog_file\x18\x03 \x01(\tR\n" +
+	"binlogFile\x12'\n" +
+	"\x0fbinlog_position\x18\x04 \x01(\x03R\x0ebinlogPosition\x12;\n" +
+	"\vexpire_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"expireTime\"3\n" +
+	"\x18ReleaseBackupLockRequest\x12\x17\n" +
+	"\alock_id\x18\x01 \x01(\tR\x06lockId\"\x1b\n" +
+	"\x19ReleaseBackupLockResponse\"'\n" +
+	"\x11CloneLocalRequest\x12\x12\n" +
+	"\x04keep\x18\x01 \x01(\x05R\x04keep\"\xfd\x01\n" +
+	"\x12CloneLocalResponse\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1d\n" +
+	"\n" +
+	"size_bytes\x18\x02 \x01(\x03R\tsizeBytes\x125\n" +
+	"\bduration\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\bduration\x12\x19\n" +
+	"\bgtid_set\x18\x04 \x01(\tR\agtidSet\x12\x1f\n" +
+	"\vbinlog_file\x18\x05 \x01(\tR\n" +
+	"binlogFile\x12'\n" +
+	"\x0fbinlog_position\x18\x06 \x01(\x03R\x0ebinlogPosition\x12\x18\n" +
+	"\aremoved\x18\a \x03(\tR\aremoved\"5\n" +
+	"\x1aReconcilePrivilegesRequest\x12\x17\n" +
+	"\adry_run\x18\x01 \x01(\bR\x06dryRun\"\xcb\x01\n" +
+	"\x0ePrivilegeDrift\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\x12\x18\n" +
+	"\amissing\x18\x02 \x03(\tR\amissing\x12\x14\n" +
+	"\x05extra\x18\x03 \x03(\tR\x05extra\x12\x1e\n" +
+	"\n" +
+	"statements\x18\x04 \x03(\tR\n" +
+	"statements\x12\x12\n" +
+	"\x04host\x18\x05 \x01(\tR\x04host\x12!\n" +
+	"\fuser_missing\x18\x06 \x01(\bR\vuserMissing\x12\x1e\n" +
+	"\n" +
+	"attributes\x18\a \x03(\tR\n" +
+	"attributes\"e\n" +
+	"\x1bReconcilePrivilegesResponse\x12,\n" +
+	"\x06drifts\x18\x01 \x03(\v2\x14.moco.PrivilegeDriftR\x06drifts\x12\x18\n" +
+	"\aapplied\x18\x02 \x01(\bR\aapplied\"2\n" +
+	"\x17ReconcilePluginsRequest\x12\x17\n" +
+	"\adry_run\x18\x01 \x01(\bR\x06dryRun\"\xc2\x01\n" +
+	"\vPluginState\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x18\n" +
+	"\alibrary\x18\x03 \x01(\tR\alibrary\x12\x18\n" +
+	"\adesired\x18\x04 \x01(\bR\adesired\x12\x1c\n" +
+	"\tinstalled\x18\x05 \x01(\bR\tinstalled\x12\x16\n" +
+	"\x06status\x18\x06 \x01(\tR\x06status\x12!\n" +
+	"\finstalled_as\x18\a \x01(\tR\vinstalledAs\"e\n" +
+	"\x18ReconcilePluginsResponse\x12+\n" +
+	"\aplugins\x18\x01 \x03(\v2\x11.moco.PluginStateR\aplugins\x12\x1c\n" +
+	"\tinstalled\x18\x02 \x03(\tR\tinstalled2\xba\a\n" +
+	"\x05Agent\x120\n" +
+	"\x05Clone\x12\x12.moco.CloneRequest\x1a\x13.moco.CloneResponse\x12K\n" +
+	"\x0eGetCloneStatus\x12\x1b.moco.GetCloneStatusRequest\x1a\x1c.moco.GetCloneStatusResponse\x12N\n" +
+	"\x0fPurgeBinaryLogs\x12\x1c.moco.PurgeBinaryLogsRequest\x1a\x1d.moco.PurgeBinaryLogsResponse\x12\\\n" +
+	"\x13PointInTimeRecovery\x12 .moco.PointInTimeRecoveryRequest\x1a!.moco.PointInTimeRecoveryResponse0\x01\x12S\n" +
+	"\x10BootstrapReplica\x12\x1d.moco.BootstrapReplicaRequest\x1a\x1e.moco.BootstrapReplicaResponse0\x01\x12G\n" +
+	"\fStreamBinlog\x12\x19.moco.StreamBinlogRequest\x1a\x1a.moco.StreamBinlogResponse0\x01\x12J\n" +
+	"\rLogicalBackup\x12\x1a.moco.LogicalBackupRequest\x1a\x1b.moco.LogicalBackupResponse0\x01\x12T\n" +
+	"\x11AcquireBackupLock\x12\x1e.moco.AcquireBackupLockRequest\x1a\x1f.moco.AcquireBackupLockResponse\x12T\n" +
+	"\x11ReleaseBackupLock\x12\x1e.moco.ReleaseBackupLockRequest\x1a\x1f.moco.ReleaseBackupLockResponse\x12?\n" +
+	"\n" +
+	"CloneLocal\x12\x17.moco.CloneLocalRequest\x1a\x18.moco.CloneLocalResponse\x12Z\n" +
+	"\x13ReconcilePrivileges\x12 .moco.ReconcilePrivilegesRequest\x1a!.moco.ReconcilePrivilegesResponse\x12Q\n" +
+	"\x10ReconcilePlugins\x12\x1d.moco.ReconcilePluginsRequest\x1a\x1e.moco.ReconcilePluginsResponseB'Z%github.com/cybozu-go/moco-agent/protob\x06proto3"
 
 var (
 	file_proto_agentrpc_proto_rawDescOnce sync.Once
@@ -183,21 +2459,96 @@ func file_proto_agentrpc_proto_rawDescGZIP() []byte {
 	return file_proto_agentrpc_proto_rawDescData
 }
 
-var file_proto_agentrpc_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_agentrpc_proto_msgTypes = make([]protoimpl.MessageInfo, 31)
 var file_proto_agentrpc_proto_goTypes = []any{
-	(*CloneRequest)(nil),        // 0: moco.CloneRequest
-	(*CloneResponse)(nil),       // 1: moco.CloneResponse
-	(*durationpb.Duration)(nil), // 2: google.protobuf.Duration
+	(*CloneRequest)(nil),                // 0: moco.CloneRequest
+	(*CloneDonor)(nil),                  // 1: moco.CloneDonor
+	(*CloneResponse)(nil),               // 2: moco.CloneResponse
+	(*GetCloneStatusRequest)(nil),       // 3: moco.GetCloneStatusRequest
+	(*CloneAttempt)(nil),                // 4: moco.CloneAttempt
+	(*GetCloneStatusResponse)(nil),      // 5: moco.GetCloneStatusResponse
+	(*PurgeBinaryLogsRequest)(nil),      // 6: moco.PurgeBinaryLogsRequest
+	(*PurgeBinaryLogsResponse)(nil),     // 7: moco.PurgeBinaryLogsResponse
+	(*PointInTimeRecoveryRequest)(nil),  // 8: moco.PointInTimeRecoveryRequest
+	(*PointInTimeRecoveryResponse)(nil), // 9: moco.PointInTimeRecoveryResponse
+	(*BootstrapReplicaRequest)(nil),     // 10: moco.BootstrapReplicaRequest
+	(*BootstrapReplicaResponse)(nil),    // 11: moco.BootstrapReplicaResponse
+	(*StreamBinlogRequest)(nil),         // 12: moco.StreamBinlogRequest
+	(*StreamBinlogResponse)(nil),        // 13: moco.StreamBinlogResponse
+	(*BinlogRowsEvent)(nil),             // 14: moco.BinlogRowsEvent
+	(*BinlogRow)(nil),                   // 15: moco.BinlogRow
+	(*BinlogValue)(nil),                 // 16: moco.BinlogValue
+	(*LogicalBackupRequest)(nil),        // 17: moco.LogicalBackupRequest
+	(*LogicalBackupResponse)(nil),       // 18: moco.LogicalBackupResponse
+	(*AcquireBackupLockRequest)(nil),    // 19: moco.AcquireBackupLockRequest
+	(*AcquireBackupLockResponse)(nil),   // 20: moco.AcquireBackupLockResponse
+	(*ReleaseBackupLockRequest)(nil),    // 21: moco.ReleaseBackupLockRequest
+	(*ReleaseBackupLockResponse)(nil),   // 22: moco.ReleaseBackupLockResponse
+	(*CloneLocalRequest)(nil),           // 23: moco.CloneLocalRequest
+	(*CloneLocalResponse)(nil),          // 24: moco.CloneLocalResponse
+	(*ReconcilePrivilegesRequest)(nil),  // 25: moco.ReconcilePrivilegesRequest
+	(*PrivilegeDrift)(nil),              // 26: moco.PrivilegeDrift
+	(*ReconcilePrivilegesResponse)(nil), // 27: moco.ReconcilePrivilegesResponse
+	(*ReconcilePluginsRequest)(nil),     // 28: moco.ReconcilePluginsRequest
+	(*PluginState)(nil),                 // 29: moco.PluginState
+	(*ReconcilePluginsResponse)(nil),    // 30: moco.ReconcilePluginsResponse
+	(*durationpb.Duration)(nil),         // 31: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil),       // 32: google.protobuf.Timestamp
 }
 var file_proto_agentrpc_proto_depIdxs = []int32{
-	2, // 0: moco.CloneRequest.boot_timeout:type_name -> google.protobuf.Duration
-	0, // 1: moco.Agent.Clone:input_type -> moco.CloneRequest
-	1, // 2: moco.Agent.Clone:output_type -> moco.CloneResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	31, // 0: moco.CloneRequest.boot_timeout:type_name -> google.protobuf.Duration
+	8,  // 1: moco.CloneRequest.recovery:type_name -> moco.PointInTimeRecoveryRequest
+	1,  // 2: moco.CloneRequest.candidates:type_name -> moco.CloneDonor
+	32, // 3: moco.CloneAttempt.start_time:type_name -> google.protobuf.Timestamp
+	32, // 4: moco.CloneAttempt.end_time:type_name -> google.protobuf.Timestamp
+	32, // 5: moco.GetCloneStatusResponse.start_time:type_name -> google.protobuf.Timestamp
+	32, // 6: moco.GetCloneStatusResponse.end_time:type_name -> google.protobuf.Timestamp
+	4,  // 7: moco.GetCloneStatusResponse.attempts:type_name -> moco.CloneAttempt
+	31, // 8: moco.PurgeBinaryLogsRequest.min_retention:type_name -> google.protobuf.Duration
+	32, // 9: moco.PointInTimeRecoveryRequest.target_time:type_name -> google.protobuf.Timestamp
+	0,  // 10: moco.BootstrapReplicaRequest.clone:type_name -> moco.CloneRequest
+	31, // 11: moco.BootstrapReplicaRequest.max_lag:type_name -> google.protobuf.Duration
+	31, // 12: moco.BootstrapReplicaRequest.catch_up_timeout:type_name -> google.protobuf.Duration
+	31, // 13: moco.BootstrapReplicaResponse.lag:type_name -> google.protobuf.Duration
+	32, // 14: moco.StreamBinlogResponse.timestamp:type_name -> google.protobuf.Timestamp
+	14, // 15: moco.StreamBinlogResponse.rows:type_name -> moco.BinlogRowsEvent
+	15, // 16: moco.BinlogRowsEvent.rows:type_name -> moco.BinlogRow
+	16, // 17: moco.BinlogRow.before:type_name -> moco.BinlogValue
+	16, // 18: moco.BinlogRow.after:type_name -> moco.BinlogValue
+	31, // 19: moco.AcquireBackupLockRequest.ttl:type_name -> google.protobuf.Duration
+	32, // 20: moco.AcquireBackupLockResponse.expire_time:type_name -> google.protobuf.Timestamp
+	31, // 21: moco.CloneLocalResponse.duration:type_name -> google.protobuf.Duration
+	26, // 22: moco.ReconcilePrivilegesResponse.drifts:type_name -> moco.PrivilegeDrift
+	29, // 23: moco.ReconcilePluginsResponse.plugins:type_name -> moco.PluginState
+	0,  // 24: moco.Agent.Clone:input_type -> moco.CloneRequest
+	3,  // 25: moco.Agent.GetCloneStatus:input_type -> moco.GetCloneStatusRequest
+	6,  // 26: moco.Agent.PurgeBinaryLogs:input_type -> moco.PurgeBinaryLogsRequest
+	8,  // 27: moco.Agent.PointInTimeRecovery:input_type -> moco.PointInTimeRecoveryRequest
+	10, // 28: moco.Agent.BootstrapReplica:input_type -> moco.BootstrapReplicaRequest
+	12, // 29: moco.Agent.StreamBinlog:input_type -> moco.StreamBinlogRequest
+	17, // 30: moco.Agent.LogicalBackup:input_type -> moco.LogicalBackupRequest
+	19, // 31: moco.Agent.AcquireBackupLock:input_type -> moco.AcquireBackupLockRequest
+	21, // 32: moco.Agent.ReleaseBackupLock:input_type -> moco.ReleaseBackupLockRequest
+	23, // 33: moco.Agent.CloneLocal:input_type -> moco.CloneLocalRequest
+	25, // 34: moco.Agent.ReconcilePrivileges:input_type -> moco.ReconcilePrivilegesRequest
+	28, // 35: moco.Agent.ReconcilePlugins:input_type -> moco.ReconcilePluginsRequest
+	2,  // 36: moco.Agent.Clone:output_type -> moco.CloneResponse
+	5,  // 37: moco.Agent.GetCloneStatus:output_type -> moco.GetCloneStatusResponse
+	7,  // 38: moco.Agent.PurgeBinaryLogs:output_type -> moco.PurgeBinaryLogsResponse
+	9,  // 39: moco.Agent.PointInTimeRecovery:output_type -> moco.PointInTimeRecoveryResponse
+	11, // 40: moco.Agent.BootstrapReplica:output_type -> moco.BootstrapReplicaResponse
+	13, // 41: moco.Agent.StreamBinlog:output_type -> moco.StreamBinlogResponse
+	18, // 42: moco.Agent.LogicalBackup:output_type -> moco.LogicalBackupResponse
+	20, // 43: moco.Agent.AcquireBackupLock:output_type -> moco.AcquireBackupLockResponse
+	22, // 44: moco.Agent.ReleaseBackupLock:output_type -> moco.ReleaseBackupLockResponse
+	24, // 45: moco.Agent.CloneLocal:output_type -> moco.CloneLocalResponse
+	27, // 46: moco.Agent.ReconcilePrivileges:output_type -> moco.ReconcilePrivilegesResponse
+	30, // 47: moco.Agent.ReconcilePlugins:output_type -> moco.ReconcilePluginsResponse
+	36, // [36:48] is the sub-list for method output_type
+	24, // [24:36] is the sub-list for method input_type
+	24, // [24:24] is the sub-list for extension type_name
+	24, // [24:24] is the sub-list for extension extendee
+	0,  // [0:24] is the sub-list for field type_name
 }
 
 func init() { file_proto_agentrpc_proto_init() }
@@ -211,7 +2562,7 @@ func file_proto_agentrpc_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_agentrpc_proto_rawDesc), len(file_proto_agentrpc_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   31,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,7 +19,18 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Agent_Clone_FullMethodName = "/moco.Agent/Clone"
+	Agent_Clone_FullMethodName               = "/moco.Agent/Clone"
+	Agent_GetCloneStatus_FullMethodName      = "/moco.Agent/GetCloneStatus"
+	Agent_PurgeBinaryLogs_FullMethodName     = "/moco.Agent/PurgeBinaryLogs"
+	Agent_PointInTimeRecovery_FullMethodName = "/moco.Agent/PointInTimeRecovery"
+	Agent_BootstrapReplica_FullMethodName    = "/moco.Agent/BootstrapReplica"
+	Agent_StreamBinlog_FullMethodName        = "/moco.Agent/StreamBinlog"
+	Agent_LogicalBackup_FullMethodName       = "/moco.Agent/LogicalBackup"
+	Agent_AcquireBackupLock_FullMethodName   = "/moco.Agent/AcquireBackupLock"
+	Agent_ReleaseBackupLock_FullMethodName   = "/moco.Agent/ReleaseBackupLock"
+	Agent_CloneLocal_FullMethodName          = "/moco.Agent/CloneLocal"
+	Agent_ReconcilePrivileges_FullMethodName = "/moco.Agent/ReconcilePrivileges"
+	Agent_ReconcilePlugins_FullMethodName    = "/moco.Agent/ReconcilePlugins"
 )
 
 // AgentClient is the client API for Agent service.
@@ -28,22 +39,126 @@ const (
 //
 // *
 // Agent provides services for MOCO.
+//
+// Errors returned by MySQL are translated into appropriate gRPC status codes
+// and have google.rpc.ErrorInfo with reason `MYSQL_ERROR`, domain `mysql`,
+// and metadata `errno` and `sqlstate`.
 type AgentClient interface {
 	// Clone invokes MySQL CLONE command initializes the cloned database for MOCO.
 	// It does _not_ start the replication (START REPLICA).  Actually, it works as follows.
 	//
-	// 1. Configure `clone_donor_valid_list` global variable to allow the donor instance.
+	// 1. Connect to the donor with `user` and `password`, and check the version, active plugins,
+	//    `innodb_page_size`, `lower_case_table_names`, `max_allowed_packet`, and the data size
+	//    against the free space.  The data size is not checked if `user` lacks PROCESS to read it.
+	//    If any check fails, return FailedPrecondition listing all problems.
+	//    If `candidates` are given, each of them is probed also for the replication lag and
+	//    a running clone, and usable ones are ordered by the lag.  If `dry_run` is true, return here.
+	//
+	// 2. Configure `clone_donor_valid_list` global variable to allow the donor instance.
+	//    Also configure `clone_max_data_bandwidth`, `clone_max_concurrency`, `clone_enable_compression`,
+	//    and `clone_ssl_*` if specified.  They are restored to the previous values when Clone returns.
+	//
+	// 3. Invoke `CLONE INSTANCE` with `user` and `password` in the CloneRequest.
+	//    Retryable errors such as network errors are retried up to `max_attempts` times
+	//    with exponential backoff.  The recipient is checked to be empty before each retry.
+	//    If the connection is lost, `performance_schema.clone_status` is checked after mysqld comes back
+	//    because mysqld restarts after a successful clone.
+	//    If cloning from a candidate fails, the next candidate is tried.
 	//
-	// 2. Invoke `CLONE INSTANCE` with `user` and `password` in the CloneRequest.
+	// 4. Initialize the database for MOCO using `init_user` and `init_password`.
 	//
-	// 3. Initialize the database for MOCO using `init_user` and `init_password`.
+	// 5. If `recovery` is specified, replay archived binary logs as PointInTimeRecovery does.
 	//
-	// For 2, the user must have BACKUP_ADMIN and REPLICATION SLAVE privilege.
-	// For 3, the init_user must have ALL privilege with GRANT OPTION.
+	// For 1 and 3, the user must have BACKUP_ADMIN and REPLICATION SLAVE privilege.
+	// For 4, the init_user must have ALL privilege with GRANT OPTION.
 	// The init_user is used only via UNIX domain socket, so its host can be `localhost`.
 	//
 	// The donor database should have prepared these two users beforehand.
 	Clone(ctx context.Context, in *CloneRequest, opts ...grpc.CallOption) (*CloneResponse, error)
+	// GetCloneStatus returns the status of the last Clone including every attempt of CLONE INSTANCE.
+	GetCloneStatus(ctx context.Context, in *GetCloneStatusRequest, opts ...grpc.CallOption) (*GetCloneStatusResponse, error)
+	// PurgeBinaryLogs purges binary logs that are no longer needed by invoking `PURGE BINARY LOGS TO`.
+	//
+	// The purge point is the newest binary log file that satisfies all of the
+	// constraints in the request.  The active binary log file is never purged.
+	PurgeBinaryLogs(ctx context.Context, in *PurgeBinaryLogsRequest, opts ...grpc.CallOption) (*PurgeBinaryLogsResponse, error)
+	// PointInTimeRecovery replays archived binary logs up to the target and streams the progress.
+	//
+	// The binary log files are fetched from the archive into the relay log directory,
+	// and applied by the replication SQL thread of a dedicated channel `pitr`.
+	// Transactions already executed are skipped.  The SQL thread stops exactly at the target
+	// with `START REPLICA SQL_THREAD UNTIL`, and the channel is removed afterward.
+	PointInTimeRecovery(ctx context.Context, in *PointInTimeRecoveryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PointInTimeRecoveryResponse], error)
+	// BootstrapReplica turns an empty instance into a ready replica and streams the progress.
+	//
+	// 1. Clone the instance as Clone does with `clone`.
+	//
+	// 2. Configure the replication with `CHANGE REPLICATION SOURCE TO ... SOURCE_AUTO_POSITION=1`.
+	//
+	// 3. Start the replication with `START REPLICA`.
+	//
+	// 4. Wait until `Seconds_Behind_Source` becomes less than `max_lag`.
+	//    If a replication thread stops with an error, return the error.
+	//
+	// Each phase is reported when it completes.  "catching_up" is reported periodically while waiting.
+	BootstrapReplica(ctx context.Context, in *BootstrapReplicaRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BootstrapReplicaResponse], error)
+	// StreamBinlog reads binary log files directly from the disk and streams the events.
+	//
+	// The stream starts from the file and the position, or from the first transaction
+	// not included in the GTID set.  Events are streamed in the raw form by default.
+	// With `decode_rows`, only row events are streamed in the decoded form.
+	StreamBinlog(ctx context.Context, in *StreamBinlogRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamBinlogResponse], error)
+	// LogicalBackup dumps schemas and tables from a consistent snapshot and streams them.
+	//
+	// The snapshot is taken as follows using the `moco-backup` user.
+	//
+	// 1. Block DDL by `LOCK INSTANCE FOR BACKUP` until the backup finishes.
+	//
+	// 2. Block commits momentarily by `FLUSH TABLES WITH READ LOCK`.
+	//
+	// 3. Open `START TRANSACTION WITH CONSISTENT SNAPSHOT` in every session dumping tables.
+	//
+	// 4. Record the executed GTID set and the binary log position, then `UNLOCK TABLES`.
+	//
+	// For each schema, `<schema>.schema.sql.gz` has the CREATE DATABASE statement, and
+	// `<schema>.routines.sql.gz`, `<schema>.triggers.sql.gz`, and `<schema>.events.sql.gz` have
+	// the CREATE statements of the stored routines, the triggers, and the events delimited by `;;` if any.
+	// For each table or view, `<schema>/<table>.schema.sql.gz` has the CREATE statement.
+	// For each table, `<schema>/<table>.sql.gz` or `<schema>/<table>.csv.gz` has the data.
+	//
+	// Files are sent in the order to be restored: schemas and routines, tables, views, then triggers and events.
+	// Each view is sent after the views it refers to.
+	LogicalBackup(ctx context.Context, in *LogicalBackupRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogicalBackupResponse], error)
+	// AcquireBackupLock quiesces mysqld for taking a volume snapshot.
+	//
+	// The agent holds the lock in a dedicated session of the `moco-backup` user.
+	// The lock is released by ReleaseBackupLock, when the lease expires, or when the agent stops.
+	// Only one lock can be held at a time, and Clone and other exclusive operations are rejected meanwhile.
+	// The binary log coordinates are returned only in the "flush_tables" mode because DML continues
+	// under LOCK INSTANCE FOR BACKUP and no coordinates match the snapshot.
+	AcquireBackupLock(ctx context.Context, in *AcquireBackupLockRequest, opts ...grpc.CallOption) (*AcquireBackupLockResponse, error)
+	// ReleaseBackupLock releases the lock acquired by AcquireBackupLock.
+	ReleaseBackupLock(ctx context.Context, in *ReleaseBackupLockRequest, opts ...grpc.CallOption) (*ReleaseBackupLockResponse, error)
+	// CloneLocal takes a physical snapshot by `CLONE LOCAL DATA DIRECTORY`.
+	//
+	// The snapshot is created as `snapshot-<UTC time>` under the directory given by `--clone-local-dir`.
+	// Old snapshots exceeding the retention count are removed afterward.
+	// A partially created snapshot is removed if cloning fails.
+	CloneLocal(ctx context.Context, in *CloneLocalRequest, opts ...grpc.CallOption) (*CloneLocalResponse, error)
+	// ReconcilePrivileges compares the privileges of MOCO users and custom users in `SHOW GRANTS` with the declared ones,
+	// and corrects the drifts with minimal GRANT and REVOKE statements using the `moco-admin` user.
+	//
+	// Privileges on `*.*` and on databases or tables, the grant option, partial revokes, PROXY,
+	// and the account attributes are compared.  Missing custom users are created.
+	// The correction is skipped on a read-only instance because grants are replicated from the primary.
+	ReconcilePrivileges(ctx context.Context, in *ReconcilePrivilegesRequest, opts ...grpc.CallOption) (*ReconcilePrivilegesResponse, error)
+	// ReconcilePlugins reports the desired and installed plugins and components,
+	// and installs the missing ones unless `dry_run` is true.
+	//
+	// The semi-synchronous replication plugins are `rpl_semi_sync_master` and `rpl_semi_sync_slave`
+	// unless `--native-semi-sync-plugins` is specified on MySQL 8.4 or later.
+	// The legacy plugins already installed are regarded as the installed ones.
+	ReconcilePlugins(ctx context.Context, in *ReconcilePluginsRequest, opts ...grpc.CallOption) (*ReconcilePluginsResponse, error)
 }
 
 type agentClient struct {
@@ -64,28 +179,278 @@ func (c *agentClient) Clone(ctx context.Context, in *CloneRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *agentClient) GetCloneStatus(ctx context.Context, in *GetCloneStatusRequest, opts ...grpc.CallOption) (*GetCloneStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetCloneStatusResponse)
+	err := c.cc.Invoke(ctx, Agent_GetCloneStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) PurgeBinaryLogs(ctx context.Context, in *PurgeBinaryLogsRequest, opts ...grpc.CallOption) (*PurgeBinaryLogsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PurgeBinaryLogsResponse)
+	err := c.cc.Invoke(ctx, Agent_PurgeBinaryLogs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) PointInTimeRecovery(ctx context.Context, in *PointInTimeRecoveryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PointInTimeRecoveryResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[0], Agent_PointInTimeRecovery_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PointInTimeRecoveryRequest, PointInTimeRecoveryResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_PointInTimeRecoveryClient = grpc.ServerStreamingClient[PointInTimeRecoveryResponse]
+
+func (c *agentClient) BootstrapReplica(ctx context.Context, in *BootstrapReplicaRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BootstrapReplicaResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[1], Agent_BootstrapReplica_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BootstrapReplicaRequest, BootstrapReplicaResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_BootstrapReplicaClient = grpc.ServerStreamingClient[BootstrapReplicaResponse]
+
+func (c *agentClient) StreamBinlog(ctx context.Context, in *StreamBinlogRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamBinlogResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[2], Agent_StreamBinlog_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamBinlogRequest, StreamBinlogResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_StreamBinlogClient = grpc.ServerStreamingClient[StreamBinlogResponse]
+
+func (c *agentClient) LogicalBackup(ctx context.Context, in *LogicalBackupRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogicalBackupResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[3], Agent_LogicalBackup_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LogicalBackupRequest, LogicalBackupResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_LogicalBackupClient = grpc.ServerStreamingClient[LogicalBackupResponse]
+
+func (c *agentClient) AcquireBackupLock(ctx context.Context, in *AcquireBackupLockRequest, opts ...grpc.CallOption) (*AcquireBackupLockResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AcquireBackupLockResponse)
+	err := c.cc.Invoke(ctx, Agent_AcquireBackupLock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) ReleaseBackupLock(ctx context.Context, in *ReleaseBackupLockRequest, opts ...grpc.CallOption) (*ReleaseBackupLockResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReleaseBackupLockResponse)
+	err := c.cc.Invoke(ctx, Agent_ReleaseBackupLock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CloneLocal(ctx context.Context, in *CloneLocalRequest, opts ...grpc.CallOption) (*CloneLocalResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CloneLocalResponse)
+	err := c.cc.Invoke(ctx, Agent_CloneLocal_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) ReconcilePrivileges(ctx context.Context, in *ReconcilePrivilegesRequest, opts ...grpc.CallOption) (*ReconcilePrivilegesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReconcilePrivilegesResponse)
+	err := c.cc.Invoke(ctx, Agent_ReconcilePrivileges_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) ReconcilePlugins(ctx context.Context, in *ReconcilePluginsRequest, opts ...grpc.CallOption) (*ReconcilePluginsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReconcilePluginsResponse)
+	err := c.cc.Invoke(ctx, Agent_ReconcilePlugins_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AgentServer is the server API for Agent service.
 // All implementations must embed UnimplementedAgentServer
 // for forward compatibility.
 //
 // *
 // Agent provides services for MOCO.
+//
+// Errors returned by MySQL are translated into appropriate gRPC status codes
+// and have google.rpc.ErrorInfo with reason `MYSQL_ERROR`, domain `mysql`,
+// and metadata `errno` and `sqlstate`.
 type AgentServer interface {
 	// Clone invokes MySQL CLONE command initializes the cloned database for MOCO.
 	// It does _not_ start the replication (START REPLICA).  Actually, it works as follows.
 	//
-	// 1. Configure `clone_donor_valid_list` global variable to allow the donor instance.
+	// 1. Connect to the donor with `user` and `password`, and check the version, active plugins,
+	//    `innodb_page_size`, `lower_case_table_names`, `max_allowed_packet`, and the data size
+	//    against the free space.  The data size is not checked if `user` lacks PROCESS to read it.
+	//    If any check fails, return FailedPrecondition listing all problems.
+	//    If `candidates` are given, each of them is probed also for the replication lag and
+	//    a running clone, and usable ones are ordered by the lag.  If `dry_run` is true, return here.
+	//
+	// 2. Configure `clone_donor_valid_list` global variable to allow the donor instance.
+	//    Also configure `clone_max_data_bandwidth`, `clone_max_concurrency`, `clone_enable_compression`,
+	//    and `clone_ssl_*` if specified.  They are restored to the previous values when Clone returns.
+	//
+	// 3. Invoke `CLONE INSTANCE` with `user` and `password` in the CloneRequest.
+	//    Retryable errors such as network errors are retried up to `max_attempts` times
+	//    with exponential backoff.  The recipient is checked to be empty before each retry.
+	//    If the connection is lost, `performance_schema.clone_status` is checked after mysqld comes back
+	//    because mysqld restarts after a successful clone.
+	//    If cloning from a candidate fails, the next candidate is tried.
 	//
-	// 2. Invoke `CLONE INSTANCE` with `user` and `password` in the CloneRequest.
+	// 4. Initialize the database for MOCO using `init_user` and `init_password`.
 	//
-	// 3. Initialize the database for MOCO using `init_user` and `init_password`.
+	// 5. If `recovery` is specified, replay archived binary logs as PointInTimeRecovery does.
 	//
-	// For 2, the user must have BACKUP_ADMIN and REPLICATION SLAVE privilege.
-	// For 3, the init_user must have ALL privilege with GRANT OPTION.
+	// For 1 and 3, the user must have BACKUP_ADMIN and REPLICATION SLAVE privilege.
+	// For 4, the init_user must have ALL privilege with GRANT OPTION.
 	// The init_user is used only via UNIX domain socket, so its host can be `localhost`.
 	//
 	// The donor database should have prepared these two users beforehand.
 	Clone(context.Context, *CloneRequest) (*CloneResponse, error)
+	// GetCloneStatus returns the status of the last Clone including every attempt of CLONE INSTANCE.
+	GetCloneStatus(context.Context, *GetCloneStatusRequest) (*GetCloneStatusResponse, error)
+	// PurgeBinaryLogs purges binary logs that are no longer needed by invoking `PURGE BINARY LOGS TO`.
+	//
+	// The purge point is the newest binary log file that satisfies all of the
+	// constraints in the request.  The active binary log file is never purged.
+	PurgeBinaryLogs(context.Context, *PurgeBinaryLogsRequest) (*PurgeBinaryLogsResponse, error)
+	// PointInTimeRecovery replays archived binary logs up to the target and streams the progress.
+	//
+	// The binary log files are fetched from the archive into the relay log directory,
+	// and applied by the replication SQL thread of a dedicated channel `pitr`.
+	// Transactions already executed are skipped.  The SQL thread stops exactly at the target
+	// with `START REPLICA SQL_THREAD UNTIL`, and the channel is removed afterward.
+	PointInTimeRecovery(*PointInTimeRecoveryRequest, grpc.ServerStreamingServer[PointInTimeRecoveryResponse]) error
+	// BootstrapReplica turns an empty instance into a ready replica and streams the progress.
+	//
+	// 1. Clone the instance as Clone does with `clone`.
+	//
+	// 2. Configure the replication with `CHANGE REPLICATION SOURCE TO ... SOURCE_AUTO_POSITION=1`.
+	//
+	// 3. Start the replication with `START REPLICA`.
+	//
+	// 4. Wait until `Seconds_Behind_Source` becomes less than `max_lag`.
+	//    If a replication thread stops with an error, return the error.
+	//
+	// Each phase is reported when it completes.  "catching_up" is reported periodically while waiting.
+	BootstrapReplica(*BootstrapReplicaRequest, grpc.ServerStreamingServer[BootstrapReplicaResponse]) error
+	// StreamBinlog reads binary log files directly from the disk and streams the events.
+	//
+	// The stream starts from the file and the position, or from the first transaction
+	// not included in the GTID set.  Events are streamed in the raw form by default.
+	// With `decode_rows`, only row events are streamed in the decoded form.
+	StreamBinlog(*StreamBinlogRequest, grpc.ServerStreamingServer[StreamBinlogResponse]) error
+	// LogicalBackup dumps schemas and tables from a consistent snapshot and streams them.
+	//
+	// The snapshot is taken as follows using the `moco-backup` user.
+	//
+	// 1. Block DDL by `LOCK INSTANCE FOR BACKUP` until the backup finishes.
+	//
+	// 2. Block commits momentarily by `FLUSH TABLES WITH READ LOCK`.
+	//
+	// 3. Open `START TRANSACTION WITH CONSISTENT SNAPSHOT` in every session dumping tables.
+	//
+	// 4. Record the executed GTID set and the binary log position, then `UNLOCK TABLES`.
+	//
+	// For each schema, `<schema>.schema.sql.gz` has the CREATE DATABASE statement, and
+	// `<schema>.routines.sql.gz`, `<schema>.triggers.sql.gz`, and `<schema>.events.sql.gz` have
+	// the CREATE statements of the stored routines, the triggers, and the events delimited by `;;` if any.
+	// For each table or view, `<schema>/<table>.schema.sql.gz` has the CREATE statement.
+	// For each table, `<schema>/<table>.sql.gz` or `<schema>/<table>.csv.gz` has the data.
+	//
+	// Files are sent in the order to be restored: schemas and routines, tables, views, then triggers and events.
+	// Each view is sent after the views it refers to.
+	LogicalBackup(*LogicalBackupRequest, grpc.ServerStreamingServer[LogicalBackupResponse]) error
+	// AcquireBackupLock quiesces mysqld for taking a volume snapshot.
+	//
+	// The agent holds the lock in a dedicated session of the `moco-backup` user.
+	// The lock is released by ReleaseBackupLock, when the lease expires, or when the agent stops.
+	// Only one lock can be held at a time, and Clone and other exclusive operations are rejected meanwhile.
+	// The binary log coordinates are returned only in the "flush_tables" mode because DML continues
+	// under LOCK INSTANCE FOR BACKUP and no coordinates match the snapshot.
+	AcquireBackupLock(context.Context, *AcquireBackupLockRequest) (*AcquireBackupLockResponse, error)
+	// ReleaseBackupLock releases the lock acquired by AcquireBackupLock.
+	ReleaseBackupLock(context.Context, *ReleaseBackupLockRequest) (*ReleaseBackupLockResponse, error)
+	// CloneLocal takes a physical snapshot by `CLONE LOCAL DATA DIRECTORY`.
+	//
+	// The snapshot is created as `snapshot-<UTC time>` under the directory given by `--clone-local-dir`.
+	// Old snapshots exceeding the retention count are removed afterward.
+	// A partially created snapshot is removed if cloning fails.
+	CloneLocal(context.Context, *CloneLocalRequest) (*CloneLocalResponse, error)
+	// ReconcilePrivileges compares the privileges of MOCO users and custom users in `SHOW GRANTS` with the declared ones,
+	// and corrects the drifts with minimal GRANT and REVOKE statements using the `moco-admin` user.
+	//
+	// Privileges on `*.*` and on databases or tables, the grant option, partial revokes, PROXY,
+	// and the account attributes are compared.  Missing custom users are created.
+	// The correction is skipped on a read-only instance because grants are replicated from the primary.
+	ReconcilePrivileges(context.Context, *ReconcilePrivilegesRequest) (*ReconcilePrivilegesResponse, error)
+	// ReconcilePlugins reports the desired and installed plugins and components,
+	// and installs the missing ones unless `dry_run` is true.
+	//
+	// The semi-synchronous replication plugins are `rpl_semi_sync_master` and `rpl_semi_sync_slave`
+	// unless `--native-semi-sync-plugins` is specified on MySQL 8.4 or later.
+	// The legacy plugins already installed are regarded as the installed ones.
+	ReconcilePlugins(context.Context, *ReconcilePluginsRequest) (*ReconcilePluginsResponse, error)
 	mustEmbedUnimplementedAgentServer()
 }
 
@@ -99,6 +464,39 @@ type UnimplementedAgentServer struct{}
 func (UnimplementedAgentServer) Clone(context.Context, *CloneRequest) (*CloneResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Clone not implemented")
 }
+func (UnimplementedAgentServer) GetCloneStatus(context.Context, *GetCloneStatusRequest) (*GetCloneStatusResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetCloneStatus not implemented")
+}
+func (UnimplementedAgentServer) PurgeBinaryLogs(context.Context, *PurgeBinaryLogsRequest) (*PurgeBinaryLogsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method PurgeBinaryLogs not implemented")
+}
+func (UnimplementedAgentServer) PointInTimeRecovery(*PointInTimeRecoveryRequest, grpc.ServerStreamingServer[PointInTimeRecoveryResponse]) error {
+	return status.Error(codes.Unimplemented, "method PointInTimeRecovery not implemented")
+}
+func (UnimplementedAgentServer) BootstrapReplica(*BootstrapReplicaRequest, grpc.ServerStreamingServer[BootstrapReplicaResponse]) error {
+	return status.Error(codes.Unimplemented, "method BootstrapReplica not implemented")
+}
+func (UnimplementedAgentServer) StreamBinlog(*StreamBinlogRequest, grpc.ServerStreamingServer[StreamBinlogResponse]) error {
+	return status.Error(codes.Unimplemented, "method StreamBinlog not implemented")
+}
+func (UnimplementedAgentServer) LogicalBackup(*LogicalBackupRequest, grpc.ServerStreamingServer[LogicalBackupResponse]) error {
+	return status.Error(codes.Unimplemented, "method LogicalBackup not implemented")
+}
+func (UnimplementedAgentServer) AcquireBackupLock(context.Context, *AcquireBackupLockRequest) (*AcquireBackupLockResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AcquireBackupLock not implemented")
+}
+func (UnimplementedAgentServer) ReleaseBackupLock(context.Context, *ReleaseBackupLockRequest) (*ReleaseBackupLockResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReleaseBackupLock not implemented")
+}
+func (UnimplementedAgentServer) CloneLocal(context.Context, *CloneLocalRequest) (*CloneLocalResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CloneLocal not implemented")
+}
+func (UnimplementedAgentServer) ReconcilePrivileges(context.Context, *ReconcilePrivilegesRequest) (*ReconcilePrivilegesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReconcilePrivileges not implemented")
+}
+func (UnimplementedAgentServer) ReconcilePlugins(context.Context, *ReconcilePluginsRequest) (*ReconcilePluginsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReconcilePlugins not implemented")
+}
 func (UnimplementedAgentServer) mustEmbedUnimplementedAgentServer() {}
 func (UnimplementedAgentServer) testEmbeddedByValue()               {}
 
@@ -138,6 +536,176 @@ func _Agent_Clone_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Agent_GetCloneStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCloneStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).GetCloneStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_GetCloneStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).GetCloneStatus(ctx, req.(*GetCloneStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_PurgeBinaryLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeBinaryLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).PurgeBinaryLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_PurgeBinaryLogs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).PurgeBinaryLogs(ctx, req.(*PurgeBinaryLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_PointInTimeRecovery_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PointInTimeRecoveryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServer).PointInTimeRecovery(m, &grpc.GenericServerStream[PointInTimeRecoveryRequest, PointInTimeRecoveryResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_PointInTimeRecoveryServer = grpc.ServerStreamingServer[PointInTimeRecoveryResponse]
+
+func _Agent_BootstrapReplica_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BootstrapReplicaRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServer).BootstrapReplica(m, &grpc.GenericServerStream[BootstrapReplicaRequest, BootstrapReplicaResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_BootstrapReplicaServer = grpc.ServerStreamingServer[BootstrapReplicaResponse]
+
+func _Agent_StreamBinlog_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamBinlogRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServer).StreamBinlog(m, &grpc.GenericServerStream[StreamBinlogRequest, StreamBinlogResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_StreamBinlogServer = grpc.ServerStreamingServer[StreamBinlogResponse]
+
+func _Agent_LogicalBackup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LogicalBackupRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServer).LogicalBackup(m, &grpc.GenericServerStream[LogicalBackupRequest, LogicalBackupResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_LogicalBackupServer = grpc.ServerStreamingServer[LogicalBackupResponse]
+
+func _Agent_AcquireBackupLock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AcquireBackupLockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).AcquireBackupLock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_AcquireBackupLock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).AcquireBackupLock(ctx, req.(*AcquireBackupLockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_ReleaseBackupLock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseBackupLockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).ReleaseBackupLock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_ReleaseBackupLock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).ReleaseBackupLock(ctx, req.(*ReleaseBackupLockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CloneLocal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloneLocalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CloneLocal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CloneLocal_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CloneLocal(ctx, req.(*CloneLocalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_ReconcilePrivileges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReconcilePrivilegesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).ReconcilePrivileges(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_ReconcilePrivileges_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).ReconcilePrivileges(ctx, req.(*ReconcilePrivilegesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_ReconcilePlugins_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReconcilePluginsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).ReconcilePlugins(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_ReconcilePlugins_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).ReconcilePlugins(ctx, req.(*ReconcilePluginsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Agent_ServiceDesc is the grpc.ServiceDesc for Agent service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -149,7 +717,56 @@ var Agent_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Clone",
 			Handler:    _Agent_Clone_Handler,
 		},
+		{
+			MethodName: "GetCloneStatus",
+			Handler:    _Agent_GetCloneStatus_Handler,
+		},
+		{
+			MethodName: "PurgeBinaryLogs",
+			Handler:    _Agent_PurgeBinaryLogs_Handler,
+		},
+		{
+			MethodName: "AcquireBackupLock",
+			Handler:    _Agent_AcquireBackupLock_Handler,
+		},
+		{
+			MethodName: "ReleaseBackupLock",
+			Handler:    _Agent_ReleaseBackupLock_Handler,
+		},
+		{
+			MethodName: "CloneLocal",
+			Handler:    _Agent_CloneLocal_Handler,
+		},
+		{
+			MethodName: "ReconcilePrivileges",
+			Handler:    _Agent_ReconcilePrivileges_Handler,
+		},
+		{
+			MethodName: "ReconcilePlugins",
+			Handler:    _Agent_ReconcilePlugins_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PointInTimeRecovery",
+			Handler:       _Agent_PointInTimeRecovery_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "BootstrapReplica",
+			Handler:       _Agent_BootstrapReplica_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamBinlog",
+			Handler:       _Agent_StreamBinlog_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "LogicalBackup",
+			Handler:       _Agent_LogicalBackup_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/agentrpc.proto",
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// MySQLAccessor is the set of operations that Agent performs on its own mysqld.
+//
+// The SQL implementation is returned by NewMySQLAccessor.  Other implementations such as
+// an in-memory fake can be given to NewWithAccessor.
+// Operations executed as other users, such as reconciling privileges and plugins as moco-admin
+// or taking the backup lock as moco-backup, are not included.
+//
+// Implementations may choose the connection to mysqld by the class given to the context with WithPoolClass.
+type MySQLAccessor interface {
+	// Ping checks that mysqld accepts queries.
+	Ping(ctx context.Context) error
+
+	GetGlobalVariables(ctx context.Context) (*MySQLGlobalVariablesStatus, error)
+	// GetCloneState returns the state of the last clone operation.  State is NULL if no clone has been run.
+	GetCloneState(ctx context.Context) (*MySQLCloneStateStatus, error)
+	GetPrimaryStatus(ctx context.Context) (*MySQLPrimaryStatus, error)
+	// GetReplicaStatus returns the status of the replication `channel`.  The empty name is the default channel.
+	GetReplicaStatus(ctx context.Context, channel string) (*MySQLReplicaStatus, error)
+	// GetTransactionTimestamps returns the original commit timestamps of the last queued and applied transactions,
+	// and the uptime of mysqld.
+	GetTransactionTimestamps(ctx context.Context) (queued, applied time.Time, uptime time.Duration, err error)
+	// GetCloneInstanceInfo returns the information compared with donors before cloning.
+	GetCloneInstanceInfo(ctx context.Context) (*CloneInstanceInfo, error)
+
+	// GetGlobalVariable stores the global system variable `name` in `dest`.
+	// `dest` is *int64, *bool, or *string.  NULL is stored as the zero value.
+	GetGlobalVariable(ctx context.Context, name string, dest any) error
+	// SetGlobalVariable sets the global system variable `name`.  `value` is int64, bool, or string.
+	SetGlobalVariable(ctx context.Context, name string, value any) error
+
+	// ListBinaryLogs returns the binary log files in order from the oldest.
+	ListBinaryLogs(ctx context.Context) ([]BinaryLog, error)
+	// ListBinlogEvents returns the first `limit` events in the binary log `file`.
+	ListBinlogEvents(ctx context.Context, file string, limit int) ([]BinlogEvent, error)
+	// PurgeBinaryLogs removes the binary logs before `file`.
+	PurgeBinaryLogs(ctx context.Context, file string) error
+	// IsGTIDSubset returns true if `set` excluding `excluded` is a subset of `superset`.
+	IsGTIDSubset(ctx context.Context, set, excluded, superset string) (bool, error)
+	// FlushSlowLogs reopens the slow query log file.
+	FlushSlowLogs(ctx context.Context) error
+
+	// ChangeReplicationSource configures the default replication channel with GTID auto positioning.
+	ChangeReplicationSource(ctx context.Context, source *ReplicationSource) error
+	// StartReplica starts the default replication channel.
+	StartReplica(ctx context.Context) error
+	// StartRelayLogApplier configures a replication channel to apply existing relay logs and starts its SQL thread.
+	StartRelayLogApplier(ctx context.Context, applier *RelayLogApplier) error
+	// RemoveReplicationChannel stops and removes the replication `channel` if it exists.
+	RemoveReplicationChannel(ctx context.Context, channel string) error
+
+	// CloneInstance executes CLONE INSTANCE.  mysqld restarts after a successful clone.
+	CloneInstance(ctx context.Context, source *CloneSource) error
+
+	// ChangePassword changes the password of the account `user`@`host` retaining the current password.
+	ChangePassword(ctx context.Context, user, host, password string) error
+	// DiscardOldPassword discards the retained password of the account `user`@`host`.
+	DiscardOldPassword(ctx context.Context, user, host string) error
+	// HasRetainedPassword returns true if the account `user`@`host` retains an old password.
+	HasRetainedPassword(ctx context.Context, user, host string) (bool, error)
+	// CheckPassword returns nil if `user` can log in with `password`.
+	CheckPassword(ctx context.Context, user, password string) error
+	// ResetConnections closes the idle connections so that new connections use the current password.
+	ResetConnections()
+
+	Close() error
+}
+
+// ReplicationSource is the source of the default replication channel.
+type ReplicationSource struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	SSL      bool
+}
+
+// RelayLogApplier is a replication channel to apply relay logs without a source.
+type RelayLogApplier struct {
+	Channel string
+	// RelayLogFile is the first relay log file to apply.
+	RelayLogFile string
+	// At most one of AfterGTIDs and BeforeGTIDs is set to stop applying.
+	AfterGTIDs  string
+	BeforeGTIDs string
+}
+
+// CloneSource is the donor of CLONE INSTANCE.
+type CloneSource struct {
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	RequireSSL bool
+}
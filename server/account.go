@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Values of accountAttributes.require.
+const (
+	requireSSL  = "SSL"
+	requireX509 = "X509"
+)
+
+// passwordLockTimeUnbounded is the value of accountAttributes.passwordLockTime for PASSWORD_LOCK_TIME UNBOUNDED.
+const passwordLockTimeUnbounded = -1
+
+// accountAttributes is the attributes of a MySQL account other than the password and privileges.
+// The zero value is the default of CREATE USER except for authPlugin, which is not reconciled if empty.
+type accountAttributes struct {
+	authPlugin string
+	// require is "", "SSL", or "X509".
+	require             string
+	maxUserConnections  int
+	maxQueriesPerHour   int
+	failedLoginAttempts int
+	// passwordLockTime is in days.
+	passwordLockTime int
+}
+
+// options returns the REQUIRE, resource, and lock options of CREATE USER or ALTER USER.
+// If `all` is true, the default values are also included to reset the actual values.
+func (at accountAttributes) options(all bool) string {
+	var opts []string
+	switch {
+	case at.require != "":
+		opts = append(opts, "REQUIRE "+at.require)
+	case all:
+		opts = append(opts, "REQUIRE NONE")
+	}
+
+	var limits []string
+	if all || at.maxUserConnections > 0 {
+		limits = append(limits, fmt.Sprintf("MAX_USER_CONNECTIONS %d", at.maxUserConnections))
+	}
+	if all || at.maxQueriesPerHour > 0 {
+		limits = append(limits, fmt.Sprintf("MAX_QUERIES_PER_HOUR %d", at.maxQueriesPerHour))
+	}
+	if len(limits) > 0 {
+		opts = append(opts, "WITH "+strings.Join(limits, " "))
+	}
+
+	if all || at.failedLoginAttempts > 0 {
+		opts = append(opts, fmt.Sprintf("FAILED_LOGIN_ATTEMPTS %d", at.failedLoginAttempts))
+	}
+	switch {
+	case at.passwordLockTime == passwordLockTimeUnbounded:
+		opts = append(opts, "PASSWORD_LOCK_TIME UNBOUNDED")
+	case all || at.passwordLockTime > 0:
+		opts = append(opts, fmt.Sprintf("PASSWORD_LOCK_TIME %d", at.passwordLockTime))
+	}
+	return strings.Join(opts, " ")
+}
+
+// getAccountAttributes returns the actual attributes of an account.
+// It returns nil if the account does not exist.
+func getAccountAttributes(ctx context.Context, db *sqlx.DB, user, host string) (*accountAttributes, error) {
+	var row struct {
+		Plugin              string `db:"plugin"`
+		SSLType             string `db:"ssl_type"`
+		MaxUserConnections  int    `db:"max_user_connections"`
+		MaxQuestions        int    `db:"max_questions"`
+		FailedLoginAttempts int    `db:"failed_login_attempts"`
+		PasswordLockTime    int    `db:"password_lock_time"`
+	}
+	err := db.GetContext(ctx, &row, `SELECT plugin, ssl_type, max_user_connections, max_questions,
+  CAST(IFNULL(JSON_EXTRACT(User_attributes, '$.Password_locking.failed_login_attempts'), 0) AS SIGNED) AS failed_login_attempts,
+  CAST(IFNULL(JSON_EXTRACT(User_attributes, '$.Password_locking.password_lock_time_days'), 0) AS SIGNED) AS password_lock_time
+FROM mysql.user WHERE user=? AND host=?`, user, host)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to select from mysql.user: %w", err)
+	}
+
+	at := &accountAttributes{
+		authPlugin:          row.Plugin,
+		maxUserConnections:  row.MaxUserConnections,
+		maxQueriesPerHour:   row.MaxQuestions,
+		failedLoginAttempts: row.FailedLoginAttempts,
+		passwordLockTime:    row.PasswordLockTime,
+	}
+	switch row.SSLType {
+	case "ANY":
+		at.require = requireSSL
+	case "X509":
+		at.require = requireX509
+	case "SPECIFIED":
+		// REQUIRE ISSUER/SUBJECT/CIPHER is not declarable.  Treat it as a drift.
+		at.require = row.SSLType
+	}
+	return at, nil
+}
+
+// diffAttributes returns the attributes of `actual` different from `declared`,
+// the ALTER USER statement to correct them except the authentication plugin,
+// and whether the authentication plugin differs.
+func diffAttributes(account string, declared, actual accountAttributes) ([]string, string, bool) {
+	var diffs []string
+	add := func(name string, d, a any) {
+		diffs = append(diffs, fmt.Sprintf("%s %v (actual %v)", name, d, a))
+	}
+
+	pluginChanged := declared.authPlugin != "" && declared.authPlugin != actual.authPlugin
+	if pluginChanged {
+		add("IDENTIFIED WITH", declared.authPlugin, actual.authPlugin)
+	}
+	changed := false
+	if declared.require != actual.require {
+		add("REQUIRE", requireString(declared.require), requireString(actual.require))
+		changed = true
+	}
+	if declared.maxUserConnections != actual.maxUserConnections {
+		add("MAX_USER_CONNECTIONS", declared.maxUserConnections, actual.maxUserConnections)
+		changed = true
+	}
+	if declared.maxQueriesPerHour != actual.maxQueriesPerHour {
+		add("MAX_QUERIES_PER_HOUR", declared.maxQueriesPerHour, actual.maxQueriesPerHour)
+		changed = true
+	}
+	if declared.failedLoginAttempts != actual.failedLoginAttempts {
+		add("FAILED_LOGIN_ATTEMPTS", declared.failedLoginAttempts, actual.failedLoginAttempts)
+		changed = true
+	}
+	if declared.passwordLockTime != actual.passwordLockTime {
+		add("PASSWORD_LOCK_TIME", lockTimeString(declared.passwordLockTime), lockTimeString(actual.passwordLockTime))
+		changed = true
+	}
+
+	if !changed {
+		return diffs, "", pluginChanged
+	}
+	return diffs, fmt.Sprintf("ALTER USER %s %s", account, declared.options(true)), pluginChanged
+}
+
+func requireString(r string) string {
+	if r == "" {
+		return "NONE"
+	}
+	return r
+}
+
+func lockTimeString(days int) string {
+	if days == passwordLockTimeUnbounded {
+		return "UNBOUNDED"
+	}
+	return fmt.Sprint(days)
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/archive"
+	"github.com/cybozu-go/moco-agent/binlog"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/go-logr/logr"
+)
+
+// BinlogArchiver archives closed binary log files to a storage.
+type BinlogArchiver struct {
+	agent    *Agent
+	storage  archive.Storage
+	compress bool
+	interval time.Duration
+	logger   logr.Logger
+
+	mu       sync.Mutex
+	manifest *archive.Manifest
+
+	// unarchived is the binary logs listed but not archived by the last Archive.
+	unarchived []string
+}
+
+// EnableBinlogArchive creates a BinlogArchiver for the agent archiving at every `interval`.
+// Once enabled, the agent never purges binary logs that have not been archived yet.
+// This should be called before purging binary logs.
+//
+// It fails if mysqld expires binary logs by binlog_expire_logs_seconds within `interval` plus `margin`,
+// where `margin` is the time allowed for uploads and retries after failures.
+func (a *Agent) EnableBinlogArchive(ctx context.Context, storage archive.Storage, compress bool, interval, margin time.Duration) (*BinlogArchiver, error) {
+	var expire int64
+	if err := a.mysql.GetGlobalVariable(ctx, "binlog_expire_logs_seconds", &expire); err != nil {
+		return nil, err
+	}
+	if expire > 0 {
+		if time.Duration(expire)*time.Second <= interval+margin {
+			return nil, fmt.Errorf("binlog_expire_logs_seconds %d is not longer than the archive interval %v plus the margin %v", expire, interval, margin)
+		}
+		a.logger.Info("mysqld removes binary logs not archived yet if archiving is delayed longer than binlog_expire_logs_seconds; consider setting it to 0",
+			"binlog_expire_logs_seconds", expire)
+	}
+
+	manifest, err := archive.LoadManifest(ctx, storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the archive manifest: %w", err)
+	}
+
+	ar := &BinlogArchiver{
+		agent:    a,
+		storage:  storage,
+		compress: compress,
+		interval: interval,
+		logger:   a.logger.WithName("binlog-archiver"),
+		manifest: manifest,
+	}
+	a.archiver.Store(ar)
+	return ar, nil
+}
+
+// Run archives binary logs until `ctx` is canceled.
+// This should be called as a goroutine.
+func (ar *BinlogArchiver) Run(ctx context.Context) {
+	tick := time.NewTicker(ar.interval)
+	defer tick.Stop()
+
+	for {
+		if err := ar.Archive(ctx); err != nil {
+			ar.logger.Error(err, "failed to archive binary logs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// IsArchived returns true if the binary log file `name` has been archived.
+func (ar *BinlogArchiver) IsArchived(name string) bool {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.manifest.Find(name) != nil
+}
+
+// Manifest returns a copy of the current manifest.
+func (ar *BinlogArchiver) Manifest() archive.Manifest {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return archive.Manifest{Binlogs: append([]archive.Entry(nil), ar.manifest.Binlogs...)}
+}
+
+// Archive uploads closed binary log files that have not been archived yet.
+func (ar *BinlogArchiver) Archive(ctx context.Context) error {
+	logs, err := ar.agent.ListBinaryLogs(ctx)
+	if err != nil {
+		return err
+	}
+	dir, err := ar.agent.binlogDir(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The last binary log is still being written.
+	closed := logs[:max(len(logs)-1, 0)]
+	defer ar.updateLag(dir, closed)
+
+	var expiredErr error
+	if expired := ar.findExpired(logs); len(expired) > 0 {
+		metrics.BinlogArchiveFailureCount.Inc()
+		metrics.BinlogArchiveExpiredCount.Add(float64(len(expired)))
+		expiredErr = fmt.Errorf("mysqld removed binary logs before archiving them: %s", strings.Join(expired, ", "))
+	}
+
+	for _, l := range closed {
+		if ar.IsArchived(l.Name) {
+			continue
+		}
+
+		startTime := time.Now()
+		if err := ar.archiveFile(ctx, dir, l); err != nil {
+			metrics.BinlogArchiveFailureCount.Inc()
+			return errors.Join(expiredErr, fmt.Errorf("failed to archive %s: %w", l.Name, err))
+		}
+		metrics.BinlogArchiveCount.Inc()
+		metrics.BinlogArchiveDurationSeconds.Observe(time.Since(startTime).Seconds())
+		ar.logger.Info("archived binary log", "file", l.Name)
+	}
+	return expiredErr
+}
+
+// findExpired returns the binary logs not archived by the last Archive and missing in `logs`.
+// They have been removed by mysqld, such as by binlog_expire_logs_seconds, and can never be archived.
+func (ar *BinlogArchiver) findExpired(logs []BinaryLog) []string {
+	listed := make(map[string]bool, len(logs))
+	for _, l := range logs {
+		listed[l.Name] = true
+	}
+
+	var expired []string
+	for _, name := range ar.unarchived {
+		if !listed[name] && !ar.IsArchived(name) {
+			expired = append(expired, name)
+		}
+	}
+
+	ar.unarchived = ar.unarchived[:0]
+	for _, l := range logs {
+		if !ar.IsArchived(l.Name) {
+			ar.unarchived = append(ar.unarchived, l.Name)
+		}
+	}
+	return expired
+}
+
+func (ar *BinlogArchiver) archiveFile(ctx context.Context, dir string, l BinaryLog) error {
+	f, err := os.Open(filepath.Join(dir, l.Name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entry := archive.Entry{
+		Name:   l.Name,
+		Object: l.Name,
+	}
+
+	h := sha256.New()
+	r := io.TeeReader(f, h)
+	if l.Encrypted == "Yes" {
+		// Encrypted binary logs cannot be parsed.  Archive them without GTID information.
+		entry.Encrypted = true
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+	} else {
+		info, err := binlog.Scan(r)
+		if err != nil {
+			return fmt.Errorf("failed to read binary log: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		entry.PreviousGTIDSet = info.PreviousGTIDs.String()
+		entry.GTIDSet = info.GTIDs.String()
+		entry.FirstEventTime = info.FirstEventTime
+		entry.LastEventTime = info.LastEventTime
+	}
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	entry.Size = size
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var body io.ReadSeeker = f
+	entry.ObjectSHA256 = entry.SHA256
+	if ar.compress {
+		tmp, sum, err := compressToTemp(f)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		body = tmp
+		entry.Object = l.Name + ".gz"
+		entry.ObjectSHA256 = sum
+		entry.Compression = archive.CompressionGzip
+	}
+
+	if err := ar.storage.Put(ctx, entry.Object, body); err != nil {
+		return err
+	}
+	entry.ArchivedAt = time.Now().UTC()
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	manifest := &archive.Manifest{Binlogs: append(ar.manifest.Binlogs[:len(ar.manifest.Binlogs):len(ar.manifest.Binlogs)], entry)}
+	if err := manifest.Save(ctx, ar.storage); err != nil {
+		return fmt.Errorf("failed to save the archive manifest: %w", err)
+	}
+	ar.manifest = manifest
+	return nil
+}
+
+// compressToTemp writes gzip-compressed contents of r to a temporary file.
+// It returns the file rewound to the beginning and the SHA256 checksum of the compressed data.
+func compressToTemp(r io.Reader) (*os.File, string, error) {
+	tmp, err := os.CreateTemp("", "moco-binlog-")
+	if err != nil {
+		return nil, "", err
+	}
+
+	h := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(tmp, h))
+	_, err = io.Copy(zw, r)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", fmt.Errorf("failed to compress binary log: %w", err)
+	}
+	return tmp, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// updateLag sets the age of the oldest closed binary log that has not been archived yet.
+func (ar *BinlogArchiver) updateLag(dir string, closed []BinaryLog) {
+	for _, l := range closed {
+		if ar.IsArchived(l.Name) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, l.Name))
+		if err != nil {
+			ar.logger.Error(err, "failed to stat binary log", "file", l.Name)
+			return
+		}
+		metrics.BinlogArchiveLagSeconds.Set(time.Since(fi.ModTime()).Seconds())
+		return
+	}
+	metrics.BinlogArchiveLagSeconds.Set(0)
+}
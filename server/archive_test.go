@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/archive"
+	"github.com/cybozu-go/moco-agent/binlog"
+	"github.com/cybozu-go/moco-agent/mysqltest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BinlogArchiver", func() {
+	It("should report binary logs removed by mysqld before archived", func() {
+		inst, agent := startFakeMySQLD()
+		t0 := time.Now().Add(-time.Hour).Truncate(time.Second)
+		writeTestBinlogs(inst, t0)
+
+		storage, err := archive.NewLocalStorage(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		ar, err := agent.EnableBinlogArchive(context.Background(), storage, false, time.Minute, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ar.Archive(context.Background())).To(Succeed())
+		Expect(ar.Manifest().Binlogs).To(HaveLen(2))
+
+		By("expiring the active binary log after it is closed")
+		executed, err := binlog.ParseGTIDSet(testUUID + ":1-4")
+		Expect(err).NotTo(HaveOccurred())
+		f := mysqltest.NewBinlogFile(t0.Add(30*time.Second), executed)
+		Expect(inst.WriteBinaryLog("binlog.000004", f)).To(Succeed())
+		Expect(agent.mysql.PurgeBinaryLogs(context.Background(), "binlog.000004")).To(Succeed())
+
+		err = ar.Archive(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("binlog.000003")))
+		Expect(ar.IsArchived("binlog.000003")).To(BeFalse())
+
+		By("reporting the removed binary log only once")
+		Expect(ar.Archive(context.Background())).To(Succeed())
+	})
+})
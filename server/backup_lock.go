@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/go-logr/logr"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	backupLockModeInstance    = "instance"
+	backupLockModeFlushTables = "flush_tables"
+
+	defaultBackupLockTTL = 5 * time.Minute
+)
+
+// backupLock is a lock held in a dedicated session until it is released.
+type backupLock struct {
+	id     string
+	mode   string
+	db     *sqlx.DB
+	conn   *sqlx.Conn
+	timer  *time.Timer
+	logger logr.Logger
+}
+
+// backupCoordinates is the binary log coordinates under a backup lock.
+type backupCoordinates struct {
+	GTIDSet        string `db:"gtid_set"`
+	BinlogFile     string `db:"binlog_file"`
+	BinlogPosition int64  `db:"binlog_position"`
+}
+
+func (s agentService) AcquireBackupLock(ctx context.Context, req *proto.AcquireBackupLockRequest) (*proto.AcquireBackupLockResponse, error) {
+	return s.agent.AcquireBackupLock(ctx, req)
+}
+
+func (s agentService) ReleaseBackupLock(ctx context.Context, req *proto.ReleaseBackupLockRequest) (*proto.ReleaseBackupLockResponse, error) {
+	if err := s.agent.ReleaseBackupLock(ctx, req.LockId); err != nil {
+		return nil, err
+	}
+	return &proto.ReleaseBackupLockResponse{}, nil
+}
+
+// AcquireBackupLock acquires a backup lock and holds it until released or the lease expires.
+func (a *Agent) AcquireBackupLock(ctx context.Context, req *proto.AcquireBackupLockRequest) (*proto.AcquireBackupLockResponse, error) {
+	mode := req.Mode
+	if mode == "" {
+		mode = backupLockModeInstance
+	}
+	var stmt string
+	switch mode {
+	case backupLockModeInstance:
+		stmt = `LOCK INSTANCE FOR BACKUP`
+	case backupLockModeFlushTables:
+		stmt = `FLUSH TABLES WITH READ LOCK`
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown mode: %s", req.Mode)
+	}
+	ttl := defaultBackupLockTTL
+	if req.Ttl != nil {
+		ttl = req.Ttl.AsDuration()
+		if ttl <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid ttl: %s", ttl)
+		}
+	}
+
+	select {
+	case a.cloneLock <- struct{}{}:
+	default:
+		return nil, status.Error(codes.ResourceExhausted, "another request is undergoing")
+	}
+	releaseCloneLock := true
+	defer func() {
+		if releaseCloneLock {
+			<-a.cloneLock
+		}
+	}()
+
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	db, err := GetMySQLConnLocalSocket(mocoagent.BackupUser, a.userPassword(mocoagent.BackupUser), a.mysqlSocketPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to connect to mysqld through %s: %+v", a.mysqlSocketPath, err)
+	}
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		db.Close()
+		return nil, status.Errorf(codes.Internal, "failed to connect to mysqld: %+v", err)
+	}
+	l := &backupLock{id: rand.Text(), mode: mode, db: db, conn: conn, logger: logger}
+
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		l.close()
+		logger.Error(err, "failed to acquire backup lock", "mode", mode)
+		return nil, mysqlStatusError(codes.Internal, err, "failed to "+stmt)
+	}
+
+	// LOCK INSTANCE FOR BACKUP does not block DML, so no coordinates match the snapshot.
+	// FLUSH TABLES WITH READ LOCK blocks writes, and the coordinates are read in the locked session.
+	var coords backupCoordinates
+	if mode == backupLockModeFlushTables {
+		err := conn.GetContext(ctx, &coords, `SELECT LOCAL->>'$.gtid_executed' AS gtid_set,
+  LOCAL->>'$.binary_log_file' AS binlog_file, LOCAL->>'$.binary_log_position' AS binlog_position
+FROM performance_schema.log_status`)
+		if err != nil {
+			l.close()
+			return nil, mysqlStatusError(codes.Internal, err, "failed to get the binary log coordinates")
+		}
+	}
+
+	a.backupLockMu.Lock()
+	a.backupLock = l
+	l.timer = time.AfterFunc(ttl, func() {
+		if a.releaseBackupLock(l.id) {
+			logger.Info("backup lock expired", "id", l.id)
+		}
+	})
+	a.backupLockMu.Unlock()
+	releaseCloneLock = false
+	metrics.BackupLockHeld.Set(1)
+
+	expire := time.Now().Add(ttl)
+	logger.Info("acquired backup lock", "id", l.id, "mode", mode, "ttl", ttl.String(), "gtid", coords.GTIDSet)
+	return &proto.AcquireBackupLockResponse{
+		LockId:         l.id,
+		GtidSet:        coords.GTIDSet,
+		BinlogFile:     coords.BinlogFile,
+		BinlogPosition: coords.BinlogPosition,
+		ExpireTime:     timestamppb.New(expire),
+	}, nil
+}
+
+// ReleaseBackupLock releases the backup lock identified by `id`.
+func (a *Agent) ReleaseBackupLock(ctx context.Context, id string) error {
+	if id == "" {
+		return status.Error(codes.InvalidArgument, "lock_id is empty")
+	}
+	if !a.releaseBackupLock(id) {
+		return status.Errorf(codes.NotFound, "backup lock %s is not held", id)
+	}
+	a.logger.WithValues(logging.ExtractFields(ctx)...).Info("released backup lock", "id", id)
+	return nil
+}
+
+// releaseBackupLock releases the backup lock if it is held.
+// If `id` is empty, the lock is released regardless of its ID.
+func (a *Agent) releaseBackupLock(id string) bool {
+	a.backupLockMu.Lock()
+	l := a.backupLock
+	if l == nil || (id != "" && l.id != id) {
+		a.backupLockMu.Unlock()
+		return false
+	}
+	a.backupLock = nil
+	a.backupLockMu.Unlock()
+
+	l.timer.Stop()
+	l.unlock()
+	l.close()
+	metrics.BackupLockHeld.Set(0)
+	<-a.cloneLock
+	return true
+}
+
+func (l *backupLock) unlock() {
+	stmt := `UNLOCK INSTANCE`
+	if l.mode == backupLockModeFlushTables {
+		stmt = `UNLOCK TABLES`
+	}
+	// Even if this fails, closing the session releases the lock.
+	if _, err := l.conn.ExecContext(context.Background(), stmt); err != nil {
+		l.logger.Error(err, "failed to release backup lock", "id", l.id)
+	}
+}
+
+func (l *backupLock) close() {
+	l.conn.Close()
+	l.db.Close()
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var _ = Describe("backup lock", func() {
+	It("should hold the lock until released or expired", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, adminUserPassword, sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		_, err = db.Exec(`SET GLOBAL super_read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`SET GLOBAL read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE DATABASE foo`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE TABLE foo.bar (i INT PRIMARY KEY) ENGINE=InnoDB`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`SET SESSION lock_wait_timeout=1`)
+		Expect(err).NotTo(HaveOccurred())
+		db.SetMaxOpenConns(1)
+
+		By("passing invalid requests")
+		_, err = agent.AcquireBackupLock(context.Background(), &proto.AcquireBackupLockRequest{Mode: "invalid"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		_, err = agent.AcquireBackupLock(context.Background(), &proto.AcquireBackupLockRequest{Ttl: durationpb.New(-time.Second)})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		By("acquiring FLUSH TABLES WITH READ LOCK")
+		resp, err := agent.AcquireBackupLock(context.Background(), &proto.AcquireBackupLockRequest{Mode: backupLockModeFlushTables})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.LockId).NotTo(BeEmpty())
+		Expect(resp.GtidSet).NotTo(BeEmpty())
+		Expect(resp.BinlogFile).NotTo(BeEmpty())
+
+		_, err = db.Exec(`INSERT INTO foo.bar VALUES (1)`)
+		Expect(err).To(HaveOccurred())
+
+		_, err = agent.AcquireBackupLock(context.Background(), &proto.AcquireBackupLockRequest{})
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+
+		By("releasing the lock")
+		err = agent.ReleaseBackupLock(context.Background(), "unknown")
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+		err = agent.ReleaseBackupLock(context.Background(), resp.LockId)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`INSERT INTO foo.bar VALUES (1)`)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("acquiring LOCK INSTANCE FOR BACKUP with a short lease")
+		resp, err = agent.AcquireBackupLock(context.Background(), &proto.AcquireBackupLockRequest{Ttl: durationpb.New(3 * time.Second)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.GtidSet).To(BeEmpty())
+		Expect(resp.BinlogFile).To(BeEmpty())
+		_, err = db.Exec(`INSERT INTO foo.bar VALUES (2)`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE TABLE foo.baz (i INT PRIMARY KEY) ENGINE=InnoDB`)
+		Expect(err).To(HaveOccurred())
+
+		Eventually(func() error {
+			_, err := db.Exec(`CREATE TABLE foo.baz (i INT PRIMARY KEY) ENGINE=InnoDB`)
+			return err
+		}).Should(Succeed())
+		err = agent.ReleaseBackupLock(context.Background(), resp.LockId)
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+})
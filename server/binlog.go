@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BinaryLog represents a binary log file listed by SHOW BINARY LOGS.
+type BinaryLog struct {
+	Name      string `db:"Log_name"`
+	Size      int64  `db:"File_size"`
+	Encrypted string `db:"Encrypted"`
+}
+
+// BinlogEvent represents an event listed by SHOW BINLOG EVENTS.
+type BinlogEvent struct {
+	LogName   string `db:"Log_name"`
+	Pos       int64  `db:"Pos"`
+	EventType string `db:"Event_type"`
+	ServerID  int64  `db:"Server_id"`
+	EndLogPos int64  `db:"End_log_pos"`
+	Info      string `db:"Info"`
+}
+
+// binlogPurgeConstraints are the conditions that the binary logs to be purged should satisfy.
+type binlogPurgeConstraints struct {
+	replicaGTIDSets []string
+	minRetention    time.Duration
+	toFile          string
+}
+
+func (s agentService) PurgeBinaryLogs(ctx context.Context, req *proto.PurgeBinaryLogsRequest) (*proto.PurgeBinaryLogsResponse, error) {
+	purged, err := s.agent.PurgeBinaryLogs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.PurgeBinaryLogsResponse{PurgedFiles: purged}, nil
+}
+
+// PurgeBinaryLogs purges binary logs that satisfy all the constraints in req.
+// It returns the names of the purged files.
+func (a *Agent) PurgeBinaryLogs(ctx context.Context, req *proto.PurgeBinaryLogsRequest) ([]string, error) {
+	c := binlogPurgeConstraints{
+		replicaGTIDSets: req.ReplicaGtidSets,
+		toFile:          req.ToFile,
+	}
+	if req.MinRetention != nil {
+		c.minRetention = req.MinRetention.AsDuration()
+	}
+	if len(c.replicaGTIDSets) == 0 && c.minRetention <= 0 && c.toFile == "" {
+		return nil, status.Error(codes.InvalidArgument, "no constraint is specified")
+	}
+
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	purged, err := a.purgeBinaryLogs(ctx, c)
+	if err != nil {
+		logger.Error(err, "failed to purge binary logs")
+		return nil, err
+	}
+	if len(purged) > 0 {
+		logger.Info("purged binary logs", "files", purged)
+	}
+	return purged, nil
+}
+
+// PurgeExpiredBinaryLogs purges binary logs written before the retention period.
+func (a *Agent) PurgeExpiredBinaryLogs(retention time.Duration) {
+	purged, err := a.purgeBinaryLogs(context.Background(), binlogPurgeConstraints{minRetention: retention})
+	if err != nil {
+		a.logger.Error(err, "failed to purge expired binary logs")
+		return
+	}
+	if len(purged) > 0 {
+		a.logger.Info("purged expired binary logs", "files", purged)
+	}
+}
+
+func (a *Agent) purgeBinaryLogs(ctx context.Context, c binlogPurgeConstraints) ([]string, error) {
+	a.binlogLock.Lock()
+	defer a.binlogLock.Unlock()
+
+	metrics.BinlogPurgeCount.Inc()
+	startTime := time.Now()
+
+	purged, err := a.doPurgeBinaryLogs(ctx, c)
+	if err != nil {
+		metrics.BinlogPurgeFailureCount.Inc()
+		return nil, err
+	}
+
+	metrics.BinlogPurgeDurationSeconds.Observe(time.Since(startTime).Seconds())
+	return purged, nil
+}
+
+func (a *Agent) doPurgeBinaryLogs(ctx context.Context, c binlogPurgeConstraints) ([]string, error) {
+	logs, err := a.ListBinaryLogs(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%+v", err)
+	}
+
+	// logs[:limit] are the purge candidates.
+	// The last one is the active binary log, so it is never purged.
+	limit := len(logs) - 1
+
+	if c.toFile != "" {
+		idx := slices.IndexFunc(logs, func(l BinaryLog) bool { return l.Name == c.toFile })
+		if idx < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "binary log %s is not found", c.toFile)
+		}
+		limit = min(limit, idx)
+	}
+
+	if archiver := a.archiver.Load(); archiver != nil {
+		for i := 0; i < limit; i++ {
+			if !archiver.IsArchived(logs[i].Name) {
+				limit = i
+				break
+			}
+		}
+	}
+
+	if c.minRetention > 0 && limit > 0 {
+		dir, err := a.binlogDir(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%+v", err)
+		}
+		threshold := time.Now().Add(-c.minRetention)
+		for i := 0; i < limit; i++ {
+			fi, err := os.Stat(filepath.Join(dir, logs[i].Name))
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to stat binary log %s: %+v", logs[i].Name, err)
+			}
+			if fi.ModTime().After(threshold) {
+				limit = i
+				break
+			}
+		}
+	}
+
+	if len(c.replicaGTIDSets) > 0 && limit > 0 {
+		oldest, err := a.GetPreviousGTIDs(ctx, logs[0].Name)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%+v", err)
+		}
+		for ; limit > 0; limit-- {
+			ok, err := a.canPurgeTo(ctx, logs[limit].Name, oldest, c.replicaGTIDSets)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "%+v", err)
+			}
+			if ok {
+				break
+			}
+		}
+	}
+
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	if err := a.mysql.PurgeBinaryLogs(ctx, logs[limit].Name); err != nil {
+		return nil, status.Errorf(codes.Internal, "%+v", err)
+	}
+
+	// mysqld may keep files that are in use, so check what has been actually removed.
+	remaining, err := a.ListBinaryLogs(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%+v", err)
+	}
+	var purged []string
+	for _, l := range logs[:limit] {
+		if !slices.ContainsFunc(remaining, func(r BinaryLog) bool { return r.Name == l.Name }) {
+			purged = append(purged, l.Name)
+		}
+	}
+	return purged, nil
+}
+
+// canPurgeTo returns true if all GTIDs in binary logs before `file` are executed in every replica.
+// `oldest` is the previous GTID set of the oldest binary log.
+func (a *Agent) canPurgeTo(ctx context.Context, file, oldest string, replicaGTIDSets []string) (bool, error) {
+	prev, err := a.GetPreviousGTIDs(ctx, file)
+	if err != nil {
+		return false, err
+	}
+	for _, set := range replicaGTIDSets {
+		ok, err := a.mysql.IsGTIDSubset(ctx, prev, oldest, set)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ListBinaryLogs returns the binary log files in order from the oldest.
+func (a *Agent) ListBinaryLogs(ctx context.Context) ([]BinaryLog, error) {
+	return a.mysql.ListBinaryLogs(ctx)
+}
+
+// GetPreviousGTIDs returns the GTID set executed before the binary log `file`.
+func (a *Agent) GetPreviousGTIDs(ctx context.Context, file string) (string, error) {
+	events, err := a.mysql.ListBinlogEvents(ctx, file, 2)
+	if err != nil {
+		return "", err
+	}
+	for _, ev := range events {
+		if ev.EventType == "Previous_gtids" {
+			return ev.Info, nil
+		}
+	}
+	return "", fmt.Errorf("no Previous_gtids event in %s", file)
+}
+
+func (a *Agent) binlogDir(ctx context.Context) (string, error) {
+	var basename string
+	if err := a.mysql.GetGlobalVariable(ctx, "log_bin_basename", &basename); err != nil {
+		return "", err
+	}
+	return filepath.Dir(basename), nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("purge binary logs", func() {
+	It("should purge binary logs not needed by replicas", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, adminUserPassword, sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		By("writing transactions to multiple binary logs")
+		_, err = db.Exec("SET GLOBAL super_read_only=0")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec("CREATE DATABASE foo")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec("CREATE TABLE foo.bar (i INT PRIMARY KEY) ENGINE=InnoDB")
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 3; i++ {
+			_, err = db.Exec("INSERT INTO foo.bar (i) VALUES (?)", i)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = db.Exec("FLUSH BINARY LOGS")
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		logs, err := agent.ListBinaryLogs(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(logs)).To(BeNumerically(">=", 4))
+
+		By("rejecting a request without constraints")
+		_, err = agent.PurgeBinaryLogs(context.Background(), &proto.PurgeBinaryLogsRequest{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		By("rejecting an unknown file")
+		_, err = agent.PurgeBinaryLogs(context.Background(), &proto.PurgeBinaryLogsRequest{ToFile: "no-such-file.000001"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		By("keeping binary logs needed by a replica")
+		prev, err := agent.GetPreviousGTIDs(context.Background(), logs[1].Name)
+		Expect(err).NotTo(HaveOccurred())
+		purged, err := agent.PurgeBinaryLogs(context.Background(), &proto.PurgeBinaryLogsRequest{
+			ReplicaGtidSets: []string{prev},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(Equal([]string{logs[0].Name}))
+
+		By("purging binary logs up to the specified file")
+		purged, err = agent.PurgeBinaryLogs(context.Background(), &proto.PurgeBinaryLogsRequest{
+			ToFile: logs[len(logs)-1].Name,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(HaveLen(len(logs) - 2))
+
+		remaining, err := agent.ListBinaryLogs(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(HaveLen(1))
+		Expect(remaining[0].Name).To(Equal(logs[len(logs)-1].Name))
+	})
+})
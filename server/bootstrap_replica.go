@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/go-logr/logr"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	defaultBootstrapMaxLag  = 1 * time.Second
+	bootstrapPollInterval   = 1 * time.Second
+	bootstrapReportInterval = 10 * time.Second
+)
+
+// Values of Replica_IO_Running and Replica_SQL_Running.
+const (
+	replicationThreadRunning = "Yes"
+	replicationThreadStopped = "No"
+)
+
+// Phases reported in BootstrapReplicaResponse.
+const (
+	bootstrapPhaseCloned     = "cloned"
+	bootstrapPhaseConfigured = "replication_configured"
+	bootstrapPhaseStarted    = "replication_started"
+	bootstrapPhaseCatchingUp = "catching_up"
+	bootstrapPhaseCompleted  = "completed"
+)
+
+func (s agentService) BootstrapReplica(req *proto.BootstrapReplicaRequest, stream proto.Agent_BootstrapReplicaServer) error {
+	return s.agent.BootstrapReplica(stream.Context(), req, stream.Send)
+}
+
+// BootstrapReplica clones the instance, starts the replication, and waits for it to catch up.
+// The progress is passed to `report`.
+func (a *Agent) BootstrapReplica(ctx context.Context, req *proto.BootstrapReplicaRequest, report func(*proto.BootstrapReplicaResponse) error) error {
+	if req.Clone == nil {
+		return status.Error(codes.InvalidArgument, "clone is not specified")
+	}
+	if req.Clone.DryRun {
+		return status.Error(codes.InvalidArgument, "dry_run cannot be used with BootstrapReplica")
+	}
+	if req.SourceUser == "" {
+		return status.Error(codes.InvalidArgument, "source_user is not specified")
+	}
+	maxLag := defaultBootstrapMaxLag
+	if req.MaxLag != nil {
+		maxLag = req.MaxLag.AsDuration()
+		if maxLag <= 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid max_lag: %s", maxLag)
+		}
+	}
+
+	select {
+	case a.cloneLock <- struct{}{}:
+	default:
+		return status.Error(codes.ResourceExhausted, "another request is undergoing")
+	}
+	defer func() { <-a.cloneLock }()
+
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	if err := a.bootstrapReplica(ctx, req, maxLag, report, logger); err != nil {
+		logger.Error(err, "failed to bootstrap the replica")
+		return err
+	}
+	return nil
+}
+
+func (a *Agent) bootstrapReplica(ctx context.Context, req *proto.BootstrapReplicaRequest, maxLag time.Duration, report func(*proto.BootstrapReplicaResponse) error, logger logr.Logger) error {
+	cloned, err := a.cloneInstance(ctx, req.Clone, logger)
+	if err != nil {
+		return err
+	}
+
+	progress := &proto.BootstrapReplicaResponse{
+		DonorHost:  cloned.DonorHost,
+		DonorPort:  cloned.DonorPort,
+		SourceHost: cloned.DonorHost,
+		SourcePort: cloned.DonorPort,
+	}
+	if req.SourceHost != "" {
+		progress.SourceHost = req.SourceHost
+	}
+	if req.SourcePort != 0 {
+		progress.SourcePort = req.SourcePort
+	}
+	send := func(phase string) error {
+		progress.Phase = phase
+		// progress is updated after reported.
+		return report(protobuf.Clone(progress).(*proto.BootstrapReplicaResponse))
+	}
+	if err := send(bootstrapPhaseCloned); err != nil {
+		return err
+	}
+
+	err = a.mysql.ChangeReplicationSource(ctx, &ReplicationSource{
+		Host:     progress.SourceHost,
+		Port:     int(progress.SourcePort),
+		User:     req.SourceUser,
+		Password: req.SourcePassword,
+		SSL:      req.SourceSsl,
+	})
+	if err != nil {
+		return mysqlStatusError(codes.Internal, err, "failed to configure the replication")
+	}
+	logger.Info("configured the replication", "source", progress.SourceHost, "port", progress.SourcePort)
+	if err := send(bootstrapPhaseConfigured); err != nil {
+		return err
+	}
+
+	if err := a.mysql.StartReplica(ctx); err != nil {
+		return mysqlStatusError(codes.Internal, err, "failed to start the replication")
+	}
+	logger.Info("started the replication")
+	if err := send(bootstrapPhaseStarted); err != nil {
+		return err
+	}
+
+	if req.CatchUpTimeout != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.CatchUpTimeout.AsDuration())
+		defer cancel()
+	}
+
+	var lastReport time.Time
+	for {
+		replicaStatus, err := a.GetMySQLReplicaStatus(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return status.Errorf(codes.Internal, "%+v", err)
+		}
+		lag, caughtUp, err := replicaCaughtUp(replicaStatus, maxLag)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%+v", err)
+		}
+		if lag >= 0 {
+			progress.Lag = durationpb.New(lag)
+		}
+		if caughtUp {
+			break
+		}
+
+		if time.Since(lastReport) >= bootstrapReportInterval {
+			logger.Info("waiting for the replica to catch up", "lag", lag.Seconds(), "io_thread", replicaStatus.ReplicaIORunning)
+			if err := send(bootstrapPhaseCatchingUp); err != nil {
+				return err
+			}
+			lastReport = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(bootstrapPollInterval):
+		}
+	}
+
+	logger.Info("the replica caught up", "lag", progress.Lag.AsDuration().Seconds())
+	return send(bootstrapPhaseCompleted)
+}
+
+// replicaCaughtUp returns the replication lag and true if the lag is less than `maxLag`.
+// The lag is -1 if unknown.  It returns an error if a replication thread stopped.
+func replicaCaughtUp(st *MySQLReplicaStatus, maxLag time.Duration) (time.Duration, bool, error) {
+	if st.ReplicaSQLRunning != replicationThreadRunning {
+		if st.LastSQLErrno != 0 {
+			return -1, false, fmt.Errorf("replication SQL thread stopped: %d: %s", st.LastSQLErrno, st.LastSQLError)
+		}
+		return -1, false, errors.New("replication SQL thread stopped")
+	}
+	if st.ReplicaIORunning == replicationThreadStopped {
+		if st.LastIOErrno != 0 {
+			return -1, false, fmt.Errorf("replication I/O thread stopped: %d: %s", st.LastIOErrno, st.LastIOError)
+		}
+		return -1, false, errors.New("replication I/O thread stopped")
+	}
+
+	// Seconds_Behind_Source is NULL while the I/O thread is connecting to the source.
+	if st.ReplicaIORunning != replicationThreadRunning || !st.SecondsBehindSource.Valid {
+		return -1, false, nil
+	}
+	lag := time.Duration(st.SecondsBehindSource.Int64) * time.Second
+	return lag, lag < maxLag, nil
+}
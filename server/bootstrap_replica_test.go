@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var _ = Describe("BootstrapReplica", func() {
+	It("should validate the request", func() {
+		agent := &Agent{cloneLock: make(chan struct{}, 1)}
+		report := func(*proto.BootstrapReplicaResponse) error { return nil }
+
+		err := agent.BootstrapReplica(context.Background(), &proto.BootstrapReplicaRequest{SourceUser: "repl"}, report)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		err = agent.BootstrapReplica(context.Background(), &proto.BootstrapReplicaRequest{
+			Clone:      &proto.CloneRequest{DryRun: true},
+			SourceUser: "repl",
+		}, report)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		err = agent.BootstrapReplica(context.Background(), &proto.BootstrapReplicaRequest{Clone: &proto.CloneRequest{}}, report)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		err = agent.BootstrapReplica(context.Background(), &proto.BootstrapReplicaRequest{
+			Clone:      &proto.CloneRequest{},
+			SourceUser: "repl",
+			MaxLag:     durationpb.New(0),
+		}, report)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should judge the replica caught up", func() {
+		st := &MySQLReplicaStatus{
+			ReplicaIORunning:    "Connecting",
+			ReplicaSQLRunning:   "Yes",
+			SecondsBehindSource: sql.NullInt64{},
+		}
+		lag, ok, err := replicaCaughtUp(st, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(lag).To(Equal(time.Duration(-1)))
+
+		st.ReplicaIORunning = "Yes"
+		st.SecondsBehindSource = sql.NullInt64{Int64: 5, Valid: true}
+		lag, ok, err = replicaCaughtUp(st, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(lag).To(Equal(5 * time.Second))
+
+		st.SecondsBehindSource.Int64 = 0
+		lag, ok, err = replicaCaughtUp(st, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(lag).To(BeZero())
+
+		st.ReplicaIORunning = "No"
+		st.LastIOErrno = 13117
+		st.LastIOError = "fatal error"
+		_, _, err = replicaCaughtUp(st, time.Second)
+		Expect(err).To(MatchError(ContainSubstring("13117: fatal error")))
+
+		st.ReplicaSQLRunning = "No"
+		st.LastSQLErrno = 1062
+		st.LastSQLError = "duplicate entry"
+		_, _, err = replicaCaughtUp(st, time.Second)
+		Expect(err).To(MatchError(ContainSubstring("SQL thread stopped: 1062")))
+	})
+})
@@ -4,10 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net"
 	"time"
 
-	mocoagent "github.com/cybozu-go/moco-agent"
 	"github.com/cybozu-go/moco-agent/metrics"
 	"github.com/cybozu-go/moco-agent/proto"
 	"github.com/go-logr/logr"
@@ -20,22 +18,58 @@ import (
 const cloneBootstrapTimeout = 10 * time.Minute
 
 func (s agentService) Clone(ctx context.Context, req *proto.CloneRequest) (*proto.CloneResponse, error) {
-	if err := s.agent.Clone(ctx, req); err != nil {
-		return nil, err
-	}
-	return &proto.CloneResponse{}, nil
+	return s.agent.Clone(ctx, req)
 }
 
-func (a *Agent) Clone(ctx context.Context, req *proto.CloneRequest) error {
+func (a *Agent) Clone(ctx context.Context, req *proto.CloneRequest) (*proto.CloneResponse, error) {
 	select {
 	case a.cloneLock <- struct{}{}:
 	default:
-		return status.Error(codes.ResourceExhausted, "another request is undergoing")
+		return nil, status.Error(codes.ResourceExhausted, "another request is undergoing")
 	}
 	defer func() { <-a.cloneLock }()
 
 	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+	return a.cloneInstance(ctx, req, logger)
+}
+
+// cloneInstance runs Clone.  The caller must hold cloneLock.
+func (a *Agent) cloneInstance(ctx context.Context, req *proto.CloneRequest, logger logr.Logger) (*proto.CloneResponse, error) {
+	vars, err := cloneVariables(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%+v", err)
+	}
 
+	if req.MaxAttempts < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max_attempts: %d", req.MaxAttempts)
+	}
+	for _, c := range req.Candidates {
+		if c.Host == "" || c.Port <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid candidate: %s:%d", c.Host, c.Port)
+		}
+	}
+
+	if err := a.checkRecipientEmpty(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	donors, reason, err := a.selectDonors(ctx, req, logger)
+	if err != nil {
+		logger.Error(err, "preflight checks failed")
+		return nil, err
+	}
+	logger.Info("selected donor", "donor", donors[0].addr(), "reason", reason)
+	if req.DryRun {
+		return &proto.CloneResponse{DonorHost: donors[0].host, DonorPort: int32(donors[0].port), Reason: reason}, nil
+	}
+
+	a.cloneOp.start()
+	res, err := a.clone(ctx, req, donors, reason, vars, logger)
+	a.cloneOp.finish(err)
+	return res, err
+}
+
+func (a *Agent) checkRecipientEmpty(ctx context.Context, logger logr.Logger) error {
 	primaryStatus, err := a.GetMySQLPrimaryStatus(ctx)
 	if err != nil {
 		logger.Error(err, "failed to get MySQL primary status")
@@ -47,7 +81,11 @@ func (a *Agent) Clone(ctx context.Context, req *proto.CloneRequest) error {
 		logger.Error(err, "recipient is not empty")
 		return status.Errorf(codes.FailedPrecondition, "recipient is not empty: gtid=%s", gtid)
 	}
+	return nil
+}
 
+// clone clones from `donors` in order until it succeeds.
+func (a *Agent) clone(ctx context.Context, req *proto.CloneRequest, donors []*donorProbe, reason string, vars []cloneVariable, logger logr.Logger) (*proto.CloneResponse, error) {
 	startTime := time.Now()
 	metrics.CloneCount.Inc()
 	metrics.CloneInProgress.Set(1)
@@ -56,58 +94,223 @@ func (a *Agent) Clone(ctx context.Context, req *proto.CloneRequest) error {
 		metrics.CloneDurationSeconds.Observe(time.Since(startTime).Seconds())
 	}()
 
-	// Unfortunately, MySQL 8.0 does not support IPv6 address format.
-	// https://dev.mysql.com/doc/refman/8.0/en/clone-plugin-options-variables.html#sysvar_clone_valid_donor_list
-	donorAddr := net.JoinHostPort(req.Host, fmt.Sprint(req.Port))
-	if _, err := a.db.ExecContext(ctx, `SET GLOBAL clone_valid_donor_list = ?`, donorAddr); err != nil {
-		return status.Errorf(codes.Internal, "failed to set clone_valid_donor_list: %+v", err)
-	}
-
-	// To clone, the connection should not set timeout values.
-	cloneDB, err := GetMySQLConnLocalSocket(mocoagent.AgentUser, a.config.Password, a.mysqlSocketPath)
+	prevVars, err := a.setCloneVariables(ctx, vars)
+	defer func() {
+		// mysqld restarts after cloning, so the values may have been reset already.
+		if _, err := a.setCloneVariables(context.Background(), prevVars); err != nil {
+			logger.Error(err, "failed to restore clone variables")
+		}
+	}()
 	if err != nil {
-		return fmt.Errorf("failed to connect to mysqld through %s: %w", a.mysqlSocketPath, err)
+		metrics.CloneFailureCount.Inc()
+		return nil, status.Errorf(codes.Internal, "%+v", err)
 	}
-	defer cloneDB.Close()
 
-	logger.Info("start cloning instance", "donor", donorAddr)
-	_, err = cloneDB.Exec(`CLONE INSTANCE FROM ?@?:? IDENTIFIED BY ?`, req.User, req.Host, req.Port, req.Password)
-	if err != nil && !IsRestartFailed(err) {
+	var donor *donorProbe
+	for i, d := range donors {
+		if i > 0 {
+			if err := a.checkRecipientEmpty(ctx, logger); err != nil {
+				metrics.CloneFailureCount.Inc()
+				return nil, err
+			}
+			logger.Info("falling back to the next donor", "donor", d.addr(), "failed", donors[i-1].addr())
+			reason += fmt.Sprintf("; fell back from %s: %v", donors[i-1].addr(), status.Convert(err).Message())
+		}
+		err = a.cloneFrom(ctx, req, d, logger)
+		if err == nil {
+			donor = d
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if donor == nil {
 		metrics.CloneFailureCount.Inc()
-
-		logger.Error(err, "failed to exec CLONE INSTANCE", "donor", donorAddr)
-		return err
+		return nil, err
 	}
 
-	logger.Info("cloning finished successfully", "donor", donorAddr)
+	logger.Info("cloning finished successfully", "donor", donor.addr())
 
 	time.Sleep(100 * time.Millisecond)
 
-	timeout := cloneBootstrapTimeout
-	if req.BootTimeout != nil {
-		timeout = req.BootTimeout.AsDuration()
-	}
-
+	timeout := cloneBootTimeout(req)
 	logger.Info("waiting for mysqld to boot", "timeout", timeout.Seconds())
 
 	if err := waitBootstrap(req.InitUser, req.InitPassword, a.mysqlSocketPath, timeout, logger); err != nil {
 		logger.Error(err, "mysqld didn't boot up after cloning from external")
-		return err
+		return nil, status.Errorf(codes.DeadlineExceeded, "mysqld didn't boot up after cloning: %+v", err)
 	}
 
 	initDB, err := GetMySQLConnLocalSocket(req.InitUser, req.InitPassword, a.mysqlSocketPath)
 	if err != nil {
 		logger.Error(err, "failed to connect to mysqld after bootstrap")
-		return err
+		return nil, mysqlStatusError(codes.Internal, err, "failed to connect to mysqld after bootstrap")
 	}
 	defer initDB.Close()
 
-	if err := InitExternal(context.Background(), initDB); err != nil {
+	if err := InitExternal(context.Background(), initDB, a.pluginConfig, a.userPassword); err != nil {
 		logger.Error(err, "failed to initialize after clone")
-		return err
+		return nil, mysqlStatusError(codes.Internal, err, "failed to initialize after clone")
 	}
 
-	return nil
+	if req.Recovery != nil {
+		logger.Info("start point-in-time recovery after clone")
+		report := func(p *proto.PointInTimeRecoveryResponse) error {
+			if p.Phase != pitrPhaseApplying {
+				logger.Info("point-in-time recovery", "phase", p.Phase, "fetched", p.FetchedFiles, "total", p.TotalFiles)
+			}
+			return nil
+		}
+		if err := a.pointInTimeRecovery(ctx, req.Recovery, report, logger); err != nil {
+			logger.Error(err, "failed to recover to the point in time after clone")
+			return nil, err
+		}
+	}
+
+	return &proto.CloneResponse{DonorHost: donor.host, DonorPort: int32(donor.port), Reason: reason}, nil
+}
+
+// cloneFrom executes CLONE INSTANCE from `donor`, retrying up to max_attempts times on retryable errors.
+func (a *Agent) cloneFrom(ctx context.Context, req *proto.CloneRequest, donor *donorProbe, logger logr.Logger) error {
+	// Unfortunately, MySQL 8.0 does not support IPv6 address format.
+	// https://dev.mysql.com/doc/refman/8.0/en/clone-plugin-options-variables.html#sysvar_clone_valid_donor_list
+	if err := a.mysql.SetGlobalVariable(ctx, "clone_valid_donor_list", donor.addr()); err != nil {
+		return mysqlStatusError(codes.Internal, err, "failed to set clone_valid_donor_list")
+	}
+
+	source := &CloneSource{
+		Host:       donor.host,
+		Port:       donor.port,
+		User:       req.User,
+		Password:   req.Password,
+		RequireSSL: req.RequireSsl || req.SslCa != "" || req.SslCert != "" || req.SslKey != "",
+	}
+
+	maxAttempts := max(int(req.MaxAttempts), 1)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			// A failed clone may have left data in the recipient.
+			if err := a.checkRecipientEmpty(ctx, logger); err != nil {
+				return err
+			}
+		}
+
+		logger.Info("start cloning instance", "donor", donor.addr(), "require_ssl", source.RequireSSL, "attempt", attempt)
+		a.cloneOp.startAttempt(donor.addr())
+		metrics.CloneAttempts.Inc()
+		err := a.mysql.CloneInstance(ctx, source)
+		if err == nil || IsRestartFailed(err) {
+			a.cloneOp.finishAttempt(nil, false)
+			return nil
+		}
+		if isConnectionError(err) {
+			logger.Error(err, "lost the connection of CLONE INSTANCE; waiting for mysqld to report the clone state", "donor", donor.addr())
+			state, serr := a.cloneStateAfterDisconnect(ctx, req, cloneBootTimeout(req), logger)
+			if serr != nil {
+				a.cloneOp.finishAttempt(err, false)
+				return status.Errorf(codes.Internal, "failed to exec CLONE INSTANCE from %s: %+v; %+v", donor.addr(), err, serr)
+			}
+			if state == "Completed" {
+				logger.Info("CLONE INSTANCE has completed despite the lost connection", "donor", donor.addr())
+				a.cloneOp.finishAttempt(nil, false)
+				return nil
+			}
+		}
+
+		retryable := isRetryableCloneError(err)
+		a.cloneOp.finishAttempt(err, retryable)
+		logger.Error(err, "failed to exec CLONE INSTANCE", "donor", donor.addr(), "attempt", attempt, "retryable", retryable)
+		if !retryable || attempt >= maxAttempts {
+			return mysqlStatusError(codes.Internal, err, fmt.Sprintf("failed to exec CLONE INSTANCE from %s after %d attempt(s)", donor.addr(), attempt))
+		}
+
+		backoff := cloneBackoff(attempt)
+		logger.Info("retrying CLONE INSTANCE", "backoff", backoff.Seconds())
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// cloneBootTimeout returns the time to wait for mysqld to restart after cloning.
+func cloneBootTimeout(req *proto.CloneRequest) time.Duration {
+	if req.BootTimeout != nil {
+		return req.BootTimeout.AsDuration()
+	}
+	return cloneBootstrapTimeout
+}
+
+// cloneVariable is a global variable of the clone plugin.
+// value is int64, bool, or string.
+type cloneVariable struct {
+	name  string
+	value any
+}
+
+// cloneVariables returns the global variables to be configured for the clone.
+func cloneVariables(req *proto.CloneRequest) ([]cloneVariable, error) {
+	var vars []cloneVariable
+	if req.MaxDataBandwidth < 0 {
+		return nil, fmt.Errorf("invalid max_data_bandwidth: %d", req.MaxDataBandwidth)
+	}
+	if req.MaxDataBandwidth > 0 {
+		vars = append(vars, cloneVariable{"clone_max_data_bandwidth", int64(req.MaxDataBandwidth)})
+	}
+	if req.MaxConcurrency < 0 || req.MaxConcurrency > 128 {
+		return nil, fmt.Errorf("invalid max_concurrency: %d", req.MaxConcurrency)
+	}
+	if req.MaxConcurrency > 0 {
+		vars = append(vars, cloneVariable{"clone_max_concurrency", int64(req.MaxConcurrency)})
+	}
+	if req.EnableCompression {
+		vars = append(vars, cloneVariable{"clone_enable_compression", true})
+	}
+	if (req.SslCert == "") != (req.SslKey == "") {
+		return nil, errors.New("ssl_cert and ssl_key must be specified together")
+	}
+	if req.SslCa != "" {
+		vars = append(vars, cloneVariable{"clone_ssl_ca", req.SslCa})
+	}
+	if req.SslCert != "" {
+		vars = append(vars, cloneVariable{"clone_ssl_cert", req.SslCert}, cloneVariable{"clone_ssl_key", req.SslKey})
+	}
+	return vars, nil
+}
+
+// setCloneVariables sets the global variables and returns the previous values.
+// If it fails, the returned values are those changed before the failure.
+func (a *Agent) setCloneVariables(ctx context.Context, vars []cloneVariable) ([]cloneVariable, error) {
+	var prev []cloneVariable
+	for _, v := range vars {
+		var old any
+		var err error
+		switch v.value.(type) {
+		case int64:
+			var i int64
+			err = a.mysql.GetGlobalVariable(ctx, v.name, &i)
+			old = i
+		case bool:
+			var b bool
+			err = a.mysql.GetGlobalVariable(ctx, v.name, &b)
+			old = b
+		default:
+			var str string
+			err = a.mysql.GetGlobalVariable(ctx, v.name, &str)
+			old = str
+		}
+		if err != nil {
+			return prev, err
+		}
+
+		if err := a.mysql.SetGlobalVariable(ctx, v.name, v.value); err != nil {
+			return prev, err
+		}
+		prev = append(prev, cloneVariable{v.name, old})
+	}
+	return prev, nil
 }
 
 func waitBootstrap(user, password, socket string, timeout time.Duration, logger logr.Logger) error {
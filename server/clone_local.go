@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	localSnapshotPrefix     = "snapshot-"
+	localSnapshotTimeFormat = "20060102T150405Z"
+)
+
+// cloneStatusRow is the result of the last clone operation in performance_schema.clone_status.
+type cloneStatusRow struct {
+	BinlogFile     string `db:"BINLOG_FILE"`
+	BinlogPosition int64  `db:"BINLOG_POSITION"`
+	GTIDExecuted   string `db:"GTID_EXECUTED"`
+}
+
+func (s agentService) CloneLocal(ctx context.Context, req *proto.CloneLocalRequest) (*proto.CloneLocalResponse, error) {
+	return s.agent.CloneLocal(ctx, req)
+}
+
+// EnableCloneLocal enables CloneLocal to create snapshots under `dir`.
+// `keep` is the default number of snapshots to keep.
+func (a *Agent) EnableCloneLocal(dir string, keep int) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("clone-local-dir must be an absolute path: %s", dir)
+	}
+	if keep < 1 {
+		return fmt.Errorf("clone-local-keep must be positive: %d", keep)
+	}
+	a.cloneLocalDir = dir
+	a.cloneLocalKeep = keep
+	return nil
+}
+
+// CloneLocal takes a physical snapshot by CLONE LOCAL DATA DIRECTORY, and removes old snapshots.
+func (a *Agent) CloneLocal(ctx context.Context, req *proto.CloneLocalRequest) (*proto.CloneLocalResponse, error) {
+	if a.cloneLocalDir == "" {
+		return nil, status.Error(codes.FailedPrecondition, "local clone is not enabled")
+	}
+	keep := a.cloneLocalKeep
+	if req.Keep < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid keep: %d", req.Keep)
+	}
+	if req.Keep > 0 {
+		keep = int(req.Keep)
+	}
+
+	select {
+	case a.cloneLock <- struct{}{}:
+	default:
+		return nil, status.Error(codes.ResourceExhausted, "another request is undergoing")
+	}
+	defer func() { <-a.cloneLock }()
+
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	if err := os.MkdirAll(a.cloneLocalDir, 0750); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create %s: %+v", a.cloneLocalDir, err)
+	}
+
+	startTime := time.Now()
+	path := filepath.Join(a.cloneLocalDir, localSnapshotPrefix+startTime.UTC().Format(localSnapshotTimeFormat))
+	if _, err := os.Stat(path); err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "%s already exists", path)
+	}
+
+	metrics.CloneLocalCount.Inc()
+
+	// To clone, the connection should not set timeout values.
+	cloneDB, err := GetMySQLConnLocalSocket(mocoagent.AgentUser, a.userPassword(mocoagent.AgentUser), a.mysqlSocketPath)
+	if err != nil {
+		metrics.CloneLocalFailureCount.Inc()
+		return nil, status.Errorf(codes.Internal, "failed to connect to mysqld through %s: %+v", a.mysqlSocketPath, err)
+	}
+	defer cloneDB.Close()
+
+	logger.Info("start cloning to the local directory", "path", path)
+	if _, err := cloneDB.ExecContext(ctx, `CLONE LOCAL DATA DIRECTORY = ?`, path); err != nil {
+		metrics.CloneLocalFailureCount.Inc()
+		logger.Error(err, "failed to exec CLONE LOCAL DATA DIRECTORY", "path", path)
+		if err := os.RemoveAll(path); err != nil {
+			logger.Error(err, "failed to remove the incomplete snapshot", "path", path)
+		}
+		return nil, mysqlStatusError(codes.Internal, err, "failed to clone to "+path)
+	}
+	duration := time.Since(startTime)
+	metrics.CloneLocalDurationSeconds.Observe(duration.Seconds())
+
+	cs := &cloneStatusRow{}
+	err = cloneDB.GetContext(ctx, cs, `SELECT BINLOG_FILE, BINLOG_POSITION, GTID_EXECUTED FROM performance_schema.clone_status`)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get clone status: %+v", err)
+	}
+
+	size, err := dirSize(path)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get the size of %s: %+v", path, err)
+	}
+	logger.Info("cloning to the local directory finished", "path", path, "size", size, "duration", duration.Seconds())
+
+	removed, err := removeOldSnapshots(a.cloneLocalDir, keep)
+	if err != nil {
+		logger.Error(err, "failed to remove old snapshots")
+		return nil, status.Errorf(codes.Internal, "failed to remove old snapshots: %+v", err)
+	}
+	for _, r := range removed {
+		logger.Info("removed old snapshot", "path", r)
+	}
+
+	return &proto.CloneLocalResponse{
+		Path:           path,
+		SizeBytes:      size,
+		Duration:       durationpb.New(duration),
+		GtidSet:        strings.ReplaceAll(cs.GTIDExecuted, "\n", ""),
+		BinlogFile:     cs.BinlogFile,
+		BinlogPosition: cs.BinlogPosition,
+		Removed:        removed,
+	}, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+// removeOldSnapshots removes snapshots in `dir` other than the newest `keep` ones.
+// Only directories created by CloneLocal are considered.
+func removeOldSnapshots(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []string
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), localSnapshotPrefix) {
+			continue
+		}
+		if _, err := time.Parse(localSnapshotTimeFormat, strings.TrimPrefix(e.Name(), localSnapshotPrefix)); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, e.Name())
+	}
+	if len(snapshots) <= keep {
+		return nil, nil
+	}
+
+	// The names are sorted in the chronological order.
+	slices.Sort(snapshots)
+	var removed []string
+	for _, name := range snapshots[:len(snapshots)-keep] {
+		path := filepath.Join(dir, name)
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
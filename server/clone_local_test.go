@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("local clone", func() {
+	It("should be rejected unless enabled", func() {
+		agent := &Agent{cloneLock: make(chan struct{}, 1), logger: testLogger}
+		_, err := agent.CloneLocal(context.Background(), &proto.CloneLocalRequest{})
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+
+		Expect(agent.EnableCloneLocal("relative", 1)).To(HaveOccurred())
+		Expect(agent.EnableCloneLocal("/backup", 0)).To(HaveOccurred())
+		Expect(agent.EnableCloneLocal("/backup", 1)).To(Succeed())
+
+		_, err = agent.CloneLocal(context.Background(), &proto.CloneLocalRequest{Keep: -1})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should remove old snapshots", func() {
+		dir := GinkgoT().TempDir()
+		now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		var names []string
+		for i := 0; i < 4; i++ {
+			name := localSnapshotPrefix + now.Add(time.Duration(i)*time.Hour).Format(localSnapshotTimeFormat)
+			names = append(names, name)
+			Expect(os.MkdirAll(filepath.Join(dir, name, "mysql"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, name, "mysql", "ibdata1"), []byte("data"), 0644)).To(Succeed())
+		}
+		Expect(os.Mkdir(filepath.Join(dir, "snapshot-manual"), 0755)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(dir, "other"), 0755)).To(Succeed())
+
+		size, err := dirSize(filepath.Join(dir, names[0]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size).To(BeNumerically("==", 4))
+
+		removed, err := removeOldSnapshots(dir, 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeEmpty())
+
+		removed, err = removeOldSnapshots(dir, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal([]string{filepath.Join(dir, names[0]), filepath.Join(dir, names[1])}))
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		var rest []string
+		for _, e := range entries {
+			rest = append(rest, e.Name())
+		}
+		Expect(rest).To(ConsistOf(names[2], names[3], "snapshot-manual", "other"))
+	})
+})
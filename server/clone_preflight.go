@@ -0,0 +1,282 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/go-logr/logr"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// cloneMinMaxAllowedPacket is the minimum max_allowed_packet required by the clone plugin.
+const cloneMinMaxAllowedPacket = 2 << 20
+
+// CloneInstanceInfo is the information of an instance compared before cloning.
+type CloneInstanceInfo struct {
+	Version             string `db:"version"`
+	VersionComment      string `db:"version_comment"`
+	InnoDBPageSize      int64  `db:"innodb_page_size"`
+	LowerCaseTableNames int    `db:"lower_case_table_names"`
+	MaxAllowedPacket    int64  `db:"max_allowed_packet"`
+	DataDir             string `db:"datadir"`
+
+	// Plugins is the names of the active plugins.
+	Plugins []string `db:"-"`
+	// DataSize is the size of the data to be cloned in bytes, or -1 if the user is not allowed to read it.
+	DataSize int64 `db:"-"`
+}
+
+func getCloneInstanceInfo(ctx context.Context, db *sqlx.DB) (*CloneInstanceInfo, error) {
+	info := &CloneInstanceInfo{}
+	err := db.GetContext(ctx, info, `SELECT VERSION() AS version, @@version_comment AS version_comment, @@innodb_page_size AS innodb_page_size,
+@@lower_case_table_names AS lower_case_table_names, @@max_allowed_packet AS max_allowed_packet, @@datadir AS datadir`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variables: %w", err)
+	}
+	if err := db.SelectContext(ctx, &info.Plugins, `SELECT PLUGIN_NAME FROM information_schema.PLUGINS WHERE PLUGIN_STATUS = 'ACTIVE'`); err != nil {
+		return nil, fmt.Errorf("failed to get plugins: %w", err)
+	}
+	// The temporary tablespaces are not cloned.
+	// information_schema.FILES requires PROCESS, which the clone donor user may not have.
+	err = db.GetContext(ctx, &info.DataSize, `SELECT COALESCE(SUM(TOTAL_EXTENTS * EXTENT_SIZE), 0) FROM information_schema.FILES WHERE FILE_TYPE <> 'TEMPORARY'`)
+	var merr *mysql.MySQLError
+	if errors.As(err, &merr) && merr.Number == 1227 {
+		info.DataSize = -1
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data size: %w", err)
+	}
+	return info, nil
+}
+
+// donorProbe is the result of probing a candidate donor.
+type donorProbe struct {
+	host string
+	port int
+
+	// err is set if the donor could not be probed.
+	err      error
+	problems []string
+
+	// lag is the replication lag of the donor, or -1 if unknown.
+	lag time.Duration
+	// dataSize is the data size of the donor, or -1 if unknown.
+	dataSize int64
+}
+
+func (p *donorProbe) addr() string {
+	return net.JoinHostPort(p.host, strconv.Itoa(p.port))
+}
+
+func (p *donorProbe) usable() bool {
+	return p.err == nil && len(p.problems) == 0
+}
+
+func (p *donorProbe) String() string {
+	if p.err != nil {
+		return fmt.Sprintf("%s: %v", p.addr(), p.err)
+	}
+	return fmt.Sprintf("%s: %s", p.addr(), strings.Join(p.problems, ", "))
+}
+
+// selectDonors probes the candidate donors in req, and returns usable ones in the order of preference
+// with the reason of the choice.  It returns FailedPrecondition if no donor is usable.
+func (a *Agent) selectDonors(ctx context.Context, req *proto.CloneRequest, logger logr.Logger) ([]*donorProbe, string, error) {
+	candidates := req.Candidates
+	if len(candidates) == 0 {
+		candidates = []*proto.CloneDonor{{Host: req.Host, Port: req.Port}}
+	}
+
+	recipient, err := a.mysql.GetCloneInstanceInfo(ctx)
+	if err != nil {
+		return nil, "", status.Errorf(codes.Internal, "failed to get the recipient information: %+v", err)
+	}
+	var free int64 = -1
+	var st unix.Statfs_t
+	if err := unix.Statfs(recipient.DataDir, &st); err != nil {
+		logger.Error(err, "failed to get free space; skipped checking disk space", "datadir", recipient.DataDir)
+	} else {
+		free = int64(st.Bavail) * int64(st.Bsize)
+	}
+
+	probes := make([]*donorProbe, len(candidates))
+	for i, c := range candidates {
+		probes[i] = a.probeDonor(ctx, c.Host, int(c.Port), req.User, req.Password, recipient, free)
+		logger.Info("probed donor", "donor", probes[i].addr(), "usable", probes[i].usable(), "lag", probes[i].lag.Seconds())
+		if probes[i].err == nil && probes[i].dataSize < 0 {
+			logger.Info("the donor user is not allowed to read the data size; skipped checking disk space", "donor", probes[i].addr())
+		}
+	}
+
+	donors, reason := orderDonors(probes)
+	if len(donors) > 0 {
+		return donors, reason, nil
+	}
+
+	if len(probes) == 1 {
+		p := probes[0]
+		if p.err != nil {
+			return nil, "", mysqlStatusError(codes.FailedPrecondition, p.err, "failed to probe the donor "+p.addr())
+		}
+		return nil, "", status.Errorf(codes.FailedPrecondition, "preflight checks failed: %s", strings.Join(p.problems, "; "))
+	}
+	msgs := make([]string, len(probes))
+	for i, p := range probes {
+		msgs[i] = p.String()
+	}
+	return nil, "", status.Errorf(codes.FailedPrecondition, "no usable donor: %s", strings.Join(msgs, "; "))
+}
+
+// probeDonor checks the reachability, the compatibility, the replication lag, and a running clone of the donor.
+func (a *Agent) probeDonor(ctx context.Context, host string, port int, user, password string, recipient *CloneInstanceInfo, free int64) *donorProbe {
+	p := &donorProbe{host: host, port: port, lag: -1, dataSize: -1}
+
+	conf := mysql.NewConfig()
+	conf.User = user
+	conf.Passwd = password
+	conf.Net = "tcp"
+	conf.Addr = p.addr()
+	conf.Timeout = a.config.ConnectionTimeout
+	conf.ReadTimeout = a.config.ReadTimeout
+	conf.ParseTime = true
+	donorDB, err := sqlx.Connect("mysql", conf.FormatDSN())
+	if err != nil {
+		p.err = err
+		return p
+	}
+	defer donorDB.Close()
+
+	donor, err := getCloneInstanceInfo(ctx, donorDB)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	p.dataSize = donor.DataSize
+	p.problems = checkCloneCompatibility(donor, recipient, free)
+
+	// The following information may not be readable by the donor user.
+	var cloning int
+	err = donorDB.GetContext(ctx, &cloning, `SELECT COUNT(*) FROM performance_schema.clone_status WHERE STATE = 'In Progress'`)
+	if err == nil && cloning > 0 {
+		p.problems = append(p.problems, "clone is in progress on the donor")
+	}
+
+	var queued, applied time.Time
+	err = donorDB.GetContext(ctx, &queued, `SELECT COALESCE(MAX(LAST_QUEUED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP), 0) FROM performance_schema.replication_connection_status`)
+	if err != nil {
+		return p
+	}
+	err = donorDB.GetContext(ctx, &applied, `SELECT COALESCE(MAX(LAST_APPLIED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP), 0) FROM performance_schema.replication_applier_status_by_worker`)
+	if err != nil {
+		return p
+	}
+	p.lag = 0
+	if !queued.IsZero() && queued.After(applied) {
+		p.lag = queued.Sub(applied)
+	}
+	return p
+}
+
+// orderDonors returns usable donors ordered by the replication lag with the reason of the choice.
+// Donors with unknown lag come last, and the order of candidates is kept for the same lag.
+func orderDonors(probes []*donorProbe) ([]*donorProbe, string) {
+	var donors []*donorProbe
+	var skipped []string
+	for _, p := range probes {
+		if p.usable() {
+			donors = append(donors, p)
+		} else {
+			skipped = append(skipped, p.String())
+		}
+	}
+	if len(donors) == 0 {
+		return nil, ""
+	}
+
+	slices.SortStableFunc(donors, func(x, y *donorProbe) int {
+		switch {
+		case x.lag == y.lag:
+			return 0
+		case x.lag < 0:
+			return 1
+		case y.lag < 0:
+			return -1
+		}
+		return cmp.Compare(x.lag, y.lag)
+	})
+
+	var reason string
+	switch {
+	case len(probes) == 1:
+		reason = "the only candidate"
+	case donors[0].lag < 0:
+		reason = fmt.Sprintf("the first of %d usable candidates; replication lag is unknown", len(donors))
+	default:
+		reason = fmt.Sprintf("the lowest replication lag %s among %d usable candidates", donors[0].lag, len(donors))
+	}
+	if len(skipped) > 0 {
+		reason += "; skipped " + strings.Join(skipped, "; ")
+	}
+	return donors, reason
+}
+
+// checkCloneCompatibility returns the problems to clone `recipient` from `donor`.
+// `free` is the free space of the recipient, or -1 if unknown.
+// The disk space is not checked if either is unknown.
+func checkCloneCompatibility(donor, recipient *CloneInstanceInfo, free int64) []string {
+	var problems []string
+
+	df, err := newServerFlavor(donor.Version, donor.VersionComment)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	rf, err := newServerFlavor(recipient.Version, recipient.VersionComment)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if df != nil && rf != nil {
+		if p := df.cloneProblem(rf); p != "" {
+			problems = append(problems, p)
+		}
+	}
+
+	var missing []string
+	for _, p := range donor.Plugins {
+		if !slices.Contains(recipient.Plugins, p) {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("plugins active on the donor are not active on the recipient: %s", strings.Join(missing, ",")))
+	}
+
+	if donor.InnoDBPageSize != recipient.InnoDBPageSize {
+		problems = append(problems, fmt.Sprintf("innodb_page_size differs: donor=%d recipient=%d", donor.InnoDBPageSize, recipient.InnoDBPageSize))
+	}
+	if donor.LowerCaseTableNames != recipient.LowerCaseTableNames {
+		problems = append(problems, fmt.Sprintf("lower_case_table_names differs: donor=%d recipient=%d", donor.LowerCaseTableNames, recipient.LowerCaseTableNames))
+	}
+	if donor.MaxAllowedPacket < cloneMinMaxAllowedPacket {
+		problems = append(problems, fmt.Sprintf("max_allowed_packet of the donor is less than %d: %d", cloneMinMaxAllowedPacket, donor.MaxAllowedPacket))
+	}
+	if recipient.MaxAllowedPacket < cloneMinMaxAllowedPacket {
+		problems = append(problems, fmt.Sprintf("max_allowed_packet of the recipient is less than %d: %d", cloneMinMaxAllowedPacket, recipient.MaxAllowedPacket))
+	}
+	if free >= 0 && donor.DataSize >= 0 && donor.DataSize > free {
+		problems = append(problems, fmt.Sprintf("not enough disk space: donor data size=%d free=%d", donor.DataSize, free))
+	}
+	return problems
+}
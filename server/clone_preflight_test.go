@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("clone preflight", func() {
+	newInfo := func(version string) *CloneInstanceInfo {
+		return &CloneInstanceInfo{
+			Version:             version,
+			InnoDBPageSize:      16384,
+			LowerCaseTableNames: 0,
+			MaxAllowedPacket:    64 << 20,
+			Plugins:             []string{"InnoDB", "clone"},
+			DataSize:            100 << 20,
+		}
+	}
+
+	It("should pass compatible instances", func() {
+		Expect(checkCloneCompatibility(newInfo("8.4.4"), newInfo("8.4.5"), 1<<30)).To(BeEmpty())
+		Expect(checkCloneCompatibility(newInfo("8.0.39"), newInfo("8.0.37"), -1)).To(BeEmpty())
+		Expect(checkCloneCompatibility(newInfo("8.0.28-log"), newInfo("8.0.28"), 1<<30)).To(BeEmpty())
+	})
+
+	It("should list every problem", func() {
+		donor := newInfo("8.0.36")
+		donor.Plugins = append(donor.Plugins, "keyring_file", "audit_log")
+		donor.InnoDBPageSize = 32768
+		donor.LowerCaseTableNames = 1
+		donor.MaxAllowedPacket = 1 << 20
+		recipient := newInfo("8.0.37")
+
+		problems := checkCloneCompatibility(donor, recipient, 10<<20)
+		Expect(problems).To(HaveLen(6))
+		Expect(problems[0]).To(ContainSubstring("versions differ"))
+		Expect(problems[1]).To(ContainSubstring("keyring_file,audit_log"))
+		Expect(problems[2]).To(ContainSubstring("innodb_page_size"))
+		Expect(problems[3]).To(ContainSubstring("lower_case_table_names"))
+		Expect(problems[4]).To(ContainSubstring("max_allowed_packet of the donor"))
+		Expect(problems[5]).To(ContainSubstring("not enough disk space"))
+
+		donor = newInfo("8.4.4")
+		donor.DataSize = -1
+		Expect(checkCloneCompatibility(donor, newInfo("8.4.4"), 10<<20)).To(BeEmpty())
+
+		problems = checkCloneCompatibility(newInfo("8.4.4"), newInfo("8.0.40"), -1)
+		Expect(problems).To(ConsistOf(ContainSubstring("version series differ")))
+
+		problems = checkCloneCompatibility(newInfo("invalid"), newInfo("8.0.40"), -1)
+		Expect(problems).To(ConsistOf(ContainSubstring("invalid version")))
+	})
+	It("should order donors by replication lag", func() {
+		probe := func(host string, lag time.Duration, problems ...string) *donorProbe {
+			return &donorProbe{host: host, port: 3306, lag: lag, problems: problems}
+		}
+
+		donors, reason := orderDonors([]*donorProbe{probe("a", -1)})
+		Expect(donors).To(HaveLen(1))
+		Expect(reason).To(Equal("the only candidate"))
+
+		donors, reason = orderDonors([]*donorProbe{
+			probe("a", -1),
+			probe("b", 3*time.Second),
+			{host: "c", port: 3306, lag: -1, err: errors.New("connection refused")},
+			probe("d", time.Second),
+			probe("e", 0, "clone is in progress on the donor"),
+			probe("f", time.Second),
+		})
+		hosts := make([]string, len(donors))
+		for i, d := range donors {
+			hosts[i] = d.host
+		}
+		Expect(hosts).To(Equal([]string{"d", "f", "b", "a"}))
+		Expect(reason).To(HavePrefix("the lowest replication lag 1s among 4 usable candidates"))
+		Expect(reason).To(ContainSubstring("skipped c:3306: connection refused; e:3306: clone is in progress on the donor"))
+
+		_, reason = orderDonors([]*donorProbe{probe("a", -1), probe("b", -1)})
+		Expect(reason).To(Equal("the first of 2 usable candidates; replication lag is unknown"))
+
+		donors, _ = orderDonors([]*donorProbe{probe("a", 0, "not enough disk space")})
+		Expect(donors).To(BeEmpty())
+	})
+})
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/go-logr/logr"
+	"github.com/go-sql-driver/mysql"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	cloneRetryInitialBackoff = 5 * time.Second
+	cloneRetryMaxBackoff     = 2 * time.Minute
+	cloneStatePollInterval   = 1 * time.Second
+)
+
+// States of GetCloneStatusResponse.
+const (
+	cloneStateRunning   = "running"
+	cloneStateSucceeded = "succeeded"
+	cloneStateFailed    = "failed"
+)
+
+// retryableCloneErrors are MySQL errors caused by transient failures of the donor or the network.
+var retryableCloneErrors = map[uint16]bool{
+	1040: true, // ER_CON_COUNT_ERROR
+	1158: true, // ER_NET_READ_ERROR
+	1159: true, // ER_NET_READ_INTERRUPTED
+	1160: true, // ER_NET_ERROR_ON_WRITE
+	1161: true, // ER_NET_WRITE_INTERRUPTED
+	1203: true, // ER_TOO_MANY_USER_CONNECTIONS
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	3634: true, // ER_TOO_MANY_CONCURRENT_CLONES
+	3874: true, // ER_CLONE_IN_PROGRESS
+}
+
+// errCloneDonor is ER_CLONE_DONOR that wraps an error of the donor.
+const errCloneDonor = 3862
+
+// cloneDonorErrorPattern matches the message of ER_CLONE_DONOR such as
+// "Clone Donor Error: 1158 : Got an error reading communication packets."
+var cloneDonorErrorPattern = regexp.MustCompile(`^Clone Donor Error: (\d+) :`)
+
+// isRetryableCloneError returns true if CLONE INSTANCE may succeed by retrying after `err`.
+// For a connection error, the caller must check the clone has not succeeded with cloneStateAfterDisconnect.
+func isRetryableCloneError(err error) bool {
+	var merr *mysql.MySQLError
+	if errors.As(err, &merr) {
+		if merr.Number == errCloneDonor {
+			// Classify by the error of the donor, which may be fatal such as access denied or disk full.
+			m := cloneDonorErrorPattern.FindStringSubmatch(merr.Message)
+			if m == nil {
+				return false
+			}
+			number, err := strconv.ParseUint(m[1], 10, 16)
+			return err == nil && retryableCloneErrors[uint16(number)]
+		}
+		return retryableCloneErrors[merr.Number]
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError returns true if `err` is caused by the connection to mysqld.
+func isConnectionError(err error) bool {
+	var nerr net.Error
+	return errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, driver.ErrBadConn) || errors.As(err, &nerr)
+}
+
+// cloneStateAfterDisconnect waits for mysqld to accept connections and returns the state in performance_schema.clone_status
+// after CLONE INSTANCE lost its connection.  A successful clone also drops the connection by restarting mysqld.
+// The state is read by the init user of `req` as well because the clone replaces the users with those of the donor.
+func (a *Agent) cloneStateAfterDisconnect(ctx context.Context, req *proto.CloneRequest, timeout time.Duration, logger logr.Logger) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		state, err := a.readCloneState(ctx, req)
+		switch {
+		case err != nil:
+			logger.Error(err, "failed to read the clone state")
+		case state != "In Progress":
+			return state, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("mysqld did not report the clone state: %w", ctx.Err())
+		case <-time.After(cloneStatePollInterval):
+		}
+	}
+}
+
+func (a *Agent) readCloneState(ctx context.Context, req *proto.CloneRequest) (string, error) {
+	st, err := a.mysql.GetCloneState(ctx)
+	if err != nil && req.InitUser != "" {
+		db, dbErr := GetMySQLConnLocalSocket(req.InitUser, req.InitPassword, a.mysqlSocketPath)
+		if dbErr != nil {
+			return "", err
+		}
+		defer db.Close()
+		st = &MySQLCloneStateStatus{}
+		err = db.GetContext(ctx, st, `SELECT state FROM performance_schema.clone_status`)
+	}
+	if err != nil {
+		return "", err
+	}
+	return st.State.String, nil
+}
+
+// cloneBackoff returns the wait before the next attempt after `attempt` attempts failed.
+func cloneBackoff(attempt int) time.Duration {
+	d := cloneRetryInitialBackoff
+	for i := 1; i < attempt && d < cloneRetryMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, cloneRetryMaxBackoff)
+}
+
+// cloneOperation records the status of the last Clone.
+type cloneOperation struct {
+	mu     sync.Mutex
+	status *proto.GetCloneStatusResponse
+}
+
+func (op *cloneOperation) start() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.status = &proto.GetCloneStatusResponse{
+		State:     cloneStateRunning,
+		StartTime: timestamppb.Now(),
+	}
+}
+
+func (op *cloneOperation) finish(err error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.status.EndTime = timestamppb.Now()
+	if err != nil {
+		op.status.State = cloneStateFailed
+		op.status.Error = err.Error()
+		return
+	}
+	op.status.State = cloneStateSucceeded
+}
+
+func (op *cloneOperation) startAttempt(donor string) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.status.Attempts = append(op.status.Attempts, &proto.CloneAttempt{
+		Attempt:   int32(len(op.status.Attempts) + 1),
+		StartTime: timestamppb.Now(),
+		Donor:     donor,
+	})
+}
+
+func (op *cloneOperation) finishAttempt(err error, retryable bool) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	a := op.status.Attempts[len(op.status.Attempts)-1]
+	a.EndTime = timestamppb.Now()
+	if err != nil {
+		a.Error = err.Error()
+		a.Retryable = retryable
+	}
+}
+
+func (op *cloneOperation) get() *proto.GetCloneStatusResponse {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.status == nil {
+		return &proto.GetCloneStatusResponse{}
+	}
+	return protobuf.Clone(op.status).(*proto.GetCloneStatusResponse)
+}
+
+func (s agentService) GetCloneStatus(ctx context.Context, req *proto.GetCloneStatusRequest) (*proto.GetCloneStatusResponse, error) {
+	return s.agent.GetCloneStatus(), nil
+}
+
+// GetCloneStatus returns the status of the last Clone.
+func (a *Agent) GetCloneStatus() *proto.GetCloneStatusResponse {
+	return a.cloneOp.get()
+}
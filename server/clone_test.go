@@ -2,14 +2,22 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/mysqltest"
 	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/go-sql-driver/mysql"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
@@ -84,18 +92,76 @@ var _ = Describe("clone", func() {
 		Expect(err).NotTo(HaveOccurred())
 		defer replicaDB.Close()
 
+		By("running preflight checks only")
+		// The donor host name can be resolved only in the docker network.
+		mysql.RegisterDialContext("tcp", func(ctx context.Context, addr string) (net.Conn, error) {
+			if addr == net.JoinHostPort(donorHost, "3306") {
+				addr = net.JoinHostPort("localhost", strconv.Itoa(donorPort))
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", addr)
+		})
+
+		_, err = agent.Clone(context.Background(), &proto.CloneRequest{
+			Host:     donorHost,
+			Port:     3306,
+			User:     externalDonorUser,
+			Password: "wrong",
+			DryRun:   true,
+		})
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+
+		res, err := agent.Clone(context.Background(), &proto.CloneRequest{
+			Host:     donorHost,
+			Port:     3306,
+			User:     externalDonorUser,
+			Password: externalDonorPassword,
+			DryRun:   true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.DonorHost).To(Equal(donorHost))
+		Expect(res.Reason).To(Equal("the only candidate"))
+
+		By("selecting a donor from candidates")
+		res, err = agent.Clone(context.Background(), &proto.CloneRequest{
+			Candidates: []*proto.CloneDonor{
+				{Host: "localhost", Port: 1},
+				{Host: donorHost, Port: 3306},
+			},
+			User:     externalDonorUser,
+			Password: externalDonorPassword,
+			DryRun:   true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.DonorHost).To(Equal(donorHost))
+		Expect(res.Reason).To(ContainSubstring("skipped localhost:1"))
+
 		By("executing CLONE INSTANCE")
-		err = agent.Clone(context.Background(), &proto.CloneRequest{
-			Host:         donorHost,
-			Port:         3306,
-			User:         externalDonorUser,
-			Password:     externalDonorPassword,
-			InitUser:     externalInitUser,
-			InitPassword: externalInitPassword,
-			BootTimeout:  durationpb.New(2 * time.Minute),
+		res, err = agent.Clone(context.Background(), &proto.CloneRequest{
+			Host:             donorHost,
+			Port:             3306,
+			User:             externalDonorUser,
+			Password:         externalDonorPassword,
+			InitUser:         externalInitUser,
+			InitPassword:     externalInitPassword,
+			BootTimeout:      durationpb.New(2 * time.Minute),
+			MaxDataBandwidth: 100,
+			MaxConcurrency:   2,
 		})
 		Expect(err).NotTo(HaveOccurred())
 
+		cloneStatus := agent.GetCloneStatus()
+		Expect(cloneStatus.State).To(Equal(cloneStateSucceeded))
+		Expect(cloneStatus.Attempts).To(HaveLen(1))
+		Expect(cloneStatus.Attempts[0].Error).To(BeEmpty())
+		Expect(cloneStatus.Attempts[0].Donor).To(Equal(net.JoinHostPort(donorHost, "3306")))
+		Expect(res.DonorHost).To(Equal(donorHost))
+
+		var concurrency int
+		err = replicaDB.Get(&concurrency, `SELECT @@global.clone_max_concurrency`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(concurrency).To(Equal(16))
+
 		By("checking the cloned data")
 		var count int
 		err = replicaDB.Get(&count, `SELECT COUNT(*) FROM foo.bar`)
@@ -132,3 +198,162 @@ var _ = Describe("clone", func() {
 		Expect(isSubset).To(BeTrue())
 	})
 })
+
+var _ = Describe("clone variables", func() {
+	It("should be built from the request", func() {
+		vars, err := cloneVariables(&proto.CloneRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars).To(BeEmpty())
+
+		vars, err = cloneVariables(&proto.CloneRequest{
+			MaxDataBandwidth:  100,
+			MaxConcurrency:    4,
+			EnableCompression: true,
+			SslCa:             "/ssl/ca.crt",
+			SslCert:           "/ssl/tls.crt",
+			SslKey:            "/ssl/tls.key",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars).To(Equal([]cloneVariable{
+			{"clone_max_data_bandwidth", int64(100)},
+			{"clone_max_concurrency", int64(4)},
+			{"clone_enable_compression", true},
+			{"clone_ssl_ca", "/ssl/ca.crt"},
+			{"clone_ssl_cert", "/ssl/tls.crt"},
+			{"clone_ssl_key", "/ssl/tls.key"},
+		}))
+
+		_, err = cloneVariables(&proto.CloneRequest{MaxDataBandwidth: -1})
+		Expect(err).To(HaveOccurred())
+		_, err = cloneVariables(&proto.CloneRequest{MaxConcurrency: 129})
+		Expect(err).To(HaveOccurred())
+		_, err = cloneVariables(&proto.CloneRequest{SslCert: "/ssl/tls.crt"})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("clone retry", func() {
+	DescribeTable("should classify errors",
+		func(err error, retryable bool) {
+			Expect(isRetryableCloneError(err)).To(Equal(retryable))
+		},
+		Entry("network error of the donor", &mysql.MySQLError{Number: 3862, Message: "Clone Donor Error: 1158 : Got an error reading communication packets."}, true),
+		Entry("too many connections to the donor", &mysql.MySQLError{Number: 3862, Message: "Clone Donor Error: 1040 : Too many connections."}, true),
+		Entry("access denied by the donor", &mysql.MySQLError{Number: 3862, Message: "Clone Donor Error: 1045 : Access denied for user 'moco-clone-donor'@'10.0.0.2' (using password: YES)."}, false),
+		Entry("disk full on the donor", &mysql.MySQLError{Number: 3862, Message: "Clone Donor Error: 1021 : Disk full (./#clone/); waiting for someone to free some space..."}, false),
+		Entry("unknown error of the donor", &mysql.MySQLError{Number: 3862, Message: "Clone Donor Error."}, false),
+		Entry("wrapped network error", fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1158}), true),
+		Entry("invalid connection", mysql.ErrInvalidConn, true),
+		Entry("connection refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true),
+		Entry("access denied", &mysql.MySQLError{Number: 1045}, false),
+		Entry("plugin mismatch", &mysql.MySQLError{Number: 3869}, false),
+		Entry("unknown error", errors.New("unknown"), false),
+	)
+
+	It("should detect connection errors", func() {
+		Expect(isConnectionError(mysql.ErrInvalidConn)).To(BeTrue())
+		Expect(isConnectionError(&mysql.MySQLError{Number: 1158})).To(BeFalse())
+	})
+
+	It("should check the clone state after losing the connection", func() {
+		const clonePattern = `CLONE INSTANCE FROM .*`
+		inst, agent := startFakeMySQLD()
+		donor := &donorProbe{host: "donor.invalid", port: 3306}
+		req := &proto.CloneRequest{User: mocoagent.CloneDonorUser, Password: "password", MaxAttempts: 2}
+		clones := func() int {
+			var n int
+			for _, q := range inst.Queries() {
+				if strings.HasPrefix(q, "CLONE INSTANCE FROM ") {
+					n++
+				}
+			}
+			return n
+		}
+
+		By("succeeding without retrying if the clone has completed")
+		inst.Handle(clonePattern, func(string, []string) (*mysqltest.Result, error) {
+			// mysqld restarts after a successful clone.
+			inst.SetCloneState(mysqltest.CloneCompleted)
+			inst.Disconnect()
+			return nil, nil
+		})
+		agent.cloneOp.start()
+		err := agent.cloneFrom(context.Background(), req, donor, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clones()).To(Equal(1))
+		st := agent.GetCloneStatus()
+		Expect(st.Attempts).To(HaveLen(1))
+		Expect(st.Attempts[0].Error).To(BeEmpty())
+
+		By("retrying if the clone has failed")
+		inst.Remove(clonePattern)
+		inst.Handle(clonePattern, func(string, []string) (*mysqltest.Result, error) {
+			if clones() == 2 {
+				inst.SetCloneState(mysqltest.CloneFailed)
+				inst.Disconnect()
+				return nil, nil
+			}
+			inst.SetCloneState(mysqltest.CloneCompleted)
+			return nil, nil
+		})
+		agent.cloneOp.start()
+		err = agent.cloneFrom(context.Background(), req, donor, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clones()).To(Equal(3))
+		st = agent.GetCloneStatus()
+		Expect(st.Attempts).To(HaveLen(2))
+		Expect(st.Attempts[0].Retryable).To(BeTrue())
+
+		By("waiting for the clone in progress")
+		inst.SetCloneState(mysqltest.CloneInProgress)
+		go func() {
+			time.Sleep(2 * cloneStatePollInterval)
+			inst.SetCloneState(mysqltest.CloneFailed)
+		}()
+		state, err := agent.cloneStateAfterDisconnect(context.Background(), req, time.Minute, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(mysqltest.CloneFailed))
+
+		inst.SetCloneState(mysqltest.CloneInProgress)
+		_, err = agent.cloneStateAfterDisconnect(context.Background(), req, 2*cloneStatePollInterval, testLogger)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should back off exponentially", func() {
+		Expect(cloneBackoff(1)).To(Equal(5 * time.Second))
+		Expect(cloneBackoff(2)).To(Equal(10 * time.Second))
+		Expect(cloneBackoff(3)).To(Equal(20 * time.Second))
+		Expect(cloneBackoff(10)).To(Equal(2 * time.Minute))
+	})
+
+	It("should record attempts", func() {
+		var op cloneOperation
+		Expect(op.get().State).To(BeEmpty())
+
+		op.start()
+		op.startAttempt("donor1:3306")
+		op.finishAttempt(&mysql.MySQLError{Number: 3862, Message: "donor error"}, true)
+		op.startAttempt("donor2:3306")
+		Expect(op.get().State).To(Equal(cloneStateRunning))
+		op.finishAttempt(nil, false)
+		op.finish(nil)
+
+		st := op.get()
+		Expect(st.State).To(Equal(cloneStateSucceeded))
+		Expect(st.EndTime).NotTo(BeNil())
+		Expect(st.Attempts).To(HaveLen(2))
+		Expect(st.Attempts[0].Attempt).To(BeNumerically("==", 1))
+		Expect(st.Attempts[0].Error).To(ContainSubstring("donor error"))
+		Expect(st.Attempts[0].Retryable).To(BeTrue())
+		Expect(st.Attempts[1].Attempt).To(BeNumerically("==", 2))
+		Expect(st.Attempts[1].Error).To(BeEmpty())
+		Expect(st.Attempts[1].Donor).To(Equal("donor2:3306"))
+
+		op.start()
+		op.finish(errors.New("failed"))
+		st = op.get()
+		Expect(st.State).To(Equal(cloneStateFailed))
+		Expect(st.Error).To(Equal("failed"))
+		Expect(st.Attempts).To(BeEmpty())
+	})
+})
@@ -1,39 +1,95 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net"
 	"time"
 
 	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/metrics"
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
-func getMySQLConn(config MySQLAccessorConfig) (*sqlx.DB, error) {
+// getMySQLConn returns a connection pool of moco-agent configured with `pool`.
+// `password` is called for each new connection because the password may be rotated.
+// If `config.TLSConfig` is not nil, connections are encrypted unless mysqld does not support TLS and `config.RequireTLS` is false.
+// If `config.UseSocket` is true, connections are made over `socket` and fall back to TCP when it fails.
+func getMySQLConn(config MySQLAccessorConfig, pool PoolConfig, socket string, password func() string) (*sqlx.DB, error) {
 	conf := mysql.NewConfig()
 	conf.User = mocoagent.AgentUser
-	conf.Passwd = config.Password
 	conf.Net = "tcp"
 	conf.Addr = net.JoinHostPort(config.Host, fmt.Sprint(config.Port))
-	conf.Timeout = config.ConnectionTimeout
-	conf.ReadTimeout = config.ReadTimeout
+	conf.Timeout = pool.ConnectionTimeout
+	conf.ReadTimeout = pool.ReadTimeout
 	conf.InterpolateParams = true
 	conf.ParseTime = true
+	conf.AllowFallbackToPlaintext = !config.RequireTLS
+	conf.DialFunc = tcpDialer
+	if config.UseSocket {
+		conf.DialFunc = socketDialer(socket)
+	}
+	err := conf.Apply(mysql.BeforeConnect(func(_ context.Context, c *mysql.Config) error {
+		c.Passwd = password()
+		if config.TLSConfig != nil {
+			// The certificates may have been reloaded since the last connection.
+			tlsConfig := config.TLSConfig().Clone()
+			tlsConfig.ServerName = config.Host
+			c.TLS = tlsConfig
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := sqlx.Connect("mysql", conf.FormatDSN())
+	connector, err := mysql.NewConnector(conf)
 	if err != nil {
 		return nil, err
 	}
+	db := sqlx.NewDb(sql.OpenDB(connector), "mysql")
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
 	db.SetConnMaxLifetime(5 * time.Minute)
-	db.SetMaxIdleConns(1)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
 
 	return db, nil
 }
 
+// socketDialer returns a dial function connecting to `socket` in preference to the given TCP address.
+func socketDialer(socket string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", socket)
+		if err == nil {
+			metrics.MySQLConnectionCount.WithLabelValues("unix").Inc()
+			return conn, nil
+		}
+		metrics.MySQLSocketFallbackCount.Inc()
+		return tcpDialer(ctx, network, addr)
+	}
+}
+
+// tcpDialer connects to the given TCP address.  It is used instead of the default one of the driver
+// to count the connections for each transport.
+func tcpDialer(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	metrics.MySQLConnectionCount.WithLabelValues(network).Inc()
+	return conn, nil
+}
+
 func GetMySQLConnLocalSocket(user, password, socket string) (*sqlx.DB, error) {
 	conf := mysql.NewConfig()
 	conf.User = user
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	customUserNamePattern   = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+	customUserHostPattern   = regexp.MustCompile(`^[A-Za-z0-9_.%:/-]{1,255}$`)
+	customUserTargetPattern = regexp.MustCompile(`^(\*|[A-Za-z0-9_$-]{1,64})\.(\*|[A-Za-z0-9_$-]{1,64})$`)
+	privilegePattern        = regexp.MustCompile(`^[A-Z][A-Z_ ]*$`)
+	authPluginPattern       = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// maxAccountLimit is the maximum of FAILED_LOGIN_ATTEMPTS and PASSWORD_LOCK_TIME.
+const maxAccountLimit = 32767
+
+// AccountAttributes is the account attributes in the custom users file.
+type AccountAttributes struct {
+	Require             string `yaml:"require"`
+	MaxUserConnections  int    `yaml:"maxUserConnections"`
+	MaxQueriesPerHour   int    `yaml:"maxQueriesPerHour"`
+	FailedLoginAttempts int    `yaml:"failedLoginAttempts"`
+	// PasswordLockTime is in days.  -1 means UNBOUNDED.
+	PasswordLockTime int `yaml:"passwordLockTime"`
+}
+
+// CustomUser is the definition of a user in the custom users file.
+type CustomUser struct {
+	Name              string              `yaml:"name"`
+	Host              string              `yaml:"host"`
+	PasswordFile      string              `yaml:"passwordFile"`
+	AuthPlugin        string              `yaml:"authPlugin"`
+	Privileges        map[string][]string `yaml:"privileges"`
+	Revokes           map[string][]string `yaml:"revokes"`
+	WithGrantOption   bool                `yaml:"withGrantOption"`
+	AccountAttributes `yaml:",inline"`
+}
+
+type customUsersFile struct {
+	Users []CustomUser `yaml:"users"`
+	// MOCOUsers overrides the account attributes of MOCO users.
+	MOCOUsers map[string]AccountAttributes `yaml:"mocoUsers"`
+}
+
+// LoadCustomUsers reads the custom users and the account attributes of MOCO users from a YAML or JSON file.
+// The users are created and reconciled by ReconcilePrivileges along with MOCO users.
+func (a *Agent) LoadCustomUsers(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	users, attrs, err := parseCustomUsers(data)
+	if err != nil {
+		return fmt.Errorf("invalid custom users in %s: %w", path, err)
+	}
+	a.customUsers = users
+	a.mocoUserAttributes = attrs
+	return nil
+}
+
+// managedUsers returns MOCO users and custom users.
+func (a *Agent) managedUsers() []UserSetting {
+	users := make([]UserSetting, 0, len(Users)+len(a.customUsers))
+	for _, u := range Users {
+		if at, ok := a.mocoUserAttributes[u.name]; ok {
+			u.accountAttributes = at
+		}
+		users = append(users, u)
+	}
+	return append(users, a.customUsers...)
+}
+
+// passwordOf returns the password of `user`.
+func (a *Agent) passwordOf(user UserSetting) (string, error) {
+	if user.passwordFile == "" {
+		return a.userPassword(user.name), nil
+	}
+	data, err := os.ReadFile(user.passwordFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func parseCustomUsers(data []byte) ([]UserSetting, map[string]accountAttributes, error) {
+	var f customUsersFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+
+	names := make(map[string]bool)
+	users := make([]UserSetting, 0, len(f.Users))
+	for i, cu := range f.Users {
+		u, err := cu.toUserSetting()
+		if err != nil {
+			return nil, nil, fmt.Errorf("users[%d]: %w", i, err)
+		}
+		if names[u.name] {
+			return nil, nil, fmt.Errorf("users[%d]: duplicate user %s", i, u.name)
+		}
+		names[u.name] = true
+		users = append(users, u)
+	}
+
+	var attrs map[string]accountAttributes
+	for name, ca := range f.MOCOUsers {
+		if !slices.ContainsFunc(Users, func(u UserSetting) bool { return u.name == name }) {
+			return nil, nil, fmt.Errorf("mocoUsers: unknown MOCO user %s", name)
+		}
+		at, err := ca.toAccountAttributes()
+		if err != nil {
+			return nil, nil, fmt.Errorf("mocoUsers[%s]: %w", name, err)
+		}
+		if attrs == nil {
+			attrs = make(map[string]accountAttributes)
+		}
+		attrs[name] = at
+	}
+	return users, attrs, nil
+}
+
+func (ca AccountAttributes) toAccountAttributes() (accountAttributes, error) {
+	require := strings.ToUpper(ca.Require)
+	switch require {
+	case "", "NONE":
+		require = ""
+	case requireSSL, requireX509:
+	default:
+		return accountAttributes{}, fmt.Errorf("invalid require: %q", ca.Require)
+	}
+	if ca.MaxUserConnections < 0 || ca.MaxQueriesPerHour < 0 {
+		return accountAttributes{}, errors.New("resource limits must not be negative")
+	}
+	if ca.FailedLoginAttempts < 0 || ca.FailedLoginAttempts > maxAccountLimit {
+		return accountAttributes{}, fmt.Errorf("failedLoginAttempts must be between 0 and %d", maxAccountLimit)
+	}
+	if ca.PasswordLockTime < passwordLockTimeUnbounded || ca.PasswordLockTime > maxAccountLimit {
+		return accountAttributes{}, fmt.Errorf("passwordLockTime must be between -1 and %d", maxAccountLimit)
+	}
+	return accountAttributes{
+		require:             require,
+		maxUserConnections:  ca.MaxUserConnections,
+		maxQueriesPerHour:   ca.MaxQueriesPerHour,
+		failedLoginAttempts: ca.FailedLoginAttempts,
+		passwordLockTime:    ca.PasswordLockTime,
+	}, nil
+}
+
+func (cu CustomUser) toUserSetting() (UserSetting, error) {
+	if !customUserNamePattern.MatchString(cu.Name) {
+		return UserSetting{}, fmt.Errorf("invalid name: %q", cu.Name)
+	}
+	// MOCO users are managed by MOCO only.
+	if strings.HasPrefix(cu.Name, "moco-") || cu.Name == "root" {
+		return UserSetting{}, fmt.Errorf("reserved name: %s", cu.Name)
+	}
+	if cu.Host != "" && !customUserHostPattern.MatchString(cu.Host) {
+		return UserSetting{}, fmt.Errorf("invalid host: %q", cu.Host)
+	}
+	if cu.PasswordFile == "" {
+		return UserSetting{}, errors.New("passwordFile is not specified")
+	}
+	if cu.AuthPlugin != "" && !authPluginPattern.MatchString(cu.AuthPlugin) {
+		return UserSetting{}, fmt.Errorf("invalid authPlugin: %q", cu.AuthPlugin)
+	}
+	at, err := cu.toAccountAttributes()
+	if err != nil {
+		return UserSetting{}, err
+	}
+	at.authPlugin = cu.AuthPlugin
+
+	u := UserSetting{
+		name:              cu.Name,
+		host:              cu.Host,
+		withGrantOption:   cu.WithGrantOption,
+		passwordFile:      cu.PasswordFile,
+		accountAttributes: at,
+	}
+	for target, privileges := range cu.Privileges {
+		privileges, err := normalizePrivileges(target, privileges)
+		if err != nil {
+			return UserSetting{}, err
+		}
+		if target == globalTarget {
+			u.privileges = privileges
+			continue
+		}
+		if u.targetPrivileges == nil {
+			u.targetPrivileges = make(map[string][]string)
+		}
+		u.targetPrivileges[target] = privileges
+	}
+	for target, privileges := range cu.Revokes {
+		if !strings.HasSuffix(target, ".*") || target == globalTarget {
+			return UserSetting{}, fmt.Errorf("revokes are allowed only on databases: %s", target)
+		}
+		privileges, err := normalizePrivileges(target, privileges)
+		if err != nil {
+			return UserSetting{}, err
+		}
+		// Only the privileges granted on *.* can be revoked partially.
+		if !slices.Contains(u.privileges, "ALL") {
+			for _, p := range privileges {
+				if !slices.Contains(u.privileges, p) {
+					return UserSetting{}, fmt.Errorf("%s on %s cannot be revoked since it is not granted on *.*", p, target)
+				}
+			}
+		}
+		if u.revokePrivileges == nil {
+			u.revokePrivileges = make(map[string][]string)
+		}
+		u.revokePrivileges[target] = privileges
+	}
+	if u.withGrantOption && len(u.privileges) == 0 {
+		return UserSetting{}, errors.New("withGrantOption requires privileges on *.*")
+	}
+	return u, nil
+}
+
+// normalizePrivileges validates `target` and `privileges`, and returns the privileges in upper case.
+func normalizePrivileges(target string, privileges []string) ([]string, error) {
+	if !customUserTargetPattern.MatchString(target) {
+		return nil, fmt.Errorf("invalid target: %q", target)
+	}
+	if len(privileges) == 0 {
+		return nil, fmt.Errorf("no privileges on %s", target)
+	}
+	normalized := make([]string, len(privileges))
+	for i, p := range privileges {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		if !privilegePattern.MatchString(p) {
+			return nil, fmt.Errorf("invalid privilege on %s: %q", target, privileges[i])
+		}
+		switch p {
+		case "PROXY", "GRANT OPTION", "USAGE":
+			return nil, fmt.Errorf("%s cannot be granted on %s", p, target)
+		case "ALL PRIVILEGES":
+			p = "ALL"
+		}
+		normalized[i] = p
+	}
+	return normalized, nil
+}
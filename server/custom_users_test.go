@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("custom users", func() {
+	It("should parse the custom users file", func() {
+		users, attrs, err := parseCustomUsers([]byte(`
+users:
+  - name: app
+    host: "10.%"
+    passwordFile: /secrets/app
+    authPlugin: caching_sha2_password
+    privileges:
+      "*.*": [process]
+      "app.*": [SELECT, insert]
+    revokes:
+      "mysql.*": [PROCESS]
+    require: ssl
+    maxUserConnections: 10
+    failedLoginAttempts: 3
+    passwordLockTime: -1
+mocoUsers:
+  moco-writable:
+    maxUserConnections: 100
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attrs).To(Equal(map[string]accountAttributes{
+			"moco-writable": {maxUserConnections: 100},
+		}))
+		Expect(users).To(HaveLen(1))
+		u := users[0]
+		Expect(u.account()).To(Equal("'app'@'10.%'"))
+		Expect(u.privileges).To(Equal([]string{"PROCESS"}))
+		Expect(u.targetPrivileges).To(Equal(map[string][]string{"app.*": {"SELECT", "INSERT"}}))
+		Expect(u.revokePrivileges).To(Equal(map[string][]string{"mysql.*": {"PROCESS"}}))
+		Expect(u.createUserQuery()).To(Equal("CREATE USER IF NOT EXISTS ?@? IDENTIFIED WITH caching_sha2_password BY ? REQUIRE SSL WITH MAX_USER_CONNECTIONS 10 FAILED_LOGIN_ATTEMPTS 3 PASSWORD_LOCK_TIME UNBOUNDED"))
+
+		users, attrs, err = parseCustomUsers([]byte(`{"users": [{"name": "reader", "passwordFile": "/secrets/reader", "privileges": {"app.t1": ["SELECT"]}}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(HaveLen(1))
+		Expect(users[0].account()).To(Equal("'reader'@'%'"))
+		Expect(users[0].privileges).To(BeEmpty())
+		Expect(users[0].createUserQuery()).To(Equal("CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?"))
+		Expect(attrs).To(BeNil())
+
+		users, _, err = parseCustomUsers([]byte(`{"users": [{"name": "admin", "passwordFile": "/p", "privileges": {"*.*": ["ALL"]}, "revokes": {"app-db.*": ["DROP"]}}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users[0].revokePrivileges).To(Equal(map[string][]string{"app-db.*": {"DROP"}}))
+
+		users, _, err = parseCustomUsers(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(BeEmpty())
+	})
+
+	DescribeTable("should reject invalid custom users",
+		func(data string) {
+			_, _, err := parseCustomUsers([]byte(data))
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("reserved name", `{"users": [{"name": "moco-app", "passwordFile": "/p"}]}`),
+		Entry("root", `{"users": [{"name": "root", "passwordFile": "/p"}]}`),
+		Entry("quoted name", `{"users": [{"name": "a'b", "passwordFile": "/p"}]}`),
+		Entry("duplicate name", `{"users": [{"name": "app", "passwordFile": "/p"}, {"name": "app", "host": "localhost", "passwordFile": "/p"}]}`),
+		Entry("no password", `{"users": [{"name": "app"}]}`),
+		Entry("unknown field", `{"users": [{"name": "app", "passwordFile": "/p", "pasword": "x"}]}`),
+		Entry("invalid target", "{\"users\": [{\"name\": \"app\", \"passwordFile\": \"/p\", \"privileges\": {\"`app`.*\": [\"SELECT\"]}}]}"),
+		Entry("invalid privilege", `{"users": [{"name": "app", "passwordFile": "/p", "privileges": {"app.*": ["SELECT; DROP"]}}]}`),
+		Entry("proxy", `{"users": [{"name": "app", "passwordFile": "/p", "privileges": {"*.*": ["PROXY"]}}]}`),
+		Entry("revoke on a table", `{"users": [{"name": "app", "passwordFile": "/p", "privileges": {"*.*": ["SELECT"]}, "revokes": {"app.t1": ["SELECT"]}}]}`),
+		Entry("revoke not granted on *.*", `{"users": [{"name": "app", "passwordFile": "/p", "privileges": {"*.*": ["SELECT"]}, "revokes": {"mysql.*": ["INSERT"]}}]}`),
+		Entry("revoke without global privileges", `{"users": [{"name": "app", "passwordFile": "/p", "privileges": {"app.*": ["SELECT"]}, "revokes": {"app.*": ["SELECT"]}}]}`),
+		Entry("negative limit", `{"users": [{"name": "app", "passwordFile": "/p", "maxUserConnections": -1}]}`),
+		Entry("invalid require", `{"users": [{"name": "app", "passwordFile": "/p", "require": "ISSUER"}]}`),
+		Entry("invalid lock time", `{"users": [{"name": "app", "passwordFile": "/p", "passwordLockTime": -2}]}`),
+		Entry("unknown MOCO user", `{"mocoUsers": {"moco-unknown": {"maxUserConnections": 1}}}`),
+		Entry("plugin of a MOCO user", `{"mocoUsers": {"moco-writable": {"authPlugin": "mysql_native_password"}}}`),
+	)
+
+	It("should compute the statement to correct account attributes", func() {
+		declared := accountAttributes{require: requireX509, maxUserConnections: 10, passwordLockTime: passwordLockTimeUnbounded}
+		diffs, alter, pluginChanged := diffAttributes("'app'@'%'", declared, declared)
+		Expect(diffs).To(BeEmpty())
+		Expect(alter).To(BeEmpty())
+		Expect(pluginChanged).To(BeFalse())
+
+		actual := accountAttributes{authPlugin: "mysql_native_password", require: requireSSL, maxQueriesPerHour: 5, failedLoginAttempts: 3, passwordLockTime: 1}
+		diffs, alter, pluginChanged = diffAttributes("'app'@'%'", declared, actual)
+		Expect(diffs).To(Equal([]string{
+			"REQUIRE X509 (actual SSL)",
+			"MAX_USER_CONNECTIONS 10 (actual 0)",
+			"MAX_QUERIES_PER_HOUR 0 (actual 5)",
+			"FAILED_LOGIN_ATTEMPTS 0 (actual 3)",
+			"PASSWORD_LOCK_TIME UNBOUNDED (actual 1)",
+		}))
+		Expect(alter).To(Equal("ALTER USER 'app'@'%' REQUIRE X509 WITH MAX_USER_CONNECTIONS 10 MAX_QUERIES_PER_HOUR 0 FAILED_LOGIN_ATTEMPTS 0 PASSWORD_LOCK_TIME UNBOUNDED"))
+		Expect(pluginChanged).To(BeFalse())
+
+		declared = accountAttributes{authPlugin: "caching_sha2_password"}
+		actual = accountAttributes{authPlugin: "mysql_native_password"}
+		diffs, alter, pluginChanged = diffAttributes("'app'@'%'", declared, actual)
+		Expect(diffs).To(Equal([]string{"IDENTIFIED WITH caching_sha2_password (actual mysql_native_password)"}))
+		Expect(alter).To(BeEmpty())
+		Expect(pluginChanged).To(BeTrue())
+	})
+
+	It("should create and reconcile custom users", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		dir := GinkgoT().TempDir()
+		passwordFile := filepath.Join(dir, "app-password")
+		Expect(os.WriteFile(passwordFile, []byte("app-password\n"), 0600)).To(Succeed())
+		usersFile := filepath.Join(dir, "users.yaml")
+		Expect(os.WriteFile(usersFile, []byte(`
+users:
+  - name: app
+    passwordFile: `+passwordFile+`
+    privileges:
+      "app.*": [SELECT, INSERT]
+    maxUserConnections: 5
+mocoUsers:
+  moco-writable:
+    maxUserConnections: 100
+`), 0644)).To(Succeed())
+		Expect(agent.LoadCustomUsers(usersFile)).To(Succeed())
+
+		db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, adminUserPassword, sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		_, err = db.Exec(`SET GLOBAL super_read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("creating the missing user")
+		drifts, applied, err := agent.ReconcilePrivileges(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(BeTrue())
+		Expect(drifts).To(HaveLen(2))
+		Expect(drifts[0].user).To(Equal(mocoagent.WritableUser))
+		Expect(drifts[0].attributes).To(Equal([]string{"MAX_USER_CONNECTIONS 100 (actual 0)"}))
+		Expect(drifts[1].user).To(Equal("app"))
+		Expect(drifts[1].userMissing).To(BeTrue())
+
+		appDB, err := GetMySQLConnLocalSocket("app", "app-password", sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		appDB.Close()
+
+		By("correcting the drifted privileges")
+		_, err = db.Exec("GRANT DELETE ON `app`.* TO 'app'@'%'")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec("ALTER USER 'app'@'%' WITH MAX_USER_CONNECTIONS 0 MAX_QUERIES_PER_HOUR 10")
+		Expect(err).NotTo(HaveOccurred())
+		drifts, applied, err = agent.ReconcilePrivileges(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(BeTrue())
+		Expect(drifts).To(HaveLen(1))
+		Expect(drifts[0].extra).To(Equal([]string{"DELETE ON app.*"}))
+		Expect(drifts[0].attributes).To(Equal([]string{"MAX_USER_CONNECTIONS 5 (actual 0)", "MAX_QUERIES_PER_HOUR 0 (actual 10)"}))
+
+		drifts, _, err = agent.ReconcilePrivileges(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(BeEmpty())
+	})
+})
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// MySQLErrorReason is the reason of ErrorInfo attached to errors caused by MySQL errors.
+	MySQLErrorReason = "MYSQL_ERROR"
+
+	// MySQLErrorDomain is the domain of ErrorInfo attached to errors caused by MySQL errors.
+	MySQLErrorDomain = "mysql"
+
+	// Keys of the metadata of ErrorInfo.
+	MySQLErrorNumberKey = "errno"
+	MySQLSQLStateKey    = "sqlstate"
+)
+
+// mysqlErrorCodes maps MySQL error numbers to gRPC status codes.
+var mysqlErrorCodes = map[uint16]codes.Code{
+	1040: codes.ResourceExhausted,  // ER_CON_COUNT_ERROR
+	1044: codes.PermissionDenied,   // ER_DBACCESS_DENIED_ERROR
+	1045: codes.PermissionDenied,   // ER_ACCESS_DENIED_ERROR
+	1049: codes.NotFound,           // ER_BAD_DB_ERROR
+	1064: codes.InvalidArgument,    // ER_PARSE_ERROR
+	1142: codes.PermissionDenied,   // ER_TABLEACCESS_DENIED_ERROR
+	1143: codes.PermissionDenied,   // ER_COLUMNACCESS_DENIED_ERROR
+	1146: codes.NotFound,           // ER_NO_SUCH_TABLE
+	1158: codes.Unavailable,        // ER_NET_READ_ERROR
+	1159: codes.Unavailable,        // ER_NET_READ_INTERRUPTED
+	1160: codes.Unavailable,        // ER_NET_ERROR_ON_WRITE
+	1161: codes.Unavailable,        // ER_NET_WRITE_INTERRUPTED
+	1203: codes.ResourceExhausted,  // ER_TOO_MANY_USER_CONNECTIONS
+	1205: codes.Unavailable,        // ER_LOCK_WAIT_TIMEOUT
+	1213: codes.Aborted,            // ER_LOCK_DEADLOCK
+	1227: codes.PermissionDenied,   // ER_SPECIFIC_ACCESS_DENIED_ERROR
+	1290: codes.FailedPrecondition, // ER_OPTION_PREVENTS_STATEMENT
+	1317: codes.Canceled,           // ER_QUERY_INTERRUPTED
+	1524: codes.FailedPrecondition, // ER_PLUGIN_IS_NOT_LOADED
+	1792: codes.FailedPrecondition, // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION
+	1836: codes.FailedPrecondition, // ER_READ_ONLY_MODE
+	3024: codes.DeadlineExceeded,   // ER_QUERY_TIMEOUT
+	3634: codes.ResourceExhausted,  // ER_TOO_MANY_CONCURRENT_CLONES
+	3862: codes.Unavailable,        // ER_CLONE_DONOR
+	3863: codes.FailedPrecondition, // ER_CLONE_PROTOCOL
+	3864: codes.FailedPrecondition, // ER_CLONE_DONOR_VERSION
+	3865: codes.FailedPrecondition, // ER_CLONE_OS
+	3866: codes.FailedPrecondition, // ER_CLONE_PLATFORM
+	3867: codes.FailedPrecondition, // ER_CLONE_CHARSET
+	3868: codes.FailedPrecondition, // ER_CLONE_CONFIG
+	3869: codes.FailedPrecondition, // ER_CLONE_SYS_CONFIG
+	3870: codes.FailedPrecondition, // ER_CLONE_PLUGIN_MATCH
+	3871: codes.InvalidArgument,    // ER_CLONE_LOOPBACK
+	3872: codes.FailedPrecondition, // ER_CLONE_ENCRYPTION
+	3873: codes.ResourceExhausted,  // ER_CLONE_DISK_SPACE
+	3874: codes.Aborted,            // ER_CLONE_IN_PROGRESS
+	3875: codes.FailedPrecondition, // ER_CLONE_DISALLOWED
+}
+
+// mysqlStatusError returns a gRPC status error for `err` with `msg` as the prefix of the message.
+// If `err` is a MySQL error, the code is translated from the error number, and ErrorInfo
+// having the error number and SQLSTATE is attached.  Otherwise, the code is `fallback`.
+func mysqlStatusError(fallback codes.Code, err error, msg string) error {
+	var merr *mysql.MySQLError
+	if !errors.As(err, &merr) {
+		return status.Errorf(fallback, "%s: %+v", msg, err)
+	}
+
+	code, ok := mysqlErrorCodes[merr.Number]
+	if !ok {
+		code = fallback
+	}
+	st := status.Newf(code, "%s: %+v", msg, err)
+
+	info := &errdetails.ErrorInfo{
+		Reason: MySQLErrorReason,
+		Domain: MySQLErrorDomain,
+		Metadata: map[string]string{
+			MySQLErrorNumberKey: strconv.Itoa(int(merr.Number)),
+		},
+	}
+	if merr.SQLState != [5]byte{} {
+		info.Metadata[MySQLSQLStateKey] = string(merr.SQLState[:])
+	}
+	if withDetails, err := st.WithDetails(info); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
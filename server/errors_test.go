@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("MySQL error translation", func() {
+	It("should translate MySQL errors into gRPC status", func() {
+		merr := &mysql.MySQLError{Number: 1045, SQLState: [5]byte{'2', '8', '0', '0', '0'}, Message: "Access denied"}
+		err := mysqlStatusError(codes.Internal, fmt.Errorf("failed to connect: %w", merr), "failed to clone")
+
+		st, ok := status.FromError(err)
+		Expect(ok).To(BeTrue())
+		Expect(st.Code()).To(Equal(codes.PermissionDenied))
+		Expect(st.Message()).To(HavePrefix("failed to clone: failed to connect: Error 1045 (28000)"))
+		Expect(st.Details()).To(HaveLen(1))
+		info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+		Expect(ok).To(BeTrue())
+		Expect(info.Reason).To(Equal(MySQLErrorReason))
+		Expect(info.Domain).To(Equal(MySQLErrorDomain))
+		Expect(info.Metadata).To(Equal(map[string]string{
+			MySQLErrorNumberKey: "1045",
+			MySQLSQLStateKey:    "28000",
+		}))
+
+		err = mysqlStatusError(codes.Internal, &mysql.MySQLError{Number: 3869, Message: "Clone system configuration"}, "failed to clone")
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		st, _ = status.FromError(err)
+		Expect(st.Details()[0].(*errdetails.ErrorInfo).Metadata).NotTo(HaveKey(MySQLSQLStateKey))
+
+		err = mysqlStatusError(codes.Internal, &mysql.MySQLError{Number: 9999}, "failed to clone")
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+		st, _ = status.FromError(err)
+		Expect(st.Details()).To(HaveLen(1))
+	})
+
+	It("should use the fallback code for other errors", func() {
+		err := mysqlStatusError(codes.FailedPrecondition, errors.New("connection refused"), "failed to connect")
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		st, _ := status.FromError(err)
+		Expect(st.Message()).To(Equal("failed to connect: connection refused"))
+		Expect(st.Details()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,605 @@
+// Package fake provides an in-memory implementation of server.MySQLAccessor.
+//
+// It lets tests of Agent and its users simulate replication errors, lag, clone states,
+// and server versions without running mysqld.
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/binlog"
+	"github.com/cybozu-go/moco-agent/server"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Clone states in performance_schema.clone_status.
+const (
+	CloneNotStarted = "Not Started"
+	CloneInProgress = "In Progress"
+	CloneCompleted  = "Completed"
+	CloneFailed     = "Failed"
+)
+
+// ErrClosed is returned after Close is called.
+var ErrClosed = errors.New("fake: closed")
+
+// MySQL is an in-memory server.MySQLAccessor.
+//
+// Global variables are shared by GetGlobalVariables, GetPrimaryStatus, and GetCloneInstanceInfo,
+// so setting read_only or gtid_executed with SetGlobalVariable changes their results as well.
+// Statements are not executed; for example, StartReplica only marks the replication threads running.
+// Use SetReplicaStatus and SetTransactionTimestamps to simulate the progress of replication.
+type MySQL struct {
+	mu sync.Mutex
+
+	version   string
+	comment   string
+	variables map[string]string
+	plugins   []string
+	dataSize  int64
+
+	cloneState string
+	cloneHook  func(*server.CloneSource) error
+	clones     []server.CloneSource
+
+	replicas map[string]*server.MySQLReplicaStatus
+
+	queued  time.Time
+	applied time.Time
+	uptime  time.Duration
+
+	binlogs []server.BinaryLog
+	events  map[string][]server.BinlogEvent
+
+	// passwords maps users to the current and the retained passwords.
+	passwords map[string][2]string
+	resets    int
+
+	failures map[string]error
+	closed   bool
+}
+
+var _ server.MySQLAccessor = &MySQL{}
+
+// New returns a writable MySQL 8.4 instance with no data.
+func New() *MySQL {
+	return &MySQL{
+		version: "8.4.3",
+		comment: "MySQL Community Server - GPL",
+		variables: map[string]string{
+			"read_only":                                 "0",
+			"super_read_only":                           "0",
+			"clone_valid_donor_list":                    "",
+			"clone_max_concurrency":                     "16",
+			"clone_max_data_bandwidth":                  "0",
+			"clone_enable_compression":                  "0",
+			"clone_ssl_ca":                              "",
+			"clone_ssl_cert":                            "",
+			"clone_ssl_key":                             "",
+			"rpl_semi_sync_master_wait_for_slave_count": "0",
+			"gtid_executed":                             "",
+			"innodb_page_size":                          "16384",
+			"lower_case_table_names":                    "0",
+			"max_allowed_packet":                        "67108864",
+			"datadir":                                   "/var/lib/mysql/",
+			"log_bin_basename":                          "/var/lib/mysql/binlog",
+			"relay_log_basename":                        "/var/lib/mysql/relay-bin",
+		},
+		plugins:   []string{"InnoDB", "clone"},
+		replicas:  make(map[string]*server.MySQLReplicaStatus),
+		events:    make(map[string][]server.BinlogEvent),
+		passwords: make(map[string][2]string),
+		failures:  make(map[string]error),
+		uptime:    time.Hour,
+	}
+}
+
+// Fail makes `method` return `err` until it is called again with nil.
+// `method` is the name of a method of server.MySQLAccessor such as "GetReplicaStatus".
+func (m *MySQL) Fail(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.failures, method)
+		return
+	}
+	m.failures[method] = err
+}
+
+// check returns the error for `method`.  The caller must hold mu.
+func (m *MySQL) check(method string) error {
+	if m.closed {
+		return ErrClosed
+	}
+	return m.failures[method]
+}
+
+// SetVersion sets VERSION() and @@version_comment.
+func (m *MySQL) SetVersion(version, comment string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.version = version
+	m.comment = comment
+}
+
+// SetPlugins sets the active plugins and the size of the data returned by GetCloneInstanceInfo.
+func (m *MySQL) SetPlugins(plugins []string, dataSize int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.plugins = slices.Clone(plugins)
+	m.dataSize = dataSize
+}
+
+// SetCloneState sets the state of the last clone.  The empty state means no clone has been run.
+func (m *MySQL) SetCloneState(state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cloneState = state
+}
+
+// SetCloneHook sets the function called by CloneInstance.
+// If it returns an error, CloneInstance fails with the error and the clone state becomes Failed.
+func (m *MySQL) SetCloneHook(hook func(*server.CloneSource) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cloneHook = hook
+}
+
+// Clones returns the donors of the CLONE INSTANCE calls.
+func (m *MySQL) Clones() []server.CloneSource {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.clones)
+}
+
+// SetReplicaStatus sets the status of the replication `channel`.  nil removes the channel.
+func (m *MySQL) SetReplicaStatus(channel string, status *server.MySQLReplicaStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if status == nil {
+		delete(m.replicas, channel)
+		return
+	}
+	st := *status
+	st.ChannelName = channel
+	m.replicas[channel] = &st
+}
+
+// SetTransactionTimestamps sets the timestamps of the last queued and applied transactions, and the uptime.
+// The replication lag is queued - applied.
+func (m *MySQL) SetTransactionTimestamps(queued, applied time.Time, uptime time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queued = queued
+	m.applied = applied
+	m.uptime = uptime
+}
+
+// AddBinaryLog appends a binary log file whose Previous_gtids event has `previousGTIDs`.
+func (m *MySQL) AddBinaryLog(name string, size int64, previousGTIDs string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.binlogs = append(m.binlogs, server.BinaryLog{Name: name, Size: size, Encrypted: "No"})
+	m.events[name] = []server.BinlogEvent{
+		{LogName: name, Pos: 4, EventType: "Format_desc", ServerID: 1, EndLogPos: 126, Info: "Server ver: " + m.version + ", Binlog ver: 4"},
+		{LogName: name, Pos: 126, EventType: "Previous_gtids", ServerID: 1, EndLogPos: 197, Info: previousGTIDs},
+	}
+}
+
+// SetPassword sets the password of `user` discarding the retained one.
+func (m *MySQL) SetPassword(user, password string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.passwords[user] = [2]string{password, ""}
+}
+
+// Passwords returns the users and their current passwords.
+func (m *MySQL) Passwords() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make(map[string]string, len(m.passwords))
+	for user, p := range m.passwords {
+		ret[user] = p[0]
+	}
+	return ret
+}
+
+// ConnectionResets returns the number of ResetConnections calls.
+func (m *MySQL) ConnectionResets() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.resets
+}
+
+func (m *MySQL) Ping(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check("Ping")
+}
+
+func (m *MySQL) GetGlobalVariables(ctx context.Context) (*server.MySQLGlobalVariablesStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("GetGlobalVariables"); err != nil {
+		return nil, err
+	}
+
+	count, _ := strconv.Atoi(m.variables["rpl_semi_sync_master_wait_for_slave_count"])
+	status := &server.MySQLGlobalVariablesStatus{
+		ReadOnly:                           m.variables["read_only"] == "1",
+		SuperReadOnly:                      m.variables["super_read_only"] == "1",
+		RplSemiSyncMasterWaitForSlaveCount: count,
+	}
+	if list := m.variables["clone_valid_donor_list"]; list != "" {
+		status.CloneValidDonorList = sql.NullString{String: list, Valid: true}
+	}
+	return status, nil
+}
+
+func (m *MySQL) GetCloneState(ctx context.Context) (*server.MySQLCloneStateStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("GetCloneState"); err != nil {
+		return nil, err
+	}
+	status := &server.MySQLCloneStateStatus{}
+	if m.cloneState != "" {
+		status.State = sql.NullString{String: m.cloneState, Valid: true}
+	}
+	return status, nil
+}
+
+func (m *MySQL) GetPrimaryStatus(ctx context.Context) (*server.MySQLPrimaryStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("GetPrimaryStatus"); err != nil {
+		return nil, err
+	}
+	status := &server.MySQLPrimaryStatus{ExecutedGtidSet: m.variables["gtid_executed"]}
+	if len(m.binlogs) > 0 {
+		last := m.binlogs[len(m.binlogs)-1]
+		status.File = last.Name
+		status.Position = strconv.FormatInt(last.Size, 10)
+	}
+	return status, nil
+}
+
+func (m *MySQL) GetReplicaStatus(ctx context.Context, channel string) (*server.MySQLReplicaStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("GetReplicaStatus"); err != nil {
+		return nil, err
+	}
+	st, ok := m.replicas[channel]
+	if !ok {
+		return nil, fmt.Errorf("failed to show replica status: %w", sql.ErrNoRows)
+	}
+	ret := *st
+	ret.ExecutedGtidSet = m.variables["gtid_executed"]
+	return &ret, nil
+}
+
+func (m *MySQL) GetTransactionTimestamps(ctx context.Context) (queued, applied time.Time, uptime time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("GetTransactionTimestamps"); err != nil {
+		return time.Time{}, time.Time{}, 0, err
+	}
+	return m.queued, m.applied, m.uptime, nil
+}
+
+func (m *MySQL) GetCloneInstanceInfo(ctx context.Context) (*server.CloneInstanceInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("GetCloneInstanceInfo"); err != nil {
+		return nil, err
+	}
+	pageSize, _ := strconv.ParseInt(m.variables["innodb_page_size"], 10, 64)
+	lowerCase, _ := strconv.Atoi(m.variables["lower_case_table_names"])
+	maxPacket, _ := strconv.ParseInt(m.variables["max_allowed_packet"], 10, 64)
+	return &server.CloneInstanceInfo{
+		Version:             m.version,
+		VersionComment:      m.comment,
+		InnoDBPageSize:      pageSize,
+		LowerCaseTableNames: lowerCase,
+		MaxAllowedPacket:    maxPacket,
+		DataDir:             m.variables["datadir"],
+		Plugins:             slices.Clone(m.plugins),
+		DataSize:            m.dataSize,
+	}, nil
+}
+
+// unknownVariable returns the error of MySQL for an unknown system variable.
+func unknownVariable(name string) error {
+	return &mysql.MySQLError{Number: 1193, Message: fmt.Sprintf("Unknown system variable '%s'", name)}
+}
+
+func (m *MySQL) GetGlobalVariable(ctx context.Context, name string, dest any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("GetGlobalVariable"); err != nil {
+		return err
+	}
+	v, ok := m.variables[name]
+	if !ok {
+		return unknownVariable(name)
+	}
+
+	switch dest := dest.(type) {
+	case *string:
+		*dest = v
+	case *int64:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s is not an integer: %s", name, v)
+		}
+		*dest = n
+	case *bool:
+		*dest = v == "1"
+	default:
+		return fmt.Errorf("unsupported type %T for %s", dest, name)
+	}
+	return nil
+}
+
+func (m *MySQL) SetGlobalVariable(ctx context.Context, name string, value any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("SetGlobalVariable"); err != nil {
+		return err
+	}
+	if _, ok := m.variables[name]; !ok {
+		return unknownVariable(name)
+	}
+
+	switch value := value.(type) {
+	case bool:
+		if value {
+			m.variables[name] = "1"
+		} else {
+			m.variables[name] = "0"
+		}
+	case string:
+		switch strings.ToUpper(value) {
+		case "ON":
+			value = "1"
+		case "OFF":
+			value = "0"
+		}
+		m.variables[name] = value
+	default:
+		m.variables[name] = fmt.Sprint(value)
+	}
+	return nil
+}
+
+func (m *MySQL) ListBinaryLogs(ctx context.Context) ([]server.BinaryLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("ListBinaryLogs"); err != nil {
+		return nil, err
+	}
+	return slices.Clone(m.binlogs), nil
+}
+
+func (m *MySQL) ListBinlogEvents(ctx context.Context, file string, limit int) ([]server.BinlogEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("ListBinlogEvents"); err != nil {
+		return nil, err
+	}
+	events, ok := m.events[file]
+	if !ok {
+		return nil, fmt.Errorf("failed to show binlog events in %s: could not find target log", file)
+	}
+	return slices.Clone(events[:min(limit, len(events))]), nil
+}
+
+func (m *MySQL) PurgeBinaryLogs(ctx context.Context, file string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("PurgeBinaryLogs"); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(m.binlogs, func(l server.BinaryLog) bool { return l.Name == file })
+	if i < 0 {
+		return fmt.Errorf("failed to purge binary logs to %s: target log not found in binlog index", file)
+	}
+	for _, l := range m.binlogs[:i] {
+		delete(m.events, l.Name)
+	}
+	m.binlogs = slices.Clone(m.binlogs[i:])
+	return nil
+}
+
+func (m *MySQL) IsGTIDSubset(ctx context.Context, set, excluded, superset string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("IsGTIDSubset"); err != nil {
+		return false, err
+	}
+
+	// set - excluded ⊆ superset if and only if set ⊆ superset ∪ excluded.
+	sets := make([]binlog.GTIDSet, 3)
+	for i, s := range []string{set, excluded, superset} {
+		parsed, err := binlog.ParseGTIDSet(s)
+		if err != nil {
+			return false, fmt.Errorf("failed to compare GTID sets: %w", err)
+		}
+		sets[i] = parsed
+	}
+	union := sets[2].Clone()
+	union.Union(sets[1])
+	return sets[0].IsSubset(union), nil
+}
+
+func (m *MySQL) FlushSlowLogs(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check("FlushSlowLogs")
+}
+
+func (m *MySQL) ChangeReplicationSource(ctx context.Context, source *server.ReplicationSource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("ChangeReplicationSource"); err != nil {
+		return err
+	}
+	st := m.replicas[""]
+	if st == nil {
+		st = &server.MySQLReplicaStatus{ReplicaIORunning: "No", ReplicaSQLRunning: "No"}
+		m.replicas[""] = st
+	}
+	st.SourceHost = source.Host
+	st.SourcePort = source.Port
+	st.SourceUser = source.User
+	st.AutoPosition = "1"
+	st.SourceSSLAllowed = "No"
+	if source.SSL {
+		st.SourceSSLAllowed = "Yes"
+	}
+	return nil
+}
+
+func (m *MySQL) StartReplica(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("StartReplica"); err != nil {
+		return err
+	}
+	st := m.replicas[""]
+	if st == nil {
+		return &mysql.MySQLError{Number: 3074, Message: "Replica failed to initialize applier metadata structure from the repository"}
+	}
+	st.ReplicaIORunning = "Yes"
+	st.ReplicaSQLRunning = "Yes"
+	return nil
+}
+
+func (m *MySQL) StartRelayLogApplier(ctx context.Context, applier *server.RelayLogApplier) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("StartRelayLogApplier"); err != nil {
+		return err
+	}
+	if applier.AfterGTIDs != "" && applier.BeforeGTIDs != "" {
+		return errors.New("both AfterGTIDs and BeforeGTIDs are set")
+	}
+	st := &server.MySQLReplicaStatus{
+		ChannelName:       applier.Channel,
+		SourceHost:        applier.Channel + ".invalid",
+		RelayLogFile:      applier.RelayLogFile,
+		RelayLogPos:       4,
+		ReplicaIORunning:  "No",
+		ReplicaSQLRunning: "Yes",
+	}
+	switch {
+	case applier.AfterGTIDs != "":
+		st.UntilCondition = "SQL_AFTER_GTIDS"
+	case applier.BeforeGTIDs != "":
+		st.UntilCondition = "SQL_BEFORE_GTIDS"
+	default:
+		st.UntilCondition = "None"
+	}
+	m.replicas[applier.Channel] = st
+	return nil
+}
+
+func (m *MySQL) RemoveReplicationChannel(ctx context.Context, channel string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("RemoveReplicationChannel"); err != nil {
+		return err
+	}
+	delete(m.replicas, channel)
+	return nil
+}
+
+func (m *MySQL) CloneInstance(ctx context.Context, source *server.CloneSource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("CloneInstance"); err != nil {
+		m.cloneState = CloneFailed
+		return err
+	}
+	m.clones = append(m.clones, *source)
+	if m.cloneHook != nil {
+		if err := m.cloneHook(source); err != nil {
+			m.cloneState = CloneFailed
+			return err
+		}
+	}
+	m.cloneState = CloneCompleted
+	return nil
+}
+
+func (m *MySQL) ChangePassword(ctx context.Context, user, host, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("ChangePassword"); err != nil {
+		return err
+	}
+	p, ok := m.passwords[user]
+	if !ok {
+		return &mysql.MySQLError{Number: 1396, Message: fmt.Sprintf("Operation ALTER USER failed for '%s'@'%s'", user, host)}
+	}
+	m.passwords[user] = [2]string{password, p[0]}
+	return nil
+}
+
+func (m *MySQL) DiscardOldPassword(ctx context.Context, user, host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("DiscardOldPassword"); err != nil {
+		return err
+	}
+	p, ok := m.passwords[user]
+	if !ok {
+		return &mysql.MySQLError{Number: 1396, Message: fmt.Sprintf("Operation ALTER USER failed for '%s'@'%s'", user, host)}
+	}
+	m.passwords[user] = [2]string{p[0], ""}
+	return nil
+}
+
+func (m *MySQL) HasRetainedPassword(ctx context.Context, user, host string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("HasRetainedPassword"); err != nil {
+		return false, err
+	}
+	return m.passwords[user][1] != "", nil
+}
+
+func (m *MySQL) CheckPassword(ctx context.Context, user, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check("CheckPassword"); err != nil {
+		return err
+	}
+	p, ok := m.passwords[user]
+	if !ok || password == "" || (password != p[0] && password != p[1]) {
+		return &mysql.MySQLError{Number: 1045, Message: fmt.Sprintf("Access denied for user '%s'@'localhost' (using password: YES)", user)}
+	}
+	return nil
+}
+
+func (m *MySQL) ResetConnections() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resets++
+}
+
+func (m *MySQL) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
@@ -0,0 +1,262 @@
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/mysqltest"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/cybozu-go/moco-agent/server"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const testUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func newAgent(m *MySQL) *server.Agent {
+	conf := server.MySQLAccessorConfig{
+		Host:              "localhost",
+		Port:              3306,
+		Password:          "password",
+		ConnMaxIdleTime:   time.Minute,
+		ConnectionTimeout: time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	return server.NewWithAccessor(conf, m, "test", "/nonexistent/mysqld.sock", "", 5*time.Second, time.Second, logr.Discard())
+}
+
+// samePasswords gives the same password to all MOCO users.
+type samePasswords string
+
+func (p samePasswords) Password(string) string { return string(p) }
+
+func (samePasswords) Updated() <-chan struct{} { return nil }
+
+func getReady(agent *server.Agent) *http.Response {
+	rec := httptest.NewRecorder()
+	agent.MySQLDReady(rec, httptest.NewRequest("GET", "http://localhost/readyz", nil))
+	return rec.Result()
+}
+
+func getHealth(agent *server.Agent) *http.Response {
+	rec := httptest.NewRecorder()
+	agent.MySQLDHealth(rec, httptest.NewRequest("GET", "http://localhost/healthz", nil))
+	return rec.Result()
+}
+
+var _ = Describe("MySQL", func() {
+	It("should let Agent reply for probes", func() {
+		m := New()
+		agent := newAgent(m)
+		ctx := context.Background()
+
+		By("checking a writable primary")
+		Expect(getHealth(agent)).To(HaveHTTPStatus(http.StatusOK))
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusOK))
+
+		By("checking a replica with the stopped replication")
+		Expect(m.SetGlobalVariable(ctx, "read_only", "ON")).To(Succeed())
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusInternalServerError))
+		Expect(m.ChangeReplicationSource(ctx, &server.ReplicationSource{Host: "moco-test-0", Port: 3306, User: "moco-repl"})).To(Succeed())
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusServiceUnavailable))
+
+		By("checking a replica in sync")
+		Expect(m.StartReplica(ctx)).To(Succeed())
+		now := time.Now()
+		m.SetTransactionTimestamps(now, now, time.Hour)
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusOK))
+
+		By("checking a lagging replica")
+		m.SetTransactionTimestamps(now, now.Add(-10*time.Second), time.Hour)
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusServiceUnavailable))
+
+		By("checking a replica that has not received transactions yet")
+		m.SetTransactionTimestamps(time.Time{}, time.Time{}, 0)
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusServiceUnavailable))
+		m.SetTransactionTimestamps(time.Time{}, time.Time{}, time.Hour)
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusOK))
+
+		By("checking a replica with a replication error")
+		st, err := m.GetReplicaStatus(ctx, "")
+		Expect(err).NotTo(HaveOccurred())
+		st.LastSQLErrno = 1062
+		st.LastSQLError = "Duplicate entry"
+		m.SetReplicaStatus("", st)
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusServiceUnavailable))
+
+		By("checking an instance under cloning")
+		m.SetCloneState(CloneInProgress)
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusServiceUnavailable))
+
+		By("checking failures of queries")
+		m.Fail("GetCloneState", errors.New("connection refused"))
+		Expect(getReady(agent)).To(HaveHTTPStatus(http.StatusInternalServerError))
+		m.Fail("Ping", errors.New("connection refused"))
+		Expect(getHealth(agent)).To(HaveHTTPStatus(http.StatusServiceUnavailable))
+		m.Fail("Ping", nil)
+		Expect(getHealth(agent)).To(HaveHTTPStatus(http.StatusOK))
+	})
+
+	It("should let Agent purge binary logs executed in replicas", func() {
+		m := New()
+		m.AddBinaryLog("binlog.000001", 1000, "")
+		m.AddBinaryLog("binlog.000002", 1000, testUUID+":1-10")
+		m.AddBinaryLog("binlog.000003", 1000, testUUID+":1-20")
+		agent := newAgent(m)
+
+		purged, err := agent.PurgeBinaryLogs(context.Background(), &proto.PurgeBinaryLogsRequest{
+			ReplicaGtidSets: []string{testUUID + ":1-15", testUUID + ":1-30"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(Equal([]string{"binlog.000001"}))
+
+		logs, err := m.ListBinaryLogs(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs).To(HaveLen(2))
+		Expect(logs[0].Name).To(Equal("binlog.000002"))
+	})
+
+	It("should let Agent bootstrap a replica", func() {
+		m := New()
+
+		// The donor is probed over TCP.
+		donor := mysqltest.NewInstance()
+		DeferCleanup(donor.Close)
+		donorAddr, err := donor.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		// mysqld restarted after the clone is initialized via the socket.
+		local := mysqltest.NewInstance()
+		DeferCleanup(local.Close)
+		sock := filepath.Join(GinkgoT().TempDir(), "mysqld.sock")
+		_, err = local.Listen("unix", sock)
+		Expect(err).NotTo(HaveOccurred())
+		local.SetVariable("partial_revokes", "0")
+		local.Respond(`SELECT COUNT\(\*\) FROM mysql.user WHERE .*`, &mysqltest.Result{Columns: []string{"COUNT(*)"}, Rows: [][]any{{1}}})
+		local.Respond(`ALTER USER .+ IDENTIFIED BY .+`, nil)
+		local.Respond(`SELECT PLUGIN_NAME, PLUGIN_STATUS, PLUGIN_LIBRARY FROM information_schema.plugins .*`, &mysqltest.Result{Columns: []string{"PLUGIN_NAME", "PLUGIN_STATUS", "PLUGIN_LIBRARY"}})
+		local.Respond(`SELECT component_urn FROM mysql.component`, &mysqltest.Result{Columns: []string{"component_urn"}})
+		local.Respond(`INSTALL PLUGIN .+`, nil)
+
+		conf := server.MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              3306,
+			Password:          "password",
+			ConnMaxIdleTime:   time.Minute,
+			ConnectionTimeout: time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent := server.NewWithAccessor(conf, m, "test", sock, "", 5*time.Second, time.Second, logr.Discard())
+		agent.SetCredentialProvider(samePasswords("password"))
+
+		var responses []*proto.BootstrapReplicaResponse
+		report := func(res *proto.BootstrapReplicaResponse) error {
+			responses = append(responses, res)
+			if res.Phase == "catching_up" {
+				m.SetReplicaStatus("", &server.MySQLReplicaStatus{
+					SourceHost:          res.SourceHost,
+					ReplicaIORunning:    "Yes",
+					ReplicaSQLRunning:   "Yes",
+					SecondsBehindSource: sql.NullInt64{Int64: 0, Valid: true},
+				})
+			}
+			return nil
+		}
+		host, port, err := net.SplitHostPort(donorAddr.String())
+		Expect(err).NotTo(HaveOccurred())
+		donorPort, err := strconv.Atoi(port)
+		Expect(err).NotTo(HaveOccurred())
+		err = agent.BootstrapReplica(context.Background(), &proto.BootstrapReplicaRequest{
+			Clone: &proto.CloneRequest{
+				Host:     host,
+				Port:     int32(donorPort),
+				User:     "moco-clone-donor",
+				Password: "password",
+			},
+			SourceHost: "moco-test-0",
+			SourcePort: 3306,
+			SourceUser: "moco-repl",
+		}, report)
+		Expect(err).NotTo(HaveOccurred())
+
+		var phases []string
+		for _, res := range responses {
+			phases = append(phases, res.Phase)
+			Expect(res.DonorHost).To(Equal(host))
+			Expect(res.SourceHost).To(Equal("moco-test-0"))
+		}
+		Expect(phases).To(Equal([]string{"cloned", "replication_configured", "replication_started", "catching_up", "completed"}))
+		Expect(responses[3].Lag).To(BeNil())
+		Expect(responses[4].Lag.AsDuration()).To(BeZero())
+		Expect(m.Clones()).To(HaveLen(1))
+
+		st, err := m.GetReplicaStatus(context.Background(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.ReplicaSQLRunning).To(Equal("Yes"))
+	})
+
+	It("should convert global variables", func() {
+		m := New()
+		ctx := context.Background()
+
+		Expect(m.SetGlobalVariable(ctx, "super_read_only", true)).To(Succeed())
+		Expect(m.SetGlobalVariable(ctx, "clone_max_concurrency", int64(4))).To(Succeed())
+		Expect(m.SetGlobalVariable(ctx, "clone_valid_donor_list", "10.0.0.1:3306")).To(Succeed())
+		Expect(m.SetGlobalVariable(ctx, "no_such_variable", 1)).NotTo(Succeed())
+
+		var b bool
+		Expect(m.GetGlobalVariable(ctx, "super_read_only", &b)).To(Succeed())
+		Expect(b).To(BeTrue())
+		var i int64
+		Expect(m.GetGlobalVariable(ctx, "clone_max_concurrency", &i)).To(Succeed())
+		Expect(i).To(Equal(int64(4)))
+
+		vars, err := m.GetGlobalVariables(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars.SuperReadOnly).To(BeTrue())
+		Expect(vars.ReadOnly).To(BeFalse())
+		Expect(vars.CloneValidDonorList.String).To(Equal("10.0.0.1:3306"))
+	})
+
+	It("should compare GTID sets", func() {
+		m := New()
+		ctx := context.Background()
+
+		ok, err := m.IsGTIDSubset(ctx, testUUID+":1-20", testUUID+":1-10", testUUID+":11-30")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		ok, err = m.IsGTIDSubset(ctx, testUUID+":1-20", testUUID+":1-5", testUUID+":11-30")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should rotate passwords with a retained one", func() {
+		m := New()
+		ctx := context.Background()
+		m.SetPassword("moco-agent", "old")
+
+		Expect(m.ChangePassword(ctx, "moco-agent", "%", "new")).To(Succeed())
+		Expect(m.CheckPassword(ctx, "moco-agent", "old")).To(Succeed())
+		Expect(m.CheckPassword(ctx, "moco-agent", "new")).To(Succeed())
+		Expect(m.HasRetainedPassword(ctx, "moco-agent", "%")).To(BeTrue())
+		Expect(m.DiscardOldPassword(ctx, "moco-agent", "%")).To(Succeed())
+		Expect(m.CheckPassword(ctx, "moco-agent", "old")).NotTo(Succeed())
+		Expect(m.HasRetainedPassword(ctx, "moco-agent", "%")).To(BeFalse())
+		Expect(m.Passwords()).To(Equal(map[string]string{"moco-agent": "new"}))
+		Expect(m.ChangePassword(ctx, "unknown", "%", "new")).NotTo(Succeed())
+	})
+
+	It("should fail after Close", func() {
+		m := New()
+		Expect(m.Close()).To(Succeed())
+		Expect(m.Ping(context.Background())).To(MatchError(ErrClosed))
+	})
+})
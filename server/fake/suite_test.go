@@ -0,0 +1,19 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/cybozu-go/moco-agent/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFake(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake Suite")
+}
+
+var _ = BeforeSuite(func() {
+	metrics.Init(prometheus.NewRegistry(), "test", 0)
+})
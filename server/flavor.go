@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Flavors of MySQL servers.
+const (
+	flavorMySQL   = "MySQL"
+	flavorPercona = "Percona Server"
+)
+
+// serverFlavor is the flavor and version of a MySQL server.
+// It provides the SQL statements that vary among server versions.
+//
+// MySQL 8.0.22 or later, including 8.4 LTS and 9.x innovation releases, and Percona Server of those series are supported.
+// SHOW REPLICA STATUS and START REPLICA are added in 8.0.22.
+// Percona Server is compatible with MySQL of the same version as far as moco-agent is concerned.
+type serverFlavor struct {
+	name string
+	// version is the major, minor, and patch versions.
+	version []int
+	// raw is VERSION() such as "8.0.36-28".
+	raw string
+}
+
+// detectFlavor detects the flavor of the server connected with `db`.
+func detectFlavor(ctx context.Context, db *sqlx.DB) (*serverFlavor, error) {
+	var row struct {
+		Version string `db:"version"`
+		Comment string `db:"version_comment"`
+	}
+	if err := db.GetContext(ctx, &row, `SELECT VERSION() AS version, @@version_comment AS version_comment`); err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+	return newServerFlavor(row.Version, row.Comment)
+}
+
+// newServerFlavor returns serverFlavor from VERSION() and @@version_comment.
+func newServerFlavor(version, comment string) (*serverFlavor, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Compare(v, []int{8, 0, 22}) < 0 {
+		return nil, fmt.Errorf("unsupported version: %s", version)
+	}
+
+	f := &serverFlavor{name: flavorMySQL, version: v, raw: version}
+	if strings.Contains(comment, "Percona Server") {
+		f.name = flavorPercona
+	}
+	return f, nil
+}
+
+// parseVersion parses the major, minor, and patch versions in VERSION() such as "8.0.28-log".
+func parseVersion(v string) ([]int, error) {
+	fields := strings.SplitN(v, ".", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid version: %s", v)
+	}
+	fields[2], _, _ = strings.Cut(fields[2], "-")
+
+	ret := make([]int, 3)
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version: %s", v)
+		}
+		ret[i] = n
+	}
+	return ret, nil
+}
+
+func (f *serverFlavor) String() string {
+	return f.name + " " + f.raw
+}
+
+// series returns the release series such as "8.0", "8.4", or "9.1".
+func (f *serverFlavor) series() string {
+	return fmt.Sprintf("%d.%d", f.version[0], f.version[1])
+}
+
+// atLeast returns true if the version is `v` or later.  `v` may omit the minor and patch versions.
+func (f *serverFlavor) atLeast(v ...int) bool {
+	return slices.Compare(f.version[:len(v)], v) >= 0
+}
+
+// showBinaryLogStatus returns the statement to show the binary log status.
+// SHOW MASTER STATUS is deprecated in 8.2 and removed in 8.4.
+func (f *serverFlavor) showBinaryLogStatus() string {
+	if f.atLeast(8, 2) {
+		return `SHOW BINARY LOG STATUS`
+	}
+	return `SHOW MASTER STATUS`
+}
+
+// resetBinaryLogs returns the statement to delete all binary logs and reset GTID_EXECUTED.
+// RESET MASTER is deprecated in 8.2 and removed in 8.4.
+func (f *serverFlavor) resetBinaryLogs() string {
+	if f.atLeast(8, 2) {
+		return `RESET BINARY LOGS AND GTIDS`
+	}
+	return `RESET MASTER`
+}
+
+// showReplicaStatus returns the statement to show the replica status of `channel`.
+// Empty `channel` means the default channel.
+func (f *serverFlavor) showReplicaStatus(channel string) string {
+	if channel == "" {
+		return `SHOW REPLICA STATUS`
+	}
+	return fmt.Sprintf(`SHOW REPLICA STATUS FOR CHANNEL '%s'`, channel)
+}
+
+// changeReplicationSource returns the statement to configure the replication source of `channel`.
+// `options` are written with the SOURCE_ names such as "SOURCE_HOST = ?", and they are renamed to the MASTER_ ones
+// before 8.0.23, where CHANGE REPLICATION SOURCE TO is added.  CHANGE MASTER TO is removed in 8.4.
+// Empty `channel` means the default channel.
+func (f *serverFlavor) changeReplicationSource(options []string, channel string) string {
+	stmt := `CHANGE REPLICATION SOURCE TO `
+	if !f.atLeast(8, 0, 23) {
+		stmt = `CHANGE MASTER TO `
+		options = slices.Clone(options)
+		for i, opt := range options {
+			name, value, _ := strings.Cut(opt, "=")
+			options[i] = strings.ReplaceAll(name, "SOURCE_", "MASTER_") + "=" + value
+		}
+	}
+	opts := strings.Join(options, ", ")
+	if channel == "" {
+		return stmt + opts
+	}
+	return fmt.Sprintf(`%s%s FOR CHANNEL '%s'`, stmt, opts, channel)
+}
+
+// semiSyncWaitCountVariables returns the names of the variable for the number of replica acknowledgments.
+// Only the variable of the installed semi-synchronous replication plugin exists.
+// rpl_semi_sync_source, whose variables are renamed from those of rpl_semi_sync_master, is added in 8.0.26.
+func (f *serverFlavor) semiSyncWaitCountVariables() []string {
+	if f.atLeast(8, 0, 26) {
+		return []string{"rpl_semi_sync_master_wait_for_slave_count", "rpl_semi_sync_source_wait_for_replica_count"}
+	}
+	return []string{"rpl_semi_sync_master_wait_for_slave_count"}
+}
+
+// mocoPlugins returns the plugins required by MOCO.
+// The legacy semi-synchronous replication plugins are deprecated in 8.0.26, but they are used
+// unless `native` is true on 8.4 or later because MOCO uses the variables of the legacy ones,
+// and the donor and the recipient of CLONE must have the same plugins.
+func (f *serverFlavor) mocoPlugins(native bool) []Plugin {
+	if native && f.atLeast(8, 4) {
+		return slices.Clone(NativePlugins)
+	}
+	return slices.Clone(Plugins)
+}
+
+// cloneProblem returns the reason why `recipient` cannot be cloned from this server, or empty if it can.
+func (f *serverFlavor) cloneProblem(recipient *serverFlavor) string {
+	switch {
+	case f.name != recipient.name:
+		return fmt.Sprintf("flavors differ: donor=%s recipient=%s", f, recipient)
+	case f.series() != recipient.series():
+		return fmt.Sprintf("version series differ: donor=%s recipient=%s", f.raw, recipient.raw)
+	case !f.atLeast(8, 0, 37) || !recipient.atLeast(8, 0, 37):
+		// Cloning between different patch versions is supported since 8.0.37.
+		if f.version[2] != recipient.version[2] {
+			return fmt.Sprintf("versions differ: donor=%s recipient=%s", f.raw, recipient.raw)
+		}
+	}
+	return ""
+}
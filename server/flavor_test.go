@@ -0,0 +1,92 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("flavor", func() {
+	const (
+		mysqlComment   = "MySQL Community Server - GPL"
+		perconaComment = "Percona Server (GPL), Release 28, Revision 47601f19"
+	)
+
+	DescribeTable("should provide SQL for the server version",
+		func(version, comment, name, series, binlogStatus, reset, semiSync string) {
+			f, err := newServerFlavor(version, comment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.name).To(Equal(name))
+			Expect(f.series()).To(Equal(series))
+			Expect(f.showBinaryLogStatus()).To(Equal(binlogStatus))
+			Expect(f.resetBinaryLogs()).To(Equal(reset))
+			Expect(f.mocoPlugins(false)[0].name).To(Equal("rpl_semi_sync_master"))
+			Expect(f.mocoPlugins(true)[0].name).To(Equal(semiSync))
+			Expect(f.showReplicaStatus("")).To(Equal("SHOW REPLICA STATUS"))
+			Expect(f.showReplicaStatus("pitr")).To(Equal("SHOW REPLICA STATUS FOR CHANNEL 'pitr'"))
+		},
+		Entry("MySQL 8.0", "8.0.40", mysqlComment, flavorMySQL, "8.0", "SHOW MASTER STATUS", "RESET MASTER", "rpl_semi_sync_master"),
+		Entry("MySQL 8.0 with suffix", "8.0.28-log", mysqlComment, flavorMySQL, "8.0", "SHOW MASTER STATUS", "RESET MASTER", "rpl_semi_sync_master"),
+		Entry("MySQL 8.3 innovation", "8.3.0", mysqlComment, flavorMySQL, "8.3", "SHOW BINARY LOG STATUS", "RESET BINARY LOGS AND GTIDS", "rpl_semi_sync_master"),
+		Entry("MySQL 8.4 LTS", "8.4.3", mysqlComment, flavorMySQL, "8.4", "SHOW BINARY LOG STATUS", "RESET BINARY LOGS AND GTIDS", "rpl_semi_sync_source"),
+		Entry("MySQL 9.x innovation", "9.1.0", mysqlComment, flavorMySQL, "9.1", "SHOW BINARY LOG STATUS", "RESET BINARY LOGS AND GTIDS", "rpl_semi_sync_source"),
+		Entry("Percona Server 8.0", "8.0.36-28", perconaComment, flavorPercona, "8.0", "SHOW MASTER STATUS", "RESET MASTER", "rpl_semi_sync_master"),
+		Entry("Percona Server 8.4", "8.4.2-2", perconaComment, flavorPercona, "8.4", "SHOW BINARY LOG STATUS", "RESET BINARY LOGS AND GTIDS", "rpl_semi_sync_source"),
+	)
+
+	DescribeTable("should change the replication source",
+		func(version, semiSyncCount string, expected ...string) {
+			f, err := newServerFlavor(version, mysqlComment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.changeReplicationSource([]string{"SOURCE_HOST = ?", "GET_SOURCE_PUBLIC_KEY = 1"}, "")).To(Equal(expected[0]))
+			Expect(f.changeReplicationSource([]string{"SOURCE_HOST='pitr.invalid'", "RELAY_LOG_POS=4"}, "pitr")).To(Equal(expected[1]))
+			Expect(f.semiSyncWaitCountVariables()).To(ContainElement(semiSyncCount))
+		},
+		Entry("MySQL 8.0.22", "8.0.22", "rpl_semi_sync_master_wait_for_slave_count",
+			"CHANGE MASTER TO MASTER_HOST = ?, GET_MASTER_PUBLIC_KEY = 1",
+			"CHANGE MASTER TO MASTER_HOST='pitr.invalid', RELAY_LOG_POS=4 FOR CHANNEL 'pitr'"),
+		Entry("MySQL 8.0.23", "8.0.23", "rpl_semi_sync_master_wait_for_slave_count",
+			"CHANGE REPLICATION SOURCE TO SOURCE_HOST = ?, GET_SOURCE_PUBLIC_KEY = 1",
+			"CHANGE REPLICATION SOURCE TO SOURCE_HOST='pitr.invalid', RELAY_LOG_POS=4 FOR CHANNEL 'pitr'"),
+		Entry("MySQL 8.4 LTS", "8.4.3", "rpl_semi_sync_source_wait_for_replica_count",
+			"CHANGE REPLICATION SOURCE TO SOURCE_HOST = ?, GET_SOURCE_PUBLIC_KEY = 1",
+			"CHANGE REPLICATION SOURCE TO SOURCE_HOST='pitr.invalid', RELAY_LOG_POS=4 FOR CHANNEL 'pitr'"),
+	)
+
+	It("should not look up the renamed semi-sync variable before 8.0.26", func() {
+		f, err := newServerFlavor("8.0.25", mysqlComment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.semiSyncWaitCountVariables()).To(Equal([]string{"rpl_semi_sync_master_wait_for_slave_count"}))
+	})
+
+	DescribeTable("should reject unsupported versions",
+		func(version string) {
+			_, err := newServerFlavor(version, mysqlComment)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("MySQL 5.7", "5.7.44-log"),
+		Entry("MySQL 8.0 without SHOW REPLICA STATUS", "8.0.21"),
+		Entry("invalid", "invalid"),
+		Entry("no patch version", "8.4"),
+	)
+
+	DescribeTable("should check clone compatibility",
+		func(donor, donorComment, recipient, recipientComment, problem string) {
+			df, err := newServerFlavor(donor, donorComment)
+			Expect(err).NotTo(HaveOccurred())
+			rf, err := newServerFlavor(recipient, recipientComment)
+			Expect(err).NotTo(HaveOccurred())
+			if problem == "" {
+				Expect(df.cloneProblem(rf)).To(BeEmpty())
+			} else {
+				Expect(df.cloneProblem(rf)).To(HavePrefix(problem))
+			}
+		},
+		Entry("same version", "8.0.36", mysqlComment, "8.0.36", mysqlComment, ""),
+		Entry("patch versions before 8.0.37", "8.0.36", mysqlComment, "8.0.37", mysqlComment, "versions differ"),
+		Entry("patch versions since 8.0.37", "8.0.39", mysqlComment, "8.0.37", mysqlComment, ""),
+		Entry("patch versions of 8.4", "8.4.4", mysqlComment, "8.4.0", mysqlComment, ""),
+		Entry("different series", "8.4.4", mysqlComment, "8.0.40", mysqlComment, "version series differ"),
+		Entry("different innovation releases", "9.1.0", mysqlComment, "9.2.0", mysqlComment, "version series differ"),
+		Entry("different flavors", "8.0.36-28", perconaComment, "8.0.36", mysqlComment, "flavors differ"),
+	)
+})
@@ -2,12 +2,15 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
 	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/credential"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -20,6 +23,40 @@ type UserSetting struct {
 	proxyAdmin       bool
 	revokePrivileges map[string][]string
 	withGrantOption  bool
+
+	// host is the host part of the account.  Empty means '%'.
+	host string
+	// targetPrivileges is the privileges on databases or tables such as "app.*".
+	targetPrivileges map[string][]string
+
+	accountAttributes
+
+	// passwordFile is the file containing the password of a custom user.
+	passwordFile string
+}
+
+func (u UserSetting) accountHost() string {
+	if u.host == "" {
+		return "%"
+	}
+	return u.host
+}
+
+// account returns the quoted account name such as 'moco-agent'@'%'.
+func (u UserSetting) account() string {
+	return fmt.Sprintf("'%s'@'%s'", u.name, u.accountHost())
+}
+
+// createUserQuery returns the CREATE USER statement taking the user, host, and password as parameters.
+func (u UserSetting) createUserQuery() string {
+	q := `CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?`
+	if u.authPlugin != "" {
+		q = fmt.Sprintf(`CREATE USER IF NOT EXISTS ?@? IDENTIFIED WITH %s BY ?`, u.authPlugin)
+	}
+	if opts := u.accountAttributes.options(false); opts != "" {
+		q += " " + opts
+	}
+	return q
 }
 
 var Users = []UserSetting{
@@ -38,6 +75,8 @@ var Users = []UserSetting{
 			"CLONE_ADMIN",
 			"RELOAD",
 			"REPLICATION CLIENT",
+			"REPLICATION SLAVE",
+			"REPLICATION_SLAVE_ADMIN",
 			"SELECT",
 			"SERVICE_CONNECTION_ADMIN",
 			"SYSTEM_VARIABLES_ADMIN",
@@ -141,47 +180,33 @@ var Users = []UserSetting{
 	},
 }
 
-// Plugin represents a plugin for mysqld.
-type Plugin struct {
-	name   string
-	soName string
-}
-
-var Plugins = []Plugin{
-	{
-		name:   "rpl_semi_sync_master",
-		soName: "semisync_master.so",
-	},
-	{
-		name:   "rpl_semi_sync_slave",
-		soName: "semisync_slave.so",
-	},
-	{
-		name:   "clone",
-		soName: "mysql_clone.so",
-	},
+// userPasswordKeys maps MOCO users to the names of the environment variables and the files of their passwords.
+var userPasswordKeys = map[string]string{
+	mocoagent.AdminUser:       mocoagent.AdminPasswordEnvKey,
+	mocoagent.AgentUser:       mocoagent.AgentPasswordEnvKey,
+	mocoagent.ReplicationUser: mocoagent.ReplicationPasswordEnvKey,
+	mocoagent.CloneDonorUser:  mocoagent.CloneDonorPasswordEnvKey,
+	mocoagent.ExporterUser:    mocoagent.ExporterPasswordKey,
+	mocoagent.BackupUser:      mocoagent.BackupPasswordKey,
+	mocoagent.ReadOnlyUser:    mocoagent.ReadOnlyPasswordEnvKey,
+	mocoagent.WritableUser:    mocoagent.WritablePasswordEnvKey,
 }
 
-func ensureMOCOUsers(ctx context.Context, db *sqlx.DB, reset bool) error {
+// ensureMOCOUsers creates MOCO users with the passwords returned by `password`.
+func ensureMOCOUsers(ctx context.Context, db *sqlx.DB, password func(user string) string, reset bool) error {
 	_, err := db.ExecContext(ctx, "SET GLOBAL partial_revokes='ON'")
 	if err != nil {
 		return fmt.Errorf("failed to set global partial_revokes=ON: %w", err)
 	}
 
-	passwords := map[string]string{
-		mocoagent.AdminUser:       os.Getenv(mocoagent.AdminPasswordEnvKey),
-		mocoagent.AgentUser:       os.Getenv(mocoagent.AgentPasswordEnvKey),
-		mocoagent.ReplicationUser: os.Getenv(mocoagent.ReplicationPasswordEnvKey),
-		mocoagent.CloneDonorUser:  os.Getenv(mocoagent.CloneDonorPasswordEnvKey),
-		mocoagent.ExporterUser:    os.Getenv(mocoagent.ExporterPasswordKey),
-		mocoagent.BackupUser:      os.Getenv(mocoagent.BackupPasswordKey),
-		mocoagent.ReadOnlyUser:    os.Getenv(mocoagent.ReadOnlyPasswordEnvKey),
-		mocoagent.WritableUser:    os.Getenv(mocoagent.WritablePasswordEnvKey),
+	passwords := make(map[string]string)
+	for user := range userPasswordKeys {
+		passwords[user] = password(user)
 	}
 
 	for k, v := range passwords {
 		if v == "" {
-			return fmt.Errorf("no password for %s is given via envvar", k)
+			return fmt.Errorf("no password for %s is given", k)
 		}
 	}
 
@@ -195,6 +220,18 @@ func ensureMOCOUsers(ctx context.Context, db *sqlx.DB, reset bool) error {
 	return nil
 }
 
+// checkPartialRevokes returns an error if partial_revokes is OFF.  Revoking privileges on databases requires it.
+func checkPartialRevokes(ctx context.Context, db *sqlx.DB) error {
+	var on bool
+	if err := db.GetContext(ctx, &on, `SELECT @@partial_revokes`); err != nil {
+		return fmt.Errorf("failed to get partial_revokes: %w", err)
+	}
+	if !on {
+		return errors.New("partial_revokes is OFF; revokes on databases require partial_revokes=ON")
+	}
+	return nil
+}
+
 func dropLocalRootUser(ctx context.Context, db *sqlx.DB) error {
 	_, err := db.ExecContext(ctx, "DROP USER IF EXISTS 'root'@'localhost'")
 	if err != nil {
@@ -208,15 +245,16 @@ func dropLocalRootUser(ctx context.Context, db *sqlx.DB) error {
 }
 
 func ensureMySQLUser(ctx context.Context, db *sqlx.DB, user UserSetting, pwd string, reset bool) error {
+	host := user.accountHost()
 	var count int
-	err := db.GetContext(ctx, &count, `SELECT COUNT(*) FROM mysql.user WHERE user=? and host='%'`, user.name)
+	err := db.GetContext(ctx, &count, `SELECT COUNT(*) FROM mysql.user WHERE user=? and host=?`, user.name, host)
 	if err != nil {
 		return fmt.Errorf("failed to select from mysql.user: %w", err)
 	}
 	if count == 1 {
 		// The user already exists
 		if reset {
-			_, err := db.ExecContext(ctx, `ALTER USER ?@'%' IDENTIFIED BY ?`, user.name, pwd)
+			_, err := db.ExecContext(ctx, `ALTER USER ?@? IDENTIFIED BY ?`, user.name, host, pwd)
 			if err != nil {
 				return fmt.Errorf("failed to reset password for %s: %w", user.name, err)
 			}
@@ -224,85 +262,77 @@ func ensureMySQLUser(ctx context.Context, db *sqlx.DB, user UserSetting, pwd str
 		return nil
 	}
 
-	queryStr := `CREATE USER IF NOT EXISTS ?@'%' IDENTIFIED BY ?`
-	_, err = db.ExecContext(ctx, queryStr, user.name, pwd)
-	if err != nil {
-		return fmt.Errorf("failed to create user %s: %w", user.name, err)
+	// Check partial_revokes in advance not to leave the user created halfway.
+	if len(user.revokePrivileges) > 0 {
+		if err := checkPartialRevokes(ctx, db); err != nil {
+			return err
+		}
 	}
 
-	queryStr = fmt.Sprintf(`GRANT %s ON *.* TO ?@'%%'`, strings.Join(user.privileges, ","))
-	if user.withGrantOption {
-		queryStr = queryStr + " WITH GRANT OPTION"
-	}
-	_, err = db.ExecContext(ctx, queryStr, user.name)
+	_, err = db.ExecContext(ctx, user.createUserQuery(), user.name, host, pwd)
 	if err != nil {
-		return fmt.Errorf("failed to grant to %s: %w", user.name, err)
+		return fmt.Errorf("failed to create user %s: %w", user.name, err)
 	}
 
-	if user.proxyAdmin {
-		queryStr = `GRANT PROXY ON ''@'' TO ?@'%' WITH GRANT OPTION`
-		_, err = db.ExecContext(ctx, queryStr, user.name)
+	if len(user.privileges) > 0 {
+		queryStr := fmt.Sprintf(`GRANT %s ON *.* TO ?@?`, strings.Join(user.privileges, ","))
+		if user.withGrantOption {
+			queryStr = queryStr + " WITH GRANT OPTION"
+		}
+		_, err = db.ExecContext(ctx, queryStr, user.name, host)
 		if err != nil {
 			return fmt.Errorf("failed to grant to %s: %w", user.name, err)
 		}
 	}
 
-	for target, privileges := range user.revokePrivileges {
-		queryStr = fmt.Sprintf(`REVOKE %s ON %s FROM ?@'%%'`, strings.Join(privileges, ","), target)
-
-		_, err = db.ExecContext(ctx, queryStr, user.name)
+	for _, target := range slices.Sorted(maps.Keys(user.targetPrivileges)) {
+		queryStr := fmt.Sprintf(`GRANT %s ON %s TO ?@?`, strings.Join(user.targetPrivileges[target], ","), quoteTarget(target))
+		_, err = db.ExecContext(ctx, queryStr, user.name, host)
 		if err != nil {
-			return fmt.Errorf("failed to revoke from %s: %w", user.name, err)
+			return fmt.Errorf("failed to grant to %s: %w", user.name, err)
 		}
 	}
 
-	return nil
-}
-
-func ensureMOCOPlugins(ctx context.Context, db *sqlx.DB) error {
-	for _, p := range Plugins {
-		err := ensurePlugin(ctx, db, p)
+	if user.proxyAdmin {
+		queryStr := `GRANT PROXY ON ''@'' TO ?@? WITH GRANT OPTION`
+		_, err = db.ExecContext(ctx, queryStr, user.name, host)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to grant to %s: %w", user.name, err)
 		}
 	}
 
-	return nil
-}
-
-func ensurePlugin(ctx context.Context, db *sqlx.DB, plugin Plugin) error {
-	var installed bool
-	err := db.GetContext(ctx, &installed, "SELECT COUNT(*) FROM information_schema.plugins WHERE PLUGIN_NAME=? and PLUGIN_STATUS='ACTIVE'", plugin.name)
-	if err != nil {
-		return fmt.Errorf("failed to select from information_schema.plugins: %w", err)
-	}
+	for target, privileges := range user.revokePrivileges {
+		queryStr := fmt.Sprintf(`REVOKE %s ON %s FROM ?@?`, strings.Join(privileges, ","), quoteTarget(target))
 
-	if !installed {
-		queryStr := fmt.Sprintf(`INSTALL PLUGIN %s SONAME ?`, plugin.name)
-		_, err = db.ExecContext(ctx, queryStr, plugin.soName)
+		_, err = db.ExecContext(ctx, queryStr, user.name, host)
 		if err != nil {
-			return fmt.Errorf("failed to install plugin %s: %w", plugin.name, err)
+			return fmt.Errorf("failed to revoke from %s: %w", user.name, err)
 		}
 	}
 
 	return nil
 }
 
-func Init(ctx context.Context, db *sqlx.DB, socket string) error {
+// Init initializes MOCO users and plugins on a fresh instance.  `plugins` may be nil.
+// The passwords of MOCO users are given by `credentials`.
+func Init(ctx context.Context, db *sqlx.DB, socket string, plugins *PluginConfig, credentials credential.Provider) error {
 	if _, err := db.ExecContext(ctx, "SET GLOBAL read_only=OFF"); err != nil {
 		return fmt.Errorf("failed to disable read_only: %w", err)
 	}
-	if err := ensureMOCOUsers(ctx, db, false); err != nil {
+	password := func(user string) string {
+		return credentials.Password(userPasswordKeys[user])
+	}
+	if err := ensureMOCOUsers(ctx, db, password, false); err != nil {
 		return err
 	}
-	if err := ensureMOCOPlugins(ctx, db); err != nil {
+	if err := ensureMOCOPlugins(ctx, db, plugins); err != nil {
 		return err
 	}
 
 	st := time.Now()
 	for {
 		var err error
-		db, err = GetMySQLConnLocalSocket(mocoagent.AdminUser, os.Getenv(mocoagent.AdminPasswordEnvKey), socket)
+		db, err = GetMySQLConnLocalSocket(mocoagent.AdminUser, credentials.Password(mocoagent.AdminPasswordEnvKey), socket)
 		if err == nil {
 			break
 		}
@@ -318,20 +348,12 @@ func Init(ctx context.Context, db *sqlx.DB, socket string) error {
 		return err
 	}
 
-	var version string
-	err := db.GetContext(ctx, &version, `SELECT SUBSTRING_INDEX(VERSION(), '.', 2)`)
+	flavor, err := detectFlavor(ctx, db)
 	if err != nil {
-		return fmt.Errorf("failed to get version: %w", err)
+		return err
 	}
-	if version == "8.4" {
-		if _, err := db.ExecContext(ctx, "RESET BINARY LOGS AND GTIDS"); err != nil {
-			return fmt.Errorf("failed to reset binary logs and gtids: %w", err)
-		}
-
-	} else {
-		if _, err := db.ExecContext(ctx, "RESET MASTER"); err != nil {
-			return fmt.Errorf("failed to reset master: %w", err)
-		}
+	if _, err := db.ExecContext(ctx, flavor.resetBinaryLogs()); err != nil {
+		return fmt.Errorf("failed to reset binary logs and gtids: %w", err)
 	}
 	if _, err := db.ExecContext(ctx, "SET GLOBAL super_read_only=ON"); err != nil {
 		return fmt.Errorf("failed to enable super_read_only: %w", err)
@@ -339,17 +361,19 @@ func Init(ctx context.Context, db *sqlx.DB, socket string) error {
 	return nil
 }
 
-func InitExternal(ctx context.Context, db *sqlx.DB) error {
+// InitExternal initializes MOCO users and plugins on an instance cloned from an external mysqld.
+// The passwords of MOCO users are reset to the ones returned by `password`.
+func InitExternal(ctx context.Context, db *sqlx.DB, plugins *PluginConfig, password func(user string) string) error {
 	if _, err := db.ExecContext(ctx, "SET sql_log_bin=OFF"); err != nil {
 		return fmt.Errorf("failed to disable binary logging: %w", err)
 	}
 	if _, err := db.ExecContext(ctx, "SET GLOBAL read_only=OFF"); err != nil {
 		return fmt.Errorf("failed to disable read_only: %w", err)
 	}
-	if err := ensureMOCOUsers(ctx, db, true); err != nil {
+	if err := ensureMOCOUsers(ctx, db, password, true); err != nil {
 		return err
 	}
-	if err := ensureMOCOPlugins(ctx, db); err != nil {
+	if err := ensureMOCOPlugins(ctx, db, plugins); err != nil {
 		return err
 	}
 	if _, err := db.ExecContext(ctx, "SET GLOBAL super_read_only=ON"); err != nil {
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"path/filepath"
 
 	mocoagent "github.com/cybozu-go/moco-agent"
@@ -59,7 +60,9 @@ var _ = Describe("initialize", func() {
 		Expect(executedGTIDSet).To(BeEmpty())
 
 		By("checking active plugins in information_schema")
-		for _, p := range Plugins {
+		flavor, err := detectFlavor(context.Background(), db)
+		Expect(err).NotTo(HaveOccurred())
+		for _, p := range (&PluginConfig{}).desiredPlugins(flavor) {
 			var installed bool
 			err := db.Get(&installed, "SELECT COUNT(*) FROM information_schema.plugins WHERE PLUGIN_NAME=? and PLUGIN_STATUS='ACTIVE'", p.name)
 			Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,694 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/go-logr/logr"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	backupFormatSQL = "sql"
+	backupFormatCSV = "csv"
+
+	// backupChunkSize is the maximum size of a chunk in LogicalBackupResponse.
+	backupChunkSize = 1 << 20
+
+	// backupMaxStatementSize is the approximate maximum size of an INSERT statement.
+	backupMaxStatementSize = 1 << 20
+)
+
+var systemSchemas = []string{"mysql", "sys", "information_schema", "performance_schema"}
+
+// backupTable is a table or a view to be dumped.
+type backupTable struct {
+	Schema string `db:"TABLE_SCHEMA"`
+	Name   string `db:"TABLE_NAME"`
+	Type   string `db:"TABLE_TYPE"`
+}
+
+// backupObject is a stored routine, a trigger, or an event to be dumped.
+type backupObject struct {
+	Schema string `db:"SCHEMA_NAME"`
+	Name   string `db:"OBJECT_NAME"`
+	Type   string `db:"OBJECT_TYPE"`
+}
+
+// backupColumn is a column of a table to be dumped.
+type backupColumn struct {
+	Name     string `db:"COLUMN_NAME"`
+	DataType string `db:"DATA_TYPE"`
+}
+
+func (s agentService) LogicalBackup(req *proto.LogicalBackupRequest, stream proto.Agent_LogicalBackupServer) error {
+	return s.agent.LogicalBackup(stream.Context(), req, stream.Send)
+}
+
+// LogicalBackup dumps schemas and tables from a consistent snapshot and passes the chunks to `send`.
+func (a *Agent) LogicalBackup(ctx context.Context, req *proto.LogicalBackupRequest, send func(*proto.LogicalBackupResponse) error) error {
+	format := req.Format
+	if format == "" {
+		format = backupFormatSQL
+	}
+	if format != backupFormatSQL && format != backupFormatCSV {
+		return status.Errorf(codes.InvalidArgument, "unknown format: %s", req.Format)
+	}
+	parallel := max(int(req.Parallel), 1)
+
+	select {
+	case a.cloneLock <- struct{}{}:
+	default:
+		return status.Error(codes.ResourceExhausted, "another request is undergoing")
+	}
+	defer func() { <-a.cloneLock }()
+
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	startTime := time.Now()
+	metrics.LogicalBackupCount.Inc()
+	metrics.LogicalBackupInProgress.Set(1)
+	defer metrics.LogicalBackupInProgress.Set(0)
+
+	if err := a.logicalBackup(ctx, req, format, parallel, send, logger); err != nil {
+		metrics.LogicalBackupFailureCount.Inc()
+		logger.Error(err, "failed to take a logical backup")
+		return err
+	}
+
+	metrics.LogicalBackupDurationSeconds.Observe(time.Since(startTime).Seconds())
+	logger.Info("logical backup finished", "duration", time.Since(startTime).Seconds())
+	return nil
+}
+
+func (a *Agent) logicalBackup(ctx context.Context, req *proto.LogicalBackupRequest, format string, parallel int, send func(*proto.LogicalBackupResponse) error, logger logr.Logger) error {
+	// Queries for a dump may take a long time, so the connection should not set timeout values.
+	db, err := GetMySQLConnLocalSocket(mocoagent.BackupUser, a.userPassword(mocoagent.BackupUser), a.mysqlSocketPath)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to connect to mysqld through %s: %+v", a.mysqlSocketPath, err)
+	}
+	defer db.Close()
+
+	lockConn, err := db.Connx(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to connect to mysqld: %+v", err)
+	}
+	defer lockConn.Close()
+
+	if _, err := lockConn.ExecContext(ctx, `LOCK INSTANCE FOR BACKUP`); err != nil {
+		return status.Errorf(codes.Internal, "failed to lock instance for backup: %+v", err)
+	}
+	defer func() {
+		if _, err := lockConn.ExecContext(context.Background(), `UNLOCK INSTANCE`); err != nil {
+			logger.Error(err, "failed to unlock instance")
+		}
+	}()
+
+	conns, primaryStatus, err := a.openSnapshots(ctx, db, lockConn, parallel)
+	for _, conn := range conns {
+		defer conn.Close()
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+	logger.Info("opened a consistent snapshot", "gtid", primaryStatus.ExecutedGtidSet, "parallel", parallel)
+
+	pos, _ := strconv.ParseInt(primaryStatus.Position, 10, 64)
+	err = send(&proto.LogicalBackupResponse{
+		GtidSet:        primaryStatus.ExecutedGtidSet,
+		BinlogFile:     primaryStatus.File,
+		BinlogPosition: pos,
+	})
+	if err != nil {
+		return err
+	}
+
+	schemas, err := listBackupSchemas(ctx, conns[0], req.IncludeSchemas, req.ExcludeSchemas)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+	tables, views, err := listBackupTables(ctx, conns[0], schemas)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+
+	var mu sync.Mutex
+	sendChunk := func(resp *proto.LogicalBackupResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return send(resp)
+	}
+
+	// Stored functions may be used by views and triggers, so they are dumped before them.
+	for _, schema := range schemas {
+		if err := dumpSchema(ctx, conns[0], schema, sendChunk); err != nil {
+			return status.Errorf(codes.Internal, "failed to dump schema %s: %+v", schema, err)
+		}
+		if err := dumpObjects(ctx, conns[0], schema, "routines", `SELECT ROUTINE_SCHEMA AS SCHEMA_NAME, ROUTINE_NAME AS OBJECT_NAME, ROUTINE_TYPE AS OBJECT_TYPE
+FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? ORDER BY ROUTINE_TYPE, ROUTINE_NAME`, sendChunk); err != nil {
+			return status.Errorf(codes.Internal, "failed to dump routines of %s: %+v", schema, err)
+		}
+	}
+
+	if err := dumpTables(ctx, conns, tables, format, sendChunk); err != nil {
+		return err
+	}
+
+	// A view may refer to other views, so views are dumped after all tables in the order of dependency.
+	views, err = sortViews(ctx, conns[0], views)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+	for _, v := range views {
+		if err := dumpTable(ctx, conns[0], v, format, sendChunk); err != nil {
+			return status.Errorf(codes.Internal, "failed to dump %s.%s: %+v", v.Schema, v.Name, err)
+		}
+	}
+
+	// Triggers are dumped after the data so that they are not fired while restoring the data.
+	for _, schema := range schemas {
+		if err := dumpObjects(ctx, conns[0], schema, "triggers", `SELECT TRIGGER_SCHEMA AS SCHEMA_NAME, TRIGGER_NAME AS OBJECT_NAME, 'TRIGGER' AS OBJECT_TYPE
+FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ? ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER`, sendChunk); err != nil {
+			return status.Errorf(codes.Internal, "failed to dump triggers of %s: %+v", schema, err)
+		}
+		if err := dumpObjects(ctx, conns[0], schema, "events", `SELECT EVENT_SCHEMA AS SCHEMA_NAME, EVENT_NAME AS OBJECT_NAME, 'EVENT' AS OBJECT_TYPE
+FROM information_schema.EVENTS WHERE EVENT_SCHEMA = ? ORDER BY EVENT_NAME`, sendChunk); err != nil {
+			return status.Errorf(codes.Internal, "failed to dump events of %s: %+v", schema, err)
+		}
+	}
+	return nil
+}
+
+// dumpTables dumps `tables` in parallel using `conns`.
+func dumpTables(ctx context.Context, conns []*sqlx.Conn, tables []backupTable, format string, send func(*proto.LogicalBackupResponse) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan backupTable)
+	errCh := make(chan error, len(conns))
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				if err := dumpTable(ctx, conn, t, format, send); err != nil {
+					errCh <- fmt.Errorf("failed to dump %s.%s: %w", t.Schema, t.Name, err)
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+OUTER:
+	for _, t := range tables {
+		select {
+		case queue <- t:
+		case <-ctx.Done():
+			break OUTER
+		}
+	}
+	close(queue)
+	wg.Wait()
+	close(errCh)
+
+	if err := <-errCh; err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+// openSnapshots opens `n` sessions sharing the same consistent snapshot.
+// Commits are blocked while the snapshots are opened so that the returned status matches them.
+func (a *Agent) openSnapshots(ctx context.Context, db *sqlx.DB, lockConn *sqlx.Conn, n int) ([]*sqlx.Conn, *MySQLPrimaryStatus, error) {
+	if _, err := lockConn.ExecContext(ctx, `FLUSH TABLES WITH READ LOCK`); err != nil {
+		return nil, nil, fmt.Errorf("failed to flush tables with read lock: %w", err)
+	}
+	defer lockConn.ExecContext(context.Background(), `UNLOCK TABLES`)
+
+	var conns []*sqlx.Conn
+	for i := 0; i < n; i++ {
+		conn, err := db.Connx(ctx)
+		if err != nil {
+			return conns, nil, fmt.Errorf("failed to connect to mysqld: %w", err)
+		}
+		conns = append(conns, conn)
+
+		if _, err := conn.ExecContext(ctx, `SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ`); err != nil {
+			return conns, nil, fmt.Errorf("failed to set isolation level: %w", err)
+		}
+		if _, err := conn.ExecContext(ctx, `START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY`); err != nil {
+			return conns, nil, fmt.Errorf("failed to start transaction: %w", err)
+		}
+	}
+
+	primaryStatus, err := a.GetMySQLPrimaryStatus(ctx)
+	if err != nil {
+		return conns, nil, err
+	}
+	return conns, primaryStatus, nil
+}
+
+func listBackupSchemas(ctx context.Context, conn *sqlx.Conn, include, exclude []string) ([]string, error) {
+	var schemas []string
+	if err := conn.SelectContext(ctx, &schemas, `SELECT SCHEMA_NAME FROM information_schema.SCHEMATA ORDER BY SCHEMA_NAME`); err != nil {
+		return nil, fmt.Errorf("failed to list schemas: %w", err)
+	}
+
+	return slices.DeleteFunc(schemas, func(schema string) bool {
+		if slices.Contains(systemSchemas, schema) || slices.Contains(exclude, schema) {
+			return true
+		}
+		return len(include) > 0 && !slices.Contains(include, schema)
+	}), nil
+}
+
+// listBackupTables returns the base tables and the views in `schemas`.
+func listBackupTables(ctx context.Context, conn *sqlx.Conn, schemas []string) (tables, views []backupTable, err error) {
+	var all []backupTable
+	err = conn.SelectContext(ctx, &all, `SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_TYPE FROM information_schema.TABLES
+WHERE TABLE_TYPE IN ('BASE TABLE', 'VIEW') ORDER BY TABLE_SCHEMA, TABLE_NAME`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for _, t := range all {
+		switch {
+		case !slices.Contains(schemas, t.Schema):
+		case t.Type == "VIEW":
+			views = append(views, t)
+		default:
+			tables = append(tables, t)
+		}
+	}
+	return tables, views, nil
+}
+
+// sortViews sorts `views` so that every view comes after the views it refers to.
+func sortViews(ctx context.Context, conn *sqlx.Conn, views []backupTable) ([]backupTable, error) {
+	var usages []struct {
+		ViewSchema  string `db:"VIEW_SCHEMA"`
+		ViewName    string `db:"VIEW_NAME"`
+		TableSchema string `db:"TABLE_SCHEMA"`
+		TableName   string `db:"TABLE_NAME"`
+	}
+	err := conn.SelectContext(ctx, &usages, `SELECT VIEW_SCHEMA, VIEW_NAME, TABLE_SCHEMA, TABLE_NAME FROM information_schema.VIEW_TABLE_USAGE
+ORDER BY VIEW_SCHEMA, VIEW_NAME, TABLE_SCHEMA, TABLE_NAME`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list view dependencies: %w", err)
+	}
+
+	key := func(schema, name string) string {
+		return schema + "." + name
+	}
+	deps := make(map[string][]string)
+	for _, u := range usages {
+		k := key(u.ViewSchema, u.ViewName)
+		deps[k] = append(deps[k], key(u.TableSchema, u.TableName))
+	}
+	byKey := make(map[string]backupTable)
+	for _, v := range views {
+		byKey[key(v.Schema, v.Name)] = v
+	}
+
+	sorted := make([]backupTable, 0, len(views))
+	visited := make(map[string]bool)
+	var visit func(k string)
+	visit = func(k string) {
+		v, ok := byKey[k]
+		if !ok || visited[k] {
+			return
+		}
+		visited[k] = true
+		for _, dep := range deps[k] {
+			visit(dep)
+		}
+		sorted = append(sorted, v)
+	}
+	for _, v := range views {
+		visit(key(v.Schema, v.Name))
+	}
+	return sorted, nil
+}
+
+func dumpSchema(ctx context.Context, conn *sqlx.Conn, schema string, send func(*proto.LogicalBackupResponse) error) error {
+	stmt, err := showCreate(ctx, conn, "SHOW CREATE DATABASE "+quoteIdentifier(schema))
+	if err != nil {
+		return err
+	}
+	w := newBackupFileWriter(schema+".schema.sql.gz", send)
+	fmt.Fprintf(w, "%s;\n", stmt)
+	return w.Close()
+}
+
+// dumpObjects dumps the stored routines, the triggers, or the events listed by `query` into `<schema>.<kind>.sql.gz`.
+// The file is not created if there is no object.
+//
+// As mysqldump does, the statements are delimited by `;;` since the bodies may contain `;`, and each of them
+// is preceded by the sql_mode and the time zone of the object.
+func dumpObjects(ctx context.Context, conn *sqlx.Conn, schema, kind, query string, send func(*proto.LogicalBackupResponse) error) error {
+	var objects []backupObject
+	if err := conn.SelectContext(ctx, &objects, query, schema); err != nil {
+		return fmt.Errorf("failed to list %s: %w", kind, err)
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+
+	w := newBackupFileWriter(schema+"."+kind+".sql.gz", send)
+	fmt.Fprintf(w, "USE %s;\nDELIMITER ;;\n", quoteIdentifier(schema))
+	for _, o := range objects {
+		def, err := showCreateObject(ctx, conn, o)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "SET SESSION sql_mode = '%s';;\n", def["sql_mode"])
+		if tz, ok := def["time_zone"]; ok {
+			fmt.Fprintf(w, "SET SESSION time_zone = '%s';;\n", tz)
+		}
+		fmt.Fprintf(w, "%s;;\n", def["statement"])
+	}
+	fmt.Fprint(w, "DELIMITER ;\n")
+	return w.Close()
+}
+
+// showCreateObject returns the statement, the sql_mode, and the time zone if any, in SHOW CREATE of `o`.
+func showCreateObject(ctx context.Context, conn *sqlx.Conn, o backupObject) (map[string]string, error) {
+	var column string
+	switch o.Type {
+	case "FUNCTION":
+		column = "Create Function"
+	case "PROCEDURE":
+		column = "Create Procedure"
+	case "TRIGGER":
+		column = "SQL Original Statement"
+	case "EVENT":
+		column = "Create Event"
+	default:
+		return nil, fmt.Errorf("unknown object type %s of %s.%s", o.Type, o.Schema, o.Name)
+	}
+
+	query := fmt.Sprintf("SHOW CREATE %s %s.%s", o.Type, quoteIdentifier(o.Schema), quoteIdentifier(o.Name))
+	row := make(map[string]any)
+	if err := conn.QueryRowxContext(ctx, query).MapScan(row); err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", query, err)
+	}
+
+	def := make(map[string]string)
+	for name, col := range map[string]string{"statement": column, "sql_mode": "sql_mode", "time_zone": "time_zone"} {
+		switch v := row[col].(type) {
+		case []byte:
+			def[name] = string(v)
+		case string:
+			def[name] = v
+		}
+	}
+	// The statement is NULL if the user is not allowed to read the definition.
+	if def["statement"] == "" {
+		return nil, fmt.Errorf("no definition of %s %s.%s is readable", strings.ToLower(o.Type), o.Schema, o.Name)
+	}
+	return def, nil
+}
+
+func dumpTable(ctx context.Context, conn *sqlx.Conn, t backupTable, format string, send func(*proto.LogicalBackupResponse) error) error {
+	name := quoteIdentifier(t.Schema) + "." + quoteIdentifier(t.Name)
+	stmt, err := showCreate(ctx, conn, "SHOW CREATE TABLE "+name)
+	if err != nil {
+		return err
+	}
+	w := newBackupFileWriter(path.Join(t.Schema, t.Name+".schema.sql.gz"), send)
+	fmt.Fprintf(w, "%s;\n", stmt)
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if t.Type != "BASE TABLE" {
+		return nil
+	}
+
+	var columns []backupColumn
+	err = conn.SelectContext(ctx, &columns, `SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA NOT LIKE '%GENERATED%' ORDER BY ORDINAL_POSITION`, t.Schema, t.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list columns: %w", err)
+	}
+	colNames := make([]string, len(columns))
+	for i, c := range columns {
+		colNames[i] = quoteIdentifier(c.Name)
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", strings.Join(colNames, ","), name))
+	if err != nil {
+		return fmt.Errorf("failed to select: %w", err)
+	}
+	defer rows.Close()
+
+	w = newBackupFileWriter(path.Join(t.Schema, t.Name+"."+format+".gz"), send)
+	var dumper rowDumper
+	if format == backupFormatCSV {
+		dumper = newCSVDumper(w, columns)
+	} else {
+		dumper = newSQLDumper(w, name, colNames, columns)
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := dumper.Row(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := dumper.Flush(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// showCreate returns the statement in the second column of SHOW CREATE.
+func showCreate(ctx context.Context, conn *sqlx.Conn, query string) (string, error) {
+	row := conn.QueryRowxContext(ctx, query)
+	cols, err := row.SliceScan()
+	if err != nil {
+		return "", fmt.Errorf("failed to %s: %w", query, err)
+	}
+	if len(cols) < 2 {
+		return "", fmt.Errorf("unexpected result of %s", query)
+	}
+	switch v := cols[1].(type) {
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("unexpected result of %s", query)
+}
+
+func quoteIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// rowDumper writes rows of a table.
+type rowDumper interface {
+	Row(values []sql.RawBytes) error
+	Flush() error
+}
+
+type sqlDumper struct {
+	w       io.Writer
+	prefix  string
+	types   []string
+	buf     bytes.Buffer
+	pending bool
+}
+
+func newSQLDumper(w io.Writer, table string, colNames []string, columns []backupColumn) *sqlDumper {
+	d := &sqlDumper{
+		w:      w,
+		prefix: fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", table, strings.Join(colNames, ",")),
+	}
+	for _, c := range columns {
+		d.types = append(d.types, strings.ToLower(c.DataType))
+	}
+	return d
+}
+
+func (d *sqlDumper) Row(values []sql.RawBytes) error {
+	if d.pending {
+		d.buf.WriteString(",\n")
+	} else {
+		d.buf.WriteString(d.prefix)
+		d.pending = true
+	}
+
+	d.buf.WriteByte('(')
+	for i, v := range values {
+		if i > 0 {
+			d.buf.WriteByte(',')
+		}
+		writeSQLValue(&d.buf, d.types[i], v)
+	}
+	d.buf.WriteByte(')')
+
+	if d.buf.Len() >= backupMaxStatementSize {
+		return d.Flush()
+	}
+	return nil
+}
+
+func (d *sqlDumper) Flush() error {
+	if !d.pending {
+		return nil
+	}
+	d.buf.WriteString(";\n")
+	_, err := d.w.Write(d.buf.Bytes())
+	d.buf.Reset()
+	d.pending = false
+	return err
+}
+
+func writeSQLValue(buf *bytes.Buffer, dataType string, v sql.RawBytes) {
+	if v == nil {
+		buf.WriteString("NULL")
+		return
+	}
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double", "year":
+		buf.Write(v)
+	case "bit", "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "geometry",
+		"point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection":
+		if len(v) == 0 {
+			buf.WriteString("''")
+			return
+		}
+		buf.WriteString("0x")
+		buf.WriteString(hex.EncodeToString(v))
+	default:
+		buf.WriteByte('\'')
+		for _, c := range v {
+			switch c {
+			case 0:
+				buf.WriteString(`\0`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\x1a':
+				buf.WriteString(`\Z`)
+			case '\'', '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		buf.WriteByte('\'')
+	}
+}
+
+// csvDumper writes rows in CSV with a header line.  NULL is written as `\N`.
+type csvDumper struct {
+	w      *csv.Writer
+	header []string
+	record []string
+}
+
+func newCSVDumper(w io.Writer, columns []backupColumn) *csvDumper {
+	d := &csvDumper{w: csv.NewWriter(w)}
+	for _, c := range columns {
+		d.header = append(d.header, c.Name)
+	}
+	d.record = make([]string, len(columns))
+	return d
+}
+
+func (d *csvDumper) Row(values []sql.RawBytes) error {
+	if d.header != nil {
+		if err := d.w.Write(d.header); err != nil {
+			return err
+		}
+		d.header = nil
+	}
+	for i, v := range values {
+		if v == nil {
+			d.record[i] = `\N`
+		} else {
+			d.record[i] = string(v)
+		}
+	}
+	return d.w.Write(d.record)
+}
+
+func (d *csvDumper) Flush() error {
+	if d.header != nil {
+		if err := d.w.Write(d.header); err != nil {
+			return err
+		}
+	}
+	d.w.Flush()
+	return d.w.Error()
+}
+
+// backupFileWriter compresses a file with gzip and sends it in chunks.
+type backupFileWriter struct {
+	name string
+	send func(*proto.LogicalBackupResponse) error
+	buf  bytes.Buffer
+	zw   *gzip.Writer
+}
+
+func newBackupFileWriter(name string, send func(*proto.LogicalBackupResponse) error) *backupFileWriter {
+	w := &backupFileWriter{name: name, send: send}
+	w.zw = gzip.NewWriter(&w.buf)
+	return w
+}
+
+func (w *backupFileWriter) Write(p []byte) (int, error) {
+	n, err := w.zw.Write(p)
+	if err != nil {
+		return n, err
+	}
+	for w.buf.Len() >= backupChunkSize {
+		chunk := bytes.Clone(w.buf.Next(backupChunkSize))
+		if err := w.send(&proto.LogicalBackupResponse{File: w.name, Data: chunk}); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *backupFileWriter) Close() error {
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	return w.send(&proto.LogicalBackupResponse{File: w.name, Data: bytes.Clone(w.buf.Bytes()), Eof: true})
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"slices"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("logical backup", func() {
+	It("should dump schemas and tables from a consistent snapshot", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, adminUserPassword, sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		_, err = db.Exec(`SET GLOBAL super_read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`SET GLOBAL read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE DATABASE foo`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE TABLE foo.bar (i INT PRIMARY KEY, s VARCHAR(20), b VARBINARY(8)) ENGINE=InnoDB`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`INSERT INTO foo.bar VALUES (1, 'it''s', 0x0102), (2, NULL, NULL)`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE FUNCTION foo.twice(n INT) RETURNS INT DETERMINISTIC RETURN n * 2`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE PROCEDURE foo.clear() BEGIN DELETE FROM foo.bar; END`)
+		Expect(err).NotTo(HaveOccurred())
+		// v2 is named before v, but it must be dumped after v.
+		_, err = db.Exec(`CREATE VIEW foo.v AS SELECT foo.twice(i) AS i FROM foo.bar`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE VIEW foo.a_v2 AS SELECT i FROM foo.v`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE TRIGGER foo.bar_insert BEFORE INSERT ON foo.bar FOR EACH ROW BEGIN SET NEW.s = UPPER(NEW.s); END`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE EVENT foo.cleanup ON SCHEDULE EVERY 1 DAY DISABLE DO DELETE FROM foo.bar`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE DATABASE ignored`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`CREATE TABLE ignored.t (i INT PRIMARY KEY) ENGINE=InnoDB`)
+		Expect(err).NotTo(HaveOccurred())
+
+		var responses []*proto.LogicalBackupResponse
+		send := func(resp *proto.LogicalBackupResponse) error {
+			responses = append(responses, resp)
+			return nil
+		}
+
+		By("passing an unknown format")
+		err = agent.LogicalBackup(context.Background(), &proto.LogicalBackupRequest{Format: "xml"}, send)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		By("taking a backup in SQL")
+		err = agent.LogicalBackup(context.Background(), &proto.LogicalBackupRequest{
+			ExcludeSchemas: []string{"ignored"},
+			Parallel:       2,
+		}, send)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(responses[0].GtidSet).NotTo(BeEmpty())
+		Expect(responses[0].BinlogFile).NotTo(BeEmpty())
+
+		files := collectBackupFiles(responses[1:])
+		Expect(files).To(HaveLen(8))
+		Expect(files).To(HaveKeyWithValue("foo.schema.sql.gz", ContainSubstring("CREATE DATABASE `foo`")))
+		Expect(files).To(HaveKeyWithValue("foo.routines.sql.gz", And(
+			HavePrefix("USE `foo`;\nDELIMITER ;;\n"),
+			ContainSubstring("FUNCTION `twice`"),
+			ContainSubstring("PROCEDURE `clear`() BEGIN DELETE FROM foo.bar; END;;\n"),
+			HaveSuffix("DELIMITER ;\n"),
+		)))
+		Expect(files).To(HaveKeyWithValue("foo/bar.schema.sql.gz", ContainSubstring("CREATE TABLE `bar`")))
+		Expect(files).To(HaveKeyWithValue("foo/v.schema.sql.gz", ContainSubstring("VIEW `v`")))
+		Expect(files).To(HaveKeyWithValue("foo/a_v2.schema.sql.gz", ContainSubstring("VIEW `a_v2`")))
+		Expect(files).To(HaveKeyWithValue("foo/bar.sql.gz", Equal("INSERT INTO `foo`.`bar` (`i`,`s`,`b`) VALUES\n(1,'it\\'s',0x0102),\n(2,NULL,NULL);\n")))
+		Expect(files).To(HaveKeyWithValue("foo.triggers.sql.gz", ContainSubstring("TRIGGER `bar_insert`")))
+		Expect(files).To(HaveKeyWithValue("foo.events.sql.gz", And(ContainSubstring("EVENT `cleanup`"), ContainSubstring("SET SESSION time_zone"))))
+		Expect(backupFileOrder(responses[1:])).To(Equal([]string{
+			"foo.schema.sql.gz",
+			"foo.routines.sql.gz",
+			"foo/bar.schema.sql.gz",
+			"foo/bar.sql.gz",
+			"foo/v.schema.sql.gz",
+			"foo/a_v2.schema.sql.gz",
+			"foo.triggers.sql.gz",
+			"foo.events.sql.gz",
+		}))
+
+		By("taking a backup in CSV")
+		responses = nil
+		err = agent.LogicalBackup(context.Background(), &proto.LogicalBackupRequest{
+			IncludeSchemas: []string{"foo"},
+			Format:         "csv",
+		}, send)
+		Expect(err).NotTo(HaveOccurred())
+
+		files = collectBackupFiles(responses[1:])
+		Expect(files).To(HaveKeyWithValue("foo/bar.csv.gz", Equal("i,s,b\n1,it's,\x01\x02\n2,\\N,\\N\n")))
+		Expect(files).NotTo(HaveKey("ignored/t.csv.gz"))
+	})
+
+	It("should quote values", func() {
+		testcases := []struct {
+			dataType string
+			value    sql.RawBytes
+			expected string
+		}{
+			{"int", sql.RawBytes("-3"), "-3"},
+			{"decimal", sql.RawBytes("1.50"), "1.50"},
+			{"varchar", nil, "NULL"},
+			{"varchar", sql.RawBytes("a'b\\c\n"), `'a\'b\\c\n'`},
+			{"text", sql.RawBytes{0, 0x1a}, `'\0\Z'`},
+			{"blob", sql.RawBytes{0xde, 0xad}, "0xdead"},
+			{"varbinary", sql.RawBytes{}, "''"},
+		}
+		for _, tc := range testcases {
+			var buf bytes.Buffer
+			writeSQLValue(&buf, tc.dataType, tc.value)
+			Expect(buf.String()).To(Equal(tc.expected), tc.dataType)
+		}
+	})
+})
+
+func collectBackupFiles(responses []*proto.LogicalBackupResponse) map[string]string {
+	compressed := make(map[string]*bytes.Buffer)
+	for _, resp := range responses {
+		if compressed[resp.File] == nil {
+			compressed[resp.File] = &bytes.Buffer{}
+		}
+		compressed[resp.File].Write(resp.Data)
+	}
+
+	files := make(map[string]string)
+	for name, buf := range compressed {
+		zr, err := gzip.NewReader(buf)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(zr)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		files[name] = string(data)
+	}
+	return files
+}
+
+// backupFileOrder returns the names of the files in the order of their first chunks.
+func backupFileOrder(responses []*proto.LogicalBackupResponse) []string {
+	var names []string
+	for _, resp := range responses {
+		if !slices.Contains(names, resp.File) {
+			names = append(names, resp.File)
+		}
+	}
+	return names
+}
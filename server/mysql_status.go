@@ -3,9 +3,6 @@ package server
 import (
 	"context"
 	"database/sql"
-	"errors"
-	"fmt"
-	"strconv"
 	"time"
 )
 
@@ -100,86 +97,36 @@ type MySQLReplicaStatus struct {
 }
 
 func (a *Agent) GetMySQLGlobalVariable(ctx context.Context) (*MySQLGlobalVariablesStatus, error) {
-	status := &MySQLGlobalVariablesStatus{}
-	err := a.db.GetContext(ctx, status, `SELECT @@read_only, @@super_read_only, @@rpl_semi_sync_master_wait_for_slave_count, @@clone_valid_donor_list`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get global variable: %w", err)
-	}
-	return status, nil
+	return a.mysql.GetGlobalVariables(ctx)
 }
 
 func (a *Agent) GetMySQLCloneStateStatus(ctx context.Context) (*MySQLCloneStateStatus, error) {
-	status := &MySQLCloneStateStatus{}
-	err := a.db.GetContext(ctx, status, `SELECT state FROM performance_schema.clone_status`)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return &MySQLCloneStateStatus{}, nil
-		}
-		return nil, err
-	}
-	return status, nil
+	return a.mysql.GetCloneState(ctx)
 }
 
+// IsMySQL84 returns true if mysqld is of the 8.4 series.
+//
+// Deprecated: The statements that vary among server versions are chosen by the server flavor.
 func (a *Agent) IsMySQL84(ctx context.Context) (bool, error) {
 	var version string
-	err := a.db.GetContext(ctx, &version, `SELECT SUBSTRING_INDEX(VERSION(), '.', 2)`)
+	if err := a.mysql.GetGlobalVariable(ctx, "version", &version); err != nil {
+		return false, err
+	}
+	flavor, err := newServerFlavor(version, "")
 	if err != nil {
-		return false, fmt.Errorf("failed to get version: %w", err)
+		return false, err
 	}
-	return version == "8.4", nil
+	return flavor.series() == "8.4", nil
 }
 
 func (a *Agent) GetMySQLPrimaryStatus(ctx context.Context) (*MySQLPrimaryStatus, error) {
-	status := &MySQLPrimaryStatus{}
-	isMySQL84, err := a.IsMySQL84(ctx)
-	if err != nil {
-		return nil, err
-	}
-	if isMySQL84 {
-		if err := a.db.GetContext(ctx, status, `SHOW BINARY LOG STATUS`); err != nil {
-			return nil, fmt.Errorf("failed to show binary log status: %w", err)
-		}
-	} else {
-		if err := a.db.GetContext(ctx, status, `SHOW MASTER STATUS`); err != nil {
-			return nil, fmt.Errorf("failed to show master status: %w", err)
-		}
-	}
-	return status, nil
+	return a.mysql.GetPrimaryStatus(ctx)
 }
 
 func (a *Agent) GetMySQLReplicaStatus(ctx context.Context) (*MySQLReplicaStatus, error) {
-	status := &MySQLReplicaStatus{}
-	if err := a.db.GetContext(ctx, status, `SHOW REPLICA STATUS`); err != nil {
-		return nil, fmt.Errorf("failed to show replica status: %w", err)
-	}
-	return status, nil
+	return a.mysql.GetReplicaStatus(ctx, "")
 }
 
 func (a *Agent) GetTransactionTimestamps(ctx context.Context) (queued, applied time.Time, uptime time.Duration, err error) {
-	err = a.db.GetContext(ctx, &queued, `
-SELECT MAX(LAST_QUEUED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP)
-FROM performance_schema.replication_connection_status`)
-	if err != nil {
-		return
-	}
-	err = a.db.GetContext(ctx, &applied, `
-SELECT MAX(LAST_APPLIED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP)
-FROM performance_schema.replication_applier_status_by_worker`)
-	if err != nil {
-		return
-	}
-	var uptime_seconds_string string
-	err = a.db.GetContext(ctx, &uptime_seconds_string, `
-SELECT VARIABLE_VALUE
-FROM performance_schema.global_status
-WHERE VARIABLE_NAME='Uptime'`)
-	if err != nil {
-		return
-	}
-	uptime_seconds, err := strconv.Atoi(uptime_seconds_string)
-	if err != nil {
-		return
-	}
-	uptime = time.Second * time.Duration(uptime_seconds)
-	return
+	return a.mysql.GetTransactionTimestamps(ctx)
 }
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/credential"
 	"github.com/cybozu-go/well"
 	"github.com/jmoiron/sqlx"
 	. "github.com/onsi/gomega"
@@ -71,6 +72,7 @@ func StartMySQLD(name string, port int, serverID int) {
 	ExpectWithOffset(1, err).NotTo(HaveOccurred())
 
 	socketDir := socketDir(name)
+	ExpectWithOffset(1, os.RemoveAll(socketDir)).NotTo(HaveOccurred()) // The passwords recorded by agents are for the previous data.
 	ExpectWithOffset(1, os.MkdirAll(socketDir, 0755)).NotTo(HaveOccurred())
 	ExpectWithOffset(1, os.Chmod(socketDir, 0777)).NotTo(HaveOccurred())
 
@@ -159,7 +161,7 @@ func StartMySQLD(name string, port int, serverID int) {
 		os.Setenv(k, v)
 	}
 
-	err = Init(context.Background(), db, socket)
+	err = Init(context.Background(), db, socket, nil, credential.Env{})
 	ExpectWithOffset(1, err).NotTo(HaveOccurred())
 }
 
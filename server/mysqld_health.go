@@ -1,29 +1,60 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/go-sql-driver/mysql"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Health returns the health check result of own MySQL
 func (a *Agent) MySQLDHealth(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.db.QueryxContext(r.Context(), `SELECT VERSION()`)
-	if err != nil {
+	if err := a.mysql.Ping(WithPoolClass(r.Context(), PoolProbe)); err != nil {
+		if msg := describeTLSError(err); msg != "" {
+			a.logger.Error(err, "health check failed due to TLS")
+			http.Error(w, msg, http.StatusServiceUnavailable)
+			return
+		}
 		a.logger.Info("health check failed")
 		http.Error(w, "failed to execute a query", http.StatusServiceUnavailable)
 		return
 	}
-	rows.Close()
+}
+
+// describeTLSError returns the description of `err` if it is caused by TLS between moco-agent and mysqld.
+// Otherwise, it returns an empty string.
+func describeTLSError(err error) string {
+	var verifyErr *tls.CertificateVerificationError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &verifyErr):
+		return fmt.Sprintf("failed to verify the certificate of mysqld: %v", verifyErr.Err)
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// mysqld sends a TLS alert when it rejects the certificate of moco-agent.
+		return fmt.Sprintf("mysqld rejected the TLS connection: %v", opErr.Err)
+	case errors.Is(err, mysql.ErrNoTLS):
+		return "mysqld does not support TLS"
+	}
+	return ""
 }
 
 func (a *Agent) MySQLDReady(w http.ResponseWriter, r *http.Request) {
+	ctx := WithPoolClass(r.Context(), PoolProbe)
+
 	// Check the instance is under cloning or not
-	cloneStatus, err := a.GetMySQLCloneStateStatus(r.Context())
+	cloneStatus, err := a.GetMySQLCloneStateStatus(ctx)
 	if err != nil {
+		if msg := describeTLSError(err); msg != "" {
+			a.logger.Error(err, "readiness check failed due to TLS")
+			http.Error(w, msg, http.StatusServiceUnavailable)
+			return
+		}
 		a.logger.Error(err, "failed to get clone status")
 		msg := fmt.Sprintf("failed to get clone status: %+v", err)
 		http.Error(w, msg, http.StatusInternalServerError)
@@ -36,7 +67,7 @@ func (a *Agent) MySQLDReady(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check the instance works primary or not
-	globalVariables, err := a.GetMySQLGlobalVariable(r.Context())
+	globalVariables, err := a.GetMySQLGlobalVariable(ctx)
 	if err != nil {
 		a.logger.Error(err, "failed to get global variables")
 		msg := fmt.Sprintf("failed to get global variables: %+v", err)
@@ -50,7 +81,7 @@ func (a *Agent) MySQLDReady(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check the instance has IO/SQLThread error or not
-	replicaStatus, err := a.GetMySQLReplicaStatus(r.Context())
+	replicaStatus, err := a.GetMySQLReplicaStatus(ctx)
 	if err != nil {
 		a.configureReplicationMetrics(false)
 		a.logger.Error(err, "failed to get replica status")
@@ -76,7 +107,7 @@ func (a *Agent) MySQLDReady(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	queued, applied, uptime, err := a.GetTransactionTimestamps(r.Context())
+	queued, applied, uptime, err := a.GetTransactionTimestamps(ctx)
 	if err != nil {
 		a.logger.Error(err, "failed to get replication lag")
 		msg := fmt.Sprintf("failed to get replication lag: %+v", err)
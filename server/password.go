@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/credential"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/go-logr/logr"
+)
+
+// passwordStateFile is the file next to the mysqld socket recording the passwords effective in mysqld.
+// It lets the agent log in after the credentials are changed while it is stopped.
+const passwordStateFile = "moco-agent-passwords.json"
+
+// SetCredentialProvider sets the provider of the passwords of MOCO users.
+// The passwords recorded by the previous agent, or the current ones of the provider if not recorded,
+// are taken as the ones effective in mysqld, and the changes are applied by RunPasswordRotation.
+// Without this, the environment variables are used.
+func (a *Agent) SetCredentialProvider(p credential.Provider) {
+	a.passwordMu.Lock()
+	defer a.passwordMu.Unlock()
+	a.credentials = p
+	for _, u := range Users {
+		if _, ok := a.passwords[u.name]; ok {
+			continue
+		}
+		if pwd := p.Password(userPasswordKeys[u.name]); pwd != "" {
+			a.passwords[u.name] = pwd
+		}
+	}
+	a.savePasswords()
+}
+
+// userPassword returns the current password of a MOCO user.
+// Unless rotated, it is given by the credential provider.
+func (a *Agent) userPassword(user string) string {
+	a.passwordMu.RLock()
+	defer a.passwordMu.RUnlock()
+	if pwd, ok := a.passwords[user]; ok {
+		return pwd
+	}
+	return a.credentials.Password(userPasswordKeys[user])
+}
+
+func (a *Agent) setUserPassword(user, pwd string) {
+	a.passwordMu.Lock()
+	defer a.passwordMu.Unlock()
+	a.passwords[user] = pwd
+	a.savePasswords()
+}
+
+// passwordStatePath returns the path of passwordStateFile, or "" if the socket is not given.
+func (a *Agent) passwordStatePath() string {
+	if a.mysqlSocketPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(a.mysqlSocketPath), passwordStateFile)
+}
+
+// loadPasswords reads the passwords recorded by the previous agent.
+func (a *Agent) loadPasswords() (map[string]string, error) {
+	path := a.passwordStatePath()
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the password state: %w", err)
+	}
+
+	var passwords map[string]string
+	if err := json.Unmarshal(data, &passwords); err != nil {
+		return nil, fmt.Errorf("failed to parse the password state: %w", err)
+	}
+	return passwords, nil
+}
+
+// savePasswords records the current passwords for the next agent.
+// The caller must hold passwordMu.
+func (a *Agent) savePasswords() {
+	if err := a.writePasswords(); err != nil {
+		a.logger.Error(err, "failed to record the passwords")
+	}
+}
+
+func (a *Agent) writePasswords() error {
+	path := a.passwordStatePath()
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(a.passwords)
+	if err != nil {
+		return err
+	}
+
+	// Replace the file atomically not to leave a truncated one on crash.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// passwordRotator rotates the passwords of MOCO users using the dual password feature.
+type passwordRotator struct {
+	agent  *Agent
+	grace  time.Duration
+	logger logr.Logger
+
+	// rotations is the rotations in progress on the primary keyed by user.
+	rotations map[string]*rotation
+	// restored is true after the rotations left by the previous agent are restored.
+	restored bool
+}
+
+// rotation is a password rotation for which ALTER USER ... RETAIN CURRENT PASSWORD has been executed.
+type rotation struct {
+	host string
+	// password is the new password.
+	password string
+	// discardAt is the time to discard the old password.
+	discardAt time.Time
+}
+
+// RunPasswordRotation checks the passwords of the credential provider at every `interval`
+// and whenever the provider is updated until `ctx` is canceled.
+// When a password is changed, the password is changed in mysqld with the current one retained,
+// and the retained one is discarded after `grace`.
+// This should be called as a goroutine.
+func (a *Agent) RunPasswordRotation(ctx context.Context, interval, grace time.Duration) {
+	r := &passwordRotator{
+		agent:     a,
+		grace:     grace,
+		logger:    a.logger.WithName("password-rotator"),
+		rotations: make(map[string]*rotation),
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		if err := r.check(ctx, time.Now()); err != nil {
+			r.logger.Error(err, "failed to rotate passwords")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		case <-a.credentials.Updated():
+		}
+	}
+}
+
+func (r *passwordRotator) check(ctx context.Context, now time.Time) error {
+	a := r.agent
+
+	// On replicas, ALTER USER is replicated from the primary.
+	var readOnly bool
+	if err := a.mysql.GetGlobalVariable(ctx, "read_only", &readOnly); err != nil {
+		// The agent cannot log in with the old password once the new one is replicated
+		// and the old one is discarded.  Switch to the new one and retry.
+		pwd := a.credentials.Password(userPasswordKeys[mocoagent.AgentUser])
+		if pwd == "" || pwd == a.userPassword(mocoagent.AgentUser) || !r.apply(ctx, mocoagent.AgentUser, pwd, false) {
+			return err
+		}
+		if err := a.mysql.GetGlobalVariable(ctx, "read_only", &readOnly); err != nil {
+			return err
+		}
+	}
+
+	if !readOnly && !r.restored {
+		if err := r.restore(ctx, now); err != nil {
+			return err
+		}
+		r.restored = true
+	}
+
+	for _, u := range Users {
+		pwd := a.credentials.Password(userPasswordKeys[u.name])
+
+		if rot, ok := r.rotations[u.name]; ok {
+			// Executing ALTER USER again would retain the new password and discard the old one
+			// that clients may still use.  Wait for the old one to be discarded.
+			if a.userPassword(u.name) != rot.password {
+				r.apply(ctx, u.name, rot.password, !readOnly)
+			}
+			if pwd != "" && pwd != rot.password {
+				r.logger.Info("waiting for the previous rotation to finish", "user", u.name)
+			}
+			continue
+		}
+
+		if pwd == "" || pwd == a.userPassword(u.name) {
+			continue
+		}
+
+		if !readOnly {
+			if err := a.mysql.ChangePassword(ctx, u.name, u.accountHost(), pwd); err != nil {
+				metrics.PasswordRotationFailureCount.Inc()
+				return fmt.Errorf("failed to change the password of %s: %w", u.name, err)
+			}
+			r.rotations[u.name] = &rotation{
+				host:      u.accountHost(),
+				password:  pwd,
+				discardAt: now.Add(r.grace),
+			}
+		}
+		r.apply(ctx, u.name, pwd, !readOnly)
+	}
+
+	for user, rot := range r.rotations {
+		if now.Before(rot.discardAt) {
+			continue
+		}
+		if !readOnly {
+			// The agent uses the old password until the new one becomes effective.
+			if a.userPassword(user) != rot.password {
+				continue
+			}
+			if err := a.mysql.DiscardOldPassword(ctx, user, rot.host); err != nil {
+				metrics.PasswordRotationFailureCount.Inc()
+				return fmt.Errorf("failed to discard the old password of %s: %w", user, err)
+			}
+			r.logger.Info("discarded the old password", "user", user)
+		}
+		delete(r.rotations, user)
+	}
+	return nil
+}
+
+// restore restores the rotations that the previous agent did not finish.
+// Their old passwords are discarded after the grace period from `now`.
+func (r *passwordRotator) restore(ctx context.Context, now time.Time) error {
+	a := r.agent
+	for _, u := range Users {
+		retained, err := a.mysql.HasRetainedPassword(ctx, u.name, u.accountHost())
+		if err != nil {
+			return err
+		}
+		if !retained {
+			continue
+		}
+		// The previous agent may have stopped before recording the new password.
+		pwd := a.credentials.Password(userPasswordKeys[u.name])
+		if pwd == "" {
+			pwd = a.userPassword(u.name)
+		}
+		r.rotations[u.name] = &rotation{
+			host:      u.accountHost(),
+			password:  pwd,
+			discardAt: now.Add(r.grace),
+		}
+		r.logger.Info("found the retained password", "user", u.name)
+	}
+	return nil
+}
+
+// apply uses the new password of `user` after it becomes effective in mysqld.
+func (r *passwordRotator) apply(ctx context.Context, user, pwd string, primary bool) bool {
+	a := r.agent
+	if err := a.mysql.CheckPassword(ctx, user, pwd); err != nil {
+		r.logger.Info("the new password is not effective yet", "user", user, "error", err.Error())
+		return false
+	}
+
+	a.setUserPassword(user, pwd)
+	if user == mocoagent.AgentUser {
+		// Close idle connections to reconnect with the new password.
+		a.mysql.ResetConnections()
+	}
+	metrics.PasswordRotationCount.Inc()
+	r.logger.Info("rotated the password", "user", user, "primary", primary)
+	return true
+}
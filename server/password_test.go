@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/credential"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("password rotation", func() {
+	It("should rotate passwords with dual passwords", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, adminUserPassword, sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		_, err = db.Exec(`SET GLOBAL super_read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`SET GLOBAL read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+
+		dir := GinkgoT().TempDir()
+		err = os.WriteFile(filepath.Join(dir, mocoagent.BackupPasswordKey), []byte(backupPassword), 0600)
+		Expect(err).NotTo(HaveOccurred())
+		provider, err := credential.NewDirProvider(dir, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go provider.Run(ctx)
+		agent.SetCredentialProvider(provider)
+		r := &passwordRotator{
+			agent:     agent,
+			grace:     time.Minute,
+			logger:    testLogger,
+			rotations: make(map[string]*rotation),
+		}
+
+		By("doing nothing without changes")
+		now := time.Now()
+		Expect(r.check(context.Background(), now)).To(Succeed())
+		Expect(r.rotations).To(BeEmpty())
+
+		By("changing the passwords with the current ones retained")
+		err = os.WriteFile(filepath.Join(dir, mocoagent.AgentPasswordEnvKey), []byte("newagent\n"), 0600)
+		Expect(err).NotTo(HaveOccurred())
+		err = os.WriteFile(filepath.Join(dir, mocoagent.BackupPasswordKey), []byte("newbackup"), 0600)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() string {
+			return provider.Password(mocoagent.BackupPasswordKey)
+		}).Should(Equal("newbackup"))
+		Eventually(func() string {
+			return provider.Password(mocoagent.AgentPasswordEnvKey)
+		}).Should(Equal("newagent"))
+		Expect(r.check(context.Background(), now)).To(Succeed())
+		Expect(r.rotations).To(HaveLen(2))
+		Expect(agent.userPassword(mocoagent.AgentUser)).To(Equal("newagent"))
+		Expect(agent.userPassword(mocoagent.BackupUser)).To(Equal("newbackup"))
+
+		for _, pwd := range []string{agentUserPassword, "newagent"} {
+			agentDB, err := GetMySQLConnLocalSocket(mocoagent.AgentUser, pwd, sockFile)
+			Expect(err).NotTo(HaveOccurred())
+			agentDB.Close()
+		}
+		_, err = agent.GetMySQLPrimaryStatus(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		By("restoring the rotations after restarting")
+		r2 := &passwordRotator{
+			agent:     agent,
+			grace:     time.Minute,
+			logger:    testLogger,
+			rotations: make(map[string]*rotation),
+		}
+		Expect(r2.check(context.Background(), now)).To(Succeed())
+		Expect(r2.rotations).To(HaveKey(mocoagent.AgentUser))
+		Expect(r2.rotations).To(HaveKey(mocoagent.BackupUser))
+		Expect(r2.rotations[mocoagent.BackupUser].password).To(Equal("newbackup"))
+
+		By("discarding the old passwords after the grace period")
+		Expect(r.check(context.Background(), now.Add(time.Minute))).To(Succeed())
+		Expect(r.rotations).To(BeEmpty())
+
+		_, err = GetMySQLConnLocalSocket(mocoagent.AgentUser, agentUserPassword, sockFile)
+		Expect(err).To(HaveOccurred())
+		_, err = GetMySQLConnLocalSocket(mocoagent.BackupUser, backupPassword, sockFile)
+		Expect(err).To(HaveOccurred())
+
+		agent.mysql.ResetConnections()
+		_, err = agent.GetMySQLPrimaryStatus(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,310 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/archive"
+	"github.com/cybozu-go/moco-agent/binlog"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/go-logr/logr"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	// pitrChannel is the replication channel to apply archived binary logs.
+	pitrChannel      = "pitr"
+	pitrPollInterval = 1 * time.Second
+)
+
+// Phases reported in PointInTimeRecoveryResponse.
+const (
+	pitrPhaseFetching  = "fetching"
+	pitrPhaseApplying  = "applying"
+	pitrPhaseCompleted = "completed"
+)
+
+func (s agentService) PointInTimeRecovery(req *proto.PointInTimeRecoveryRequest, stream proto.Agent_PointInTimeRecoveryServer) error {
+	return s.agent.PointInTimeRecovery(stream.Context(), req, stream.Send)
+}
+
+// PointInTimeRecovery replays archived binary logs up to the target in req.
+// The progress is passed to `report`.
+func (a *Agent) PointInTimeRecovery(ctx context.Context, req *proto.PointInTimeRecoveryRequest, report func(*proto.PointInTimeRecoveryResponse) error) error {
+	select {
+	case a.cloneLock <- struct{}{}:
+	default:
+		return status.Error(codes.ResourceExhausted, "another request is undergoing")
+	}
+	defer func() { <-a.cloneLock }()
+
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	if err := a.pointInTimeRecovery(ctx, req, report, logger); err != nil {
+		logger.Error(err, "failed to recover to the point in time")
+		return err
+	}
+	return nil
+}
+
+func (a *Agent) pointInTimeRecovery(ctx context.Context, req *proto.PointInTimeRecoveryRequest, report func(*proto.PointInTimeRecoveryResponse) error, logger logr.Logger) error {
+	target, err := recoveryTarget(req)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%+v", err)
+	}
+
+	var storage archive.Storage
+	archiver := a.archiver.Load()
+	switch {
+	case req.ArchiveUrl != "":
+		storage, err = archive.NewStorage(req.ArchiveUrl)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "%+v", err)
+		}
+	case archiver != nil:
+		storage = archiver.storage
+	default:
+		return status.Error(codes.FailedPrecondition, "no binary log archive is configured")
+	}
+
+	manifest, err := archive.LoadManifest(ctx, storage)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to load the archive manifest: %+v", err)
+	}
+
+	executed, err := a.getExecutedGTIDSet(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+
+	entries, err := manifest.Plan(executed, target)
+	if errors.Is(err, archive.ErrNotCovered) {
+		return status.Errorf(codes.FailedPrecondition, "%+v", err)
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+
+	progress := &proto.PointInTimeRecoveryResponse{
+		TotalFiles:      int32(len(entries)),
+		ExecutedGtidSet: executed.String(),
+	}
+	// `report` may retain the response, so pass a copy not to be changed later.
+	send := func(phase string) error {
+		progress.Phase = phase
+		return report(protobuf.Clone(progress).(*proto.PointInTimeRecoveryResponse))
+	}
+
+	if len(entries) == 0 {
+		logger.Info("no binary logs need to be replayed")
+		return send(pitrPhaseCompleted)
+	}
+
+	relayBase, err := a.relayLogBasename(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+	prefix := relayBase + "-" + pitrChannel
+
+	// Clean up leftovers of a failed recovery.
+	if err := a.removeRecoveryChannel(ctx, prefix); err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+	defer func() {
+		if err := a.removeRecoveryChannel(context.Background(), prefix); err != nil {
+			logger.Error(err, "failed to remove the recovery channel")
+		}
+	}()
+
+	if err := send(pitrPhaseFetching); err != nil {
+		return err
+	}
+	files := make([]string, len(entries))
+	for i, e := range entries {
+		files[i] = fmt.Sprintf("%s.%06d", prefix, i+1)
+		if err := fetchArchivedBinlog(ctx, storage, e, files[i]); err != nil {
+			return status.Errorf(codes.Internal, "failed to fetch %s: %+v", e.Name, err)
+		}
+		logger.Info("fetched archived binary log", "file", e.Name)
+
+		progress.FetchedFiles++
+		if err := send(pitrPhaseFetching); err != nil {
+			return err
+		}
+	}
+	index := strings.Join(files, "\n") + "\n"
+	if err := os.WriteFile(prefix+".index", []byte(index), 0640); err != nil {
+		return status.Errorf(codes.Internal, "failed to write the relay log index: %+v", err)
+	}
+
+	// `expected` is the GTID set executed when the recovery completes.
+	var expected binlog.GTIDSet
+	applier := &RelayLogApplier{Channel: pitrChannel, RelayLogFile: files[0]}
+	if target.GTIDSet != nil {
+		expected = target.GTIDSet
+		applier.AfterGTIDs = target.GTIDSet.String()
+	} else {
+		expected = executed.Clone()
+		for _, file := range files {
+			stop, err := findTransactionAfter(file, target.Time, expected)
+			if err != nil {
+				return status.Errorf(codes.Internal, "failed to read %s: %+v", file, err)
+			}
+			if stop != "" {
+				applier.BeforeGTIDs = stop
+				break
+			}
+		}
+	}
+
+	if err := a.mysql.StartRelayLogApplier(ctx, applier); err != nil {
+		return status.Errorf(codes.Internal, "failed to start the recovery channel: %+v", err)
+	}
+	logger.Info("start applying archived binary logs", "files", len(files), "after", applier.AfterGTIDs, "before", applier.BeforeGTIDs)
+
+	for {
+		replicaStatus, err := a.mysql.GetReplicaStatus(ctx, pitrChannel)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%+v", err)
+		}
+		executed, err := a.getExecutedGTIDSet(ctx)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%+v", err)
+		}
+		progress.ExecutedGtidSet = executed.String()
+
+		if expected.IsSubset(executed) {
+			break
+		}
+		if replicaStatus.ReplicaSQLRunning != "Yes" {
+			if replicaStatus.LastSQLErrno != 0 {
+				return status.Errorf(codes.Internal, "failed to apply binary logs: %d: %s", replicaStatus.LastSQLErrno, replicaStatus.LastSQLError)
+			}
+			return status.Errorf(codes.Internal, "replication SQL thread stopped before reaching the target: executed=%s", executed)
+		}
+
+		if err := send(pitrPhaseApplying); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(pitrPollInterval):
+		}
+	}
+
+	logger.Info("point-in-time recovery finished", "executed", progress.ExecutedGtidSet)
+	return send(pitrPhaseCompleted)
+}
+
+func recoveryTarget(req *proto.PointInTimeRecoveryRequest) (archive.RecoveryTarget, error) {
+	switch {
+	case req.TargetTime != nil && req.TargetGtidSet != "":
+		return archive.RecoveryTarget{}, errors.New("both target_time and target_gtid_set are specified")
+	case req.TargetTime != nil:
+		return archive.RecoveryTarget{Time: req.TargetTime.AsTime()}, nil
+	case req.TargetGtidSet != "":
+		set, err := binlog.ParseGTIDSet(req.TargetGtidSet)
+		if err != nil {
+			return archive.RecoveryTarget{}, err
+		}
+		return archive.RecoveryTarget{GTIDSet: set}, nil
+	}
+	return archive.RecoveryTarget{}, errors.New("no recovery target is specified")
+}
+
+func (a *Agent) getExecutedGTIDSet(ctx context.Context) (binlog.GTIDSet, error) {
+	var executed string
+	if err := a.mysql.GetGlobalVariable(ctx, "gtid_executed", &executed); err != nil {
+		return nil, err
+	}
+	return binlog.ParseGTIDSet(executed)
+}
+
+func (a *Agent) relayLogBasename(ctx context.Context) (string, error) {
+	var basename string
+	if err := a.mysql.GetGlobalVariable(ctx, "relay_log_basename", &basename); err != nil {
+		return "", err
+	}
+	return basename, nil
+}
+
+// removeRecoveryChannel removes the recovery channel and its relay logs beginning with `prefix`.
+func (a *Agent) removeRecoveryChannel(ctx context.Context, prefix string) error {
+	if err := a.mysql.RemoveReplicationChannel(ctx, pitrChannel); err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(prefix + ".*")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchArchivedBinlog downloads the archived binary log to `path` and verifies its checksum.
+func fetchArchivedBinlog(ctx context.Context, storage archive.Storage, e archive.Entry, path string) error {
+	r, err := storage.Get(ctx, e.Object)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var src io.Reader = r
+	switch e.Compression {
+	case archive.CompressionNone:
+	case archive.CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		src = zr
+	default:
+		return fmt.Errorf("unsupported compression %s", e.Compression)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), src); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != e.SHA256 {
+		return fmt.Errorf("checksum mismatch: expected %s, actual %s", e.SHA256, sum)
+	}
+	return nil
+}
+
+func findTransactionAfter(path string, t time.Time, before binlog.GTIDSet) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return binlog.FindTransactionAfter(f, t, before)
+}
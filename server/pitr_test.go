@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/archive"
+	"github.com/cybozu-go/moco-agent/binlog"
+	"github.com/cybozu-go/moco-agent/mysqltest"
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const testUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+// startFakeMySQLD starts mysqltest.Instance keeping binary logs and relay logs in a temporary directory,
+// and returns it with Agent operating it.
+func startFakeMySQLD() (*mysqltest.Instance, *Agent) {
+	inst := mysqltest.NewInstance()
+	addr, err := inst.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	dir := GinkgoT().TempDir()
+	sock := filepath.Join(dir, "mysqld.sock")
+	_, err = inst.Listen("unix", sock)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(inst.Close)
+	inst.SetVariable("log_bin_basename", filepath.Join(dir, "binlog"))
+	inst.SetVariable("relay_log_basename", filepath.Join(dir, "relay-bin"))
+
+	conf := MySQLAccessorConfig{
+		Host:              "127.0.0.1",
+		Port:              addr.(*net.TCPAddr).Port,
+		Password:          agentUserPassword,
+		ConnMaxIdleTime:   time.Minute,
+		ConnectionTimeout: 3 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	agent, err := New(conf, testClusterName, sock, "", maxDelayThreshold, time.Second, testLogger)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(agent.CloseDB)
+	return inst, agent
+}
+
+// writeTestBinlogs writes binary logs with the transactions testUUID:1-4 committed at `t0` + 1, 2, 11, and 13 seconds.
+// binlog.000001 has 1-2, binlog.000002 has 3-4, and binlog.000003 is the empty active file.
+func writeTestBinlogs(inst *mysqltest.Instance, t0 time.Time) {
+	at := func(sec int) time.Time {
+		return t0.Add(time.Duration(sec) * time.Second)
+	}
+	gtids := func(s string) binlog.GTIDSet {
+		set, err := binlog.ParseGTIDSet(s)
+		Expect(err).NotTo(HaveOccurred())
+		return set
+	}
+
+	f := mysqltest.NewBinlogFile(at(0), nil)
+	f.Transaction(at(1), testUUID, 1, "INSERT INTO test.t VALUES (1)")
+	f.Transaction(at(2), testUUID, 2, "INSERT INTO test.t VALUES (2)")
+	f.Rotate(at(2), "binlog.000002")
+	Expect(inst.WriteBinaryLog("binlog.000001", f)).To(Succeed())
+
+	f = mysqltest.NewBinlogFile(at(10), gtids(testUUID+":1-2"))
+	f.Transaction(at(11), testUUID, 3, "INSERT INTO test.t VALUES (3)")
+	f.Transaction(at(13), testUUID, 4, "INSERT INTO test.t VALUES (4)")
+	f.Rotate(at(13), "binlog.000003")
+	Expect(inst.WriteBinaryLog("binlog.000002", f)).To(Succeed())
+
+	f = mysqltest.NewBinlogFile(at(20), gtids(testUUID+":1-4"))
+	Expect(inst.WriteBinaryLog("binlog.000003", f)).To(Succeed())
+	inst.SetVariable("gtid_executed", testUUID+":1-4")
+}
+
+// archiveTestBinlogs archives the binary logs written by writeTestBinlogs and returns the URL of the archive.
+func archiveTestBinlogs() string {
+	source, agent := startFakeMySQLD()
+	writeTestBinlogs(source, time.Now().Add(-time.Hour).Truncate(time.Second))
+
+	dir := GinkgoT().TempDir()
+	storage, err := archive.NewLocalStorage(dir)
+	Expect(err).NotTo(HaveOccurred())
+	ar, err := agent.EnableBinlogArchive(context.Background(), storage, true, time.Minute, time.Hour)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ar.Archive(context.Background())).To(Succeed())
+	Expect(ar.Manifest().Binlogs).To(HaveLen(2))
+	return "file://" + dir
+}
+
+// recoveryPhases returns the phases and the executed GTID sets of `progress`.
+func recoveryPhases(progress []*proto.PointInTimeRecoveryResponse) []string {
+	phases := make([]string, len(progress))
+	for i, p := range progress {
+		phases[i] = fmt.Sprintf("%s %d/%d %s", p.Phase, p.FetchedFiles, p.TotalFiles, p.ExecutedGtidSet)
+	}
+	return phases
+}
+
+var _ = Describe("point-in-time recovery", func() {
+	It("should validate the request and the archive", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		var progress []*proto.PointInTimeRecoveryResponse
+		report := func(p *proto.PointInTimeRecoveryResponse) error {
+			progress = append(progress, p)
+			return nil
+		}
+		archiveURL := "file://" + GinkgoT().TempDir()
+
+		By("passing invalid targets")
+		err = agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{ArchiveUrl: archiveURL}, report)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		err = agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{
+			ArchiveUrl:    archiveURL,
+			TargetTime:    timestamppb.Now(),
+			TargetGtidSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",
+		}, report)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		err = agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{
+			ArchiveUrl:    archiveURL,
+			TargetGtidSet: "invalid",
+		}, report)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		By("passing no archive")
+		err = agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{TargetTime: timestamppb.Now()}, report)
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+
+		By("passing a GTID set not in the archive")
+		err = agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{
+			ArchiveUrl:    archiveURL,
+			TargetGtidSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",
+		}, report)
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		Expect(progress).To(BeEmpty())
+
+		By("completing without binary logs to be replayed")
+		err = agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{
+			ArchiveUrl: archiveURL,
+			TargetTime: timestamppb.Now(),
+		}, report)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(progress).To(HaveLen(1))
+		Expect(progress[0].Phase).To(Equal(pitrPhaseCompleted))
+	})
+
+	It("should replay archived binary logs up to a GTID set", func() {
+		archiveURL := archiveTestBinlogs()
+		target, agent := startFakeMySQLD()
+		target.SetVariable("gtid_executed", testUUID+":1")
+		relayBase := target.Variable("relay_log_basename")
+
+		var progress []*proto.PointInTimeRecoveryResponse
+		report := func(p *proto.PointInTimeRecoveryResponse) error {
+			progress = append(progress, p)
+			if p.Phase == pitrPhaseApplying {
+				_, err := target.ApplyRelayLog(pitrChannel, 2)
+				return err
+			}
+			return nil
+		}
+		err := agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{
+			ArchiveUrl:    archiveURL,
+			TargetGtidSet: testUUID + ":1-3",
+		}, report)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(recoveryPhases(progress)).To(Equal([]string{
+			"fetching 0/2 " + testUUID + ":1",
+			"fetching 1/2 " + testUUID + ":1",
+			"fetching 2/2 " + testUUID + ":1",
+			"applying 2/2 " + testUUID + ":1",
+			"completed 2/2 " + testUUID + ":1-3",
+		}))
+		Expect(target.Variable("gtid_executed")).To(Equal(testUUID + ":1-3"))
+		Expect(target.Queries()).To(ContainElement(fmt.Sprintf("CHANGE REPLICATION SOURCE TO SOURCE_HOST='pitr.invalid', RELAY_LOG_FILE='%s-pitr.000001', RELAY_LOG_POS=4 FOR CHANNEL 'pitr'", relayBase)))
+		Expect(target.Queries()).To(ContainElement("START REPLICA SQL_THREAD UNTIL SQL_AFTER_GTIDS = '" + testUUID + ":1-3' FOR CHANNEL 'pitr'"))
+
+		By("removing the recovery channel and the relay logs")
+		Expect(target.ReplicaStatus(pitrChannel)).To(BeNil())
+		files, err := filepath.Glob(relayBase + "-pitr.*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("should replay archived binary logs up to a time", func() {
+		archiveURL := archiveTestBinlogs()
+		target, agent := startFakeMySQLD()
+
+		storage, err := archive.NewStorage(archiveURL)
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := archive.LoadManifest(context.Background(), storage)
+		Expect(err).NotTo(HaveOccurred())
+		t0 := manifest.Binlogs[0].FirstEventTime
+
+		var progress []*proto.PointInTimeRecoveryResponse
+		report := func(p *proto.PointInTimeRecoveryResponse) error {
+			progress = append(progress, p)
+			if p.Phase == pitrPhaseApplying {
+				_, err := target.ApplyRelayLog(pitrChannel, 1)
+				return err
+			}
+			return nil
+		}
+		// The transactions 1-3 are committed by the target time, and 4 is after it.
+		err = agent.PointInTimeRecovery(context.Background(), &proto.PointInTimeRecoveryRequest{
+			ArchiveUrl: archiveURL,
+			TargetTime: timestamppb.New(t0.Add(12 * time.Second)),
+		}, report)
+		Expect(err).NotTo(HaveOccurred())
+
+		// The recovery completes only after the transactions before the target time in both files are applied.
+		Expect(recoveryPhases(progress)).To(Equal([]string{
+			"fetching 0/2 ",
+			"fetching 1/2 ",
+			"fetching 2/2 ",
+			"applying 2/2 ",
+			"applying 2/2 " + testUUID + ":1",
+			"applying 2/2 " + testUUID + ":1-2",
+			"completed 2/2 " + testUUID + ":1-3",
+		}))
+		Expect(target.Variable("gtid_executed")).To(Equal(testUUID + ":1-3"))
+		Expect(target.Queries()).To(ContainElement("START REPLICA SQL_THREAD UNTIL SQL_BEFORE_GTIDS = '" + testUUID + ":4' FOR CHANNEL 'pitr'"))
+	})
+})
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+)
+
+// Kinds of pluginState.
+const (
+	pluginKindPlugin    = "plugin"
+	pluginKindComponent = "component"
+)
+
+var (
+	pluginNamePattern    = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	pluginLibraryPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+\.so$`)
+	componentURNPattern  = regexp.MustCompile(`^file://[A-Za-z0-9_]+$`)
+)
+
+// Plugin represents a plugin for mysqld.
+type Plugin struct {
+	name   string
+	soName string
+
+	// replaces is the legacy plugin providing the same feature.
+	// The plugin is not installed if the legacy one is active because they cannot be loaded together.
+	replaces string
+}
+
+// Component represents a component for mysqld such as "file://component_validate_password".
+type Component struct {
+	urn string
+}
+
+// Plugins is the plugins required by MOCO.
+var Plugins = []Plugin{
+	{
+		name:   "rpl_semi_sync_master",
+		soName: "semisync_master.so",
+	},
+	{
+		name:   "rpl_semi_sync_slave",
+		soName: "semisync_slave.so",
+	},
+	{
+		name:   "clone",
+		soName: "mysql_clone.so",
+	},
+}
+
+// NativePlugins is the plugins required by MOCO on MySQL 8.4 or later with the semi-synchronous
+// replication plugins of the new names.
+var NativePlugins = []Plugin{
+	{
+		name:     "rpl_semi_sync_source",
+		soName:   "semisync_source.so",
+		replaces: "rpl_semi_sync_master",
+	},
+	{
+		name:     "rpl_semi_sync_replica",
+		soName:   "semisync_replica.so",
+		replaces: "rpl_semi_sync_slave",
+	},
+	{
+		name:   "clone",
+		soName: "mysql_clone.so",
+	},
+}
+
+// PluginConfig is the configuration of plugins and components installed by moco-agent.
+// The zero value installs MOCO's plugins only.
+type PluginConfig struct {
+	// nativeSemiSync installs the semi-synchronous replication plugins of the new names on MySQL 8.4 or later.
+	nativeSemiSync bool
+	plugins        []Plugin
+	components     []Component
+}
+
+// NewPluginConfig returns PluginConfig installing `plugins` in the form of "name=library.so"
+// and `components` in the form of "file://component_name" in addition to MOCO's plugins.
+func NewPluginConfig(plugins, components []string, nativeSemiSync bool) (*PluginConfig, error) {
+	c := &PluginConfig{nativeSemiSync: nativeSemiSync}
+	for _, p := range plugins {
+		name, soName, ok := strings.Cut(p, "=")
+		if !ok || !pluginNamePattern.MatchString(name) || !pluginLibraryPattern.MatchString(soName) {
+			return nil, fmt.Errorf("invalid plugin: %q", p)
+		}
+		c.plugins = append(c.plugins, Plugin{name: name, soName: soName})
+	}
+	for _, urn := range components {
+		if !componentURNPattern.MatchString(urn) {
+			return nil, fmt.Errorf("invalid component: %q", urn)
+		}
+		c.components = append(c.components, Component{urn: urn})
+	}
+	return c, nil
+}
+
+// SetPluginConfig sets the configuration of plugins installed after cloning and by ReconcilePlugins.
+func (a *Agent) SetPluginConfig(c *PluginConfig) {
+	a.pluginConfig = c
+}
+
+// desiredPlugins returns the plugins to be installed on the server of `f`.
+func (c *PluginConfig) desiredPlugins(f *serverFlavor) []Plugin {
+	return append(f.mocoPlugins(c.nativeSemiSync), c.plugins...)
+}
+
+// pluginState is the desired and actual state of a plugin or a component.
+type pluginState struct {
+	name    string
+	kind    string
+	library string
+	desired bool
+	// status is PLUGIN_STATUS of a plugin.  Empty if not installed.
+	status string
+	// installedAs is the legacy plugin installed instead of the desired one.
+	installedAs string
+}
+
+func (s *pluginState) installed() bool {
+	return s.status != "" || s.installedAs != ""
+}
+
+func (s agentService) ReconcilePlugins(ctx context.Context, req *proto.ReconcilePluginsRequest) (*proto.ReconcilePluginsResponse, error) {
+	return s.agent.ReconcilePlugins(ctx, req)
+}
+
+// ReconcilePlugins reports the desired and actual state of plugins and components,
+// and installs the missing ones unless `req.DryRun` is true.
+func (a *Agent) ReconcilePlugins(ctx context.Context, req *proto.ReconcilePluginsRequest) (*proto.ReconcilePluginsResponse, error) {
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, a.userPassword(mocoagent.AdminUser), a.mysqlSocketPath)
+	if err != nil {
+		return nil, mysqlStatusError(codes.Internal, err, "failed to connect to mysqld through "+a.mysqlSocketPath)
+	}
+	defer db.Close()
+
+	states, err := getPluginStates(ctx, db, a.pluginConfig)
+	if err != nil {
+		return nil, mysqlStatusError(codes.Internal, err, "failed to get the state of plugins")
+	}
+
+	res := &proto.ReconcilePluginsResponse{}
+	for _, st := range states {
+		if !req.DryRun && st.desired && !st.installed() {
+			if err := installPlugin(ctx, db, st); err != nil {
+				return nil, mysqlStatusError(codes.Internal, err, "failed to install "+st.name)
+			}
+			logger.Info("installed", "kind", st.kind, "name", st.name)
+			res.Installed = append(res.Installed, st.name)
+		}
+		res.Plugins = append(res.Plugins, &proto.PluginState{
+			Name:        st.name,
+			Kind:        st.kind,
+			Library:     st.library,
+			Desired:     st.desired,
+			Installed:   st.installed(),
+			Status:      st.status,
+			InstalledAs: st.installedAs,
+		})
+	}
+	return res, nil
+}
+
+func ensureMOCOPlugins(ctx context.Context, db *sqlx.DB, conf *PluginConfig) error {
+	states, err := getPluginStates(ctx, db, conf)
+	if err != nil {
+		return err
+	}
+	for _, st := range states {
+		if !st.desired || st.installed() {
+			continue
+		}
+		if err := installPlugin(ctx, db, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func installPlugin(ctx context.Context, db *sqlx.DB, st *pluginState) error {
+	if st.kind == pluginKindComponent {
+		// The URN is validated by NewPluginConfig.
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`INSTALL COMPONENT '%s'`, st.name)); err != nil {
+			return fmt.Errorf("failed to install component %s: %w", st.name, err)
+		}
+		return nil
+	}
+
+	queryStr := fmt.Sprintf(`INSTALL PLUGIN %s SONAME ?`, st.name)
+	if _, err := db.ExecContext(ctx, queryStr, st.library); err != nil {
+		return fmt.Errorf("failed to install plugin %s: %w", st.name, err)
+	}
+	return nil
+}
+
+// getPluginStates returns the state of the desired plugins and components followed by the undesired but installed ones.
+// Built-in plugins are not included.
+func getPluginStates(ctx context.Context, db *sqlx.DB, conf *PluginConfig) ([]*pluginState, error) {
+	if conf == nil {
+		conf = &PluginConfig{}
+	}
+
+	flavor, err := detectFlavor(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var plugins []struct {
+		Name    string `db:"PLUGIN_NAME"`
+		Status  string `db:"PLUGIN_STATUS"`
+		Library string `db:"PLUGIN_LIBRARY"`
+	}
+	err = db.SelectContext(ctx, &plugins, `SELECT PLUGIN_NAME, PLUGIN_STATUS, PLUGIN_LIBRARY FROM information_schema.plugins WHERE PLUGIN_LIBRARY IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select from information_schema.plugins: %w", err)
+	}
+	var components []string
+	if err := db.SelectContext(ctx, &components, `SELECT component_urn FROM mysql.component`); err != nil {
+		return nil, fmt.Errorf("failed to select from mysql.component: %w", err)
+	}
+
+	statusOf := make(map[string]string)
+	for _, p := range plugins {
+		statusOf[p.Name] = p.Status
+	}
+	reported := make(map[string]bool)
+
+	var states []*pluginState
+	for _, p := range conf.desiredPlugins(flavor) {
+		st := &pluginState{name: p.name, kind: pluginKindPlugin, library: p.soName, desired: true, status: statusOf[p.name]}
+		if st.status == "" && p.replaces != "" && statusOf[p.replaces] != "" {
+			st.installedAs = p.replaces
+			reported[p.replaces] = true
+		}
+		reported[p.name] = true
+		states = append(states, st)
+	}
+	for _, c := range conf.components {
+		states = append(states, &pluginState{
+			name:    c.urn,
+			kind:    pluginKindComponent,
+			desired: true,
+			status:  componentStatus(slices.Contains(components, c.urn)),
+		})
+		reported[c.urn] = true
+	}
+
+	for _, p := range plugins {
+		if !reported[p.Name] {
+			states = append(states, &pluginState{name: p.Name, kind: pluginKindPlugin, library: p.Library, status: p.Status})
+		}
+	}
+	for _, urn := range components {
+		if !reported[urn] {
+			states = append(states, &pluginState{name: urn, kind: pluginKindComponent, status: componentStatus(true)})
+		}
+	}
+	return states, nil
+}
+
+// componentStatus returns pluginState.status of a component.
+// Unlike plugins, mysql.component lists only the loaded components.
+func componentStatus(installed bool) string {
+	if installed {
+		return "ACTIVE"
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("plugins", func() {
+	It("should select plugins for the server series", func() {
+		names := func(plugins []Plugin) []string {
+			var ret []string
+			for _, p := range plugins {
+				ret = append(ret, p.name)
+			}
+			return ret
+		}
+
+		flavor := func(version string) *serverFlavor {
+			f, err := newServerFlavor(version, "MySQL Community Server - GPL")
+			Expect(err).NotTo(HaveOccurred())
+			return f
+		}
+
+		conf, err := NewPluginConfig([]string{"audit_log=audit_log.so"}, []string{"file://component_validate_password"}, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(conf.desiredPlugins(flavor("8.0.40")))).To(Equal([]string{"rpl_semi_sync_master", "rpl_semi_sync_slave", "clone", "audit_log"}))
+		Expect(names(conf.desiredPlugins(flavor("8.4.3")))).To(Equal([]string{"rpl_semi_sync_master", "rpl_semi_sync_slave", "clone", "audit_log"}))
+		Expect(names(conf.desiredPlugins(flavor("9.1.0")))).To(Equal([]string{"rpl_semi_sync_master", "rpl_semi_sync_slave", "clone", "audit_log"}))
+		Expect(conf.components).To(Equal([]Component{{urn: "file://component_validate_password"}}))
+
+		conf, err = NewPluginConfig(nil, nil, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(conf.desiredPlugins(flavor("8.0.40")))).To(Equal([]string{"rpl_semi_sync_master", "rpl_semi_sync_slave", "clone"}))
+		Expect(names(conf.desiredPlugins(flavor("8.4.3")))).To(Equal([]string{"rpl_semi_sync_source", "rpl_semi_sync_replica", "clone"}))
+	})
+
+	DescribeTable("should reject invalid plugins and components",
+		func(plugins, components []string) {
+			_, err := NewPluginConfig(plugins, components, false)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("no library", []string{"audit_log"}, nil),
+		Entry("invalid library", []string{"audit_log=audit_log"}, nil),
+		Entry("invalid name", []string{"audit-log=audit_log.so"}, nil),
+		Entry("invalid component", nil, []string{"component_validate_password"}),
+		Entry("quoted component", nil, []string{"file://a'b"}),
+	)
+
+	It("should report and install plugins", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		By("checking MOCO's plugins are installed")
+		res, err := agent.ReconcilePlugins(context.Background(), &proto.ReconcilePluginsRequest{DryRun: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Installed).To(BeEmpty())
+		Expect(len(res.Plugins)).To(BeNumerically(">=", 3))
+		for _, p := range res.Plugins[:3] {
+			Expect(p.Desired).To(BeTrue())
+			Expect(p.Installed).To(BeTrue(), "plugin %s is not installed", p.Name)
+		}
+
+		By("installing a component")
+		pluginConfig, err := NewPluginConfig(nil, []string{"file://component_validate_password"}, false)
+		Expect(err).NotTo(HaveOccurred())
+		agent.SetPluginConfig(pluginConfig)
+		res, err = agent.ReconcilePlugins(context.Background(), &proto.ReconcilePluginsRequest{DryRun: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Plugins[3].Name).To(Equal("file://component_validate_password"))
+		Expect(res.Plugins[3].Installed).To(BeFalse())
+
+		res, err = agent.ReconcilePlugins(context.Background(), &proto.ReconcilePluginsRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Installed).To(Equal([]string{"file://component_validate_password"}))
+		res, err = agent.ReconcilePlugins(context.Background(), &proto.ReconcilePluginsRequest{DryRun: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Plugins[3].Installed).To(BeTrue())
+	})
+})
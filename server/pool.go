@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// PoolClass is a class of workloads having its own connection pool to mysqld
+// so that a long-running query of a class does not delay the others.
+type PoolClass string
+
+const (
+	// PoolProbe is for the health and readiness probes.
+	PoolProbe PoolClass = "probe"
+	// PoolOps is for the gRPC operations and the background jobs other than log rotation.
+	PoolOps PoolClass = "ops"
+	// PoolRotation is for the log rotation.
+	PoolRotation PoolClass = "rotation"
+)
+
+// PoolClasses is the list of all PoolClass.
+var PoolClasses = []PoolClass{PoolProbe, PoolOps, PoolRotation}
+
+// PoolConfig is the configuration of a connection pool.
+type PoolConfig struct {
+	// MaxOpenConns is the maximum number of open connections.  Zero means unlimited.
+	MaxOpenConns int
+	// MaxIdleConns is the maximum number of idle connections.  Zero or less means no idle connections are retained.
+	MaxIdleConns int
+	// ConnectionTimeout is the dial timeout.  Zero means MySQLAccessorConfig.ConnectionTimeout.
+	ConnectionTimeout time.Duration
+	// ReadTimeout is the I/O read timeout.  Zero means MySQLAccessorConfig.ReadTimeout.
+	ReadTimeout time.Duration
+}
+
+// poolConfig returns the configuration of the pool for `class` filled with the defaults.
+func (c MySQLAccessorConfig) poolConfig(class PoolClass) PoolConfig {
+	pool, ok := c.Pools[class]
+	if !ok {
+		pool.MaxIdleConns = 1
+	}
+	if pool.ConnectionTimeout == 0 {
+		pool.ConnectionTimeout = c.ConnectionTimeout
+	}
+	if pool.ReadTimeout == 0 {
+		pool.ReadTimeout = c.ReadTimeout
+	}
+	return pool
+}
+
+type poolClassKey struct{}
+
+// WithPoolClass returns a context making MySQLAccessor use the connection pool for `class`.
+// PoolOps is used for the contexts without a class.
+func WithPoolClass(ctx context.Context, class PoolClass) context.Context {
+	return context.WithValue(ctx, poolClassKey{}, class)
+}
+
+func poolClassFromContext(ctx context.Context) PoolClass {
+	if class, ok := ctx.Value(poolClassKey{}).(PoolClass); ok {
+		return class
+	}
+	return PoolOps
+}
@@ -0,0 +1,585 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const globalTarget = "*.*"
+
+// targetPattern matches the target of GRANT and REVOKE in SHOW GRANTS such as "`app db`.*".
+// The database and the table are quoted with backticks unless they are "*".
+const targetPattern = "(`(?:[^`]|``)+`|\\*)\\.(`(?:[^`]|``)+`|\\*)"
+
+var (
+	grantPattern  = regexp.MustCompile(`^GRANT (.+) ON ` + targetPattern + ` TO .+?( WITH GRANT OPTION)?$`)
+	revokePattern = regexp.MustCompile(`^REVOKE (.+) ON ` + targetPattern + ` FROM .+$`)
+	proxyPattern  = regexp.MustCompile(`^GRANT PROXY ON .+ TO .+$`)
+)
+
+// userGrants is the privileges of a user considered by the reconciliation.
+// Column privileges and the grant option on targets other than `*.*` are not considered.
+type userGrants struct {
+	global      map[string]bool
+	grantOption bool
+	proxy       bool
+
+	// targets is the privileges granted on databases or tables such as "app.*".
+	targets map[string]map[string]bool
+
+	// revoked is the partially revoked privileges for each target such as "mysql.*".
+	revoked map[string]map[string]bool
+}
+
+// privilegeDrift is the difference between the declared and the actual privileges of a user.
+type privilegeDrift struct {
+	user       string
+	host       string
+	missing    []string
+	extra      []string
+	statements []string
+
+	// attributes is the account attributes different from the declared ones.
+	attributes []string
+	// pluginChanged is true if the authentication plugin differs.
+	// It is corrected with the password instead of `statements`.
+	pluginChanged bool
+
+	// userMissing is true if the user does not exist.
+	// The user is created by ensureMySQLUser instead of `statements`.
+	userMissing bool
+	setting     UserSetting
+}
+
+func (d *privilegeDrift) empty() bool {
+	return !d.userMissing && !d.pluginChanged && len(d.statements) == 0
+}
+
+func (s agentService) ReconcilePrivileges(ctx context.Context, req *proto.ReconcilePrivilegesRequest) (*proto.ReconcilePrivilegesResponse, error) {
+	drifts, applied, err := s.agent.ReconcilePrivileges(ctx, !req.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	res := &proto.ReconcilePrivilegesResponse{Applied: applied}
+	for _, d := range drifts {
+		res.Drifts = append(res.Drifts, &proto.PrivilegeDrift{
+			User:        d.user,
+			Host:        d.host,
+			Missing:     d.missing,
+			Extra:       d.extra,
+			Statements:  d.statements,
+			UserMissing: d.userMissing,
+			Attributes:  d.attributes,
+		})
+	}
+	return res, nil
+}
+
+// ReconcilePrivileges compares the privileges of MOCO users and custom users with their settings,
+// and corrects them if `apply` is true.  Missing users are created.
+// The correction is skipped on a read-only instance because grants are replicated from the primary.
+// It returns the users whose privileges have drifted and whether the correction is applied.
+func (a *Agent) ReconcilePrivileges(ctx context.Context, apply bool) ([]*privilegeDrift, bool, error) {
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	// moco-agent is not allowed to grant privileges.
+	db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, a.userPassword(mocoagent.AdminUser), a.mysqlSocketPath)
+	if err != nil {
+		return nil, false, mysqlStatusError(codes.Internal, err, "failed to connect to mysqld through "+a.mysqlSocketPath)
+	}
+	defer db.Close()
+
+	var drifts []*privilegeDrift
+	for _, u := range a.managedUsers() {
+		d, err := checkPrivilegeDrift(ctx, db, u)
+		if err != nil {
+			return nil, false, mysqlStatusError(codes.Internal, err, "failed to check privileges of "+u.name)
+		}
+		metrics.PrivilegeDrifts.WithLabelValues(u.name).Set(float64(len(d.missing) + len(d.extra) + len(d.attributes)))
+		if d.empty() {
+			continue
+		}
+		logger.Info("privileges have drifted", "user", u.name, "host", d.host, "missing", d.missing, "extra", d.extra, "attributes", d.attributes)
+		drifts = append(drifts, d)
+	}
+	if !apply || len(drifts) == 0 {
+		return drifts, false, nil
+	}
+
+	var readOnly bool
+	if err := db.GetContext(ctx, &readOnly, `SELECT @@read_only`); err != nil {
+		return nil, false, mysqlStatusError(codes.Internal, err, "failed to get read_only")
+	}
+	if readOnly {
+		logger.Info("skipped correcting privileges on a read-only instance")
+		return drifts, false, nil
+	}
+	if slices.ContainsFunc(drifts, func(d *privilegeDrift) bool { return len(d.setting.revokePrivileges) > 0 }) {
+		if err := checkPartialRevokes(ctx, db); err != nil {
+			return drifts, false, status.Errorf(codes.FailedPrecondition, "%+v", err)
+		}
+	}
+
+	for _, d := range drifts {
+		if d.userMissing || d.pluginChanged {
+			pwd, err := a.passwordOf(d.setting)
+			if err != nil {
+				return drifts, false, status.Errorf(codes.Internal, "failed to read the password of %s: %+v", d.user, err)
+			}
+			if d.userMissing {
+				if err := ensureMySQLUser(ctx, db, d.setting, pwd, false); err != nil {
+					return drifts, false, mysqlStatusError(codes.Internal, err, "failed to create "+d.user)
+				}
+				logger.Info("created user", "user", d.user, "host", d.host)
+				metrics.PrivilegeDrifts.WithLabelValues(d.user).Set(0)
+				continue
+			}
+			stmt := fmt.Sprintf(`ALTER USER ?@? IDENTIFIED WITH %s BY ?`, d.setting.authPlugin)
+			if _, err := db.ExecContext(ctx, stmt, d.user, d.host, pwd); err != nil {
+				return drifts, false, mysqlStatusError(codes.Internal, err, "failed to change the authentication plugin of "+d.user)
+			}
+			logger.Info("changed the authentication plugin", "user", d.user, "plugin", d.setting.authPlugin)
+		}
+		for _, stmt := range d.statements {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return drifts, false, mysqlStatusError(codes.Internal, err, "failed to correct privileges of "+d.user)
+			}
+			logger.Info("corrected privileges", "user", d.user, "statement", stmt)
+		}
+		metrics.PrivilegeDrifts.WithLabelValues(d.user).Set(0)
+	}
+	return drifts, true, nil
+}
+
+// RunPrivilegeCheck calls ReconcilePrivileges at every `interval` until `ctx` is canceled.
+// This should be called as a goroutine.
+func (a *Agent) RunPrivilegeCheck(ctx context.Context, interval time.Duration, apply bool) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		if _, _, err := a.ReconcilePrivileges(ctx, apply); err != nil {
+			a.logger.Error(err, "failed to reconcile privileges")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// GrantMissingPrivileges grants the global privileges declared for MOCO users but not granted yet.
+// MOCO users created by an older moco-agent lack the privileges added later because Init runs only
+// on a fresh instance.  Unlike ReconcilePrivileges, no privileges are revoked.
+// The grant is skipped on a read-only instance because grants are replicated from the primary.
+// It returns true if no privileges are missing.
+func (a *Agent) GrantMissingPrivileges(ctx context.Context) (bool, error) {
+	db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, a.userPassword(mocoagent.AdminUser), a.mysqlSocketPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to mysqld through %s: %w", a.mysqlSocketPath, err)
+	}
+	defer db.Close()
+
+	missing := make(map[string][]string)
+	for _, u := range Users {
+		privileges, err := missingGlobalPrivileges(ctx, db, u)
+		if err != nil {
+			return false, fmt.Errorf("failed to check privileges of %s: %w", u.name, err)
+		}
+		if len(privileges) > 0 {
+			missing[u.name] = privileges
+		}
+	}
+	if len(missing) == 0 {
+		return true, nil
+	}
+
+	var readOnly bool
+	if err := db.GetContext(ctx, &readOnly, `SELECT @@read_only`); err != nil {
+		return false, fmt.Errorf("failed to get read_only: %w", err)
+	}
+	if readOnly {
+		return false, nil
+	}
+
+	for _, u := range Users {
+		privileges := missing[u.name]
+		if len(privileges) == 0 {
+			continue
+		}
+		stmt := fmt.Sprintf(`GRANT %s ON *.* TO %s`, strings.Join(privileges, ","), u.account())
+		if u.withGrantOption {
+			stmt += " WITH GRANT OPTION"
+		}
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return false, fmt.Errorf("failed to grant privileges to %s: %w", u.name, err)
+		}
+		a.logger.Info("granted missing privileges", "user", u.name, "privileges", privileges)
+	}
+	return true, nil
+}
+
+// RunGrantMissingPrivileges calls GrantMissingPrivileges at every `interval` until no privileges are missing
+// or `ctx` is canceled.  This should be called as a goroutine.
+func (a *Agent) RunGrantMissingPrivileges(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		done, err := a.GrantMissingPrivileges(ctx)
+		if err != nil {
+			a.logger.Error(err, "failed to grant missing privileges")
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// missingGlobalPrivileges returns the privileges on `*.*` declared for `user` but not granted.
+// It returns nil if the user does not exist.
+func missingGlobalPrivileges(ctx context.Context, db *sqlx.DB, user UserSetting) ([]string, error) {
+	attrs, err := getAccountAttributes(ctx, db, user.name, user.accountHost())
+	if err != nil {
+		return nil, err
+	}
+	if attrs == nil {
+		return nil, nil
+	}
+
+	var all []string
+	if slices.Contains(user.privileges, "ALL") {
+		all, err = listAllPrivileges(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var lines []string
+	if err := db.SelectContext(ctx, &lines, `SHOW GRANTS FOR ?@?`, user.name, user.accountHost()); err != nil {
+		return nil, fmt.Errorf("failed to show grants: %w", err)
+	}
+	actual := parseGrants(lines)
+
+	var missing []string
+	for _, p := range sortedKeys(declaredGrants(user, all).global) {
+		if !actual.global[p] {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+func checkPrivilegeDrift(ctx context.Context, db *sqlx.DB, user UserSetting) (*privilegeDrift, error) {
+	var all []string
+	if slices.Contains(user.privileges, "ALL") {
+		var err error
+		all, err = listAllPrivileges(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	attrs, err := getAccountAttributes(ctx, db, user.name, user.accountHost())
+	if err != nil {
+		return nil, err
+	}
+	if attrs == nil {
+		d := diffGrants(user, declaredGrants(user, all), parseGrants(nil))
+		d.userMissing = true
+		d.missing = append([]string{"USER " + user.account()}, d.missing...)
+		d.statements = append([]string{"CREATE USER " + user.account()}, d.statements...)
+		return d, nil
+	}
+
+	var lines []string
+	if err := db.SelectContext(ctx, &lines, `SHOW GRANTS FOR ?@?`, user.name, user.accountHost()); err != nil {
+		return nil, fmt.Errorf("failed to show grants: %w", err)
+	}
+	d := diffGrants(user, declaredGrants(user, all), parseGrants(lines))
+	var alter string
+	d.attributes, alter, d.pluginChanged = diffAttributes(user.account(), user.accountAttributes, *attrs)
+	if alter != "" {
+		d.statements = append(d.statements, alter)
+	}
+	return d, nil
+}
+
+// listAllPrivileges returns the privileges granted by `GRANT ALL ON *.*`.
+func listAllPrivileges(ctx context.Context, db *sqlx.DB) ([]string, error) {
+	var rows []struct {
+		Privilege string `db:"Privilege"`
+		Context   string `db:"Context"`
+		Comment   string `db:"Comment"`
+	}
+	if err := db.SelectContext(ctx, &rows, `SHOW PRIVILEGES`); err != nil {
+		return nil, fmt.Errorf("failed to show privileges: %w", err)
+	}
+
+	var privileges []string
+	for _, r := range rows {
+		p := strings.ToUpper(r.Privilege)
+		switch p {
+		case "USAGE", "PROXY", "GRANT OPTION":
+			continue
+		}
+		privileges = append(privileges, p)
+	}
+	return privileges, nil
+}
+
+// declaredGrants returns the privileges declared in `user`.
+// `all` is the expansion of "ALL".
+func declaredGrants(user UserSetting, all []string) *userGrants {
+	g := &userGrants{
+		global:      make(map[string]bool),
+		grantOption: user.withGrantOption,
+		proxy:       user.proxyAdmin,
+		targets:     make(map[string]map[string]bool),
+		revoked:     make(map[string]map[string]bool),
+	}
+	for _, p := range user.privileges {
+		if p == "ALL" {
+			for _, a := range all {
+				g.global[a] = true
+			}
+			continue
+		}
+		g.global[p] = true
+	}
+	for target, privileges := range user.targetPrivileges {
+		g.targets[target] = make(map[string]bool)
+		for _, p := range privileges {
+			g.targets[target][p] = true
+		}
+	}
+	for target, privileges := range user.revokePrivileges {
+		g.revoked[target] = make(map[string]bool)
+		for _, p := range privileges {
+			g.revoked[target][p] = true
+		}
+	}
+	return g
+}
+
+// parseGrants parses the output of SHOW GRANTS.
+func parseGrants(lines []string) *userGrants {
+	g := &userGrants{
+		global:  make(map[string]bool),
+		targets: make(map[string]map[string]bool),
+		revoked: make(map[string]map[string]bool),
+	}
+	for _, l := range lines {
+		if proxyPattern.MatchString(l) {
+			g.proxy = true
+			continue
+		}
+		if m := grantPattern.FindStringSubmatch(l); m != nil {
+			target := unquoteIdentifier(m[2]) + "." + unquoteIdentifier(m[3])
+			switch {
+			case target == globalTarget:
+				for _, p := range splitPrivileges(m[1]) {
+					if p != "USAGE" {
+						g.global[p] = true
+					}
+				}
+				if m[4] != "" {
+					g.grantOption = true
+				}
+			case !strings.Contains(m[1], "("):
+				if g.targets[target] == nil {
+					g.targets[target] = make(map[string]bool)
+				}
+				for _, p := range splitPrivileges(m[1]) {
+					switch p {
+					case "USAGE":
+					case "ALL PRIVILEGES":
+						g.targets[target]["ALL"] = true
+					default:
+						g.targets[target][p] = true
+					}
+				}
+			}
+			continue
+		}
+		if m := revokePattern.FindStringSubmatch(l); m != nil {
+			target := unquoteIdentifier(m[2]) + "." + unquoteIdentifier(m[3])
+			if g.revoked[target] == nil {
+				g.revoked[target] = make(map[string]bool)
+			}
+			for _, p := range splitPrivileges(m[1]) {
+				g.revoked[target][p] = true
+			}
+		}
+	}
+	return g
+}
+
+// unquoteIdentifier removes the backticks quoting `s`.  "*" is returned as is.
+func unquoteIdentifier(s string) string {
+	if s == "*" {
+		return s
+	}
+	return strings.ReplaceAll(s[1:len(s)-1], "``", "`")
+}
+
+func splitPrivileges(s string) []string {
+	fields := strings.Split(s, ",")
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+	}
+	return fields
+}
+
+// diffGrants returns the difference from `declared` to `actual`, and the statements to correct it.
+func diffGrants(user UserSetting, declared, actual *userGrants) *privilegeDrift {
+	d := &privilegeDrift{user: user.name, host: user.accountHost(), setting: user}
+	account := user.account()
+
+	var missing, extra []string
+	for _, p := range sortedKeys(declared.global) {
+		if !actual.global[p] {
+			missing = append(missing, p)
+		}
+	}
+	for _, p := range sortedKeys(actual.global) {
+		if !declared.global[p] {
+			extra = append(extra, p)
+		}
+	}
+	for _, p := range missing {
+		d.missing = append(d.missing, p+" ON "+globalTarget)
+	}
+	for _, p := range extra {
+		d.extra = append(d.extra, p+" ON "+globalTarget)
+	}
+
+	if len(extra) > 0 {
+		d.statements = append(d.statements, fmt.Sprintf(`REVOKE %s ON *.* FROM %s`, strings.Join(extra, ","), account))
+	}
+	switch {
+	case declared.grantOption && !actual.grantOption:
+		d.missing = append(d.missing, "GRANT OPTION ON "+globalTarget)
+		// Grant all the privileges again since the grant option of dynamic privileges is per privilege.
+		d.statements = append(d.statements, fmt.Sprintf(`GRANT %s ON *.* TO %s WITH GRANT OPTION`, strings.Join(sortedKeys(declared.global), ","), account))
+	case len(missing) > 0:
+		stmt := fmt.Sprintf(`GRANT %s ON *.* TO %s`, strings.Join(missing, ","), account)
+		if declared.grantOption {
+			stmt += " WITH GRANT OPTION"
+		}
+		d.statements = append(d.statements, stmt)
+	}
+	if !declared.grantOption && actual.grantOption {
+		d.extra = append(d.extra, "GRANT OPTION ON "+globalTarget)
+		d.statements = append(d.statements, fmt.Sprintf(`REVOKE GRANT OPTION ON *.* FROM %s`, account))
+	}
+
+	granted := make(map[string]bool)
+	for t := range declared.targets {
+		granted[t] = true
+	}
+	for t := range actual.targets {
+		granted[t] = true
+	}
+	for _, t := range sortedKeys(granted) {
+		var toGrant, toRevoke []string
+		for _, p := range sortedKeys(declared.targets[t]) {
+			if !actual.targets[t][p] {
+				toGrant = append(toGrant, p)
+			}
+		}
+		for _, p := range sortedKeys(actual.targets[t]) {
+			if !declared.targets[t][p] {
+				toRevoke = append(toRevoke, p)
+			}
+		}
+		for _, p := range toGrant {
+			d.missing = append(d.missing, p+" ON "+t)
+		}
+		for _, p := range toRevoke {
+			d.extra = append(d.extra, p+" ON "+t)
+		}
+		if len(toRevoke) > 0 {
+			d.statements = append(d.statements, fmt.Sprintf(`REVOKE %s ON %s FROM %s`, strings.Join(toRevoke, ","), quoteTarget(t), account))
+		}
+		if len(toGrant) > 0 {
+			d.statements = append(d.statements, fmt.Sprintf(`GRANT %s ON %s TO %s`, strings.Join(toGrant, ","), quoteTarget(t), account))
+		}
+	}
+
+	targets := make(map[string]bool)
+	for t := range declared.revoked {
+		targets[t] = true
+	}
+	for t := range actual.revoked {
+		targets[t] = true
+	}
+	for _, t := range sortedKeys(targets) {
+		var toRevoke, toGrant []string
+		for _, p := range sortedKeys(declared.revoked[t]) {
+			if !actual.revoked[t][p] {
+				toRevoke = append(toRevoke, p)
+			}
+		}
+		for _, p := range sortedKeys(actual.revoked[t]) {
+			// Revoking a global privilege removes its partial revokes as well.
+			if !declared.revoked[t][p] && declared.global[p] {
+				toGrant = append(toGrant, p)
+			}
+		}
+		if len(toRevoke) > 0 {
+			d.missing = append(d.missing, fmt.Sprintf("REVOKE %s ON %s", strings.Join(toRevoke, ","), t))
+			d.statements = append(d.statements, fmt.Sprintf(`REVOKE %s ON %s FROM %s`, strings.Join(toRevoke, ","), quoteTarget(t), account))
+		}
+		if len(toGrant) > 0 {
+			d.extra = append(d.extra, fmt.Sprintf("REVOKE %s ON %s", strings.Join(toGrant, ","), t))
+			d.statements = append(d.statements, fmt.Sprintf(`GRANT %s ON %s TO %s`, strings.Join(toGrant, ","), quoteTarget(t), account))
+		}
+	}
+
+	switch {
+	case declared.proxy && !actual.proxy:
+		d.missing = append(d.missing, "PROXY ON ''@''")
+		d.statements = append(d.statements, fmt.Sprintf(`GRANT PROXY ON ''@'' TO %s WITH GRANT OPTION`, account))
+	case !declared.proxy && actual.proxy:
+		d.extra = append(d.extra, "PROXY ON ''@''")
+		d.statements = append(d.statements, fmt.Sprintf(`REVOKE PROXY ON ''@'' FROM %s`, account))
+	}
+	return d
+}
+
+// quoteTarget quotes the database and table names of `target` such as "app.*".
+func quoteTarget(target string) string {
+	db, table, _ := strings.Cut(target, ".")
+	quote := func(s string) string {
+		if s == "*" {
+			return s
+		}
+		return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+	}
+	return quote(db) + "." + quote(table)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	return slices.Sorted(maps.Keys(m))
+}
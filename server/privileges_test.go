@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("privileges", func() {
+	It("should compute the minimal statements to correct drifts", func() {
+		user := UserSetting{
+			name:       "test",
+			privileges: []string{"RELOAD", "SELECT", "BINLOG_ADMIN"},
+			revokePrivileges: map[string][]string{
+				"mysql.*": {"SELECT"},
+			},
+		}
+		actual := parseGrants([]string{
+			"GRANT SELECT, RELOAD ON *.* TO `test`@`%`",
+			"GRANT BINLOG_ADMIN ON *.* TO `test`@`%`",
+			"REVOKE SELECT ON `mysql`.* FROM `test`@`%`",
+		})
+		d := diffGrants(user, declaredGrants(user, nil), actual)
+		Expect(d.missing).To(BeEmpty())
+		Expect(d.extra).To(BeEmpty())
+		Expect(d.statements).To(BeEmpty())
+
+		actual = parseGrants([]string{
+			"GRANT SELECT, PROCESS ON *.* TO `test`@`%` WITH GRANT OPTION",
+			"GRANT BINLOG_ADMIN,CLONE_ADMIN ON *.* TO `test`@`%` WITH GRANT OPTION",
+			"GRANT PROXY ON ``@`` TO `test`@`%` WITH GRANT OPTION",
+		})
+		d = diffGrants(user, declaredGrants(user, nil), actual)
+		Expect(d.missing).To(Equal([]string{"RELOAD ON *.*", "REVOKE SELECT ON mysql.*"}))
+		Expect(d.extra).To(Equal([]string{"CLONE_ADMIN ON *.*", "PROCESS ON *.*", "GRANT OPTION ON *.*", "PROXY ON ''@''"}))
+		Expect(d.statements).To(Equal([]string{
+			"REVOKE CLONE_ADMIN,PROCESS ON *.* FROM 'test'@'%'",
+			"GRANT RELOAD ON *.* TO 'test'@'%'",
+			"REVOKE GRANT OPTION ON *.* FROM 'test'@'%'",
+			"REVOKE SELECT ON `mysql`.* FROM 'test'@'%'",
+			"REVOKE PROXY ON ''@'' FROM 'test'@'%'",
+		}))
+	})
+
+	It("should restore the grant option and partial revokes", func() {
+		user := UserSetting{
+			name:            "test",
+			privileges:      []string{"ALL"},
+			proxyAdmin:      true,
+			withGrantOption: true,
+		}
+		all := []string{"SELECT", "INSERT", "BACKUP_ADMIN"}
+		actual := parseGrants([]string{
+			"GRANT SELECT, INSERT ON *.* TO `test`@`%`",
+			"GRANT BACKUP_ADMIN ON *.* TO `test`@`%`",
+			"REVOKE INSERT ON `mysql`.* FROM `test`@`%`",
+			"REVOKE UPDATE ON `sys`.* FROM `test`@`%`",
+		})
+		d := diffGrants(user, declaredGrants(user, all), actual)
+		Expect(d.missing).To(Equal([]string{"GRANT OPTION ON *.*", "PROXY ON ''@''"}))
+		Expect(d.extra).To(Equal([]string{"REVOKE INSERT ON mysql.*"}))
+		Expect(d.statements).To(Equal([]string{
+			"GRANT BACKUP_ADMIN,INSERT,SELECT ON *.* TO 'test'@'%' WITH GRANT OPTION",
+			"GRANT INSERT ON `mysql`.* TO 'test'@'%'",
+			"GRANT PROXY ON ''@'' TO 'test'@'%' WITH GRANT OPTION",
+		}))
+	})
+
+	It("should reconcile the privileges on databases and tables", func() {
+		user := UserSetting{
+			name: "app",
+			host: "10.%",
+			targetPrivileges: map[string][]string{
+				"app.*":     {"SELECT", "INSERT"},
+				"other.tbl": {"ALL"},
+			},
+		}
+		actual := parseGrants([]string{
+			"GRANT USAGE ON *.* TO `app`@`10.%`",
+			"GRANT SELECT, DELETE ON `app`.* TO `app`@`10.%`",
+			"GRANT ALL PRIVILEGES ON `other`.`tbl` TO `app`@`10.%`",
+			"GRANT SELECT (`c1`) ON `other`.`t2` TO `app`@`10.%`",
+		})
+		d := diffGrants(user, declaredGrants(user, nil), actual)
+		Expect(d.host).To(Equal("10.%"))
+		Expect(d.missing).To(Equal([]string{"INSERT ON app.*"}))
+		Expect(d.extra).To(Equal([]string{"DELETE ON app.*"}))
+		Expect(d.statements).To(Equal([]string{
+			"REVOKE DELETE ON `app`.* FROM 'app'@'10.%'",
+			"GRANT INSERT ON `app`.* TO 'app'@'10.%'",
+		}))
+	})
+
+	It("should quote the databases of partial revokes", func() {
+		user := UserSetting{
+			name:             "app",
+			privileges:       []string{"SELECT", "INSERT"},
+			revokePrivileges: map[string][]string{"app-db.*": {"INSERT"}},
+		}
+		actual := parseGrants([]string{
+			"GRANT SELECT, INSERT ON *.* TO `app`@`%`",
+		})
+		d := diffGrants(user, declaredGrants(user, nil), actual)
+		Expect(d.missing).To(Equal([]string{"REVOKE INSERT ON app-db.*"}))
+		Expect(d.statements).To(Equal([]string{"REVOKE INSERT ON `app-db`.* FROM 'app'@'%'"}))
+
+		d = diffGrants(user, declaredGrants(user, nil), parseGrants([]string{
+			"GRANT SELECT, INSERT ON *.* TO `app`@`%`",
+			"REVOKE INSERT ON `app-db`.* FROM `app`@`%`",
+		}))
+		Expect(d.statements).To(BeEmpty())
+	})
+
+	It("should parse quoted identifiers containing spaces and backticks", func() {
+		user := UserSetting{
+			name:             "app",
+			privileges:       []string{"SELECT", "INSERT"},
+			targetPrivileges: map[string][]string{"app db.*": {"UPDATE"}},
+			revokePrivileges: map[string][]string{"a`b.*": {"INSERT"}},
+		}
+		actual := parseGrants([]string{
+			"GRANT SELECT, INSERT ON *.* TO `app`@`%`",
+			"GRANT UPDATE ON `app db`.* TO `app`@`%`",
+			"GRANT DELETE ON `app db`.`my table` TO `app`@`%`",
+			"REVOKE INSERT ON `a``b`.* FROM `app`@`%`",
+		})
+		Expect(actual.targets).To(Equal(map[string]map[string]bool{
+			"app db.*":        {"UPDATE": true},
+			"app db.my table": {"DELETE": true},
+		}))
+		Expect(actual.revoked).To(Equal(map[string]map[string]bool{"a`b.*": {"INSERT": true}}))
+
+		d := diffGrants(user, declaredGrants(user, nil), actual)
+		Expect(d.missing).To(BeEmpty())
+		Expect(d.extra).To(Equal([]string{"DELETE ON app db.my table"}))
+		Expect(d.statements).To(Equal([]string{"REVOKE DELETE ON `app db`.`my table` FROM 'app'@'%'"}))
+	})
+
+	It("should reconcile the privileges of MOCO users", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		By("checking no drift just after initialization")
+		drifts, applied, err := agent.ReconcilePrivileges(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(BeEmpty())
+		Expect(applied).To(BeFalse())
+
+		By("changing privileges manually")
+		db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, adminUserPassword, sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		_, err = db.Exec(`SET GLOBAL super_read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`REVOKE CLONE_ADMIN ON *.* FROM ?@'%'`, mocoagent.AgentUser)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`GRANT PROCESS ON *.* TO ?@'%'`, mocoagent.ReplicationUser)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`GRANT INSERT ON mysql.* TO ?@'%'`, mocoagent.WritableUser)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("reporting the drifts in the dry-run mode")
+		drifts, applied, err = agent.ReconcilePrivileges(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(BeFalse())
+		Expect(drifts).To(HaveLen(3))
+		Expect(drifts[0].user).To(Equal(mocoagent.AgentUser))
+		Expect(drifts[0].missing).To(Equal([]string{"CLONE_ADMIN ON *.*"}))
+		Expect(drifts[1].user).To(Equal(mocoagent.ReplicationUser))
+		Expect(drifts[1].extra).To(Equal([]string{"PROCESS ON *.*"}))
+		Expect(drifts[2].user).To(Equal(mocoagent.WritableUser))
+		Expect(drifts[2].missing).To(Equal([]string{"REVOKE INSERT ON mysql.*"}))
+
+		By("correcting the drifts")
+		drifts, applied, err = agent.ReconcilePrivileges(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(BeTrue())
+		Expect(drifts).To(HaveLen(3))
+
+		drifts, _, err = agent.ReconcilePrivileges(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(BeEmpty())
+
+		By("skipping the correction on a read-only instance")
+		_, err = db.Exec(`REVOKE CLONE_ADMIN ON *.* FROM ?@'%'`, mocoagent.AgentUser)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`SET GLOBAL super_read_only=1`)
+		Expect(err).NotTo(HaveOccurred())
+		drifts, applied, err = agent.ReconcilePrivileges(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(BeFalse())
+		Expect(drifts).To(HaveLen(1))
+	})
+
+	It("should grant the missing privileges of MOCO users without revoking others", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		By("doing nothing just after initialization")
+		done, err := agent.GrantMissingPrivileges(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeTrue())
+
+		By("emulating users created by an older moco-agent")
+		db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, adminUserPassword, sockFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		_, err = db.Exec(`SET GLOBAL super_read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`REVOKE REPLICATION SLAVE, REPLICATION_SLAVE_ADMIN ON *.* FROM ?@'%'`, mocoagent.AgentUser)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(`GRANT PROCESS ON *.* TO ?@'%'`, mocoagent.ReplicationUser)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("skipping the grant on a read-only instance")
+		_, err = db.Exec(`SET GLOBAL super_read_only=1`)
+		Expect(err).NotTo(HaveOccurred())
+		done, err = agent.GrantMissingPrivileges(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+
+		By("granting the missing privileges on a writable instance")
+		_, err = db.Exec(`SET GLOBAL super_read_only=0`)
+		Expect(err).NotTo(HaveOccurred())
+		done, err = agent.GrantMissingPrivileges(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeTrue())
+
+		drifts, _, err := agent.ReconcilePrivileges(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(HaveLen(1))
+		Expect(drifts[0].user).To(Equal(mocoagent.ReplicationUser))
+		Expect(drifts[0].extra).To(Equal([]string{"PROCESS ON *.*"}))
+	})
+})
@@ -12,7 +12,7 @@ import (
 
 // RotateLog rotates log file
 func (a *Agent) RotateLog() {
-	ctx := context.Background()
+	ctx := WithPoolClass(context.Background(), PoolRotation)
 
 	metrics.LogRotationCount.Inc()
 	startTime := time.Now()
@@ -25,7 +25,7 @@ func (a *Agent) RotateLog() {
 		return
 	}
 
-	if _, err := a.db.ExecContext(ctx, "FLUSH LOCAL SLOW LOGS"); err != nil {
+	if err := a.mysql.FlushSlowLogs(ctx); err != nil {
 		a.logger.Error(err, "failed to exec FLUSH LOCAL SLOW LOGS")
 		metrics.LogRotationFailureCount.Inc()
 		return
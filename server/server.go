@@ -1,13 +1,16 @@
 package server
 
 import (
+	"crypto/tls"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/credential"
 	"github.com/cybozu-go/moco-agent/metrics"
 	"github.com/cybozu-go/moco-agent/proto"
 	"github.com/go-logr/logr"
-	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -23,36 +26,93 @@ type agentService struct {
 
 // New returns an Agent
 func New(config MySQLAccessorConfig, clusterName, socket, logDir string, maxDelay, transactionQueueingWait time.Duration, logger logr.Logger) (*Agent, error) {
-	db, err := getMySQLConn(config)
+	a := newAgent(socket, logDir, maxDelay, transactionQueueingWait, logger)
+	a.config = config
+	a.passwords[mocoagent.AgentUser] = config.Password
+
+	// The passwords may have been changed while the agent was stopped.  Log in with the ones
+	// recorded by the previous agent, and let RunPasswordRotation apply the new ones.
+	recorded, err := a.loadPasswords()
+	if err != nil {
+		logger.Error(err, "failed to load the recorded passwords")
+	}
+	for user, pwd := range recorded {
+		a.passwords[user] = pwd
+	}
+
+	mysql, err := NewMySQLAccessor(config, socket, a.userPassword)
+	if UserNotExists(err) && a.userPassword(mocoagent.AgentUser) != config.Password {
+		// The recorded password may have been discarded by a rotation on the primary.
+		logger.Info("the recorded password is rejected; retrying with the given one")
+		a.passwords[mocoagent.AgentUser] = config.Password
+		mysql, err = NewMySQLAccessor(config, socket, a.userPassword)
+	}
 	if err != nil {
 		return nil, err
 	}
+	a.mysql = mysql
 
+	a.passwordMu.Lock()
+	a.savePasswords()
+	a.passwordMu.Unlock()
+	return a, nil
+}
+
+// NewWithAccessor returns an Agent operating mysqld through `mysql`.
+// `config` is used for the connections not made by `mysql` such as those to clone donors.
+func NewWithAccessor(config MySQLAccessorConfig, mysql MySQLAccessor, clusterName, socket, logDir string, maxDelay, transactionQueueingWait time.Duration, logger logr.Logger) *Agent {
+	a := newAgent(socket, logDir, maxDelay, transactionQueueingWait, logger)
+	a.config = config
+	a.passwords[mocoagent.AgentUser] = config.Password
+	a.mysql = mysql
+	return a
+}
+
+func newAgent(socket, logDir string, maxDelay, transactionQueueingWait time.Duration, logger logr.Logger) *Agent {
 	return &Agent{
-		config:                  config,
-		db:                      db,
 		logger:                  logger,
 		mysqlSocketPath:         socket,
 		logDir:                  logDir,
 		maxDelayThreshold:       maxDelay,
 		transactionQueueingWait: transactionQueueingWait,
 		cloneLock:               make(chan struct{}, 1),
-	}, nil
+		credentials:             credential.Env{},
+		passwords:               make(map[string]string),
+	}
 }
 
 // Agent is the agent to executes some MySQL commands of the own Pod
 type Agent struct {
 	config                  MySQLAccessorConfig
-	db                      *sqlx.DB
+	mysql                   MySQLAccessor
 	logger                  logr.Logger
 	mysqlSocketPath         string
 	logDir                  string
 	maxDelayThreshold       time.Duration
 	transactionQueueingWait time.Duration
 
+	archiver atomic.Pointer[BinlogArchiver]
+
+	cloneLocalDir  string
+	cloneLocalKeep int
+
+	cloneOp      cloneOperation
 	cloneLock    chan struct{}
+	binlogLock   sync.Mutex
 	registryLock sync.Mutex
 	registered   bool
+
+	backupLockMu sync.Mutex
+	backupLock   *backupLock
+
+	credentials credential.Provider
+	passwordMu  sync.RWMutex
+	passwords   map[string]string
+
+	customUsers        []UserSetting
+	mocoUserAttributes map[string]accountAttributes
+
+	pluginConfig *PluginConfig
 }
 
 func (a *Agent) configureReplicationMetrics(enable bool) {
@@ -82,8 +142,26 @@ type MySQLAccessorConfig struct {
 	ConnMaxIdleTime   time.Duration
 	ConnectionTimeout time.Duration
 	ReadTimeout       time.Duration
+
+	// UseSocket makes the connections over the UNIX domain socket of mysqld.
+	// TCP to Host and Port is used only when the socket is not connectable.
+	UseSocket bool
+
+	// TLSConfig returns the TLS configuration of the connections.  nil disables TLS.
+	// It is called for each new connection so that reloaded certificates are used.
+	// The certificate of mysqld is verified for Host.
+	TLSConfig func() *tls.Config
+
+	// RequireTLS makes connections fail if mysqld does not support TLS.
+	RequireTLS bool
+
+	// Pools is the configuration of the connection pool for each workload class.
+	// The pools not in the map retain one idle connection with no limit of open connections.
+	Pools map[PoolClass]PoolConfig
 }
 
+// CloseDB releases the backup lock if held and closes the connection to mysqld.
 func (a *Agent) CloseDB() error {
-	return a.db.Close()
+	a.releaseBackupLock("")
+	return a.mysql.Close()
 }
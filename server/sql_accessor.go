@@ -0,0 +1,389 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	mocoagent "github.com/cybozu-go/moco-agent"
+	"github.com/cybozu-go/moco-agent/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+var variableNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// sqlAccessor is MySQLAccessor executing SQL statements as moco-agent.
+type sqlAccessor struct {
+	pools    map[PoolClass]*sqlx.DB
+	configs  map[PoolClass]PoolConfig
+	socket   string
+	password func(user string) string
+
+	// flavor is the flavor of mysqld cached until a new connection is made.
+	flavor atomic.Pointer[serverFlavor]
+}
+
+var _ MySQLAccessor = &sqlAccessor{}
+
+// NewMySQLAccessor returns MySQLAccessor connecting to mysqld as moco-agent.
+// `socket` is used for the operations that need another connection such as CLONE INSTANCE,
+// and for the pool itself if `config.UseSocket` is true.
+// `password` is called to get the current password of MOCO users because passwords may be rotated.
+//
+// The returned MySQLAccessor has a connection pool for each PoolClass and uses the one for the class of the context.
+func NewMySQLAccessor(config MySQLAccessorConfig, socket string, password func(user string) string) (MySQLAccessor, error) {
+	s := &sqlAccessor{
+		pools:    make(map[PoolClass]*sqlx.DB),
+		configs:  make(map[PoolClass]PoolConfig),
+		socket:   socket,
+		password: password,
+	}
+	for _, class := range PoolClasses {
+		pool := config.poolConfig(class)
+		db, err := getMySQLConn(config, pool, socket, func() string {
+			// A new connection may be to mysqld restarted with another version.
+			s.flavor.Store(nil)
+			return password(mocoagent.AgentUser)
+		})
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to connect to mysqld for %s: %w", class, err)
+		}
+		s.pools[class] = db
+		s.configs[class] = pool
+	}
+	metrics.SetPoolStats(s.poolStats)
+	return s, nil
+}
+
+// db returns the connection pool for the class of `ctx`.
+func (s *sqlAccessor) db(ctx context.Context) *sqlx.DB {
+	return s.pools[poolClassFromContext(ctx)]
+}
+
+func (s *sqlAccessor) poolStats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats)
+	for class, db := range s.pools {
+		stats[string(class)] = db.Stats()
+	}
+	return stats
+}
+
+func (s *sqlAccessor) getFlavor(ctx context.Context) (*serverFlavor, error) {
+	if f := s.flavor.Load(); f != nil {
+		return f, nil
+	}
+	f, err := detectFlavor(ctx, s.db(ctx))
+	if err != nil {
+		return nil, err
+	}
+	s.flavor.Store(f)
+	return f, nil
+}
+
+func (s *sqlAccessor) Ping(ctx context.Context) error {
+	rows, err := s.db(ctx).QueryxContext(ctx, `SELECT VERSION()`)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+func (s *sqlAccessor) GetGlobalVariables(ctx context.Context) (*MySQLGlobalVariablesStatus, error) {
+	status := &MySQLGlobalVariablesStatus{}
+	flavor, err := s.getFlavor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The semi-sync variables are renamed if rpl_semi_sync_source is installed instead of rpl_semi_sync_master.
+	query, args, err := sqlx.In(`SELECT @@read_only, @@super_read_only, @@clone_valid_donor_list,
+  IFNULL((SELECT VARIABLE_VALUE FROM performance_schema.global_variables WHERE VARIABLE_NAME IN (?) LIMIT 1), 0)
+  AS `+"`@@rpl_semi_sync_master_wait_for_slave_count`", flavor.semiSyncWaitCountVariables())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db(ctx).GetContext(ctx, status, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get global variable: %w", err)
+	}
+	return status, nil
+}
+
+func (s *sqlAccessor) GetCloneState(ctx context.Context) (*MySQLCloneStateStatus, error) {
+	status := &MySQLCloneStateStatus{}
+	err := s.db(ctx).GetContext(ctx, status, `SELECT state FROM performance_schema.clone_status`)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &MySQLCloneStateStatus{}, nil
+		}
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *sqlAccessor) GetPrimaryStatus(ctx context.Context) (*MySQLPrimaryStatus, error) {
+	status := &MySQLPrimaryStatus{}
+	flavor, err := s.getFlavor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db(ctx).GetContext(ctx, status, flavor.showBinaryLogStatus()); err != nil {
+		return nil, fmt.Errorf("failed to show binary log status: %w", err)
+	}
+	return status, nil
+}
+
+func (s *sqlAccessor) GetReplicaStatus(ctx context.Context, channel string) (*MySQLReplicaStatus, error) {
+	status := &MySQLReplicaStatus{}
+	flavor, err := s.getFlavor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db(ctx).GetContext(ctx, status, flavor.showReplicaStatus(channel)); err != nil {
+		return nil, fmt.Errorf("failed to show replica status: %w", err)
+	}
+	return status, nil
+}
+
+func (s *sqlAccessor) GetTransactionTimestamps(ctx context.Context) (queued, applied time.Time, uptime time.Duration, err error) {
+	err = s.db(ctx).GetContext(ctx, &queued, `
+SELECT MAX(LAST_QUEUED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP)
+FROM performance_schema.replication_connection_status`)
+	if err != nil {
+		return
+	}
+	err = s.db(ctx).GetContext(ctx, &applied, `
+SELECT MAX(LAST_APPLIED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP)
+FROM performance_schema.replication_applier_status_by_worker`)
+	if err != nil {
+		return
+	}
+	var uptime_seconds_string string
+	err = s.db(ctx).GetContext(ctx, &uptime_seconds_string, `
+SELECT VARIABLE_VALUE
+FROM performance_schema.global_status
+WHERE VARIABLE_NAME='Uptime'`)
+	if err != nil {
+		return
+	}
+	uptime_seconds, err := strconv.Atoi(uptime_seconds_string)
+	if err != nil {
+		return
+	}
+	uptime = time.Second * time.Duration(uptime_seconds)
+	return
+}
+
+func (s *sqlAccessor) GetCloneInstanceInfo(ctx context.Context) (*CloneInstanceInfo, error) {
+	return getCloneInstanceInfo(ctx, s.db(ctx))
+}
+
+func (s *sqlAccessor) GetGlobalVariable(ctx context.Context, name string, dest any) error {
+	if !variableNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid variable name: %q", name)
+	}
+	query := fmt.Sprintf(`SELECT @@global.%s`, name)
+	var err error
+	switch dest := dest.(type) {
+	case *string:
+		var v sql.NullString
+		err = s.db(ctx).GetContext(ctx, &v, query)
+		*dest = v.String
+	case *int64:
+		var v sql.NullInt64
+		err = s.db(ctx).GetContext(ctx, &v, query)
+		*dest = v.Int64
+	case *bool:
+		var v sql.NullBool
+		err = s.db(ctx).GetContext(ctx, &v, query)
+		*dest = v.Bool
+	default:
+		return fmt.Errorf("unsupported type %T for %s", dest, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *sqlAccessor) SetGlobalVariable(ctx context.Context, name string, value any) error {
+	if !variableNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid variable name: %q", name)
+	}
+	if _, err := s.db(ctx).ExecContext(ctx, fmt.Sprintf(`SET GLOBAL %s = ?`, name), value); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *sqlAccessor) ListBinaryLogs(ctx context.Context) ([]BinaryLog, error) {
+	var logs []BinaryLog
+	if err := s.db(ctx).SelectContext(ctx, &logs, `SHOW BINARY LOGS`); err != nil {
+		return nil, fmt.Errorf("failed to show binary logs: %w", err)
+	}
+	return logs, nil
+}
+
+func (s *sqlAccessor) ListBinlogEvents(ctx context.Context, file string, limit int) ([]BinlogEvent, error) {
+	var events []BinlogEvent
+	if err := s.db(ctx).SelectContext(ctx, &events, `SHOW BINLOG EVENTS IN ? LIMIT ?`, file, limit); err != nil {
+		return nil, fmt.Errorf("failed to show binlog events in %s: %w", file, err)
+	}
+	return events, nil
+}
+
+func (s *sqlAccessor) PurgeBinaryLogs(ctx context.Context, file string) error {
+	if _, err := s.db(ctx).ExecContext(ctx, `PURGE BINARY LOGS TO ?`, file); err != nil {
+		return fmt.Errorf("failed to purge binary logs to %s: %w", file, err)
+	}
+	return nil
+}
+
+func (s *sqlAccessor) IsGTIDSubset(ctx context.Context, set, excluded, superset string) (bool, error) {
+	var ok bool
+	if err := s.db(ctx).GetContext(ctx, &ok, `SELECT GTID_SUBSET(GTID_SUBTRACT(?, ?), ?)`, set, excluded, superset); err != nil {
+		return false, fmt.Errorf("failed to compare GTID sets: %w", err)
+	}
+	return ok, nil
+}
+
+func (s *sqlAccessor) FlushSlowLogs(ctx context.Context) error {
+	_, err := s.db(ctx).ExecContext(ctx, "FLUSH LOCAL SLOW LOGS")
+	return err
+}
+
+func (s *sqlAccessor) ChangeReplicationSource(ctx context.Context, source *ReplicationSource) error {
+	flavor, err := s.getFlavor(ctx)
+	if err != nil {
+		return err
+	}
+	sourceSSL := 0
+	if source.SSL {
+		sourceSSL = 1
+	}
+	stmt := flavor.changeReplicationSource([]string{"SOURCE_HOST = ?", "SOURCE_PORT = ?", "SOURCE_USER = ?", "SOURCE_PASSWORD = ?",
+		"SOURCE_AUTO_POSITION = 1", "SOURCE_SSL = ?", "GET_SOURCE_PUBLIC_KEY = 1"}, "")
+	_, err = s.db(ctx).ExecContext(ctx, stmt, source.Host, source.Port, source.User, source.Password, sourceSSL)
+	return err
+}
+
+func (s *sqlAccessor) StartReplica(ctx context.Context) error {
+	_, err := s.db(ctx).ExecContext(ctx, `START REPLICA`)
+	return err
+}
+
+func (s *sqlAccessor) StartRelayLogApplier(ctx context.Context, applier *RelayLogApplier) error {
+	var until string
+	switch {
+	case applier.AfterGTIDs != "" && applier.BeforeGTIDs != "":
+		return errors.New("both AfterGTIDs and BeforeGTIDs are set")
+	case applier.AfterGTIDs != "":
+		until = fmt.Sprintf(" UNTIL SQL_AFTER_GTIDS = '%s'", applier.AfterGTIDs)
+	case applier.BeforeGTIDs != "":
+		until = fmt.Sprintf(" UNTIL SQL_BEFORE_GTIDS = '%s'", applier.BeforeGTIDs)
+	}
+
+	flavor, err := s.getFlavor(ctx)
+	if err != nil {
+		return err
+	}
+	stmt := flavor.changeReplicationSource([]string{fmt.Sprintf("SOURCE_HOST='%s.invalid'", applier.Channel),
+		fmt.Sprintf("RELAY_LOG_FILE='%s'", applier.RelayLogFile), "RELAY_LOG_POS=4"}, applier.Channel)
+	if _, err := s.db(ctx).ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to configure the channel %s: %w", applier.Channel, err)
+	}
+	if _, err := s.db(ctx).ExecContext(ctx, fmt.Sprintf(`START REPLICA SQL_THREAD%s FOR CHANNEL '%s'`, until, applier.Channel)); err != nil {
+		return fmt.Errorf("failed to start the channel %s: %w", applier.Channel, err)
+	}
+	return nil
+}
+
+func (s *sqlAccessor) RemoveReplicationChannel(ctx context.Context, channel string) error {
+	var count int
+	err := s.db(ctx).GetContext(ctx, &count, `SELECT COUNT(*) FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=?`, channel)
+	if err != nil {
+		return fmt.Errorf("failed to get replication channels: %w", err)
+	}
+	if count == 0 {
+		return nil
+	}
+	if _, err := s.db(ctx).ExecContext(ctx, fmt.Sprintf(`STOP REPLICA FOR CHANNEL '%s'`, channel)); err != nil {
+		return fmt.Errorf("failed to stop the channel %s: %w", channel, err)
+	}
+	if _, err := s.db(ctx).ExecContext(ctx, fmt.Sprintf(`RESET REPLICA ALL FOR CHANNEL '%s'`, channel)); err != nil {
+		return fmt.Errorf("failed to reset the channel %s: %w", channel, err)
+	}
+	return nil
+}
+
+func (s *sqlAccessor) CloneInstance(ctx context.Context, source *CloneSource) error {
+	// To clone, the connection should not set timeout values.
+	db, err := GetMySQLConnLocalSocket(mocoagent.AgentUser, s.password(mocoagent.AgentUser), s.socket)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	requireSSL := ""
+	if source.RequireSSL {
+		requireSSL = " REQUIRE SSL"
+	}
+	_, err = db.Exec(`CLONE INSTANCE FROM ?@?:? IDENTIFIED BY ?`+requireSSL, source.User, source.Host, source.Port, source.Password)
+	return err
+}
+
+// alterUser executes ALTER USER as moco-admin because moco-agent is not allowed to alter users.
+func (s *sqlAccessor) alterUser(ctx context.Context, query string, args ...any) error {
+	db, err := GetMySQLConnLocalSocket(mocoagent.AdminUser, s.password(mocoagent.AdminUser), s.socket)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *sqlAccessor) ChangePassword(ctx context.Context, user, host, password string) error {
+	return s.alterUser(ctx, `ALTER USER ?@? IDENTIFIED BY ? RETAIN CURRENT PASSWORD`, user, host, password)
+}
+
+func (s *sqlAccessor) DiscardOldPassword(ctx context.Context, user, host string) error {
+	return s.alterUser(ctx, `ALTER USER ?@? DISCARD OLD PASSWORD`, user, host)
+}
+
+func (s *sqlAccessor) HasRetainedPassword(ctx context.Context, user, host string) (bool, error) {
+	var count int
+	err := s.db(ctx).GetContext(ctx, &count, `SELECT COUNT(*) FROM mysql.user WHERE user=? AND host=? AND JSON_CONTAINS_PATH(User_attributes, 'one', '$.additional_password')`, user, host)
+	if err != nil {
+		return false, fmt.Errorf("failed to select from mysql.user: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *sqlAccessor) CheckPassword(ctx context.Context, user, password string) error {
+	db, err := GetMySQLConnLocalSocket(user, password, s.socket)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func (s *sqlAccessor) ResetConnections() {
+	for class, db := range s.pools {
+		db.SetMaxIdleConns(0)
+		db.SetMaxIdleConns(s.configs[class].MaxIdleConns)
+	}
+}
+
+func (s *sqlAccessor) Close() error {
+	var errs []error
+	for _, db := range s.pools {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
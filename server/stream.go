@@ -0,0 +1,402 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/binlog"
+	"github.com/cybozu-go/moco-agent/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const binlogFollowInterval = 100 * time.Millisecond
+
+func (s agentService) StreamBinlog(req *proto.StreamBinlogRequest, stream proto.Agent_StreamBinlogServer) error {
+	return s.agent.StreamBinlog(stream.Context(), req, stream.Send)
+}
+
+// binlogStream is the state of StreamBinlog.
+type binlogStream struct {
+	req     *proto.StreamBinlogRequest
+	send    func(*proto.StreamBinlogResponse) error
+	gtidSet binlog.GTIDSet
+
+	// position is the position of the first event to be sent in the first file.
+	position int64
+
+	gtid   string
+	skip   bool
+	tables map[uint64]*binlog.TableMap
+}
+
+// StreamBinlog reads binary log files from the disk and passes the events to `send`.
+func (a *Agent) StreamBinlog(ctx context.Context, req *proto.StreamBinlogRequest, send func(*proto.StreamBinlogResponse) error) error {
+	logger := a.logger.WithValues(logging.ExtractFields(ctx)...)
+
+	st := &binlogStream{
+		req:    req,
+		send:   send,
+		tables: make(map[uint64]*binlog.TableMap),
+	}
+	if req.GtidSet != "" {
+		set, err := binlog.ParseGTIDSet(req.GtidSet)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "%+v", err)
+		}
+		st.gtidSet = set
+	}
+
+	logs, err := a.ListBinaryLogs(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+	dir, err := a.binlogDir(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%+v", err)
+	}
+
+	var name string
+	switch {
+	case st.gtidSet != nil:
+		name, err = findBinlogForGTIDSet(dir, logs, st.gtidSet)
+		if err != nil {
+			return err
+		}
+	case req.File != "":
+		if !slices.ContainsFunc(logs, func(l BinaryLog) bool { return l.Name == req.File }) {
+			return status.Errorf(codes.NotFound, "binary log %s is not found", req.File)
+		}
+		name = req.File
+		st.position = req.Position
+	default:
+		name = logs[0].Name
+	}
+
+	logger.Info("start streaming binary logs", "file", name, "position", st.position, "follow", req.Follow)
+	for {
+		idx := slices.IndexFunc(logs, func(l BinaryLog) bool { return l.Name == name })
+		if idx < 0 {
+			return status.Errorf(codes.NotFound, "binary log %s is not found", name)
+		}
+		if logs[idx].Encrypted == "Yes" {
+			return status.Errorf(codes.FailedPrecondition, "binary log %s is encrypted", name)
+		}
+
+		next, err := a.streamBinlogFile(ctx, st, filepath.Join(dir, name), logs[idx], idx == len(logs)-1)
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			return status.Errorf(codes.Internal, "failed to stream %s: %+v", name, err)
+		}
+		st.position = 0
+
+		if next == "" && idx == len(logs)-1 && !req.Follow {
+			return nil
+		}
+
+		// Wait for the next file to appear in the binary log index.
+		for {
+			logs, err = a.ListBinaryLogs(ctx)
+			if err != nil {
+				return status.Errorf(codes.Internal, "%+v", err)
+			}
+			if next == "" {
+				// The file ended without a Rotate event, e.g., by a restart of mysqld.
+				i := slices.IndexFunc(logs, func(l BinaryLog) bool { return l.Name == name })
+				if i >= 0 && i+1 < len(logs) {
+					next = logs[i+1].Name
+				}
+			}
+			if next != "" && slices.ContainsFunc(logs, func(l BinaryLog) bool { return l.Name == next }) {
+				break
+			}
+			if !req.Follow {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			case <-time.After(binlogFollowInterval):
+			}
+		}
+		name = next
+	}
+}
+
+// streamBinlogFile streams the events in a binary log file.
+// It returns the next file name recorded in the Rotate event, or an empty string.
+// The active file is read until a Rotate or Stop event is found if the stream follows new events.
+func (a *Agent) streamBinlogFile(ctx context.Context, st *binlogStream, path string, l BinaryLog, active bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// A new file begins outside transactions.
+	st.skip = false
+
+	var r io.Reader = f
+	var tail *tailReader
+	if active {
+		if st.req.Follow {
+			tail = &tailReader{ctx: ctx, f: f, active: func() (bool, error) {
+				logs, err := a.ListBinaryLogs(ctx)
+				if err != nil {
+					return false, err
+				}
+				return len(logs) > 0 && logs[len(logs)-1].Name == l.Name, nil
+			}}
+			r = tail
+		} else {
+			// The file size in SHOW BINARY LOGS is at the end of the last complete event.
+			r = io.LimitReader(f, l.Size)
+		}
+	}
+
+	br, err := binlog.NewReader(r)
+	if err != nil {
+		return "", err
+	}
+	for {
+		ev, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			if st.position > br.Pos() {
+				return "", status.Errorf(codes.InvalidArgument, "position %d is beyond the end of %s", st.position, l.Name)
+			}
+			return "", nil
+		}
+		if err != nil {
+			if tail != nil && tail.ended && errors.Is(err, io.ErrUnexpectedEOF) {
+				// The last event was not completely written before mysqld stopped.
+				return "", nil
+			}
+			return "", err
+		}
+
+		var next string
+		stop := false
+		// The events outside transactions are always sent so that the client can follow
+		// the files and interpret the events.
+		inTransaction := true
+		endTransaction := false
+		switch ev.Header.Type {
+		case binlog.GTIDEvent:
+			uuid, gno, err := binlog.DecodeGTID(ev)
+			if err != nil {
+				return "", err
+			}
+			st.gtid = fmt.Sprintf("%s:%d", uuid, gno)
+			st.skip = st.gtidSet != nil && st.gtidSet.Contains(uuid, gno)
+			clear(st.tables)
+		case binlog.AnonymousGTIDEvent:
+			st.gtid = ""
+			st.skip = false
+			clear(st.tables)
+		case binlog.TableMapEvent:
+			if st.req.DecodeRows {
+				tm, err := binlog.DecodeTableMap(ev)
+				if err != nil {
+					return "", fmt.Errorf("at %d: %w", ev.Pos, err)
+				}
+				st.tables[tm.TableID] = tm
+			}
+		case binlog.XIDEvent:
+			endTransaction = true
+		case binlog.QueryEvent:
+			if st.skip {
+				_, query, err := binlog.DecodeQuery(ev)
+				if err != nil {
+					return "", fmt.Errorf("at %d: %w", ev.Pos, err)
+				}
+				endTransaction = query == "COMMIT"
+			}
+		case binlog.FormatDescriptionEvent, binlog.PreviousGTIDsEvent:
+			inTransaction = false
+		case binlog.RotateEvent:
+			next, _, err = binlog.DecodeRotate(ev)
+			if err != nil {
+				return "", err
+			}
+			inTransaction = false
+			stop = true
+		case binlog.StopEvent:
+			inTransaction = false
+			stop = true
+		}
+
+		if ev.Pos < st.position {
+			// Raw events cannot be interpreted without the format description event.
+			if ev.Header.Type != binlog.FormatDescriptionEvent || st.req.DecodeRows {
+				continue
+			}
+		} else if st.position > 0 {
+			if ev.Pos != st.position {
+				return "", status.Errorf(codes.InvalidArgument, "position %d is not at the beginning of an event in %s", st.position, l.Name)
+			}
+			st.position = 0
+		}
+
+		if !st.skip || !inTransaction {
+			if err := st.sendEvent(l.Name, ev); err != nil {
+				return "", err
+			}
+		}
+		if endTransaction {
+			st.skip = false
+		}
+		if stop {
+			return next, nil
+		}
+	}
+}
+
+func (st *binlogStream) sendEvent(file string, ev *binlog.Event) error {
+	resp := &proto.StreamBinlogResponse{
+		File:         file,
+		Position:     ev.Pos,
+		NextPosition: ev.Pos + int64(ev.Header.EventSize),
+		EventType:    uint32(ev.Header.Type),
+		Timestamp:    timestamppb.New(ev.Header.Time()),
+		Gtid:         st.gtid,
+	}
+
+	if !st.req.DecodeRows {
+		resp.Raw = ev.Raw
+		return st.send(resp)
+	}
+
+	if !binlog.IsRowsEvent(ev.Header.Type) {
+		return nil
+	}
+	rows, err := binlog.DecodeRows(ev, st.tables)
+	if err != nil {
+		return fmt.Errorf("at %d: %w", ev.Pos, err)
+	}
+	resp.Rows = rowsEventToProto(ev.Header.Type, rows)
+	return st.send(resp)
+}
+
+func rowsEventToProto(t binlog.EventType, rows *binlog.RowsEvent) *proto.BinlogRowsEvent {
+	ret := &proto.BinlogRowsEvent{
+		Schema:  rows.Table.Schema,
+		Table:   rows.Table.Table,
+		Columns: rows.Table.ColumnNames,
+	}
+	switch t {
+	case binlog.WriteRowsEventV2:
+		ret.Action = "insert"
+	case binlog.UpdateRowsEventV2:
+		ret.Action = "update"
+	case binlog.DeleteRowsEventV2:
+		ret.Action = "delete"
+	}
+
+	values := func(vs []binlog.Value) []*proto.BinlogValue {
+		if vs == nil {
+			return nil
+		}
+		ret := make([]*proto.BinlogValue, len(vs))
+		for i, v := range vs {
+			ret[i] = &proto.BinlogValue{Null: v.Null, Absent: v.Absent, Data: v.Data}
+		}
+		return ret
+	}
+	for _, r := range rows.Rows {
+		ret.Rows = append(ret.Rows, &proto.BinlogRow{Before: values(r.Before), After: values(r.After)})
+	}
+	return ret
+}
+
+// findBinlogForGTIDSet returns the newest binary log file whose previous GTID set is included in `set`.
+func findBinlogForGTIDSet(dir string, logs []BinaryLog, set binlog.GTIDSet) (string, error) {
+	for i := len(logs) - 1; i >= 0; i-- {
+		if logs[i].Encrypted == "Yes" {
+			return "", status.Errorf(codes.FailedPrecondition, "binary log %s is encrypted", logs[i].Name)
+		}
+		prev, err := readPreviousGTIDs(filepath.Join(dir, logs[i].Name))
+		if err != nil {
+			return "", status.Errorf(codes.Internal, "failed to read %s: %+v", logs[i].Name, err)
+		}
+		if prev.IsSubset(set) {
+			return logs[i].Name, nil
+		}
+	}
+	return "", status.Error(codes.FailedPrecondition, "binary logs including transactions not in the GTID set have been purged")
+}
+
+func readPreviousGTIDs(path string) (binlog.GTIDSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := binlog.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		ev, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ev.Header.Type == binlog.PreviousGTIDsEvent {
+			return binlog.DecodePreviousGTIDs(ev)
+		}
+	}
+}
+
+// tailReader reads a file being written.  At the end of the file, it waits for more data
+// while the file is the active binary log.
+type tailReader struct {
+	ctx context.Context
+	f   *os.File
+	// active returns true if the file is still the last one in the binary log index.
+	active func() (bool, error)
+	// ended is set when another file became active.
+	ended bool
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.f.Read(p)
+		if n > 0 || (err != nil && !errors.Is(err, io.EOF)) {
+			return n, err
+		}
+		if t.ended {
+			return 0, io.EOF
+		}
+
+		// mysqld opens a new file without writing Rotate or Stop events to the active one
+		// if it has crashed.  The file is read once more since events may have been written before the check.
+		active, err := t.active()
+		if err != nil {
+			return 0, err
+		}
+		if !active {
+			t.ended = true
+			continue
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return 0, t.ctx.Err()
+		case <-time.After(binlogFollowInterval):
+		}
+	}
+}
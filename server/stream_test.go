@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/moco-agent/binlog"
+	"github.com/cybozu-go/moco-agent/mysqltest"
+	"github.com/cybozu-go/moco-agent/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("stream binary logs", func() {
+	It("should validate the request", func() {
+		By("starting MySQLd")
+		StartMySQLD(replicaHost, replicaPort, replicaServerID)
+		defer StopAndRemoveMySQLD(replicaHost)
+
+		sockFile := filepath.Join(socketDir(replicaHost), "mysqld.sock")
+		conf := MySQLAccessorConfig{
+			Host:              "localhost",
+			Port:              replicaPort,
+			Password:          agentUserPassword,
+			ConnMaxIdleTime:   30 * time.Minute,
+			ConnectionTimeout: 3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		agent, err := New(conf, testClusterName, sockFile, "", maxDelayThreshold, time.Second, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		defer agent.CloseDB()
+
+		send := func(*proto.StreamBinlogResponse) error { return nil }
+
+		err = agent.StreamBinlog(context.Background(), &proto.StreamBinlogRequest{GtidSet: "invalid"}, send)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		err = agent.StreamBinlog(context.Background(), &proto.StreamBinlogRequest{File: "no-such-binlog.000001"}, send)
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("should stream binary log events", func() {
+		inst, agent := startFakeMySQLD()
+		writeTestBinlogs(inst, time.Now().Add(-time.Hour).Truncate(time.Second))
+		dir := filepath.Dir(inst.Variable("log_bin_basename"))
+
+		var events []*proto.StreamBinlogResponse
+		send := func(ev *proto.StreamBinlogResponse) error {
+			events = append(events, ev)
+			return nil
+		}
+
+		By("streaming all the events")
+		err := agent.StreamBinlog(context.Background(), &proto.StreamBinlogRequest{}, send)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(streamedEvents(events)).To(Equal([]string{
+			"binlog.000001 FDE", "binlog.000001 PREV",
+			"binlog.000001 GTID " + testUUID + ":1", "binlog.000001 QUERY", "binlog.000001 QUERY", "binlog.000001 XID",
+			"binlog.000001 GTID " + testUUID + ":2", "binlog.000001 QUERY", "binlog.000001 QUERY", "binlog.000001 XID",
+			"binlog.000001 ROTATE",
+			"binlog.000002 FDE", "binlog.000002 PREV",
+			"binlog.000002 GTID " + testUUID + ":3", "binlog.000002 QUERY", "binlog.000002 QUERY", "binlog.000002 XID",
+			"binlog.000002 GTID " + testUUID + ":4", "binlog.000002 QUERY", "binlog.000002 QUERY", "binlog.000002 XID",
+			"binlog.000002 ROTATE",
+			"binlog.000003 FDE", "binlog.000003 PREV",
+		}))
+
+		// The raw events are the same as the file.
+		data, err := os.ReadFile(filepath.Join(dir, "binlog.000001"))
+		Expect(err).NotTo(HaveOccurred())
+		var raw bytes.Buffer
+		raw.WriteString(binlog.Magic)
+		for _, ev := range events[:11] {
+			Expect(ev.Position).To(BeNumerically("==", raw.Len()))
+			raw.Write(ev.Raw)
+			Expect(ev.NextPosition).To(BeNumerically("==", raw.Len()))
+		}
+		Expect(raw.Bytes()).To(Equal(data))
+
+		By("resuming from a position")
+		pos := events[6].Position
+		events = nil
+		err = agent.StreamBinlog(context.Background(), &proto.StreamBinlogRequest{File: "binlog.000001", Position: pos}, send)
+		Expect(err).NotTo(HaveOccurred())
+		// The format description event is always sent to interpret the raw events.
+		Expect(streamedEvents(events)[:7]).To(Equal([]string{
+			"binlog.000001 FDE",
+			"binlog.000001 GTID " + testUUID + ":2", "binlog.000001 QUERY", "binlog.000001 QUERY", "binlog.000001 XID",
+			"binlog.000001 ROTATE",
+			"binlog.000002 FDE",
+		}))
+		Expect(events[1].Position).To(Equal(pos))
+
+		err = agent.StreamBinlog(context.Background(), &proto.StreamBinlogRequest{File: "binlog.000001", Position: pos + 1}, send)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		By("skipping the executed transactions")
+		events = nil
+		err = agent.StreamBinlog(context.Background(), &proto.StreamBinlogRequest{GtidSet: testUUID + ":1-3"}, send)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(streamedEvents(events)).To(Equal([]string{
+			"binlog.000002 FDE", "binlog.000002 PREV",
+			"binlog.000002 GTID " + testUUID + ":4", "binlog.000002 QUERY", "binlog.000002 QUERY", "binlog.000002 XID",
+			"binlog.000002 ROTATE",
+			"binlog.000003 FDE", "binlog.000003 PREV",
+		}))
+
+		By("skipping the executed transaction at the end of a file")
+		events = nil
+		err = agent.StreamBinlog(context.Background(), &proto.StreamBinlogRequest{GtidSet: testUUID + ":2:4"}, send)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(streamedEvents(events)).To(Equal([]string{
+			"binlog.000001 FDE", "binlog.000001 PREV",
+			"binlog.000001 GTID " + testUUID + ":1", "binlog.000001 QUERY", "binlog.000001 QUERY", "binlog.000001 XID",
+			"binlog.000001 ROTATE",
+			"binlog.000002 FDE", "binlog.000002 PREV",
+			"binlog.000002 GTID " + testUUID + ":3", "binlog.000002 QUERY", "binlog.000002 QUERY", "binlog.000002 XID",
+			"binlog.000002 ROTATE",
+			"binlog.000003 FDE", "binlog.000003 PREV",
+		}))
+	})
+
+	It("should move to the next file when mysqld restarts without rotating the active file", func() {
+		inst, agent := startFakeMySQLD()
+		t0 := time.Now().Add(-time.Hour).Truncate(time.Second)
+		writeTestBinlogs(inst, t0)
+		dir := filepath.Dir(inst.Variable("log_bin_basename"))
+
+		var mu sync.Mutex
+		var events []*proto.StreamBinlogResponse
+		send := func(ev *proto.StreamBinlogResponse) error {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, ev)
+			return nil
+		}
+		streamed := func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return streamedEvents(events)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error, 1)
+		go func() {
+			done <- agent.StreamBinlog(ctx, &proto.StreamBinlogRequest{File: "binlog.000003", Follow: true}, send)
+		}()
+		Eventually(streamed).Should(Equal([]string{"binlog.000003 FDE", "binlog.000003 PREV"}))
+
+		By("crashing in the middle of writing an event")
+		f, err := os.OpenFile(filepath.Join(dir, "binlog.000003"), os.O_APPEND|os.O_WRONLY, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Write([]byte{0, 0, 0, 0, byte(binlog.GTIDEvent), 1, 0})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		Consistently(streamed, 3*binlogFollowInterval).Should(HaveLen(2))
+
+		By("opening a new file on restart")
+		prev, err := binlog.ParseGTIDSet(testUUID + ":1-4")
+		Expect(err).NotTo(HaveOccurred())
+		next := mysqltest.NewBinlogFile(t0.Add(30*time.Second), prev)
+		next.Transaction(t0.Add(31*time.Second), testUUID, 5, "INSERT INTO test.t VALUES (5)")
+		Expect(inst.WriteBinaryLog("binlog.000004", next)).To(Succeed())
+		Eventually(streamed).Should(Equal([]string{
+			"binlog.000003 FDE", "binlog.000003 PREV",
+			"binlog.000004 FDE", "binlog.000004 PREV",
+			"binlog.000004 GTID " + testUUID + ":5", "binlog.000004 QUERY", "binlog.000004 QUERY", "binlog.000004 XID",
+		}))
+
+		cancel()
+		Eventually(done).Should(Receive(WithTransform(status.Code, Equal(codes.Canceled))))
+	})
+})
+
+// streamedEvents returns the file names, the types, and the GTIDs of GTID events in `events`.
+func streamedEvents(events []*proto.StreamBinlogResponse) []string {
+	names := map[binlog.EventType]string{
+		binlog.FormatDescriptionEvent: "FDE",
+		binlog.PreviousGTIDsEvent:     "PREV",
+		binlog.GTIDEvent:              "GTID",
+		binlog.QueryEvent:             "QUERY",
+		binlog.XIDEvent:               "XID",
+		binlog.RotateEvent:            "ROTATE",
+	}
+	ret := make([]string, len(events))
+	for i, ev := range events {
+		ret[i] = ev.File + " " + names[binlog.EventType(ev.EventType)]
+		if ev.EventType == uint32(binlog.GTIDEvent) {
+			ret[i] += " " + ev.Gtid
+		}
+	}
+	return ret
+}